@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/aerodinamicat/thisisme02/databases/conformance"
+	"github.com/aerodinamicat/thisisme02/servers"
+)
+
+type logReporter struct {
+	//* Cuenta los fallos de cada implementación y los muestra según se producen.
+	driver   string
+	failures int
+}
+
+func (lr *logReporter) Errorf(format string, args ...interface{}) {
+	lr.failures++
+	log.Printf("[%s] FAIL %s", lr.driver, fmt.Sprintf(format, args...))
+}
+
+func main() {
+	//* Uso: conformance [driver...]. Sin argumentos, se comprueban todas las implementaciones.
+	//* La conexión se configura con las mismas variables 'DB_*' que el servicio. Los casos dejan
+	//* sus registros en la DB, así que debe ser una DB desechable.
+	drivers := os.Args[1:]
+	if len(drivers) == 0 {
+		drivers = servers.DATABASE_DRIVERS
+	}
+
+	failed := false
+	for _, driver := range drivers {
+		databaseConfiguration := &servers.DBConfig{
+			Driver: driver,
+			Path:   os.Getenv("DB_PATH"),
+
+			Port:     os.Getenv("DB_PORT"),
+			Password: os.Getenv("DB_PASSWORD"),
+			User:     os.Getenv("DB_USER"),
+			Host:     os.Getenv("DB_HOST"),
+			Schema:   os.Getenv("DB_SCHEMA"),
+		}
+		dbr, err := servers.NewDatabaseRepository(databaseConfiguration)
+		if err != nil {
+			log.Printf("[%s] FAIL %v", driver, err)
+			failed = true
+			continue
+		}
+
+		//* Los casos necesitan el esquema al día.
+		if err := servers.MigrateDatabase(context.Background(), dbr); err != nil {
+			log.Printf("[%s] FAIL %v", driver, err)
+			dbr.CloseDatabaseConnection()
+			failed = true
+			continue
+		}
+
+		reporter := &logReporter{driver: driver}
+		conformance.Run(context.Background(), reporter, dbr)
+		dbr.CloseDatabaseConnection()
+
+		if reporter.failures > 0 {
+			log.Printf("[%s] %d failures", driver, reporter.failures)
+			failed = true
+			continue
+		}
+		log.Printf("[%s] ok", driver)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aerodinamicat/thisisme02/handlers"
+	"github.com/aerodinamicat/thisisme02/keys"
+	"github.com/golang-jwt/jwt"
+)
+
+//* Cliente de pruebas que recorre el flujo OIDC completo contra una instancia local del servicio
+//* y comprueba, al estilo de las pruebas de conformidad, lo que un cliente real daría por hecho.
+
+type checker struct {
+	failures int
+	//* Dónde se escribe el resultado de cada comprobación: la salida estándar o el 'log' de una prueba.
+	logf func(format string, args ...interface{})
+}
+
+func newChecker(logf func(format string, args ...interface{})) *checker {
+	return &checker{
+		logf: logf,
+	}
+}
+func (c *checker) check(name string, ok bool, detail string) {
+	if ok {
+		c.logf("PASS  %s", name)
+		return
+	}
+	c.failures++
+	c.logf("FAIL  %s: %s", name, detail)
+}
+
+func randomString() string {
+	randomBytes := make([]byte, 32)
+	if _, err := rand.Read(randomBytes); err != nil {
+		log.Fatalf("Random generation failed: '%v'", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(randomBytes)
+}
+func getJSON(target string, accessToken string, value interface{}) error {
+	request, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	if accessToken != "" {
+		request.Header.Set(handlers.HEADER_AUTHORIZATION, "Bearer "+accessToken)
+	}
+	return doJSON(request, value)
+}
+func doJSON(request *http.Request, value interface{}) error {
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		var body bytes.Buffer
+		body.ReadFrom(response.Body)
+		return fmt.Errorf("%s %s: %d %s", request.Method, request.URL, response.StatusCode, strings.TrimSpace(body.String()))
+	}
+	return json.NewDecoder(response.Body).Decode(value)
+}
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func main() {
+	issuer := flag.String("issuer", "http://localhost:5070", "issuer URL of the provider")
+	clientId := flag.String("client-id", "", "registered OAuth client id")
+	redirectURI := flag.String("redirect-uri", "", "redirect URI registered for the client")
+	accessToken := flag.String("access-token", "", "first-party access token of the user, as returned by /login")
+	scope := flag.String("scope", "openid email", "scopes to request")
+	flag.Parse()
+	if *clientId == "" || *redirectURI == "" || *accessToken == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	c := newChecker(func(format string, args ...interface{}) {
+		fmt.Printf(format+"\n", args...)
+	})
+	if err := run(c, strings.TrimSuffix(*issuer, "/"), *clientId, *redirectURI, *accessToken, *scope); err != nil {
+		fmt.Printf("FAIL  %v\n", err)
+		os.Exit(1)
+	}
+	if c.failures > 0 {
+		fmt.Printf("%d check(s) failed\n", c.failures)
+		os.Exit(1)
+	}
+	fmt.Println("All checks passed")
+}
+
+func run(c *checker, issuer, clientId, redirectURI, firstPartyToken, scope string) error {
+	//* 1. Descubrimiento.
+	var configuration handlers.OpenIdConfigurationResponse
+	if err := getJSON(issuer+"/.well-known/openid-configuration", "", &configuration); err != nil {
+		return err
+	}
+	c.check("discovery issuer matches", configuration.Issuer == issuer, configuration.Issuer)
+	c.check("discovery endpoints present",
+		configuration.AuthorizationEndpoint != "" && configuration.TokenEndpoint != "" &&
+			configuration.UserInfoEndpoint != "" && configuration.JwksURI != "", "missing endpoint")
+	c.check("discovery supports code flow", contains(configuration.ResponseTypesSupported, "code"), "")
+	c.check("discovery supports S256", contains(configuration.CodeChallengeMethodsSupported, "S256"), "")
+	c.check("discovery supports openid scope", contains(configuration.ScopesSupported, "openid"), "")
+
+	//* 2. Claves públicas.
+	var jwks keys.JSONWebKeySet
+	if err := getJSON(configuration.JwksURI, "", &jwks); err != nil {
+		return err
+	}
+	c.check("jwks has keys", len(jwks.Keys) > 0, "empty key set")
+
+	//* 3. Autorización con PKCE, 'state' y 'nonce'.
+	codeVerifier, state, nonce := randomString(), randomString(), randomString()
+	hash := sha256.Sum256([]byte(codeVerifier))
+	authorizeRequest := handlers.AuthorizeRequest{
+		ResponseType:        "code",
+		ClientId:            clientId,
+		RedirectURI:         redirectURI,
+		Scope:               scope,
+		State:               state,
+		CodeChallenge:       base64.RawURLEncoding.EncodeToString(hash[:]),
+		CodeChallengeMethod: "S256",
+		Nonce:               nonce,
+		Approve:             true,
+	}
+	body, err := json.Marshal(authorizeRequest)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest(http.MethodPost, configuration.AuthorizationEndpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(handlers.HEADER_AUTHORIZATION, "Bearer "+firstPartyToken)
+	var authorizeResponse handlers.AuthorizeResponse
+	if err := doJSON(request, &authorizeResponse); err != nil {
+		return err
+	}
+	redirectTo, err := url.Parse(authorizeResponse.RedirectTo)
+	if err != nil {
+		return err
+	}
+	if errorCode := redirectTo.Query().Get("error"); errorCode != "" {
+		return fmt.Errorf("authorization failed: %s: %s", errorCode, redirectTo.Query().Get("error_description"))
+	}
+	c.check("authorize returns state", redirectTo.Query().Get("state") == state, redirectTo.Query().Get("state"))
+	code := redirectTo.Query().Get("code")
+	if code == "" {
+		return errors.New("authorization response has no code")
+	}
+
+	//* 4. Canje del código.
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURI)
+	form.Set("client_id", clientId)
+	form.Set("code_verifier", codeVerifier)
+	request, err = http.NewRequest(http.MethodPost, configuration.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var tokenResponse handlers.OAuthTokenResponse
+	if err := doJSON(request, &tokenResponse); err != nil {
+		return err
+	}
+	c.check("token type is Bearer", tokenResponse.TokenType == "Bearer", tokenResponse.TokenType)
+	c.check("id_token returned", tokenResponse.IdToken != "", "missing id_token")
+
+	//* 5. Validación del 'token' de identidad sólo con el JWKS publicado.
+	idToken, err := jwt.ParseWithClaims(tokenResponse.IdToken, &handlers.IdTokenClaim{}, jwks.Keyfunc)
+	if err != nil {
+		return fmt.Errorf("id_token validation failed: %v", err)
+	}
+	claims := idToken.Claims.(*handlers.IdTokenClaim)
+	c.check("id_token algorithm advertised", contains(configuration.IdTokenSigningAlgValuesSupported, idToken.Method.Alg()), idToken.Method.Alg())
+	c.check("id_token iss", claims.Issuer == issuer, claims.Issuer)
+	c.check("id_token aud", claims.Audience == clientId, claims.Audience)
+	c.check("id_token sub", claims.Subject != "", "empty subject")
+	c.check("id_token nonce", claims.Nonce == nonce, claims.Nonce)
+	c.check("id_token iat", claims.IssuedAt > 0 && claims.IssuedAt <= time.Now().Add(time.Minute).Unix(), fmt.Sprint(claims.IssuedAt))
+	c.check("id_token auth_time", claims.AuthTime > 0 && claims.AuthTime <= claims.IssuedAt, fmt.Sprint(claims.AuthTime))
+	if contains(strings.Fields(scope), "email") {
+		c.check("id_token email", claims.Email != "" && claims.EmailVerified != nil, "missing email claims")
+	}
+
+	//* 6. 'userinfo' con el 'token' de acceso emitido al cliente.
+	var userInfo handlers.UserInfoResponse
+	if err := getJSON(configuration.UserInfoEndpoint, tokenResponse.AccessToken, &userInfo); err != nil {
+		return err
+	}
+	c.check("userinfo sub matches id_token", userInfo.Subject == claims.Subject, userInfo.Subject)
+	c.check("userinfo email matches id_token", userInfo.Email == claims.Email, userInfo.Email)
+
+	return nil
+}
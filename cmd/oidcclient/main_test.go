@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aerodinamicat/thisisme02/databases"
+	"github.com/aerodinamicat/thisisme02/handlers"
+	"github.com/aerodinamicat/thisisme02/middlewares"
+	"github.com/aerodinamicat/thisisme02/models"
+	"github.com/aerodinamicat/thisisme02/servers"
+	"github.com/gorilla/mux"
+	"github.com/segmentio/ksuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	TEST_EMAIL        = "oidc@example.com"
+	TEST_PASSWORD     = "correct horse battery staple"
+	TEST_REDIRECT_URI = "http://localhost/callback"
+)
+
+func newTestProvider(t *testing.T) *httptest.Server {
+	t.Helper()
+	ctx := context.Background()
+	databases.SetDatabaseRepository(databases.NewMemoryImplementation())
+
+	//* El emisor es la URL del servidor de pruebas, que sólo se conoce al arrancarlo:
+	//* las rutas se registran después, antes de la primera petición.
+	router := mux.NewRouter()
+	provider := httptest.NewServer(router)
+	t.Cleanup(provider.Close)
+
+	server := servers.NewHttpServer(ctx, &servers.Config{RelyingPartyOrigin: provider.URL}, &servers.DBConfig{Driver: servers.DATABASE_DRIVER_MEMORY})
+	if err := server.KeyRing.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	//* Las rutas que recorre el cliente, con las mismas políticas que en 'cmd/service'.
+	policies := middlewares.NewRoutePolicies()
+	router.Use(middlewares.CheckAuthMiddleware(server, policies))
+	policies.Public(router.HandleFunc("/.well-known/jwks.json", handlers.JWKSHandler(server)).Methods(http.MethodGet))
+	policies.Public(router.HandleFunc("/.well-known/openid-configuration", handlers.OpenIdConfigurationHandler(server)).Methods(http.MethodGet))
+	policies.Public(router.HandleFunc("/login", handlers.LogInHandler(server)).Methods(http.MethodPost))
+	policies.Authenticated(router.HandleFunc("/oauth/clients", handlers.CreateOAuthClientHandler(server)).Methods(http.MethodPost))
+	policies.Authenticated(router.HandleFunc("/authorize", handlers.AuthorizeHandler(server)).Methods(http.MethodGet, http.MethodPost))
+	policies.Public(router.HandleFunc("/token", handlers.OAuthTokenHandler(server)).Methods(http.MethodPost))
+	policies.RequireScopes(router.HandleFunc("/userinfo", handlers.UserInfoHandler(server)).Methods(http.MethodGet, http.MethodPost), handlers.OIDC_SCOPE_OPENID)
+
+	return provider
+}
+func postJSON(t *testing.T, target, accessToken string, body, value interface{}) {
+	t.Helper()
+	encodedBody, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(encodedBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if accessToken != "" {
+		request.Header.Set(handlers.HEADER_AUTHORIZATION, "Bearer "+accessToken)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusCreated {
+		t.Fatalf("POST %s: status %d", target, response.StatusCode)
+	}
+	if err := json.NewDecoder(response.Body).Decode(value); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	provider := newTestProvider(t)
+
+	//* Un 'user' con su sesión propia y un cliente público registrado por él, como se haría a mano antes de lanzar el cliente.
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(TEST_PASSWORD), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	currentTime := time.Now()
+	user := &models.User{
+		Id:        ksuid.New().String(),
+		Email:     TEST_EMAIL,
+		Password:  string(hashedPassword),
+		CreatedAt: currentTime,
+		UpdatedAt: currentTime,
+	}
+	user.CreatedBy, user.UpdatedBy = user.Id, user.Id
+	if err := databases.InsertUser(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	var logIn handlers.LogInResponse
+	postJSON(t, provider.URL+"/login", "", handlers.LogInRequest{Email: TEST_EMAIL, Password: TEST_PASSWORD}, &logIn)
+	var client handlers.CreateOAuthClientResponse
+	postJSON(t, provider.URL+"/oauth/clients", logIn.Authorization, handlers.CreateOAuthClientRequest{
+		Name:         "oidcclient",
+		RedirectURIs: []string{TEST_REDIRECT_URI},
+		Scopes:       []string{handlers.OIDC_SCOPE_OPENID, handlers.OIDC_SCOPE_EMAIL},
+	}, &client)
+
+	//* Descubrimiento, autorización, canje, validación del 'token' de identidad y 'userinfo'.
+	c := newChecker(t.Logf)
+	if err := run(c, provider.URL, client.Client.Id, TEST_REDIRECT_URI, logIn.Authorization, "openid email"); err != nil {
+		t.Fatal(err)
+	}
+	if c.failures > 0 {
+		t.Errorf("%d check(s) failed", c.failures)
+	}
+}
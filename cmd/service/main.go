@@ -2,27 +2,165 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/aerodinamicat/thisisme02/databases"
 	"github.com/aerodinamicat/thisisme02/handlers"
 	"github.com/aerodinamicat/thisisme02/middlewares"
+	"github.com/aerodinamicat/thisisme02/principals"
 	"github.com/aerodinamicat/thisisme02/servers"
 	"github.com/gorilla/mux"
 )
 
 func setEndPointsHandlers(server *servers.HttpServer, router *mux.Router) {
-	router.Use(middlewares.CheckAuthMiddleware(server))
+	policies := middlewares.NewRoutePolicies()
+	router.Use(middlewares.CheckAuthMiddleware(server, policies))
 
-	router.HandleFunc("/signup", handlers.SignUpHandler(server)).Methods(http.MethodPost)
-	router.HandleFunc("/login", handlers.LogInHandler(server)).Methods(http.MethodPost)
+	policies.Public(router.HandleFunc("/.well-known/jwks.json", handlers.JWKSHandler(server)).Methods(http.MethodGet))
+	policies.Public(router.HandleFunc("/.well-known/openid-configuration", handlers.OpenIdConfigurationHandler(server)).Methods(http.MethodGet))
 
-	router.HandleFunc("/user/changeEmail", handlers.ChangeEmailHandler(server)).Methods(http.MethodPut)
-	router.HandleFunc("/user/changePassword", handlers.ChangePasswordHandler(server)).Methods(http.MethodPut)
+	policies.Public(router.HandleFunc("/signup", handlers.SignUpHandler(server)).Methods(http.MethodPost))
+	policies.Public(router.HandleFunc("/signup/verify", handlers.VerifyEmailHandler(server)).Methods(http.MethodPost))
+	policies.Public(router.HandleFunc("/signup/verify/resend", handlers.ResendEmailVerificationHandler(server)).Methods(http.MethodPost))
+	policies.Public(router.HandleFunc("/login", handlers.LogInHandler(server)).Methods(http.MethodPost))
+	policies.Public(router.HandleFunc("/login/mfa", handlers.LogInMfaHandler(server)).Methods(http.MethodPost))
+	policies.Public(router.HandleFunc("/login/webauthn/begin", handlers.WebAuthnLogInBeginHandler(server)).Methods(http.MethodPost))
+	policies.Public(router.HandleFunc("/login/webauthn/finish", handlers.WebAuthnLogInFinishHandler(server)).Methods(http.MethodPost))
+	policies.Public(router.HandleFunc("/token/refresh", handlers.RefreshTokenHandler(server)).Methods(http.MethodPost))
+	policies.Authenticated(router.HandleFunc("/oauth/clients", handlers.CreateOAuthClientHandler(server)).Methods(http.MethodPost))
+	policies.AllowDelegated(router.HandleFunc("/oauth/clients", handlers.ListOAuthClientsHandler(server)).Methods(http.MethodGet), handlers.SCOPE_CLIENTS_READ)
+	policies.Authenticated(router.HandleFunc("/authorize", handlers.AuthorizeHandler(server)).Methods(http.MethodGet, http.MethodPost))
+	policies.Public(router.HandleFunc("/token", handlers.OAuthTokenHandler(server)).Methods(http.MethodPost))
+	policies.Public(router.HandleFunc("/device/code", handlers.DeviceCodeHandler(server)).Methods(http.MethodPost))
+	policies.Authenticated(router.HandleFunc("/device", handlers.DeviceLookupHandler(server)).Methods(http.MethodGet))
+	policies.Authenticated(router.HandleFunc("/device/approve", handlers.DeviceApproveHandler(server)).Methods(http.MethodPost))
+	policies.AllowServices(router.HandleFunc("/introspect", handlers.IntrospectHandler(server)).Methods(http.MethodPost), handlers.INTROSPECT_SCOPE)
+	policies.Public(router.HandleFunc("/revoke", handlers.RevokeHandler(server)).Methods(http.MethodPost))
+	policies.RequireScopes(router.HandleFunc("/userinfo", handlers.UserInfoHandler(server)).Methods(http.MethodGet, http.MethodPost), handlers.OIDC_SCOPE_OPENID)
 
-	router.HandleFunc("/user/changesHistory", handlers.GetPropertyChangesHandler(server)).Methods(http.MethodGet)
+	policies.Authenticated(router.HandleFunc("/logout", handlers.LogOutHandler(server)).Methods(http.MethodPost))
+	policies.Authenticated(router.HandleFunc("/logout/all", handlers.LogOutAllHandler(server)).Methods(http.MethodPost))
 
-	// Hay que añadir los endpoints para 'recordar contraseña'.
+	policies.Authenticated(router.HandleFunc("/user/changeEmail", handlers.ChangeEmailHandler(server)).Methods(http.MethodPut))
+	policies.Public(router.HandleFunc("/user/changeEmail/confirm", handlers.ConfirmEmailChangeHandler(server)).Methods(http.MethodPost))
+	policies.Public(router.HandleFunc("/user/changeEmail/revert", handlers.RevertEmailChangeHandler(server)).Methods(http.MethodPost))
+	policies.Authenticated(router.HandleFunc("/user/changePassword", handlers.ChangePasswordHandler(server)).Methods(http.MethodPut))
+	policies.Authenticated(router.HandleFunc("/user/delete", handlers.DeleteAccountHandler(server)).Methods(http.MethodPost))
+	policies.Public(router.HandleFunc("/user/restore", handlers.RestoreAccountHandler(server)).Methods(http.MethodPost))
+
+	policies.Authenticated(router.HandleFunc("/user/mfa/enroll", handlers.MfaEnrollHandler(server)).Methods(http.MethodPost))
+	policies.Authenticated(router.HandleFunc("/user/mfa/confirm", handlers.MfaConfirmHandler(server)).Methods(http.MethodPost))
+	policies.Authenticated(router.HandleFunc("/user/mfa/disable", handlers.MfaDisableHandler(server)).Methods(http.MethodPost))
+
+	policies.Authenticated(router.HandleFunc("/user/webauthn/register/begin", handlers.WebAuthnRegisterBeginHandler(server)).Methods(http.MethodPost))
+	policies.Authenticated(router.HandleFunc("/user/webauthn/register/finish", handlers.WebAuthnRegisterFinishHandler(server)).Methods(http.MethodPost))
+
+	policies.Authenticated(router.HandleFunc("/user/apiKeys", handlers.CreateApiKeyHandler(server)).Methods(http.MethodPost))
+	policies.AllowDelegated(router.HandleFunc("/user/apiKeys", handlers.ListApiKeysHandler(server)).Methods(http.MethodGet), handlers.SCOPE_API_KEYS_READ)
+	policies.AllowDelegated(router.HandleFunc("/user/apiKeys/{id}", handlers.RevokeApiKeyHandler(server)).Methods(http.MethodDelete), handlers.SCOPE_API_KEYS_WRITE)
+
+	policies.AllowDelegated(router.HandleFunc("/user/changesHistory", handlers.GetPropertyChangesHandler(server)).Methods(http.MethodGet), handlers.SCOPE_PROFILE_READ)
+
+	policies.RequirePermissions(router.HandleFunc("/permissions", handlers.ListPermissionsHandler(server)).Methods(http.MethodGet), principals.PERMISSION_ROLES_MANAGE)
+	policies.RequirePermissions(router.HandleFunc("/roles", handlers.ListRolesHandler(server)).Methods(http.MethodGet), principals.PERMISSION_ROLES_MANAGE)
+	policies.RequirePermissions(router.HandleFunc("/roles", handlers.CreateRoleHandler(server)).Methods(http.MethodPost), principals.PERMISSION_ROLES_MANAGE)
+	policies.RequirePermissions(router.HandleFunc("/users", handlers.ListUsersHandler(server)).Methods(http.MethodGet), principals.PERMISSION_USERS_MANAGE)
+	policies.RequirePermissions(router.HandleFunc("/users/{id}", handlers.GetUserHandler(server)).Methods(http.MethodGet), principals.PERMISSION_USERS_MANAGE)
+	policies.RequirePermissions(router.HandleFunc("/users/{id}", handlers.DeleteUserHandler(server)).Methods(http.MethodDelete), principals.PERMISSION_USERS_MANAGE)
+	policies.RequirePermissions(router.HandleFunc("/users/{id}/disable", handlers.DisableUserHandler(server)).Methods(http.MethodPost), principals.PERMISSION_USERS_MANAGE)
+	policies.RequirePermissions(router.HandleFunc("/users/{id}/enable", handlers.EnableUserHandler(server)).Methods(http.MethodPost), principals.PERMISSION_USERS_MANAGE)
+	policies.RequirePermissions(router.HandleFunc("/users/{id}/restore", handlers.RestoreUserHandler(server)).Methods(http.MethodPost), principals.PERMISSION_USERS_MANAGE)
+	policies.RequirePermissions(router.HandleFunc("/users/{id}/unlock", handlers.UnlockUserHandler(server)).Methods(http.MethodPost), principals.PERMISSION_USERS_MANAGE)
+	policies.RequirePermissions(router.HandleFunc("/users/{id}/roles", handlers.ListUserRolesHandler(server)).Methods(http.MethodGet), principals.PERMISSION_ROLES_MANAGE)
+	policies.RequirePermissions(router.HandleFunc("/users/{id}/roles", handlers.AssignUserRoleHandler(server)).Methods(http.MethodPost), principals.PERMISSION_ROLES_MANAGE)
+	policies.RequirePermissions(router.HandleFunc("/users/{id}/roles/{roleId}", handlers.RevokeUserRoleHandler(server)).Methods(http.MethodDelete), principals.PERMISSION_ROLES_MANAGE)
+
+	policies.Public(router.HandleFunc("/password/forgot", handlers.ForgotPasswordHandler(server)).Methods(http.MethodPost))
+	policies.Public(router.HandleFunc("/password/reset", handlers.ResetPasswordHandler(server)).Methods(http.MethodPost))
+}
+
+func getEnvDuration(name string) time.Duration {
+	//* Las duraciones sin valor o mal formadas se dejan a cero para que se usen los valores por defecto.
+	duration, err := time.ParseDuration(os.Getenv(name))
+	if err != nil {
+		return 0
+	}
+	return duration
+}
+
+func getEnvBool(name string) bool {
+	//* Los valores sin valor o mal formados se consideran falsos.
+	value, err := strconv.ParseBool(os.Getenv(name))
+	if err != nil {
+		return false
+	}
+	return value
+}
+
+func getEnvList(name string) []string {
+	//* Valores separados por comas. Se descartan los vacíos.
+	var values []string
+	for _, value := range strings.Split(os.Getenv(name), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func migrate(databaseConfiguration *servers.DBConfig, args []string) error {
+	//* Uso: migrate [up | down [pasos] | status]. Sin argumentos, equivale a 'up'.
+	dbr, err := servers.NewDatabaseRepository(databaseConfiguration)
+	if err != nil {
+		return err
+	}
+	defer dbr.CloseDatabaseConnection()
+	migrator, err := databases.RepositoryMigrator(dbr)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+	var applied []*databases.Migration
+	switch command {
+	case "up":
+		applied, err = migrator.Up(ctx)
+	case "down":
+		//* Por seguridad, sólo se deshace una migración salvo que se indique otra cantidad.
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 0 {
+				return fmt.Errorf("invalid number of steps '%s'", args[1])
+			}
+		}
+		applied, err = migrator.Down(ctx, steps)
+	case "status":
+	default:
+		return fmt.Errorf("unknown migrate command '%s'", command)
+	}
+	for _, migration := range applied {
+		log.Printf("Database migration %s: %04d_%s\n", command, migration.Version, migration.Name)
+	}
+	if err != nil {
+		return err
+	}
+
+	version, err := migrator.Version(ctx)
+	if err != nil {
+		return err
+	}
+	log.Printf("Database schema version: %d of %d\n", version, migrator.LatestVersion())
+	return nil
 }
 
 func main() {
@@ -37,10 +175,28 @@ func main() {
 	serverConfiguration := &servers.Config{
 		/*
 			Port:   "5070",
-			Secret: "mysecretphrase",
 		*/
 		Port:   os.Getenv("APP_PORT"),
-		Secret: os.Getenv("APP_JWTSECRET"),
+		Issuer: os.Getenv("APP_ISSUER"),
+
+		RelyingPartyId:     os.Getenv("APP_RP_ID"),
+		RelyingPartyName:   os.Getenv("APP_RP_NAME"),
+		RelyingPartyOrigin: os.Getenv("APP_RP_ORIGIN"),
+
+		EmailVerificationPolicy: os.Getenv("APP_EMAIL_VERIFICATION"),
+
+		AccountDeletionGracePeriod: getEnvDuration("APP_ACCOUNT_DELETION_GRACE_PERIOD"),
+
+		JwtAlgorithm:        os.Getenv("APP_JWT_ALGORITHM"),
+		JwtRotationInterval: getEnvDuration("APP_JWT_ROTATION_INTERVAL"),
+		JwtRotationOverlap:  getEnvDuration("APP_JWT_ROTATION_OVERLAP"),
+		KeyEncryptionKey:    os.Getenv("APP_KEY_ENCRYPTION_KEY"),
+
+		MigrateOnStart: getEnvBool("APP_MIGRATE_ON_START"),
+
+		LogNotificationBodies: getEnvBool("APP_LOG_NOTIFICATION_BODIES"),
+
+		TrustedProxies: getEnvList("APP_TRUSTED_PROXIES"),
 	}
 	databaseConfiguration := &servers.DBConfig{
 		/*
@@ -50,12 +206,27 @@ func main() {
 			Host:     "localhost",
 			Schema:   "tim_ua",
 		*/
+		Driver: os.Getenv("DB_DRIVER"),
+		Path:   os.Getenv("DB_PATH"),
+
 		Port:     os.Getenv("DB_PORT"),
 		Password: os.Getenv("DB_PASSWORD"),
 		User:     os.Getenv("DB_USER"),
 		Host:     os.Getenv("DB_HOST"),
 		Schema:   os.Getenv("DB_SCHEMA"),
 	}
+
+	//* 'migrate' sólo actualiza el esquema de la DB, sin arrancar el servidor.
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate(databaseConfiguration, os.Args[2:]); err != nil {
+			log.Fatalf("Database migration failed: '%v'", err)
+		}
+		return
+	}
+
+	if err := serverConfiguration.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: '%v'", err)
+	}
 	httpServer := servers.NewHttpServer(context.Background(), serverConfiguration, databaseConfiguration)
 	httpServer.Start(setEndPointsHandlers)
 }
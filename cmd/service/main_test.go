@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aerodinamicat/thisisme02/databases"
+	"github.com/aerodinamicat/thisisme02/handlers"
+	"github.com/aerodinamicat/thisisme02/models"
+	"github.com/aerodinamicat/thisisme02/principals"
+	"github.com/aerodinamicat/thisisme02/servers"
+	"github.com/golang-jwt/jwt"
+	"github.com/gorilla/mux"
+	"github.com/segmentio/ksuid"
+)
+
+type routePolicy int
+
+const (
+	PUBLIC routePolicy = iota
+	AUTHENTICATED
+	REQUIRE_OPENID_SCOPE
+	ALLOW_PROFILE_READ
+	ALLOW_API_KEYS_READ
+	ALLOW_API_KEYS_WRITE
+	ALLOW_CLIENTS_READ
+	REQUIRE_ROLES_MANAGE
+	REQUIRE_USERS_MANAGE
+	ALLOW_INTROSPECT_SERVICES
+)
+
+var expectedRoutePolicies = map[string]routePolicy{
+	//* Cada ruta registrada debe aparecer aquí con la política que se espera de ella.
+	"GET /.well-known/jwks.json":            PUBLIC,
+	"GET /.well-known/openid-configuration": PUBLIC,
+	"POST /signup":                          PUBLIC,
+	"POST /signup/verify":                   PUBLIC,
+	"POST /signup/verify/resend":            PUBLIC,
+	"POST /login":                           PUBLIC,
+	"POST /login/mfa":                       PUBLIC,
+	"POST /login/webauthn/begin":            PUBLIC,
+	"POST /login/webauthn/finish":           PUBLIC,
+	"POST /token/refresh":                   PUBLIC,
+	"POST /oauth/clients":                   AUTHENTICATED,
+	"GET /oauth/clients":                    ALLOW_CLIENTS_READ,
+	"GET /authorize":                        AUTHENTICATED,
+	"POST /authorize":                       AUTHENTICATED,
+	"POST /token":                           PUBLIC,
+	"POST /device/code":                     PUBLIC,
+	"GET /device":                           AUTHENTICATED,
+	"POST /device/approve":                  AUTHENTICATED,
+	"POST /introspect":                      ALLOW_INTROSPECT_SERVICES,
+	"POST /revoke":                          PUBLIC,
+	"GET /userinfo":                         REQUIRE_OPENID_SCOPE,
+	"POST /userinfo":                        REQUIRE_OPENID_SCOPE,
+	"POST /logout":                          AUTHENTICATED,
+	"POST /logout/all":                      AUTHENTICATED,
+	"PUT /user/changeEmail":                 AUTHENTICATED,
+	"POST /user/changeEmail/confirm":        PUBLIC,
+	"POST /user/changeEmail/revert":         PUBLIC,
+	"PUT /user/changePassword":              AUTHENTICATED,
+	"POST /user/delete":                     AUTHENTICATED,
+	"POST /user/restore":                    PUBLIC,
+	"POST /user/mfa/enroll":                 AUTHENTICATED,
+	"POST /user/mfa/confirm":                AUTHENTICATED,
+	"POST /user/mfa/disable":                AUTHENTICATED,
+	"POST /user/webauthn/register/begin":    AUTHENTICATED,
+	"POST /user/webauthn/register/finish":   AUTHENTICATED,
+	"POST /user/apiKeys":                    AUTHENTICATED,
+	"GET /user/apiKeys":                     ALLOW_API_KEYS_READ,
+	"DELETE /user/apiKeys/{id}":             ALLOW_API_KEYS_WRITE,
+	"GET /user/changesHistory":              ALLOW_PROFILE_READ,
+	"GET /permissions":                      REQUIRE_ROLES_MANAGE,
+	"GET /roles":                            REQUIRE_ROLES_MANAGE,
+	"POST /roles":                           REQUIRE_ROLES_MANAGE,
+	"GET /users":                            REQUIRE_USERS_MANAGE,
+	"GET /users/{id}":                       REQUIRE_USERS_MANAGE,
+	"DELETE /users/{id}":                    REQUIRE_USERS_MANAGE,
+	"POST /users/{id}/disable":              REQUIRE_USERS_MANAGE,
+	"POST /users/{id}/enable":               REQUIRE_USERS_MANAGE,
+	"POST /users/{id}/restore":              REQUIRE_USERS_MANAGE,
+	"POST /users/{id}/unlock":               REQUIRE_USERS_MANAGE,
+	"GET /users/{id}/roles":                 REQUIRE_ROLES_MANAGE,
+	"POST /users/{id}/roles":                REQUIRE_ROLES_MANAGE,
+	"DELETE /users/{id}/roles/{roleId}":     REQUIRE_ROLES_MANAGE,
+	"POST /password/forgot":                 PUBLIC,
+	"POST /password/reset":                  PUBLIC,
+}
+
+type caller int
+
+const (
+	//* Las credenciales con las que se llama a cada ruta.
+	ANONYMOUS caller = iota
+	INVALID_TOKEN
+	USER
+	ROLES_ADMIN
+	USERS_ADMIN
+	OAUTH_CLIENT
+	OAUTH_CLIENT_WITHOUT_SCOPES
+	SERVICE
+	SERVICE_WITHOUT_SCOPES
+	API_KEY
+	API_KEY_WITHOUT_SCOPES
+)
+
+var callerNames = map[caller]string{
+	ANONYMOUS:                   "anonymous",
+	INVALID_TOKEN:               "invalid token",
+	USER:                        "user",
+	ROLES_ADMIN:                 "roles admin",
+	USERS_ADMIN:                 "users admin",
+	OAUTH_CLIENT:                "oauth client",
+	OAUTH_CLIENT_WITHOUT_SCOPES: "oauth client without scopes",
+	SERVICE:                     "service",
+	SERVICE_WITHOUT_SCOPES:      "service without scopes",
+	API_KEY:                     "api key",
+	API_KEY_WITHOUT_SCOPES:      "api key without scopes",
+}
+
+func expectedStatus(policy routePolicy, c caller) int {
+	//* 'http.StatusOK' significa que el 'middleware' deja pasar la petición al 'handler'.
+	if policy == PUBLIC {
+		return http.StatusOK
+	}
+	if c == ANONYMOUS || c == INVALID_TOKEN {
+		return http.StatusUnauthorized
+	}
+
+	allowed := map[routePolicy][]caller{
+		AUTHENTICATED:             {USER, ROLES_ADMIN, USERS_ADMIN},
+		REQUIRE_OPENID_SCOPE:      {OAUTH_CLIENT, API_KEY},
+		ALLOW_PROFILE_READ:        {USER, ROLES_ADMIN, USERS_ADMIN, OAUTH_CLIENT},
+		ALLOW_API_KEYS_READ:       {USER, ROLES_ADMIN, USERS_ADMIN, API_KEY},
+		ALLOW_API_KEYS_WRITE:      {USER, ROLES_ADMIN, USERS_ADMIN},
+		ALLOW_CLIENTS_READ:        {USER, ROLES_ADMIN, USERS_ADMIN, OAUTH_CLIENT},
+		REQUIRE_ROLES_MANAGE:      {ROLES_ADMIN},
+		REQUIRE_USERS_MANAGE:      {USERS_ADMIN},
+		ALLOW_INTROSPECT_SERVICES: {SERVICE},
+	}
+	for _, allowedCaller := range allowed[policy] {
+		if allowedCaller == c {
+			return http.StatusOK
+		}
+	}
+	return http.StatusForbidden
+}
+
+func newTestServer(t *testing.T) (*servers.HttpServer, map[caller]string) {
+	t.Helper()
+	ctx := context.Background()
+	databases.SetDatabaseRepository(databases.NewMemoryImplementation())
+
+	server := servers.NewHttpServer(ctx, &servers.Config{RelyingPartyOrigin: "http://localhost"}, &servers.DBConfig{Driver: servers.DATABASE_DRIVER_MEMORY})
+	if err := server.KeyRing.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	//* Un 'user' real, porque las claves personales comprueban que su dueño exista.
+	currentTime := time.Now()
+	user := &models.User{
+		Id:        ksuid.New().String(),
+		Email:     "routes@example.com",
+		Password:  "hash",
+		CreatedAt: currentTime,
+		UpdatedAt: currentTime,
+	}
+	user.CreatedBy, user.UpdatedBy = user.Id, user.Id
+	if err := databases.InsertUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	sign := func(claims handlers.UserClaim) string {
+		claims.StandardClaims.Id = ksuid.New().String()
+		claims.StandardClaims.IssuedAt = currentTime.Unix()
+		claims.StandardClaims.ExpiresAt = currentTime.Add(time.Hour).Unix()
+		token, err := server.KeyRing.Sign(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "Bearer " + token
+	}
+	apiKey := func(scopes ...string) string {
+		//* El prefijo debe ser aleatorio, como en 'newApiKey': el principio de un 'ksuid' es su marca de tiempo.
+		randomBytes := make([]byte, handlers.API_KEY_PREFIX_SIZE)
+		if _, err := rand.Read(randomBytes); err != nil {
+			t.Fatal(err)
+		}
+		prefix := handlers.API_KEY_PREFIX_TAG + hex.EncodeToString(randomBytes)
+		secret := ksuid.New().String()
+		secretHash := sha256.Sum256([]byte(secret))
+		if err := databases.InsertApiKey(ctx, &models.ApiKey{
+			Id:         ksuid.New().String(),
+			UserId:     user.Id,
+			Name:       "routes",
+			Prefix:     prefix,
+			SecretHash: hex.EncodeToString(secretHash[:]),
+			Scopes:     scopes,
+			CreatedAt:  currentTime,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return handlers.AUTHORIZATION_SCHEME_API_KEY + " " + prefix + "_" + secret
+	}
+	clientId := ksuid.New().String()
+	service := func(scopes ...string) handlers.UserClaim {
+		return handlers.UserClaim{
+			Scopes:         scopes,
+			ClientId:       clientId,
+			SubjectType:    principals.SUBJECT_TYPE_SERVICE,
+			AuthMethod:     principals.AUTH_METHOD_CLIENT,
+			StandardClaims: jwt.StandardClaims{Subject: clientId},
+		}
+	}
+
+	authorizations := map[caller]string{
+		ANONYMOUS:     "",
+		INVALID_TOKEN: "Bearer invalid",
+		USER:          sign(handlers.UserClaim{UserId: user.Id, AuthMethod: principals.AUTH_METHOD_PASSWORD}),
+		ROLES_ADMIN:   sign(handlers.UserClaim{UserId: user.Id, AuthMethod: principals.AUTH_METHOD_PASSWORD, Permissions: []string{principals.PERMISSION_ROLES_MANAGE}}),
+		USERS_ADMIN:   sign(handlers.UserClaim{UserId: user.Id, AuthMethod: principals.AUTH_METHOD_PASSWORD, Permissions: []string{principals.PERMISSION_USERS_MANAGE}}),
+		//* Aunque el 'user' sea administrador, sus credenciales delegadas no heredan los permisos.
+		OAUTH_CLIENT:                sign(handlers.UserClaim{UserId: user.Id, ClientId: clientId, AuthMethod: principals.AUTH_METHOD_OAUTH, Scopes: []string{handlers.OIDC_SCOPE_OPENID, handlers.OIDC_SCOPE_EMAIL, handlers.SCOPE_PROFILE_READ, handlers.SCOPE_CLIENTS_READ}, Permissions: []string{principals.PERMISSION_USERS_MANAGE}}),
+		OAUTH_CLIENT_WITHOUT_SCOPES: sign(handlers.UserClaim{UserId: user.Id, ClientId: clientId, AuthMethod: principals.AUTH_METHOD_OAUTH}),
+		SERVICE:                     sign(service(handlers.INTROSPECT_SCOPE)),
+		SERVICE_WITHOUT_SCOPES:      sign(service()),
+		API_KEY:                     apiKey(handlers.OIDC_SCOPE_OPENID, handlers.SCOPE_API_KEYS_READ),
+		API_KEY_WITHOUT_SCOPES:      apiKey(),
+	}
+	return server, authorizations
+}
+
+func TestRoutePolicies(t *testing.T) {
+	server, authorizations := newTestServer(t)
+	router := mux.NewRouter()
+	setEndPointsHandlers(server, router)
+
+	//* Sustituimos los 'handlers' por uno que sólo confirma que la petición llegó hasta él:
+	//* así se prueba la política de la ruta y no la lógica de cada 'handler'.
+	reached := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusOK)
+	})
+	registered := map[string]bool{}
+	type testRoute struct {
+		name   string
+		method string
+		path   string
+	}
+	var testRoutes []testRoute
+	if err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		pathTemplate, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return err
+		}
+		route.Handler(reached)
+		for _, method := range methods {
+			name := method + " " + pathTemplate
+			registered[name] = true
+			//* Rellenamos las variables de la ruta con cualquier valor.
+			path := strings.NewReplacer("{id}", "id", "{roleId}", "roleId").Replace(pathTemplate)
+			testRoutes = append(testRoutes, testRoute{name: name, method: method, path: path})
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	//* Ninguna ruta puede quedar sin una política esperada, ni al revés.
+	for name := range registered {
+		if _, ok := expectedRoutePolicies[name]; !ok {
+			t.Errorf("route %s has no expected policy", name)
+		}
+	}
+	for name := range expectedRoutePolicies {
+		if !registered[name] {
+			t.Errorf("route %s is not registered", name)
+		}
+	}
+
+	for _, route := range testRoutes {
+		policy := expectedRoutePolicies[route.name]
+		for c := ANONYMOUS; c <= API_KEY_WITHOUT_SCOPES; c++ {
+			t.Run(fmt.Sprintf("%s/%s", route.name, callerNames[c]), func(t *testing.T) {
+				request := httptest.NewRequest(route.method, route.path, nil)
+				if authorizations[c] != "" {
+					request.Header.Set(handlers.HEADER_AUTHORIZATION, authorizations[c])
+				}
+				recorder := httptest.NewRecorder()
+				router.ServeHTTP(recorder, request)
+
+				if want := expectedStatus(policy, c); recorder.Code != want {
+					t.Errorf("status = %d (%s), want %d", recorder.Code, strings.TrimSpace(recorder.Body.String()), want)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,823 @@
+package conformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aerodinamicat/thisisme02/databases"
+	"github.com/aerodinamicat/thisisme02/models"
+	"github.com/segmentio/ksuid"
+)
+
+type Reporter interface {
+	//* Lo cumple '*testing.T', así que la batería puede ejecutarse tanto desde 'go test' como desde un comando.
+	Errorf(format string, args ...interface{})
+}
+
+type conformanceCase struct {
+	Name string
+	Run  func(ctx context.Context, dbr databases.DatabaseRepository, fx *fixture) error
+}
+
+var conformanceCases = []conformanceCase{
+	{"users/missing", checkMissingUser},
+	{"users/crud", checkUserCrud},
+	{"users/emailUniqueness", checkEmailUniqueness},
+	{"users/pagination", checkUsersPagination},
+	{"users/ordering", checkUsersOrdering},
+	{"users/search", checkUsersSearch},
+	{"users/purge", checkUsersPurge},
+	{"propertyChanges/filtering", checkPropertyChangesFiltering},
+	{"propertyChanges/pagination", checkPropertyChangesPagination},
+	{"tokens/singleUse", checkTokensSingleUse},
+	{"tokens/refreshRevocation", checkRefreshTokensRevocation},
+	{"tokens/revokedBefore", checkTokensRevokedBefore},
+	{"transactions", checkTransactions},
+	{"roles", checkRoles},
+	{"loginThrottles", checkLoginThrottles},
+}
+
+func Run(ctx context.Context, reporter Reporter, dbr databases.DatabaseRepository) {
+	//* Cada ejecución usa sus propios 'id' y 'email', así que la DB puede contener datos previos.
+	//* Aun así, conviene usar una DB desechable: los casos dejan sus registros en ella.
+	runId := strings.ToLower(ksuid.New().String())
+	for _, conformanceCase := range conformanceCases {
+		fx := &fixture{
+			domain: fmt.Sprintf("%s.%s.test", strings.ToLower(strings.ReplaceAll(conformanceCase.Name, "/", "-")), runId),
+			base:   time.Now().UTC().Truncate(time.Second),
+		}
+		if err := conformanceCase.Run(ctx, dbr, fx); err != nil {
+			reporter.Errorf("%s: %v", conformanceCase.Name, err)
+		}
+	}
+}
+
+type fixture struct {
+	//* Todos los 'email' del caso comparten dominio, así 'SearchUsersByEmail' aísla sus 'user'.
+	domain string
+	//* Los momentos se expresan en UTC y en segundos para que cualquier DB los conserve sin pérdida.
+	base time.Time
+}
+
+func (fx *fixture) at(seconds int) time.Time {
+	return fx.base.Add(time.Duration(seconds) * time.Second)
+}
+func (fx *fixture) newUser(name string, createdAt time.Time) *models.User {
+	id := ksuid.New().String()
+	return &models.User{
+		Id:        id,
+		Email:     fmt.Sprintf("%s@%s", name, fx.domain),
+		Password:  "hash-" + name,
+		CreatedAt: createdAt,
+		CreatedBy: id,
+		UpdatedAt: createdAt,
+		UpdatedBy: id,
+	}
+}
+func (fx *fixture) insertUsers(ctx context.Context, dbr databases.DatabaseRepository, names ...string) ([]*models.User, error) {
+	//* Cada 'user' es un segundo más reciente que el anterior.
+	var users []*models.User
+	for i, name := range names {
+		user := fx.newUser(name, fx.at(i))
+		if err := dbr.InsertUser(ctx, user); err != nil {
+			return nil, fmt.Errorf("InsertUser(%s): %v", name, err)
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+func userIds(users []*models.User) []string {
+	ids := make([]string, 0, len(users))
+	for _, user := range users {
+		ids = append(ids, user.Id)
+	}
+	return ids
+}
+func sameIds(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+func checkPageInfo(call string, pageInfo *models.PageInfo, token, size, totalPages, totalItems int) error {
+	if pageInfo == nil {
+		return fmt.Errorf("%s: returned a nil page info", call)
+	}
+	if pageInfo.Token != token || pageInfo.Size != size || pageInfo.TotalPages != totalPages || pageInfo.TotalItems != totalItems {
+		return fmt.Errorf("%s: page info is {token %d, size %d, pages %d, items %d}, want {token %d, size %d, pages %d, items %d}",
+			call, pageInfo.Token, pageInfo.Size, pageInfo.TotalPages, pageInfo.TotalItems, token, size, totalPages, totalItems)
+	}
+	if pageInfo.OrderBy != databases.DEFAULT_ORDER_BY {
+		return fmt.Errorf("%s: order by is '%s', want '%s'", call, pageInfo.OrderBy, databases.DEFAULT_ORDER_BY)
+	}
+	return nil
+}
+func checkSameUser(call string, got, want *models.User) error {
+	if got == nil {
+		return fmt.Errorf("%s: returned a nil user", call)
+	}
+	if got.Id != want.Id || got.Email != want.Email || got.Password != want.Password ||
+		got.CreatedBy != want.CreatedBy || got.UpdatedBy != want.UpdatedBy || got.DeletedBy != want.DeletedBy {
+		return fmt.Errorf("%s: got %+v, want %+v", call, got, want)
+	}
+	if !got.EmailVerifiedAt.Equal(want.EmailVerifiedAt) || !got.DisabledAt.Equal(want.DisabledAt) || !got.CreatedAt.Equal(want.CreatedAt) ||
+		!got.UpdatedAt.Equal(want.UpdatedAt) || !got.DeletedAt.Equal(want.DeletedAt) {
+		return fmt.Errorf("%s: timestamps are %+v, want %+v", call, got, want)
+	}
+	return nil
+}
+
+func checkMissingUser(ctx context.Context, dbr databases.DatabaseRepository, fx *fixture) error {
+	//* Un 'user' inexistente no es un error: se devuelve un 'user' vacío, nunca nulo.
+	user, err := dbr.GetUserById(ctx, ksuid.New().String())
+	if err != nil {
+		return fmt.Errorf("GetUserById: %v", err)
+	}
+	if user == nil || user.Id != "" {
+		return fmt.Errorf("GetUserById: got %+v for a missing id, want an empty user", user)
+	}
+	user, err = dbr.GetUserByEmail(ctx, "missing@"+fx.domain)
+	if err != nil {
+		return fmt.Errorf("GetUserByEmail: %v", err)
+	}
+	if user == nil || user.Id != "" {
+		return fmt.Errorf("GetUserByEmail: got %+v for a missing email, want an empty user", user)
+	}
+	return nil
+}
+func checkUserCrud(ctx context.Context, dbr databases.DatabaseRepository, fx *fixture) error {
+	//* Create y Read.
+	user := fx.newUser("crud", fx.at(0))
+	user.EmailVerifiedAt = fx.at(1)
+	if err := dbr.InsertUser(ctx, user); err != nil {
+		return fmt.Errorf("InsertUser: %v", err)
+	}
+	got, err := dbr.GetUserById(ctx, user.Id)
+	if err != nil {
+		return fmt.Errorf("GetUserById: %v", err)
+	}
+	if err := checkSameUser("GetUserById", got, user); err != nil {
+		return err
+	}
+	got, err = dbr.GetUserByEmail(ctx, user.Email)
+	if err != nil {
+		return fmt.Errorf("GetUserByEmail: %v", err)
+	}
+	if err := checkSameUser("GetUserByEmail", got, user); err != nil {
+		return err
+	}
+
+	//* Update.
+	user.Email = "crud-updated@" + fx.domain
+	user.Password = "hash-updated"
+	user.DisabledAt = fx.at(2)
+	user.UpdatedAt = fx.at(2)
+	user.UpdatedBy = "admin"
+	if err := dbr.UpdateUser(ctx, user); err != nil {
+		return fmt.Errorf("UpdateUser: %v", err)
+	}
+	got, err = dbr.GetUserById(ctx, user.Id)
+	if err != nil {
+		return fmt.Errorf("GetUserById: %v", err)
+	}
+	if err := checkSameUser("GetUserById after UpdateUser", got, user); err != nil {
+		return err
+	}
+
+	//* Delete: el 'user' sólo se marca, sigue accesible por 'id' pero no por 'email'.
+	user.DeletedAt = fx.at(3)
+	user.DeletedBy = user.Id
+	if err := dbr.DeleteUser(ctx, user); err != nil {
+		return fmt.Errorf("DeleteUser: %v", err)
+	}
+	got, err = dbr.GetUserById(ctx, user.Id)
+	if err != nil {
+		return fmt.Errorf("GetUserById: %v", err)
+	}
+	if err := checkSameUser("GetUserById after DeleteUser", got, user); err != nil {
+		return err
+	}
+	got, err = dbr.GetUserByEmail(ctx, user.Email)
+	if err != nil {
+		return fmt.Errorf("GetUserByEmail: %v", err)
+	}
+	if got == nil || got.Id != "" {
+		return fmt.Errorf("GetUserByEmail: got %+v for a deleted user, want an empty user", got)
+	}
+
+	//* Restore.
+	user.DeletedAt = time.Time{}
+	user.DeletedBy = ""
+	user.UpdatedAt = fx.at(4)
+	user.UpdatedBy = user.Id
+	if err := dbr.RestoreUser(ctx, user); err != nil {
+		return fmt.Errorf("RestoreUser: %v", err)
+	}
+	got, err = dbr.GetUserByEmail(ctx, user.Email)
+	if err != nil {
+		return fmt.Errorf("GetUserByEmail: %v", err)
+	}
+	return checkSameUser("GetUserByEmail after RestoreUser", got, user)
+}
+func checkEmailUniqueness(ctx context.Context, dbr databases.DatabaseRepository, fx *fixture) error {
+	users, err := fx.insertUsers(ctx, dbr, "first", "second")
+	if err != nil {
+		return err
+	}
+
+	//* Ni el 'id' ni el 'email' pueden repetirse.
+	duplicate := fx.newUser("first", fx.at(5))
+	if err := dbr.InsertUser(ctx, duplicate); err != databases.ErrDuplicateKey {
+		return fmt.Errorf("InsertUser: got %v for a duplicated email, want %v", err, databases.ErrDuplicateKey)
+	}
+	duplicate = fx.newUser("third", fx.at(5))
+	duplicate.Id = users[0].Id
+	if err := dbr.InsertUser(ctx, duplicate); err != databases.ErrDuplicateKey {
+		return fmt.Errorf("InsertUser: got %v for a duplicated id, want %v", err, databases.ErrDuplicateKey)
+	}
+
+	//* Tampoco puede cambiarse el 'email' por el de otro 'user'.
+	second := *users[1]
+	second.Email = users[0].Email
+	if err := dbr.UpdateUser(ctx, &second); err != databases.ErrDuplicateKey {
+		return fmt.Errorf("UpdateUser: got %v for another user's email, want %v", err, databases.ErrDuplicateKey)
+	}
+
+	//* El 'email' de un 'user' eliminado sigue reservado hasta que se purga.
+	users[0].DeletedAt = fx.at(6)
+	users[0].DeletedBy = users[0].Id
+	if err := dbr.DeleteUser(ctx, users[0]); err != nil {
+		return fmt.Errorf("DeleteUser: %v", err)
+	}
+	duplicate = fx.newUser("first", fx.at(7))
+	if err := dbr.InsertUser(ctx, duplicate); err != databases.ErrDuplicateKey {
+		return fmt.Errorf("InsertUser: got %v for the email of a deleted user, want %v", err, databases.ErrDuplicateKey)
+	}
+	for email, wantInUse := range map[string]bool{users[0].Email: true, users[1].Email: true, duplicate.Email + ".free": false} {
+		inUse, err := dbr.IsEmailInUse(ctx, email)
+		if err != nil {
+			return fmt.Errorf("IsEmailInUse: %v", err)
+		}
+		if inUse != wantInUse {
+			return fmt.Errorf("IsEmailInUse(%s) = %t, want %t", email, inUse, wantInUse)
+		}
+	}
+	return nil
+}
+func checkUsersPagination(ctx context.Context, dbr databases.DatabaseRepository, fx *fixture) error {
+	users, err := fx.insertUsers(ctx, dbr, "a", "b", "c", "d", "e", "f", "g")
+	if err != nil {
+		return err
+	}
+
+	//* Los 'user' llegan del más reciente al más antiguo, en páginas de 'Size' elementos.
+	//* 'Token' indica la página siguiente y los totales sólo se calculan en la primera llamada.
+	pageInfo := &models.PageInfo{Size: 3}
+	wantPages := [][]*models.User{
+		{users[6], users[5], users[4]},
+		{users[3], users[2], users[1]},
+		{users[0]},
+		nil,
+	}
+	for i, wantPage := range wantPages {
+		var page []*models.User
+		page, pageInfo, err = dbr.SearchUsersByEmail(ctx, fx.domain, pageInfo)
+		call := fmt.Sprintf("SearchUsersByEmail page %d", i+1)
+		if err != nil {
+			return fmt.Errorf("%s: %v", call, err)
+		}
+		if !sameIds(userIds(page), userIds(wantPage)) {
+			return fmt.Errorf("%s: got ids %v, want %v", call, userIds(page), userIds(wantPage))
+		}
+		if err := checkPageInfo(call, pageInfo, i+2, 3, 3, 7); err != nil {
+			return err
+		}
+	}
+
+	//* Sin tamaño, se usa 'DEFAULT_PAGE_SIZE'.
+	page, pageInfo, err := dbr.SearchUsersByEmail(ctx, fx.domain, &models.PageInfo{})
+	if err != nil {
+		return fmt.Errorf("SearchUsersByEmail: %v", err)
+	}
+	if len(page) != databases.DEFAULT_PAGE_SIZE {
+		return fmt.Errorf("SearchUsersByEmail: got %d users, want %d", len(page), databases.DEFAULT_PAGE_SIZE)
+	}
+	if err := checkPageInfo("SearchUsersByEmail", pageInfo, 2, databases.DEFAULT_PAGE_SIZE, 2, 7); err != nil {
+		return err
+	}
+
+	//* 'ListUsers' pagina igual, aunque la DB contenga otros 'user'.
+	page, pageInfo, err = dbr.ListUsers(ctx, &models.PageInfo{Size: 2})
+	if err != nil {
+		return fmt.Errorf("ListUsers: %v", err)
+	}
+	if len(page) != 2 || pageInfo.Token != 2 || pageInfo.TotalItems < len(users) {
+		return fmt.Errorf("ListUsers: got %d users and %+v, want 2 users, token 2 and at least %d items", len(page), pageInfo, len(users))
+	}
+	return nil
+}
+func checkUsersOrdering(ctx context.Context, dbr databases.DatabaseRepository, fx *fixture) error {
+	//* A igualdad de 'CreatedAt', se desempata por 'id'.
+	var users []*models.User
+	for _, name := range []string{"tie-1", "tie-2", "tie-3"} {
+		user := fx.newUser(name, fx.at(0))
+		if err := dbr.InsertUser(ctx, user); err != nil {
+			return fmt.Errorf("InsertUser(%s): %v", name, err)
+		}
+		users = append(users, user)
+	}
+	newest := fx.newUser("newest", fx.at(1))
+	if err := dbr.InsertUser(ctx, newest); err != nil {
+		return fmt.Errorf("InsertUser(newest): %v", err)
+	}
+
+	want := []string{newest.Id}
+	tied := userIds(users)
+	for i := range tied {
+		for j := i + 1; j < len(tied); j++ {
+			if tied[j] < tied[i] {
+				tied[i], tied[j] = tied[j], tied[i]
+			}
+		}
+	}
+	want = append(want, tied...)
+
+	page, _, err := dbr.SearchUsersByEmail(ctx, fx.domain, &models.PageInfo{Size: 10})
+	if err != nil {
+		return fmt.Errorf("SearchUsersByEmail: %v", err)
+	}
+	if !sameIds(userIds(page), want) {
+		return fmt.Errorf("SearchUsersByEmail: got ids %v, want %v", userIds(page), want)
+	}
+	return nil
+}
+func checkUsersSearch(ctx context.Context, dbr databases.DatabaseRepository, fx *fixture) error {
+	users, err := fx.insertUsers(ctx, dbr, "alice", "bob", "al_ice")
+	if err != nil {
+		return err
+	}
+
+	//* La búsqueda no distingue mayúsculas y trata los comodines de 'LIKE' como texto.
+	searches := map[string][]string{
+		strings.ToUpper("ALICE@" + fx.domain): {users[0].Id},
+		"al_ice@" + fx.domain:                 {users[2].Id},
+		"%@" + fx.domain:                      nil,
+		"@" + fx.domain:                       {users[2].Id, users[1].Id, users[0].Id},
+	}
+	for search, want := range searches {
+		page, _, err := dbr.SearchUsersByEmail(ctx, search, &models.PageInfo{Size: 10})
+		if err != nil {
+			return fmt.Errorf("SearchUsersByEmail(%q): %v", search, err)
+		}
+		if !sameIds(userIds(page), want) {
+			return fmt.Errorf("SearchUsersByEmail(%q): got ids %v, want %v", search, userIds(page), want)
+		}
+	}
+	return nil
+}
+func checkUsersPurge(ctx context.Context, dbr databases.DatabaseRepository, fx *fixture) error {
+	users, err := fx.insertUsers(ctx, dbr, "purged", "recent", "kept")
+	if err != nil {
+		return err
+	}
+
+	//* Usamos fechas muy antiguas para no purgar nada ajeno al caso.
+	longAgo := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+	users[0].DeletedAt = longAgo
+	users[0].DeletedBy = users[0].Id
+	users[1].DeletedAt = longAgo.Add(48 * time.Hour)
+	users[1].DeletedBy = users[1].Id
+	for _, user := range users[:2] {
+		if err := dbr.DeleteUser(ctx, user); err != nil {
+			return fmt.Errorf("DeleteUser: %v", err)
+		}
+	}
+	propertyChange := &models.PropertyChange{UserId: users[0].Id, Name: "status", From: "active", To: "deleted", CreatedAt: fx.at(1), CreatedBy: users[0].Id}
+	if err := dbr.InsertPropertyChangeLog(ctx, propertyChange); err != nil {
+		return fmt.Errorf("InsertPropertyChangeLog: %v", err)
+	}
+
+	//* Sólo se purgan los eliminados antes del límite, junto con todo lo suyo.
+	purged, err := dbr.PurgeDeletedUsers(ctx, longAgo.Add(24*time.Hour))
+	if err != nil {
+		return fmt.Errorf("PurgeDeletedUsers: %v", err)
+	}
+	if purged < 1 {
+		return fmt.Errorf("PurgeDeletedUsers: purged %d users, want at least 1", purged)
+	}
+	for i, wantPurged := range []bool{true, false, false} {
+		got, err := dbr.GetUserById(ctx, users[i].Id)
+		if err != nil {
+			return fmt.Errorf("GetUserById: %v", err)
+		}
+		if (got.Id == "") != wantPurged {
+			return fmt.Errorf("GetUserById(%s): purged is %t, want %t", users[i].Email, got.Id == "", wantPurged)
+		}
+	}
+	propertyChanges, _, err := dbr.ListPropertyChangesByUserId(ctx, users[0].Id, &models.PageInfo{})
+	if err != nil {
+		return fmt.Errorf("ListPropertyChangesByUserId: %v", err)
+	}
+	//* El historial de los purgados se conserva, pero sin sus valores.
+	if len(propertyChanges) != 1 || propertyChanges[0].Name != propertyChange.Name || propertyChanges[0].From != "" || propertyChanges[0].To != "" {
+		return fmt.Errorf("ListPropertyChangesByUserId: got %+v for a purged user, want one change without values", propertyChanges)
+	}
+	return nil
+}
+
+func insertPropertyChanges(ctx context.Context, dbr databases.DatabaseRepository, fx *fixture, userId string, names ...string) ([]*models.PropertyChange, error) {
+	var propertyChanges []*models.PropertyChange
+	for i, name := range names {
+		propertyChange := &models.PropertyChange{
+			UserId:    userId,
+			Name:      name,
+			From:      fmt.Sprintf("%s-%d", name, i),
+			To:        fmt.Sprintf("%s-%d", name, i+1),
+			CreatedAt: fx.at(i),
+			CreatedBy: userId,
+		}
+		if err := dbr.InsertPropertyChangeLog(ctx, propertyChange); err != nil {
+			return nil, fmt.Errorf("InsertPropertyChangeLog: %v", err)
+		}
+		propertyChanges = append(propertyChanges, propertyChange)
+	}
+	return propertyChanges, nil
+}
+func checkSamePropertyChanges(call string, got, want []*models.PropertyChange) error {
+	if len(got) != len(want) {
+		return fmt.Errorf("%s: got %d changes, want %d", call, len(got), len(want))
+	}
+	for i := range got {
+		if got[i].UserId != want[i].UserId || got[i].Name != want[i].Name || got[i].From != want[i].From ||
+			got[i].To != want[i].To || got[i].CreatedBy != want[i].CreatedBy || !got[i].CreatedAt.Equal(want[i].CreatedAt) {
+			return fmt.Errorf("%s: change %d is %+v, want %+v", call, i, got[i], want[i])
+		}
+	}
+	return nil
+}
+func checkPropertyChangesFiltering(ctx context.Context, dbr databases.DatabaseRepository, fx *fixture) error {
+	users, err := fx.insertUsers(ctx, dbr, "owner", "other")
+	if err != nil {
+		return err
+	}
+	owned, err := insertPropertyChanges(ctx, dbr, fx, users[0].Id, "email", "password", "email")
+	if err != nil {
+		return err
+	}
+	if _, err := insertPropertyChanges(ctx, dbr, fx, users[1].Id, "email"); err != nil {
+		return err
+	}
+
+	//* Sólo los cambios del 'user', del más reciente al más antiguo.
+	propertyChanges, _, err := dbr.ListPropertyChangesByUserId(ctx, users[0].Id, &models.PageInfo{Size: 10})
+	if err != nil {
+		return fmt.Errorf("ListPropertyChangesByUserId: %v", err)
+	}
+	if err := checkSamePropertyChanges("ListPropertyChangesByUserId", propertyChanges, []*models.PropertyChange{owned[2], owned[1], owned[0]}); err != nil {
+		return err
+	}
+
+	//* Y, si se indica, sólo los de una propiedad.
+	propertyChanges, _, err = dbr.ListPropertyChangesByUserIdAndName(ctx, users[0].Id, "email", &models.PageInfo{Size: 10})
+	if err != nil {
+		return fmt.Errorf("ListPropertyChangesByUserIdAndName: %v", err)
+	}
+	return checkSamePropertyChanges("ListPropertyChangesByUserIdAndName", propertyChanges, []*models.PropertyChange{owned[2], owned[0]})
+}
+func checkPropertyChangesPagination(ctx context.Context, dbr databases.DatabaseRepository, fx *fixture) error {
+	users, err := fx.insertUsers(ctx, dbr, "owner")
+	if err != nil {
+		return err
+	}
+	owned, err := insertPropertyChanges(ctx, dbr, fx, users[0].Id, "email", "email", "email")
+	if err != nil {
+		return err
+	}
+
+	//* Ambos listados avanzan 'Token' igual que el de 'user'.
+	lists := map[string]func(pageInfo *models.PageInfo) ([]*models.PropertyChange, *models.PageInfo, error){
+		"ListPropertyChangesByUserId": func(pageInfo *models.PageInfo) ([]*models.PropertyChange, *models.PageInfo, error) {
+			return dbr.ListPropertyChangesByUserId(ctx, users[0].Id, pageInfo)
+		},
+		"ListPropertyChangesByUserIdAndName": func(pageInfo *models.PageInfo) ([]*models.PropertyChange, *models.PageInfo, error) {
+			return dbr.ListPropertyChangesByUserIdAndName(ctx, users[0].Id, "email", pageInfo)
+		},
+	}
+	for name, list := range lists {
+		pageInfo := &models.PageInfo{Size: 2}
+		wantPages := [][]*models.PropertyChange{{owned[2], owned[1]}, {owned[0]}}
+		for i, wantPage := range wantPages {
+			var page []*models.PropertyChange
+			page, pageInfo, err = list(pageInfo)
+			call := fmt.Sprintf("%s page %d", name, i+1)
+			if err != nil {
+				return fmt.Errorf("%s: %v", call, err)
+			}
+			if err := checkSamePropertyChanges(call, page, wantPage); err != nil {
+				return err
+			}
+			if err := checkPageInfo(call, pageInfo, i+2, 2, 2, 3); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func checkTokensSingleUse(ctx context.Context, dbr databases.DatabaseRepository, fx *fixture) error {
+	users, err := fx.insertUsers(ctx, dbr, "owner")
+	if err != nil {
+		return err
+	}
+	userId := users[0].Id
+
+	//* Un 'token' inexistente se devuelve nulo, sin error.
+	if passwordResetToken, err := dbr.GetPasswordResetTokenByHash(ctx, ksuid.New().String()); err != nil || passwordResetToken != nil {
+		return fmt.Errorf("GetPasswordResetTokenByHash: got %+v, %v for a missing hash, want nil, nil", passwordResetToken, err)
+	}
+
+	//* Cada 'token' puede marcarse como usado una sola vez.
+	passwordResetToken := &models.PasswordResetToken{Id: ksuid.New().String(), UserId: userId, TokenHash: ksuid.New().String(), ExpiresAt: fx.at(60), CreatedAt: fx.at(0)}
+	if err := dbr.InsertPasswordResetToken(ctx, passwordResetToken); err != nil {
+		return fmt.Errorf("InsertPasswordResetToken: %v", err)
+	}
+	storedPasswordResetToken, err := dbr.GetPasswordResetTokenByHash(ctx, passwordResetToken.TokenHash)
+	if err != nil || storedPasswordResetToken == nil || storedPasswordResetToken.Id != passwordResetToken.Id || !storedPasswordResetToken.UsedAt.IsZero() {
+		return fmt.Errorf("GetPasswordResetTokenByHash: got %+v, %v", storedPasswordResetToken, err)
+	}
+	passwordResetToken.UsedAt = fx.at(1)
+	if err := dbr.UpdatePasswordResetToken(ctx, passwordResetToken); err != nil {
+		return fmt.Errorf("UpdatePasswordResetToken: %v", err)
+	}
+	if err := dbr.UpdatePasswordResetToken(ctx, passwordResetToken); err != databases.ErrTokenAlreadyUsed {
+		return fmt.Errorf("UpdatePasswordResetToken: got %v when used twice, want %v", err, databases.ErrTokenAlreadyUsed)
+	}
+
+	//* Usar todos los de un 'user' no cambia el momento de los ya usados.
+	pendingPasswordResetToken := &models.PasswordResetToken{Id: ksuid.New().String(), UserId: userId, TokenHash: ksuid.New().String(), ExpiresAt: fx.at(60), CreatedAt: fx.at(0)}
+	if err := dbr.InsertPasswordResetToken(ctx, pendingPasswordResetToken); err != nil {
+		return fmt.Errorf("InsertPasswordResetToken: %v", err)
+	}
+	if err := dbr.UsePasswordResetTokensByUserId(ctx, userId, fx.at(2)); err != nil {
+		return fmt.Errorf("UsePasswordResetTokensByUserId: %v", err)
+	}
+	for tokenHash, wantUsedAt := range map[string]time.Time{passwordResetToken.TokenHash: fx.at(1), pendingPasswordResetToken.TokenHash: fx.at(2)} {
+		storedPasswordResetToken, err := dbr.GetPasswordResetTokenByHash(ctx, tokenHash)
+		if err != nil || storedPasswordResetToken == nil || !storedPasswordResetToken.UsedAt.Equal(wantUsedAt) {
+			return fmt.Errorf("GetPasswordResetTokenByHash: got %+v, %v, want used at %v", storedPasswordResetToken, err, wantUsedAt)
+		}
+	}
+
+	emailVerificationToken := &models.EmailVerificationToken{Id: ksuid.New().String(), UserId: userId, Email: users[0].Email, Purpose: "verify", TokenHash: ksuid.New().String(), ExpiresAt: fx.at(60), CreatedAt: fx.at(0)}
+	if err := dbr.InsertEmailVerificationToken(ctx, emailVerificationToken); err != nil {
+		return fmt.Errorf("InsertEmailVerificationToken: %v", err)
+	}
+	emailVerificationToken.UsedAt = fx.at(1)
+	if err := dbr.UpdateEmailVerificationToken(ctx, emailVerificationToken); err != nil {
+		return fmt.Errorf("UpdateEmailVerificationToken: %v", err)
+	}
+	if err := dbr.UpdateEmailVerificationToken(ctx, emailVerificationToken); err != databases.ErrTokenAlreadyUsed {
+		return fmt.Errorf("UpdateEmailVerificationToken: got %v when used twice, want %v", err, databases.ErrTokenAlreadyUsed)
+	}
+
+	refreshToken := &models.RefreshToken{Id: ksuid.New().String(), UserId: userId, FamilyId: ksuid.New().String(), Scopes: []string{"openid", "email"}, TokenHash: ksuid.New().String(), ExpiresAt: fx.at(60), CreatedAt: fx.at(0)}
+	if err := dbr.InsertRefreshToken(ctx, refreshToken); err != nil {
+		return fmt.Errorf("InsertRefreshToken: %v", err)
+	}
+	storedRefreshToken, err := dbr.GetRefreshTokenByHash(ctx, refreshToken.TokenHash)
+	if err != nil || storedRefreshToken == nil || strings.Join(storedRefreshToken.Scopes, " ") != "openid email" {
+		return fmt.Errorf("GetRefreshTokenByHash: got %+v, %v", storedRefreshToken, err)
+	}
+	refreshToken.UsedAt = fx.at(1)
+	if err := dbr.UpdateRefreshToken(ctx, refreshToken); err != nil {
+		return fmt.Errorf("UpdateRefreshToken: %v", err)
+	}
+	if err := dbr.UpdateRefreshToken(ctx, refreshToken); err != databases.ErrTokenAlreadyUsed {
+		return fmt.Errorf("UpdateRefreshToken: got %v when used twice, want %v", err, databases.ErrTokenAlreadyUsed)
+	}
+	return nil
+}
+func checkRefreshTokensRevocation(ctx context.Context, dbr databases.DatabaseRepository, fx *fixture) error {
+	users, err := fx.insertUsers(ctx, dbr, "owner")
+	if err != nil {
+		return err
+	}
+
+	//* Revocar una familia no afecta a las demás.
+	revokedFamily, keptFamily := ksuid.New().String(), ksuid.New().String()
+	var refreshTokens []*models.RefreshToken
+	for _, familyId := range []string{revokedFamily, revokedFamily, keptFamily} {
+		refreshToken := &models.RefreshToken{Id: ksuid.New().String(), UserId: users[0].Id, FamilyId: familyId, TokenHash: ksuid.New().String(), ExpiresAt: fx.at(60), CreatedAt: fx.at(0)}
+		if err := dbr.InsertRefreshToken(ctx, refreshToken); err != nil {
+			return fmt.Errorf("InsertRefreshToken: %v", err)
+		}
+		refreshTokens = append(refreshTokens, refreshToken)
+	}
+	if err := dbr.RevokeRefreshTokenFamily(ctx, revokedFamily, fx.at(1)); err != nil {
+		return fmt.Errorf("RevokeRefreshTokenFamily: %v", err)
+	}
+	for i, wantRevoked := range []bool{true, true, false} {
+		storedRefreshToken, err := dbr.GetRefreshTokenByHash(ctx, refreshTokens[i].TokenHash)
+		if err != nil {
+			return fmt.Errorf("GetRefreshTokenByHash: %v", err)
+		}
+		if storedRefreshToken.RevokedAt.IsZero() == wantRevoked {
+			return fmt.Errorf("GetRefreshTokenByHash: token %d revoked is %t, want %t", i, !storedRefreshToken.RevokedAt.IsZero(), wantRevoked)
+		}
+	}
+
+	//* Revocar los de un 'user' no cambia el momento de los ya revocados.
+	if err := dbr.RevokeRefreshTokensByUserId(ctx, users[0].Id, fx.at(2)); err != nil {
+		return fmt.Errorf("RevokeRefreshTokensByUserId: %v", err)
+	}
+	for i, wantRevokedAt := range []time.Time{fx.at(1), fx.at(1), fx.at(2)} {
+		storedRefreshToken, err := dbr.GetRefreshTokenByHash(ctx, refreshTokens[i].TokenHash)
+		if err != nil {
+			return fmt.Errorf("GetRefreshTokenByHash: %v", err)
+		}
+		if !storedRefreshToken.RevokedAt.Equal(wantRevokedAt) {
+			return fmt.Errorf("GetRefreshTokenByHash: token %d revoked at %v, want %v", i, storedRefreshToken.RevokedAt, wantRevokedAt)
+		}
+	}
+	return nil
+}
+
+func checkTokensRevokedBefore(ctx context.Context, dbr databases.DatabaseRepository, fx *fixture) error {
+	users, err := fx.insertUsers(ctx, dbr, "owner")
+	if err != nil {
+		return err
+	}
+
+	//* La revocación se compara con el 'iat_us' de los 'token': la DB debe conservar los microsegundos.
+	for _, revokedBefore := range []time.Time{fx.at(0).Add(123456 * time.Microsecond), fx.at(1).Add(654321 * time.Microsecond)} {
+		if err := dbr.SetUserTokensRevokedBefore(ctx, users[0].Id, revokedBefore); err != nil {
+			return fmt.Errorf("SetUserTokensRevokedBefore: %v", err)
+		}
+		storedRevokedBefore, err := dbr.GetUserTokensRevokedBefore(ctx, users[0].Id)
+		if err != nil {
+			return fmt.Errorf("GetUserTokensRevokedBefore: %v", err)
+		}
+		if storedRevokedBefore.UnixMicro() != revokedBefore.UnixMicro() {
+			return fmt.Errorf("GetUserTokensRevokedBefore = %v, want %v", storedRevokedBefore, revokedBefore)
+		}
+	}
+	return nil
+}
+
+func checkTransactions(ctx context.Context, dbr databases.DatabaseRepository, fx *fixture) error {
+	//* Si la función falla, no queda nada de lo que hizo.
+	rolledBack := fx.newUser("rolled-back", fx.at(0))
+	errRollback := errors.New("rollback")
+	err := dbr.RunInTransaction(ctx, func(txDbr databases.DatabaseRepository) error {
+		if err := txDbr.InsertUser(ctx, rolledBack); err != nil {
+			return err
+		}
+		propertyChange := &models.PropertyChange{UserId: rolledBack.Id, Name: "email", To: rolledBack.Email, CreatedAt: fx.at(0), CreatedBy: rolledBack.Id}
+		if err := txDbr.InsertPropertyChangeLog(ctx, propertyChange); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if err != errRollback {
+		return fmt.Errorf("RunInTransaction: got %v, want the error returned by the function", err)
+	}
+	got, err := dbr.GetUserById(ctx, rolledBack.Id)
+	if err != nil {
+		return fmt.Errorf("GetUserById: %v", err)
+	}
+	if got.Id != "" {
+		return errors.New("RunInTransaction: a failed transaction left its user behind")
+	}
+
+	//* Si termina bien, todo queda guardado, también lo hecho en transacciones anidadas.
+	committed := fx.newUser("committed", fx.at(1))
+	err = dbr.RunInTransaction(ctx, func(txDbr databases.DatabaseRepository) error {
+		if err := txDbr.InsertUser(ctx, committed); err != nil {
+			return err
+		}
+		return txDbr.RunInTransaction(ctx, func(nestedDbr databases.DatabaseRepository) error {
+			propertyChange := &models.PropertyChange{UserId: committed.Id, Name: "email", To: committed.Email, CreatedAt: fx.at(1), CreatedBy: committed.Id}
+			return nestedDbr.InsertPropertyChangeLog(ctx, propertyChange)
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("RunInTransaction: %v", err)
+	}
+	got, err = dbr.GetUserById(ctx, committed.Id)
+	if err != nil {
+		return fmt.Errorf("GetUserById: %v", err)
+	}
+	if err := checkSameUser("GetUserById after RunInTransaction", got, committed); err != nil {
+		return err
+	}
+	propertyChanges, _, err := dbr.ListPropertyChangesByUserId(ctx, committed.Id, &models.PageInfo{})
+	if err != nil {
+		return fmt.Errorf("ListPropertyChangesByUserId: %v", err)
+	}
+	if len(propertyChanges) != 1 {
+		return fmt.Errorf("ListPropertyChangesByUserId: got %d changes after a nested transaction, want 1", len(propertyChanges))
+	}
+	return nil
+}
+
+func checkRoles(ctx context.Context, dbr databases.DatabaseRepository, fx *fixture) error {
+	users, err := fx.insertUsers(ctx, dbr, "member")
+	if err != nil {
+		return err
+	}
+
+	//* Los permisos sembrados existen en toda DB.
+	permissions, err := dbr.ListPermissions(ctx)
+	if err != nil {
+		return fmt.Errorf("ListPermissions: %v", err)
+	}
+	var permissionNames []string
+	for _, permission := range permissions {
+		permissionNames = append(permissionNames, permission.Name)
+	}
+	if strings.Join(permissionNames, " ") != "clients:manage roles:manage users:manage" {
+		return fmt.Errorf("ListPermissions: got %v, want the seeded permissions in order", permissionNames)
+	}
+
+	//* Los permisos de un rol se devuelven ordenados y el nombre es único.
+	role := &models.Role{Id: ksuid.New().String(), Name: "role-" + fx.domain, Permissions: []string{"users:manage", "roles:manage"}, CreatedAt: fx.at(0), CreatedBy: "system"}
+	if err := dbr.InsertRole(ctx, role); err != nil {
+		return fmt.Errorf("InsertRole: %v", err)
+	}
+	if err := dbr.InsertRole(ctx, &models.Role{Id: ksuid.New().String(), Name: role.Name, CreatedAt: fx.at(0), CreatedBy: "system"}); err == nil {
+		return errors.New("InsertRole: accepted a duplicated name")
+	}
+	storedRole, err := dbr.GetRoleById(ctx, role.Id)
+	if err != nil || storedRole == nil || strings.Join(storedRole.Permissions, " ") != "roles:manage users:manage" {
+		return fmt.Errorf("GetRoleById: got %+v, %v", storedRole, err)
+	}
+	if missingRole, err := dbr.GetRoleById(ctx, ksuid.New().String()); err != nil || missingRole != nil {
+		return fmt.Errorf("GetRoleById: got %+v, %v for a missing id, want nil, nil", missingRole, err)
+	}
+
+	//* Asignar dos veces el mismo rol no es un error, pero sólo la primera cuenta.
+	userRole := &models.UserRole{UserId: users[0].Id, RoleId: role.Id, CreatedAt: fx.at(1), CreatedBy: "system"}
+	for i, wantAssigned := range []bool{true, false} {
+		assigned, err := dbr.InsertUserRole(ctx, userRole)
+		if err != nil || assigned != wantAssigned {
+			return fmt.Errorf("InsertUserRole call %d: got %t, %v, want %t, nil", i+1, assigned, err, wantAssigned)
+		}
+	}
+	roles, err := dbr.ListRolesByUserId(ctx, users[0].Id)
+	if err != nil || len(roles) != 1 || roles[0].Id != role.Id {
+		return fmt.Errorf("ListRolesByUserId: got %d roles, %v, want the assigned role", len(roles), err)
+	}
+	for i, wantRevoked := range []bool{true, false} {
+		revoked, err := dbr.DeleteUserRole(ctx, users[0].Id, role.Id)
+		if err != nil || revoked != wantRevoked {
+			return fmt.Errorf("DeleteUserRole call %d: got %t, %v, want %t, nil", i+1, revoked, err, wantRevoked)
+		}
+	}
+	return nil
+}
+
+func checkLoginThrottles(ctx context.Context, dbr databases.DatabaseRepository, fx *fixture) error {
+	key := "account:throttled@" + fx.domain
+	if loginThrottle, err := dbr.GetLoginThrottle(ctx, key); err != nil || loginThrottle != nil {
+		return fmt.Errorf("GetLoginThrottle: got %+v, %v for a missing key, want nil, nil", loginThrottle, err)
+	}
+
+	//* Los fallos se acumulan dentro de la ventana y el recuento vuelve a empezar fuera de ella.
+	windowStart := fx.at(0)
+	for i, failedAt := range []time.Time{fx.at(1), fx.at(2), fx.at(3)} {
+		loginThrottle, err := dbr.RegisterLoginFailure(ctx, key, failedAt, windowStart)
+		if err != nil || loginThrottle == nil || loginThrottle.Failures != i+1 || !loginThrottle.LastFailedAt.Equal(failedAt) {
+			return fmt.Errorf("RegisterLoginFailure call %d: got %+v, %v", i+1, loginThrottle, err)
+		}
+	}
+	loginThrottle, err := dbr.RegisterLoginFailure(ctx, key, fx.at(20), fx.at(10))
+	if err != nil || loginThrottle == nil || loginThrottle.Failures != 1 {
+		return fmt.Errorf("RegisterLoginFailure after the window: got %+v, %v, want 1 failure", loginThrottle, err)
+	}
+
+	//* Al bloquear, el recuento vuelve a cero.
+	if err := dbr.LockLoginThrottle(ctx, key, fx.at(60)); err != nil {
+		return fmt.Errorf("LockLoginThrottle: %v", err)
+	}
+	loginThrottle, err = dbr.GetLoginThrottle(ctx, key)
+	if err != nil || loginThrottle == nil || loginThrottle.Failures != 0 || !loginThrottle.LockedUntil.Equal(fx.at(60)) {
+		return fmt.Errorf("GetLoginThrottle after LockLoginThrottle: got %+v, %v", loginThrottle, err)
+	}
+
+	if err := dbr.DeleteLoginThrottle(ctx, key); err != nil {
+		return fmt.Errorf("DeleteLoginThrottle: %v", err)
+	}
+	if loginThrottle, err := dbr.GetLoginThrottle(ctx, key); err != nil || loginThrottle != nil {
+		return fmt.Errorf("GetLoginThrottle after DeleteLoginThrottle: got %+v, %v, want nil, nil", loginThrottle, err)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package conformance_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/aerodinamicat/thisisme02/databases"
+	"github.com/aerodinamicat/thisisme02/databases/conformance"
+	"github.com/aerodinamicat/thisisme02/servers"
+)
+
+func runConformance(t *testing.T, databaseConfiguration *servers.DBConfig) {
+	t.Helper()
+	dbr, err := servers.NewDatabaseRepository(databaseConfiguration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dbr.CloseDatabaseConnection() })
+
+	//* Los casos necesitan el esquema al día, como en 'cmd/conformance'.
+	if err := servers.MigrateDatabase(context.Background(), dbr); err != nil {
+		t.Fatal(err)
+	}
+
+	conformance.Run(context.Background(), t, dbr)
+}
+
+func TestMemory(t *testing.T) {
+	runConformance(t, &servers.DBConfig{Driver: servers.DATABASE_DRIVER_MEMORY})
+}
+func TestSqlite(t *testing.T) {
+	runConformance(t, &servers.DBConfig{
+		Driver: servers.DATABASE_DRIVER_SQLITE,
+		Path:   filepath.Join(t.TempDir(), "conformance.db"),
+	})
+}
+func TestPostgres(t *testing.T) {
+	//* Necesita una DB desechable: se configura con las mismas variables 'DB_*' que el servicio.
+	if enabled, _ := strconv.ParseBool(os.Getenv("CONFORMANCE_POSTGRES")); !enabled {
+		t.Skip("set CONFORMANCE_POSTGRES=true and the DB_* variables to run against Postgres")
+	}
+	runConformance(t, &servers.DBConfig{
+		Driver:   servers.DATABASE_DRIVER_POSTGRES,
+		Port:     os.Getenv("DB_PORT"),
+		Password: os.Getenv("DB_PASSWORD"),
+		User:     os.Getenv("DB_USER"),
+		Host:     os.Getenv("DB_HOST"),
+		Schema:   os.Getenv("DB_SCHEMA"),
+	})
+}
+
+func TestSqliteMigrationsRoundTrip(t *testing.T) {
+	//* Deshacer todas las migraciones y volver a aplicarlas deja la DB lista para la batería.
+	dbr, err := databases.NewSqliteImplementation(filepath.Join(t.TempDir(), "migrations.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dbr.CloseDatabaseConnection() })
+
+	migrator, err := dbr.Migrator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	if _, err := migrator.Down(ctx, migrator.LatestVersion()); err != nil {
+		t.Fatalf("down: %v", err)
+	}
+	if version, err := migrator.Version(ctx); err != nil || version != 0 {
+		t.Fatalf("version after down = %d, %v, want 0", version, err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("up again: %v", err)
+	}
+
+	conformance.Run(ctx, t, dbr)
+}
@@ -2,13 +2,25 @@ package databases
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/aerodinamicat/thisisme02/models"
 )
 
+var (
+	ErrTokenAlreadyUsed = errors.New("token already used")
+	ErrTokenRevoked     = errors.New("token revoked")
+)
+
 type DatabaseRepository interface {
 	CloseDatabaseConnection() error
 
+	//* Transactions related methods:
+	//* Ejecuta 'fn' con un repositorio ligado a una transacción: si 'fn' devuelve un error, se deshace todo.
+	//* Si el repositorio ya está ligado a una transacción, 'fn' se ejecuta dentro de ella.
+	RunInTransaction(ctx context.Context, fn func(dbr DatabaseRepository) error) error
+
 	//* User related methods:
 	//* Standard REST API
 	//* Create
@@ -16,11 +28,15 @@ type DatabaseRepository interface {
 	//* Read
 	GetUserById(ctx context.Context, id string) (*models.User, error)
 	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	IsEmailInUse(ctx context.Context, email string) (bool, error)
 	ListUsers(ctx context.Context, pageInfo *models.PageInfo) ([]*models.User, *models.PageInfo, error)
+	SearchUsersByEmail(ctx context.Context, search string, pageInfo *models.PageInfo) ([]*models.User, *models.PageInfo, error)
 	//* Update
 	UpdateUser(ctx context.Context, user *models.User) error
+	RestoreUser(ctx context.Context, user *models.User) error
 	//* Delete
-	DeleteUser(ctx context.Context, id string) error
+	DeleteUser(ctx context.Context, user *models.User) error
+	PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error)
 
 	//* Property changes related methods:
 	//* Standard REST API
@@ -29,43 +45,396 @@ type DatabaseRepository interface {
 	//* Read
 	ListPropertyChangesByUserId(ctx context.Context, id string, pageInfo *models.PageInfo) ([]*models.PropertyChange, *models.PageInfo, error)
 	ListPropertyChangesByUserIdAndName(ctx context.Context, id, name string, pageInfo *models.PageInfo) ([]*models.PropertyChange, *models.PageInfo, error)
+
+	//* Password reset tokens related methods:
+	//* Create
+	InsertPasswordResetToken(ctx context.Context, passwordResetToken *models.PasswordResetToken) error
+	//* Read
+	GetPasswordResetTokenByHash(ctx context.Context, tokenHash string) (*models.PasswordResetToken, error)
+	//* Update
+	UpdatePasswordResetToken(ctx context.Context, passwordResetToken *models.PasswordResetToken) error
+	UsePasswordResetTokensByUserId(ctx context.Context, userId string, usedAt time.Time) error
+
+	//* Email verification tokens related methods:
+	//* Create
+	InsertEmailVerificationToken(ctx context.Context, emailVerificationToken *models.EmailVerificationToken) error
+	//* Read
+	GetEmailVerificationTokenByHash(ctx context.Context, tokenHash string) (*models.EmailVerificationToken, error)
+	//* Update
+	UpdateEmailVerificationToken(ctx context.Context, emailVerificationToken *models.EmailVerificationToken) error
+
+	//* Refresh tokens related methods:
+	//* Create
+	InsertRefreshToken(ctx context.Context, refreshToken *models.RefreshToken) error
+	//* Read
+	GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error)
+	//* Update
+	UpdateRefreshToken(ctx context.Context, refreshToken *models.RefreshToken) error
+	RevokeRefreshTokenFamily(ctx context.Context, familyId string, revokedAt time.Time) error
+	RevokeRefreshTokensByUserId(ctx context.Context, userId string, revokedAt time.Time) error
+
+	//* Access tokens revocation related methods:
+	//* Create
+	InsertRevokedToken(ctx context.Context, revokedToken *models.RevokedToken) error
+	//* Read
+	IsTokenRevoked(ctx context.Context, tokenId string) (bool, error)
+	GetUserTokensRevokedBefore(ctx context.Context, userId string) (time.Time, error)
+	//* Update
+	SetUserTokensRevokedBefore(ctx context.Context, userId string, revokedBefore time.Time) error
+
+	//* MFA related methods:
+	//* Create
+	UpsertUserMfa(ctx context.Context, userMfa *models.UserMfa) error
+	InsertRecoveryCode(ctx context.Context, recoveryCode *models.RecoveryCode) error
+	//* Read
+	GetUserMfaByUserId(ctx context.Context, userId string) (*models.UserMfa, error)
+	GetRecoveryCodeByUserIdAndHash(ctx context.Context, userId, codeHash string) (*models.RecoveryCode, error)
+	//* Update
+	UpdateUserMfa(ctx context.Context, userMfa *models.UserMfa) error
+	UpdateRecoveryCode(ctx context.Context, recoveryCode *models.RecoveryCode) error
+	//* Delete
+	DeleteUserMfa(ctx context.Context, userId string) error
+	DeleteRecoveryCodesByUserId(ctx context.Context, userId string) error
+
+	//* WebAuthn related methods:
+	//* Create
+	InsertWebAuthnCredential(ctx context.Context, credential *models.WebAuthnCredential) error
+	InsertWebAuthnChallenge(ctx context.Context, challenge *models.WebAuthnChallenge) error
+	//* Read
+	GetWebAuthnCredentialById(ctx context.Context, id string) (*models.WebAuthnCredential, error)
+	ListWebAuthnCredentialsByUserId(ctx context.Context, userId string) ([]*models.WebAuthnCredential, error)
+	GetWebAuthnChallengeById(ctx context.Context, id string) (*models.WebAuthnChallenge, error)
+	//* Update
+	UpdateWebAuthnCredential(ctx context.Context, credential *models.WebAuthnCredential) error
+	UpdateWebAuthnChallenge(ctx context.Context, challenge *models.WebAuthnChallenge) error
+
+	//* Signing keys related methods:
+	//* Create
+	InsertSigningKey(ctx context.Context, signingKey *models.SigningKey) error
+	//* Read
+	ListSigningKeys(ctx context.Context, retiredAfter time.Time) ([]*models.SigningKey, error)
+	//* Update
+	UpdateSigningKey(ctx context.Context, signingKey *models.SigningKey) error
+
+	//* OAuth related methods:
+	//* Create
+	InsertOAuthClient(ctx context.Context, client *models.OAuthClient) error
+	InsertOAuthAuthorizationCode(ctx context.Context, code *models.OAuthAuthorizationCode) error
+	UpsertOAuthConsent(ctx context.Context, consent *models.OAuthConsent) error
+	//* Read
+	GetOAuthClientById(ctx context.Context, id string) (*models.OAuthClient, error)
+	ListOAuthClientsByCreator(ctx context.Context, createdBy string) ([]*models.OAuthClient, error)
+	GetOAuthAuthorizationCodeByHash(ctx context.Context, codeHash string) (*models.OAuthAuthorizationCode, error)
+	GetOAuthConsent(ctx context.Context, userId, clientId string) (*models.OAuthConsent, error)
+	//* Update
+	UpdateOAuthAuthorizationCode(ctx context.Context, code *models.OAuthAuthorizationCode) error
+
+	//* OAuth device authorization related methods:
+	//* Create
+	InsertOAuthDeviceCode(ctx context.Context, deviceCode *models.OAuthDeviceCode) error
+	//* Read
+	GetOAuthDeviceCodeByDeviceCodeHash(ctx context.Context, deviceCodeHash string) (*models.OAuthDeviceCode, error)
+	GetOAuthDeviceCodeByUserCodeHash(ctx context.Context, userCodeHash string) (*models.OAuthDeviceCode, error)
+	//* Update
+	UpdateOAuthDeviceCode(ctx context.Context, deviceCode *models.OAuthDeviceCode) error
+	UpdateOAuthDeviceCodePolling(ctx context.Context, deviceCode *models.OAuthDeviceCode) error
+
+	//* API keys related methods:
+	//* Create
+	InsertApiKey(ctx context.Context, apiKey *models.ApiKey) error
+	//* Read
+	GetApiKeyByPrefix(ctx context.Context, prefix string) (*models.ApiKey, error)
+	ListApiKeysByUserId(ctx context.Context, userId string) ([]*models.ApiKey, error)
+	//* Update
+	UpdateApiKeyLastUsedAt(ctx context.Context, id string, lastUsedAt time.Time) error
+	RevokeApiKey(ctx context.Context, id, userId string, revokedAt time.Time) (bool, error)
+
+	//* Roles and permissions related methods:
+	//* Create
+	InsertRole(ctx context.Context, role *models.Role) error
+	InsertUserRole(ctx context.Context, userRole *models.UserRole) (bool, error)
+	//* Read
+	GetRoleById(ctx context.Context, id string) (*models.Role, error)
+	ListRoles(ctx context.Context) ([]*models.Role, error)
+	ListRolesByUserId(ctx context.Context, userId string) ([]*models.Role, error)
+	ListPermissions(ctx context.Context) ([]*models.Permission, error)
+	//* Delete
+	DeleteUserRole(ctx context.Context, userId, roleId string) (bool, error)
+
+	//* Login throttles related methods:
+	//* Read
+	GetLoginThrottle(ctx context.Context, key string) (*models.LoginThrottle, error)
+	//* Update
+	RegisterLoginFailure(ctx context.Context, key string, failedAt, windowStart time.Time) (*models.LoginThrottle, error)
+	LockLoginThrottle(ctx context.Context, key string, lockedUntil time.Time) error
+	//* Delete
+	DeleteLoginThrottle(ctx context.Context, key string) error
 }
 
 var dbrImplementation DatabaseRepository
 
+type transactionKey struct{}
+
 func SetDatabaseRepository(dbr DatabaseRepository) {
 	dbrImplementation = dbr
 }
+func repository(ctx context.Context) DatabaseRepository {
+	//* Dentro de 'RunInTransaction', el contexto lleva el repositorio ligado a la transacción.
+	if dbr, ok := ctx.Value(transactionKey{}).(DatabaseRepository); ok {
+		return dbr
+	}
+	return dbrImplementation
+}
 
 func CloseDatabaseConnection() error {
 	return dbrImplementation.CloseDatabaseConnection()
 }
 
+func RunInTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	//* Todas las llamadas a este paquete que usen el contexto recibido por 'fn' forman parte de la transacción.
+	return repository(ctx).RunInTransaction(ctx, func(dbr DatabaseRepository) error {
+		return fn(context.WithValue(ctx, transactionKey{}, dbr))
+	})
+}
+
 func InsertUser(ctx context.Context, user *models.User) error {
-	return dbrImplementation.InsertUser(ctx, user)
+	return repository(ctx).InsertUser(ctx, user)
 }
 func GetUserById(ctx context.Context, id string) (*models.User, error) {
-	return dbrImplementation.GetUserById(ctx, id)
+	return repository(ctx).GetUserById(ctx, id)
 }
 func GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
-	return dbrImplementation.GetUserByEmail(ctx, email)
+	return repository(ctx).GetUserByEmail(ctx, email)
+}
+func IsEmailInUse(ctx context.Context, email string) (bool, error) {
+	return repository(ctx).IsEmailInUse(ctx, email)
 }
 func ListUsers(ctx context.Context, pageInfo *models.PageInfo) ([]*models.User, *models.PageInfo, error) {
-	return dbrImplementation.ListUsers(ctx, pageInfo)
+	return repository(ctx).ListUsers(ctx, pageInfo)
+}
+func SearchUsersByEmail(ctx context.Context, search string, pageInfo *models.PageInfo) ([]*models.User, *models.PageInfo, error) {
+	return repository(ctx).SearchUsersByEmail(ctx, search, pageInfo)
 }
 func UpdateUser(ctx context.Context, user *models.User) error {
-	return dbrImplementation.UpdateUser(ctx, user)
+	return repository(ctx).UpdateUser(ctx, user)
+}
+func RestoreUser(ctx context.Context, user *models.User) error {
+	return repository(ctx).RestoreUser(ctx, user)
+}
+func DeleteUser(ctx context.Context, user *models.User) error {
+	return repository(ctx).DeleteUser(ctx, user)
 }
-func DeleteUser(ctx context.Context, id string) error {
-	return dbrImplementation.DeleteUser(ctx, id)
+func PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	return repository(ctx).PurgeDeletedUsers(ctx, deletedBefore)
 }
 
 func InsertPropertyChangeLog(ctx context.Context, propertyChange *models.PropertyChange) error {
-	return dbrImplementation.InsertPropertyChangeLog(ctx, propertyChange)
+	return repository(ctx).InsertPropertyChangeLog(ctx, propertyChange)
 }
 func ListPropertyChangesByUserId(ctx context.Context, id string, pageInfo *models.PageInfo) ([]*models.PropertyChange, *models.PageInfo, error) {
-	return dbrImplementation.ListPropertyChangesByUserId(ctx, id, pageInfo)
+	return repository(ctx).ListPropertyChangesByUserId(ctx, id, pageInfo)
 }
 func ListPropertyChangesByUserIdAndName(ctx context.Context, id, name string, pageInfo *models.PageInfo) ([]*models.PropertyChange, *models.PageInfo, error) {
-	return dbrImplementation.ListPropertyChangesByUserIdAndName(ctx, id, name, pageInfo)
+	return repository(ctx).ListPropertyChangesByUserIdAndName(ctx, id, name, pageInfo)
+}
+
+func InsertPasswordResetToken(ctx context.Context, passwordResetToken *models.PasswordResetToken) error {
+	return repository(ctx).InsertPasswordResetToken(ctx, passwordResetToken)
+}
+func GetPasswordResetTokenByHash(ctx context.Context, tokenHash string) (*models.PasswordResetToken, error) {
+	return repository(ctx).GetPasswordResetTokenByHash(ctx, tokenHash)
+}
+func UpdatePasswordResetToken(ctx context.Context, passwordResetToken *models.PasswordResetToken) error {
+	return repository(ctx).UpdatePasswordResetToken(ctx, passwordResetToken)
+}
+func UsePasswordResetTokensByUserId(ctx context.Context, userId string, usedAt time.Time) error {
+	return repository(ctx).UsePasswordResetTokensByUserId(ctx, userId, usedAt)
+}
+
+func InsertEmailVerificationToken(ctx context.Context, emailVerificationToken *models.EmailVerificationToken) error {
+	return repository(ctx).InsertEmailVerificationToken(ctx, emailVerificationToken)
+}
+func GetEmailVerificationTokenByHash(ctx context.Context, tokenHash string) (*models.EmailVerificationToken, error) {
+	return repository(ctx).GetEmailVerificationTokenByHash(ctx, tokenHash)
+}
+func UpdateEmailVerificationToken(ctx context.Context, emailVerificationToken *models.EmailVerificationToken) error {
+	return repository(ctx).UpdateEmailVerificationToken(ctx, emailVerificationToken)
+}
+
+func InsertRefreshToken(ctx context.Context, refreshToken *models.RefreshToken) error {
+	return repository(ctx).InsertRefreshToken(ctx, refreshToken)
+}
+func GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	return repository(ctx).GetRefreshTokenByHash(ctx, tokenHash)
+}
+func UpdateRefreshToken(ctx context.Context, refreshToken *models.RefreshToken) error {
+	return repository(ctx).UpdateRefreshToken(ctx, refreshToken)
+}
+func RevokeRefreshTokenFamily(ctx context.Context, familyId string, revokedAt time.Time) error {
+	return repository(ctx).RevokeRefreshTokenFamily(ctx, familyId, revokedAt)
+}
+func RevokeRefreshTokensByUserId(ctx context.Context, userId string, revokedAt time.Time) error {
+	return repository(ctx).RevokeRefreshTokensByUserId(ctx, userId, revokedAt)
+}
+
+func InsertRevokedToken(ctx context.Context, revokedToken *models.RevokedToken) error {
+	return repository(ctx).InsertRevokedToken(ctx, revokedToken)
+}
+func IsTokenRevoked(ctx context.Context, tokenId string) (bool, error) {
+	return repository(ctx).IsTokenRevoked(ctx, tokenId)
+}
+func GetUserTokensRevokedBefore(ctx context.Context, userId string) (time.Time, error) {
+	return repository(ctx).GetUserTokensRevokedBefore(ctx, userId)
+}
+func SetUserTokensRevokedBefore(ctx context.Context, userId string, revokedBefore time.Time) error {
+	return repository(ctx).SetUserTokensRevokedBefore(ctx, userId, revokedBefore)
+}
+
+func UpsertUserMfa(ctx context.Context, userMfa *models.UserMfa) error {
+	return repository(ctx).UpsertUserMfa(ctx, userMfa)
+}
+func InsertRecoveryCode(ctx context.Context, recoveryCode *models.RecoveryCode) error {
+	return repository(ctx).InsertRecoveryCode(ctx, recoveryCode)
+}
+func GetUserMfaByUserId(ctx context.Context, userId string) (*models.UserMfa, error) {
+	return repository(ctx).GetUserMfaByUserId(ctx, userId)
+}
+func GetRecoveryCodeByUserIdAndHash(ctx context.Context, userId, codeHash string) (*models.RecoveryCode, error) {
+	return repository(ctx).GetRecoveryCodeByUserIdAndHash(ctx, userId, codeHash)
+}
+func UpdateUserMfa(ctx context.Context, userMfa *models.UserMfa) error {
+	return repository(ctx).UpdateUserMfa(ctx, userMfa)
+}
+func UpdateRecoveryCode(ctx context.Context, recoveryCode *models.RecoveryCode) error {
+	return repository(ctx).UpdateRecoveryCode(ctx, recoveryCode)
+}
+func DeleteUserMfa(ctx context.Context, userId string) error {
+	return repository(ctx).DeleteUserMfa(ctx, userId)
+}
+func DeleteRecoveryCodesByUserId(ctx context.Context, userId string) error {
+	return repository(ctx).DeleteRecoveryCodesByUserId(ctx, userId)
+}
+
+func InsertWebAuthnCredential(ctx context.Context, credential *models.WebAuthnCredential) error {
+	return repository(ctx).InsertWebAuthnCredential(ctx, credential)
+}
+func InsertWebAuthnChallenge(ctx context.Context, challenge *models.WebAuthnChallenge) error {
+	return repository(ctx).InsertWebAuthnChallenge(ctx, challenge)
+}
+func GetWebAuthnCredentialById(ctx context.Context, id string) (*models.WebAuthnCredential, error) {
+	return repository(ctx).GetWebAuthnCredentialById(ctx, id)
+}
+func ListWebAuthnCredentialsByUserId(ctx context.Context, userId string) ([]*models.WebAuthnCredential, error) {
+	return repository(ctx).ListWebAuthnCredentialsByUserId(ctx, userId)
+}
+func GetWebAuthnChallengeById(ctx context.Context, id string) (*models.WebAuthnChallenge, error) {
+	return repository(ctx).GetWebAuthnChallengeById(ctx, id)
+}
+func UpdateWebAuthnCredential(ctx context.Context, credential *models.WebAuthnCredential) error {
+	return repository(ctx).UpdateWebAuthnCredential(ctx, credential)
+}
+func UpdateWebAuthnChallenge(ctx context.Context, challenge *models.WebAuthnChallenge) error {
+	return repository(ctx).UpdateWebAuthnChallenge(ctx, challenge)
+}
+
+func InsertSigningKey(ctx context.Context, signingKey *models.SigningKey) error {
+	return repository(ctx).InsertSigningKey(ctx, signingKey)
+}
+func ListSigningKeys(ctx context.Context, retiredAfter time.Time) ([]*models.SigningKey, error) {
+	return repository(ctx).ListSigningKeys(ctx, retiredAfter)
+}
+func UpdateSigningKey(ctx context.Context, signingKey *models.SigningKey) error {
+	return repository(ctx).UpdateSigningKey(ctx, signingKey)
+}
+
+func InsertOAuthClient(ctx context.Context, client *models.OAuthClient) error {
+	return repository(ctx).InsertOAuthClient(ctx, client)
+}
+func InsertOAuthAuthorizationCode(ctx context.Context, code *models.OAuthAuthorizationCode) error {
+	return repository(ctx).InsertOAuthAuthorizationCode(ctx, code)
+}
+func UpsertOAuthConsent(ctx context.Context, consent *models.OAuthConsent) error {
+	return repository(ctx).UpsertOAuthConsent(ctx, consent)
+}
+func GetOAuthClientById(ctx context.Context, id string) (*models.OAuthClient, error) {
+	return repository(ctx).GetOAuthClientById(ctx, id)
+}
+func ListOAuthClientsByCreator(ctx context.Context, createdBy string) ([]*models.OAuthClient, error) {
+	return repository(ctx).ListOAuthClientsByCreator(ctx, createdBy)
+}
+func GetOAuthAuthorizationCodeByHash(ctx context.Context, codeHash string) (*models.OAuthAuthorizationCode, error) {
+	return repository(ctx).GetOAuthAuthorizationCodeByHash(ctx, codeHash)
+}
+func GetOAuthConsent(ctx context.Context, userId, clientId string) (*models.OAuthConsent, error) {
+	return repository(ctx).GetOAuthConsent(ctx, userId, clientId)
+}
+func UpdateOAuthAuthorizationCode(ctx context.Context, code *models.OAuthAuthorizationCode) error {
+	return repository(ctx).UpdateOAuthAuthorizationCode(ctx, code)
+}
+
+func InsertOAuthDeviceCode(ctx context.Context, deviceCode *models.OAuthDeviceCode) error {
+	return repository(ctx).InsertOAuthDeviceCode(ctx, deviceCode)
+}
+func GetOAuthDeviceCodeByDeviceCodeHash(ctx context.Context, deviceCodeHash string) (*models.OAuthDeviceCode, error) {
+	return repository(ctx).GetOAuthDeviceCodeByDeviceCodeHash(ctx, deviceCodeHash)
+}
+func GetOAuthDeviceCodeByUserCodeHash(ctx context.Context, userCodeHash string) (*models.OAuthDeviceCode, error) {
+	return repository(ctx).GetOAuthDeviceCodeByUserCodeHash(ctx, userCodeHash)
+}
+func UpdateOAuthDeviceCode(ctx context.Context, deviceCode *models.OAuthDeviceCode) error {
+	return repository(ctx).UpdateOAuthDeviceCode(ctx, deviceCode)
+}
+func UpdateOAuthDeviceCodePolling(ctx context.Context, deviceCode *models.OAuthDeviceCode) error {
+	return repository(ctx).UpdateOAuthDeviceCodePolling(ctx, deviceCode)
+}
+
+func InsertApiKey(ctx context.Context, apiKey *models.ApiKey) error {
+	return repository(ctx).InsertApiKey(ctx, apiKey)
+}
+func GetApiKeyByPrefix(ctx context.Context, prefix string) (*models.ApiKey, error) {
+	return repository(ctx).GetApiKeyByPrefix(ctx, prefix)
+}
+func ListApiKeysByUserId(ctx context.Context, userId string) ([]*models.ApiKey, error) {
+	return repository(ctx).ListApiKeysByUserId(ctx, userId)
+}
+func UpdateApiKeyLastUsedAt(ctx context.Context, id string, lastUsedAt time.Time) error {
+	return repository(ctx).UpdateApiKeyLastUsedAt(ctx, id, lastUsedAt)
+}
+func RevokeApiKey(ctx context.Context, id, userId string, revokedAt time.Time) (bool, error) {
+	return repository(ctx).RevokeApiKey(ctx, id, userId, revokedAt)
+}
+
+func InsertRole(ctx context.Context, role *models.Role) error {
+	return repository(ctx).InsertRole(ctx, role)
+}
+func InsertUserRole(ctx context.Context, userRole *models.UserRole) (bool, error) {
+	return repository(ctx).InsertUserRole(ctx, userRole)
+}
+func GetRoleById(ctx context.Context, id string) (*models.Role, error) {
+	return repository(ctx).GetRoleById(ctx, id)
+}
+func ListRoles(ctx context.Context) ([]*models.Role, error) {
+	return repository(ctx).ListRoles(ctx)
+}
+func ListRolesByUserId(ctx context.Context, userId string) ([]*models.Role, error) {
+	return repository(ctx).ListRolesByUserId(ctx, userId)
+}
+func ListPermissions(ctx context.Context) ([]*models.Permission, error) {
+	return repository(ctx).ListPermissions(ctx)
+}
+func DeleteUserRole(ctx context.Context, userId, roleId string) (bool, error) {
+	return repository(ctx).DeleteUserRole(ctx, userId, roleId)
+}
+
+func GetLoginThrottle(ctx context.Context, key string) (*models.LoginThrottle, error) {
+	return repository(ctx).GetLoginThrottle(ctx, key)
+}
+func RegisterLoginFailure(ctx context.Context, key string, failedAt, windowStart time.Time) (*models.LoginThrottle, error) {
+	return repository(ctx).RegisterLoginFailure(ctx, key, failedAt, windowStart)
+}
+func LockLoginThrottle(ctx context.Context, key string, lockedUntil time.Time) error {
+	return repository(ctx).LockLoginThrottle(ctx, key, lockedUntil)
+}
+func DeleteLoginThrottle(ctx context.Context, key string) error {
+	return repository(ctx).DeleteLoginThrottle(ctx, key)
 }
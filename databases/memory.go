@@ -0,0 +1,1348 @@
+package databases
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aerodinamicat/thisisme02/models"
+)
+
+var (
+	//* Equivalentes a las restricciones 'UNIQUE' y 'FOREIGN KEY' del esquema de Postgres.
+	ErrDuplicateKey      = errors.New("duplicate key value violates unique constraint")
+	ErrUnknownReference  = errors.New("referenced row does not exist")
+	ErrNegativePageToken = errors.New("page token must be greater than zero")
+)
+
+type consentKey struct {
+	UserId   string
+	ClientId string
+}
+type userRoleKey struct {
+	UserId string
+	RoleId string
+}
+
+type memoryStore struct {
+	//* Cada tabla guarda valores, no punteros: así copiar los mapas basta para tomar una instantánea.
+	users                   map[string]models.User
+	propertyChanges         []models.PropertyChange
+	passwordResetTokens     map[string]models.PasswordResetToken
+	emailVerificationTokens map[string]models.EmailVerificationToken
+	refreshTokens           map[string]models.RefreshToken
+	revokedTokens           map[string]models.RevokedToken
+	tokensRevocations       map[string]time.Time
+	userMfas                map[string]models.UserMfa
+	recoveryCodes           map[string]models.RecoveryCode
+	webAuthnCredentials     map[string]models.WebAuthnCredential
+	webAuthnChallenges      map[string]models.WebAuthnChallenge
+	signingKeys             map[string]models.SigningKey
+	oauthClients            map[string]models.OAuthClient
+	oauthAuthorizationCodes map[string]models.OAuthAuthorizationCode
+	oauthConsents           map[consentKey]models.OAuthConsent
+	oauthDeviceCodes        map[string]models.OAuthDeviceCode
+	apiKeys                 map[string]models.ApiKey
+	permissions             map[string]models.Permission
+	roles                   map[string]models.Role
+	userRoles               map[userRoleKey]models.UserRole
+	loginThrottles          map[string]models.LoginThrottle
+}
+
+type MemoryImplementation struct {
+	mutex *sync.RWMutex
+	store *memoryStore
+	//* Sólo en los repositorios creados por 'RunInTransaction', que ya tienen el cerrojo.
+	inTransaction bool
+}
+
+func NewMemoryImplementation() *MemoryImplementation {
+	store := &memoryStore{
+		users:                   map[string]models.User{},
+		passwordResetTokens:     map[string]models.PasswordResetToken{},
+		emailVerificationTokens: map[string]models.EmailVerificationToken{},
+		refreshTokens:           map[string]models.RefreshToken{},
+		revokedTokens:           map[string]models.RevokedToken{},
+		tokensRevocations:       map[string]time.Time{},
+		userMfas:                map[string]models.UserMfa{},
+		recoveryCodes:           map[string]models.RecoveryCode{},
+		webAuthnCredentials:     map[string]models.WebAuthnCredential{},
+		webAuthnChallenges:      map[string]models.WebAuthnChallenge{},
+		signingKeys:             map[string]models.SigningKey{},
+		oauthClients:            map[string]models.OAuthClient{},
+		oauthAuthorizationCodes: map[string]models.OAuthAuthorizationCode{},
+		oauthConsents:           map[consentKey]models.OAuthConsent{},
+		oauthDeviceCodes:        map[string]models.OAuthDeviceCode{},
+		apiKeys:                 map[string]models.ApiKey{},
+		permissions:             map[string]models.Permission{},
+		roles:                   map[string]models.Role{},
+		userRoles:               map[userRoleKey]models.UserRole{},
+		loginThrottles:          map[string]models.LoginThrottle{},
+	}
+
+	//* Los mismos permisos y rol de administrador con los que las migraciones siembran la DB.
+	store.permissions["clients:manage"] = models.Permission{Name: "clients:manage", Description: "Register confidential and privileged OAuth clients"}
+	store.permissions["roles:manage"] = models.Permission{Name: "roles:manage", Description: "Create roles and assign them to users"}
+	store.permissions["users:manage"] = models.Permission{Name: "users:manage", Description: "List, disable and delete user accounts"}
+	store.roles["admin"] = models.Role{
+		Id:          "admin",
+		Name:        "admin",
+		Description: "Full administrative access",
+		Permissions: []string{"clients:manage", "roles:manage", "users:manage"},
+		CreatedAt:   time.Now(),
+		CreatedBy:   "system",
+	}
+
+	return &MemoryImplementation{
+		mutex: &sync.RWMutex{},
+		store: store,
+	}
+}
+
+func (mem *MemoryImplementation) CloseDatabaseConnection() error {
+	return nil
+}
+
+func cloneMap[K comparable, V any](m map[K]V) map[K]V {
+	clone := make(map[K]V, len(m))
+	for key, value := range m {
+		clone[key] = value
+	}
+	return clone
+}
+func cloneList(list []string) []string {
+	//* Las listas nunca se comparten con quien llama, para que no pueda modificar la DB por accidente.
+	if len(list) == 0 {
+		return nil
+	}
+	return append([]string(nil), list...)
+}
+func cloneBytes(bytes []byte) []byte {
+	if bytes == nil {
+		return nil
+	}
+	return append([]byte(nil), bytes...)
+}
+func (store *memoryStore) snapshot() *memoryStore {
+	return &memoryStore{
+		users:                   cloneMap(store.users),
+		propertyChanges:         append([]models.PropertyChange(nil), store.propertyChanges...),
+		passwordResetTokens:     cloneMap(store.passwordResetTokens),
+		emailVerificationTokens: cloneMap(store.emailVerificationTokens),
+		refreshTokens:           cloneMap(store.refreshTokens),
+		revokedTokens:           cloneMap(store.revokedTokens),
+		tokensRevocations:       cloneMap(store.tokensRevocations),
+		userMfas:                cloneMap(store.userMfas),
+		recoveryCodes:           cloneMap(store.recoveryCodes),
+		webAuthnCredentials:     cloneMap(store.webAuthnCredentials),
+		webAuthnChallenges:      cloneMap(store.webAuthnChallenges),
+		signingKeys:             cloneMap(store.signingKeys),
+		oauthClients:            cloneMap(store.oauthClients),
+		oauthAuthorizationCodes: cloneMap(store.oauthAuthorizationCodes),
+		oauthConsents:           cloneMap(store.oauthConsents),
+		oauthDeviceCodes:        cloneMap(store.oauthDeviceCodes),
+		apiKeys:                 cloneMap(store.apiKeys),
+		permissions:             cloneMap(store.permissions),
+		roles:                   cloneMap(store.roles),
+		userRoles:               cloneMap(store.userRoles),
+		loginThrottles:          cloneMap(store.loginThrottles),
+	}
+}
+
+func (mem *MemoryImplementation) lock() func() {
+	//* Dentro de una transacción el cerrojo ya está tomado.
+	if mem.inTransaction {
+		return func() {}
+	}
+	mem.mutex.Lock()
+	return mem.mutex.Unlock
+}
+func (mem *MemoryImplementation) rlock() func() {
+	if mem.inTransaction {
+		return func() {}
+	}
+	mem.mutex.RLock()
+	return mem.mutex.RUnlock
+}
+func (mem *MemoryImplementation) RunInTransaction(ctx context.Context, fn func(dbr DatabaseRepository) error) (err error) {
+	//* Las transacciones anidadas se integran en la que ya está en curso.
+	if mem.inTransaction {
+		return fn(mem)
+	}
+
+	//* La transacción tiene la DB para ella sola hasta que termina.
+	mem.mutex.Lock()
+	defer mem.mutex.Unlock()
+
+	//* Si 'fn' falla o entra en pánico, restauramos la instantánea tomada al empezar.
+	snapshot := mem.store.snapshot()
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			*mem.store = *snapshot
+			panic(recovered)
+		}
+		if err != nil {
+			*mem.store = *snapshot
+		}
+	}()
+
+	txRepository := *mem
+	txRepository.inTransaction = true
+	return fn(&txRepository)
+}
+
+func paginate(pageInfo *models.PageInfo, totalItems int) (int, int, error) {
+	//* Si 'pageInfo' no tiene valores, lo poblamos igual que en Postgres.
+	pageInfo.OrderBy = DEFAULT_ORDER_BY
+	if pageInfo.Size == 0 {
+		pageInfo.Size = DEFAULT_PAGE_SIZE
+	}
+
+	if pageInfo.TotalPages == 0 || pageInfo.TotalItems == 0 {
+		pageInfo.TotalItems = totalItems
+
+		//* Calculamos el total de páginas en función del número de elementos por cada una.
+		pageInfo.TotalPages = pageInfo.TotalItems / pageInfo.Size
+		//* Si los elementos no caben en un total de páginas exacto, añadimos una página mas.
+		if pageInfo.TotalItems%pageInfo.Size != 0 {
+			pageInfo.TotalPages++
+		}
+		pageInfo.Token = 1
+	}
+
+	//* Calculamos el tramo de la página pedida, limitado a los elementos existentes.
+	offset := (pageInfo.Token - 1) * pageInfo.Size
+	if offset < 0 || pageInfo.Size < 0 {
+		pageInfo.TotalPages = 0
+		pageInfo.TotalItems = 0
+
+		return 0, 0, ErrNegativePageToken
+	}
+	if offset > totalItems {
+		offset = totalItems
+	}
+	end := offset + pageInfo.Size
+	if end > totalItems {
+		end = totalItems
+	}
+
+	//* Actualizamos 'pageInfo' y la preparamos para la siguiente iteración, si la hubiera.
+	pageInfo.Token++
+
+	return offset, end, nil
+}
+
+func (mem *MemoryImplementation) InsertUser(ctx context.Context, user *models.User) error {
+	defer mem.lock()()
+
+	//* Tanto el 'id' como el 'email' son únicos, también entre los 'user' eliminados.
+	if _, ok := mem.store.users[user.Id]; ok {
+		return ErrDuplicateKey
+	}
+	for _, storedUser := range mem.store.users {
+		if storedUser.Email == user.Email {
+			return ErrDuplicateKey
+		}
+	}
+
+	storedUser := *user
+	storedUser.DisabledAt = time.Time{}
+	storedUser.DeletedAt = time.Time{}
+	storedUser.DeletedBy = ""
+	mem.store.users[user.Id] = storedUser
+
+	return nil
+}
+func (mem *MemoryImplementation) GetUserById(ctx context.Context, id string) (*models.User, error) {
+	defer mem.rlock()()
+
+	//* Como en Postgres, si no hay coincidencias devolvemos un 'user' vacío.
+	user := mem.store.users[id]
+	return &user, nil
+}
+func (mem *MemoryImplementation) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	defer mem.rlock()()
+
+	for _, user := range mem.store.users {
+		if user.Email == email && user.DeletedAt.IsZero() {
+			return &user, nil
+		}
+	}
+	return new(models.User), nil
+}
+func (mem *MemoryImplementation) IsEmailInUse(ctx context.Context, email string) (bool, error) {
+	defer mem.rlock()()
+
+	//* Cuenta también los 'user' eliminados: su 'email' sigue reservado hasta que se purgan.
+	for _, user := range mem.store.users {
+		if user.Email == email {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+func (mem *MemoryImplementation) ListUsers(ctx context.Context, pageInfo *models.PageInfo) ([]*models.User, *models.PageInfo, error) {
+	return mem.listUsers(func(user models.User) bool { return true }, pageInfo)
+}
+func (mem *MemoryImplementation) SearchUsersByEmail(ctx context.Context, search string, pageInfo *models.PageInfo) ([]*models.User, *models.PageInfo, error) {
+	//* Igual que 'ILIKE', sin distinguir mayúsculas y buscando 'search' literalmente.
+	search = strings.ToLower(search)
+	return mem.listUsers(func(user models.User) bool {
+		return strings.Contains(strings.ToLower(user.Email), search)
+	}, pageInfo)
+}
+func (mem *MemoryImplementation) listUsers(match func(user models.User) bool, pageInfo *models.PageInfo) ([]*models.User, *models.PageInfo, error) {
+	defer mem.rlock()()
+
+	//* Filtramos y ordenamos como 'DEFAULT_ORDER_BY', desempatando por 'id'.
+	var matches []models.User
+	for _, user := range mem.store.users {
+		if match(user) {
+			matches = append(matches, user)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if !matches[i].CreatedAt.Equal(matches[j].CreatedAt) {
+			return matches[i].CreatedAt.After(matches[j].CreatedAt)
+		}
+		return matches[i].Id < matches[j].Id
+	})
+
+	offset, end, err := paginate(pageInfo, len(matches))
+	if err != nil {
+		return nil, pageInfo, err
+	}
+	var users []*models.User
+	for i := offset; i < end; i++ {
+		user := matches[i]
+		users = append(users, &user)
+	}
+
+	return users, pageInfo, nil
+}
+func (mem *MemoryImplementation) UpdateUser(ctx context.Context, user *models.User) error {
+	defer mem.lock()()
+
+	storedUser, ok := mem.store.users[user.Id]
+	if !ok {
+		return nil
+	}
+	for _, otherUser := range mem.store.users {
+		if otherUser.Id != user.Id && otherUser.Email == user.Email {
+			return ErrDuplicateKey
+		}
+	}
+
+	storedUser.Email = user.Email
+	storedUser.EmailVerifiedAt = user.EmailVerifiedAt
+	storedUser.Password = user.Password
+	storedUser.DisabledAt = user.DisabledAt
+	storedUser.UpdatedAt = user.UpdatedAt
+	storedUser.UpdatedBy = user.UpdatedBy
+	mem.store.users[user.Id] = storedUser
+
+	return nil
+}
+func (mem *MemoryImplementation) RestoreUser(ctx context.Context, user *models.User) error {
+	defer mem.lock()()
+
+	storedUser, ok := mem.store.users[user.Id]
+	if !ok || storedUser.DeletedAt.IsZero() {
+		return nil
+	}
+	storedUser.DeletedAt = time.Time{}
+	storedUser.DeletedBy = ""
+	storedUser.UpdatedAt = user.UpdatedAt
+	storedUser.UpdatedBy = user.UpdatedBy
+	mem.store.users[user.Id] = storedUser
+
+	return nil
+}
+func (mem *MemoryImplementation) DeleteUser(ctx context.Context, user *models.User) error {
+	defer mem.lock()()
+
+	//* El 'user' se marca como eliminado hasta que 'PurgeDeletedUsers' lo borre definitivamente.
+	storedUser, ok := mem.store.users[user.Id]
+	if !ok || !storedUser.DeletedAt.IsZero() {
+		return nil
+	}
+	storedUser.DeletedAt = user.DeletedAt
+	storedUser.DeletedBy = user.DeletedBy
+	mem.store.users[user.Id] = storedUser
+
+	return nil
+}
+func (mem *MemoryImplementation) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	defer mem.lock()()
+
+	purged := map[string]bool{}
+	for id, user := range mem.store.users {
+		if !user.DeletedAt.IsZero() && user.DeletedAt.Before(deletedBefore) {
+			purged[id] = true
+			delete(mem.store.users, id)
+		}
+	}
+	if len(purged) == 0 {
+		return 0, nil
+	}
+
+	//* El historial se conserva, pero sin los valores, que contienen datos personales.
+	for i, propertyChange := range mem.store.propertyChanges {
+		if purged[propertyChange.UserId] {
+			propertyChange.From, propertyChange.To = "", ""
+			mem.store.propertyChanges[i] = propertyChange
+		}
+	}
+	//* Borramos en cascada todo lo demás que pertenece a los 'user' purgados, como 'ON DELETE CASCADE'.
+	for id, token := range mem.store.passwordResetTokens {
+		if purged[token.UserId] {
+			delete(mem.store.passwordResetTokens, id)
+		}
+	}
+	for id, token := range mem.store.emailVerificationTokens {
+		if purged[token.UserId] {
+			delete(mem.store.emailVerificationTokens, id)
+		}
+	}
+	for id, token := range mem.store.refreshTokens {
+		if purged[token.UserId] {
+			delete(mem.store.refreshTokens, id)
+		}
+	}
+	for id, token := range mem.store.revokedTokens {
+		if purged[token.UserId] {
+			delete(mem.store.revokedTokens, id)
+		}
+	}
+	for userId := range mem.store.tokensRevocations {
+		if purged[userId] {
+			delete(mem.store.tokensRevocations, userId)
+		}
+	}
+	for userId := range mem.store.userMfas {
+		if purged[userId] {
+			delete(mem.store.userMfas, userId)
+		}
+	}
+	for id, recoveryCode := range mem.store.recoveryCodes {
+		if purged[recoveryCode.UserId] {
+			delete(mem.store.recoveryCodes, id)
+		}
+	}
+	for id, credential := range mem.store.webAuthnCredentials {
+		if purged[credential.UserId] {
+			delete(mem.store.webAuthnCredentials, id)
+		}
+	}
+	for id, code := range mem.store.oauthAuthorizationCodes {
+		if purged[code.UserId] {
+			delete(mem.store.oauthAuthorizationCodes, id)
+		}
+	}
+	for key := range mem.store.oauthConsents {
+		if purged[key.UserId] {
+			delete(mem.store.oauthConsents, key)
+		}
+	}
+	for id, deviceCode := range mem.store.oauthDeviceCodes {
+		if purged[deviceCode.UserId] {
+			delete(mem.store.oauthDeviceCodes, id)
+		}
+	}
+	for id, apiKey := range mem.store.apiKeys {
+		if purged[apiKey.UserId] {
+			delete(mem.store.apiKeys, id)
+		}
+	}
+	for key := range mem.store.userRoles {
+		if purged[key.UserId] {
+			delete(mem.store.userRoles, key)
+		}
+	}
+
+	return int64(len(purged)), nil
+}
+
+func (mem *MemoryImplementation) InsertPropertyChangeLog(ctx context.Context, propertyChange *models.PropertyChange) error {
+	defer mem.lock()()
+
+	mem.store.propertyChanges = append(mem.store.propertyChanges, *propertyChange)
+
+	return nil
+}
+func (mem *MemoryImplementation) ListPropertyChangesByUserId(ctx context.Context, id string, pageInfo *models.PageInfo) ([]*models.PropertyChange, *models.PageInfo, error) {
+	return mem.listPropertyChanges(func(propertyChange models.PropertyChange) bool {
+		return propertyChange.UserId == id
+	}, pageInfo)
+}
+func (mem *MemoryImplementation) ListPropertyChangesByUserIdAndName(ctx context.Context, id, name string, pageInfo *models.PageInfo) ([]*models.PropertyChange, *models.PageInfo, error) {
+	return mem.listPropertyChanges(func(propertyChange models.PropertyChange) bool {
+		return propertyChange.UserId == id && propertyChange.Name == name
+	}, pageInfo)
+}
+func (mem *MemoryImplementation) listPropertyChanges(match func(propertyChange models.PropertyChange) bool, pageInfo *models.PageInfo) ([]*models.PropertyChange, *models.PageInfo, error) {
+	defer mem.rlock()()
+
+	//* Filtramos y ordenamos como 'DEFAULT_ORDER_BY'. Los cambios simultáneos conservan su orden de registro.
+	var matches []models.PropertyChange
+	for _, propertyChange := range mem.store.propertyChanges {
+		if match(propertyChange) {
+			matches = append(matches, propertyChange)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].CreatedAt.After(matches[j].CreatedAt)
+	})
+
+	offset, end, err := paginate(pageInfo, len(matches))
+	if err != nil {
+		return nil, pageInfo, err
+	}
+	var propertyChanges []*models.PropertyChange
+	for i := offset; i < end; i++ {
+		propertyChange := matches[i]
+		propertyChanges = append(propertyChanges, &propertyChange)
+	}
+
+	return propertyChanges, pageInfo, nil
+}
+
+func (mem *MemoryImplementation) InsertPasswordResetToken(ctx context.Context, passwordResetToken *models.PasswordResetToken) error {
+	defer mem.lock()()
+
+	for id, token := range mem.store.passwordResetTokens {
+		if id == passwordResetToken.Id || token.TokenHash == passwordResetToken.TokenHash {
+			return ErrDuplicateKey
+		}
+	}
+	storedToken := *passwordResetToken
+	storedToken.UsedAt = time.Time{}
+	mem.store.passwordResetTokens[passwordResetToken.Id] = storedToken
+
+	return nil
+}
+func (mem *MemoryImplementation) GetPasswordResetTokenByHash(ctx context.Context, tokenHash string) (*models.PasswordResetToken, error) {
+	defer mem.rlock()()
+
+	//* Si no hay coincidencias, devolvemos un 'token' nulo.
+	for _, token := range mem.store.passwordResetTokens {
+		if token.TokenHash == tokenHash {
+			return &token, nil
+		}
+	}
+	return nil, nil
+}
+func (mem *MemoryImplementation) UpdatePasswordResetToken(ctx context.Context, passwordResetToken *models.PasswordResetToken) error {
+	defer mem.lock()()
+
+	//* Sólo se marca como usado si no lo estaba ya, así un mismo 'token' no puede consumirse dos veces.
+	storedToken, ok := mem.store.passwordResetTokens[passwordResetToken.Id]
+	if !ok || !storedToken.UsedAt.IsZero() {
+		return ErrTokenAlreadyUsed
+	}
+	storedToken.UsedAt = passwordResetToken.UsedAt
+	mem.store.passwordResetTokens[passwordResetToken.Id] = storedToken
+
+	return nil
+}
+func (mem *MemoryImplementation) UsePasswordResetTokensByUserId(ctx context.Context, userId string, usedAt time.Time) error {
+	defer mem.lock()()
+
+	for id, token := range mem.store.passwordResetTokens {
+		if token.UserId == userId && token.UsedAt.IsZero() {
+			token.UsedAt = usedAt
+			mem.store.passwordResetTokens[id] = token
+		}
+	}
+
+	return nil
+}
+
+func (mem *MemoryImplementation) InsertEmailVerificationToken(ctx context.Context, emailVerificationToken *models.EmailVerificationToken) error {
+	defer mem.lock()()
+
+	for id, token := range mem.store.emailVerificationTokens {
+		if id == emailVerificationToken.Id || token.TokenHash == emailVerificationToken.TokenHash {
+			return ErrDuplicateKey
+		}
+	}
+	storedToken := *emailVerificationToken
+	storedToken.UsedAt = time.Time{}
+	mem.store.emailVerificationTokens[emailVerificationToken.Id] = storedToken
+
+	return nil
+}
+func (mem *MemoryImplementation) GetEmailVerificationTokenByHash(ctx context.Context, tokenHash string) (*models.EmailVerificationToken, error) {
+	defer mem.rlock()()
+
+	//* Si no hay coincidencias, devolvemos un 'token' nulo.
+	for _, token := range mem.store.emailVerificationTokens {
+		if token.TokenHash == tokenHash {
+			return &token, nil
+		}
+	}
+	return nil, nil
+}
+func (mem *MemoryImplementation) UpdateEmailVerificationToken(ctx context.Context, emailVerificationToken *models.EmailVerificationToken) error {
+	defer mem.lock()()
+
+	//* Sólo se marca como usado si no lo estaba ya, así un mismo 'token' no puede consumirse dos veces.
+	storedToken, ok := mem.store.emailVerificationTokens[emailVerificationToken.Id]
+	if !ok || !storedToken.UsedAt.IsZero() {
+		return ErrTokenAlreadyUsed
+	}
+	storedToken.UsedAt = emailVerificationToken.UsedAt
+	mem.store.emailVerificationTokens[emailVerificationToken.Id] = storedToken
+
+	return nil
+}
+
+func (mem *MemoryImplementation) InsertRefreshToken(ctx context.Context, refreshToken *models.RefreshToken) error {
+	defer mem.lock()()
+
+	for id, token := range mem.store.refreshTokens {
+		if id == refreshToken.Id || token.TokenHash == refreshToken.TokenHash {
+			return ErrDuplicateKey
+		}
+	}
+	storedToken := *refreshToken
+	storedToken.Scopes = cloneList(refreshToken.Scopes)
+	storedToken.UsedAt = time.Time{}
+	storedToken.RevokedAt = time.Time{}
+	mem.store.refreshTokens[refreshToken.Id] = storedToken
+
+	return nil
+}
+func (mem *MemoryImplementation) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	defer mem.rlock()()
+
+	//* Si no hay coincidencias, devolvemos un 'token' nulo.
+	for _, token := range mem.store.refreshTokens {
+		if token.TokenHash == tokenHash {
+			token.Scopes = cloneList(token.Scopes)
+			return &token, nil
+		}
+	}
+	return nil, nil
+}
+func (mem *MemoryImplementation) UpdateRefreshToken(ctx context.Context, refreshToken *models.RefreshToken) error {
+	defer mem.lock()()
+
+	//* Sólo se marca como usado si no lo estaba ya, así dos peticiones simultáneas no pueden rotar el mismo 'token'.
+	storedToken, ok := mem.store.refreshTokens[refreshToken.Id]
+	if !ok || !storedToken.UsedAt.IsZero() {
+		return ErrTokenAlreadyUsed
+	}
+	storedToken.UsedAt = refreshToken.UsedAt
+	mem.store.refreshTokens[refreshToken.Id] = storedToken
+
+	return nil
+}
+func (mem *MemoryImplementation) RevokeRefreshTokenFamily(ctx context.Context, familyId string, revokedAt time.Time) error {
+	defer mem.lock()()
+
+	for id, token := range mem.store.refreshTokens {
+		if token.FamilyId == familyId && token.RevokedAt.IsZero() {
+			token.RevokedAt = revokedAt
+			mem.store.refreshTokens[id] = token
+		}
+	}
+
+	return nil
+}
+func (mem *MemoryImplementation) RevokeRefreshTokensByUserId(ctx context.Context, userId string, revokedAt time.Time) error {
+	defer mem.lock()()
+
+	for id, token := range mem.store.refreshTokens {
+		if token.UserId == userId && token.RevokedAt.IsZero() {
+			token.RevokedAt = revokedAt
+			mem.store.refreshTokens[id] = token
+		}
+	}
+
+	return nil
+}
+
+func (mem *MemoryImplementation) InsertRevokedToken(ctx context.Context, revokedToken *models.RevokedToken) error {
+	defer mem.lock()()
+
+	//* Revocar dos veces el mismo 'token' no es un error.
+	if _, ok := mem.store.revokedTokens[revokedToken.TokenId]; ok {
+		return nil
+	}
+	mem.store.revokedTokens[revokedToken.TokenId] = *revokedToken
+
+	return nil
+}
+func (mem *MemoryImplementation) IsTokenRevoked(ctx context.Context, tokenId string) (bool, error) {
+	defer mem.rlock()()
+
+	_, ok := mem.store.revokedTokens[tokenId]
+	return ok, nil
+}
+func (mem *MemoryImplementation) GetUserTokensRevokedBefore(ctx context.Context, userId string) (time.Time, error) {
+	defer mem.rlock()()
+
+	//* Si el 'user' nunca cerró todas sus sesiones, devolvemos un momento nulo.
+	return mem.store.tokensRevocations[userId], nil
+}
+func (mem *MemoryImplementation) SetUserTokensRevokedBefore(ctx context.Context, userId string, revokedBefore time.Time) error {
+	defer mem.lock()()
+
+	mem.store.tokensRevocations[userId] = revokedBefore
+
+	return nil
+}
+
+func (mem *MemoryImplementation) UpsertUserMfa(ctx context.Context, userMfa *models.UserMfa) error {
+	defer mem.lock()()
+
+	//* Un 'user' sólo tiene un secreto: si repite el alta antes de confirmarla, sustituimos el anterior.
+	mem.store.userMfas[userMfa.UserId] = *userMfa
+
+	return nil
+}
+func (mem *MemoryImplementation) InsertRecoveryCode(ctx context.Context, recoveryCode *models.RecoveryCode) error {
+	defer mem.lock()()
+
+	if _, ok := mem.store.recoveryCodes[recoveryCode.Id]; ok {
+		return ErrDuplicateKey
+	}
+	storedCode := *recoveryCode
+	storedCode.UsedAt = time.Time{}
+	mem.store.recoveryCodes[recoveryCode.Id] = storedCode
+
+	return nil
+}
+func (mem *MemoryImplementation) GetUserMfaByUserId(ctx context.Context, userId string) (*models.UserMfa, error) {
+	defer mem.rlock()()
+
+	//* Si el 'user' no tiene MFA, devolvemos un valor nulo.
+	userMfa, ok := mem.store.userMfas[userId]
+	if !ok {
+		return nil, nil
+	}
+	return &userMfa, nil
+}
+func (mem *MemoryImplementation) GetRecoveryCodeByUserIdAndHash(ctx context.Context, userId, codeHash string) (*models.RecoveryCode, error) {
+	defer mem.rlock()()
+
+	//* Si no hay coincidencias, devolvemos un código nulo.
+	for _, recoveryCode := range mem.store.recoveryCodes {
+		if recoveryCode.UserId == userId && recoveryCode.CodeHash == codeHash {
+			return &recoveryCode, nil
+		}
+	}
+	return nil, nil
+}
+func (mem *MemoryImplementation) UpdateUserMfa(ctx context.Context, userMfa *models.UserMfa) error {
+	defer mem.lock()()
+
+	//* El paso sólo puede avanzar: así un mismo código TOTP no sirve dos veces.
+	storedMfa, ok := mem.store.userMfas[userMfa.UserId]
+	if !ok || storedMfa.LastUsedStep >= userMfa.LastUsedStep {
+		return ErrTokenAlreadyUsed
+	}
+	storedMfa.LastUsedStep = userMfa.LastUsedStep
+	storedMfa.EnabledAt = userMfa.EnabledAt
+	mem.store.userMfas[userMfa.UserId] = storedMfa
+
+	return nil
+}
+func (mem *MemoryImplementation) UpdateRecoveryCode(ctx context.Context, recoveryCode *models.RecoveryCode) error {
+	defer mem.lock()()
+
+	storedCode, ok := mem.store.recoveryCodes[recoveryCode.Id]
+	if !ok || !storedCode.UsedAt.IsZero() {
+		return ErrTokenAlreadyUsed
+	}
+	storedCode.UsedAt = recoveryCode.UsedAt
+	mem.store.recoveryCodes[recoveryCode.Id] = storedCode
+
+	return nil
+}
+func (mem *MemoryImplementation) DeleteUserMfa(ctx context.Context, userId string) error {
+	defer mem.lock()()
+
+	delete(mem.store.userMfas, userId)
+
+	return nil
+}
+func (mem *MemoryImplementation) DeleteRecoveryCodesByUserId(ctx context.Context, userId string) error {
+	defer mem.lock()()
+
+	for id, recoveryCode := range mem.store.recoveryCodes {
+		if recoveryCode.UserId == userId {
+			delete(mem.store.recoveryCodes, id)
+		}
+	}
+
+	return nil
+}
+
+func (mem *MemoryImplementation) InsertWebAuthnCredential(ctx context.Context, credential *models.WebAuthnCredential) error {
+	defer mem.lock()()
+
+	if _, ok := mem.store.webAuthnCredentials[credential.Id]; ok {
+		return ErrDuplicateKey
+	}
+	storedCredential := *credential
+	storedCredential.PublicKey = cloneBytes(credential.PublicKey)
+	storedCredential.LastUsedAt = time.Time{}
+	mem.store.webAuthnCredentials[credential.Id] = storedCredential
+
+	return nil
+}
+func (mem *MemoryImplementation) InsertWebAuthnChallenge(ctx context.Context, challenge *models.WebAuthnChallenge) error {
+	defer mem.lock()()
+
+	if _, ok := mem.store.webAuthnChallenges[challenge.Id]; ok {
+		return ErrDuplicateKey
+	}
+	storedChallenge := *challenge
+	storedChallenge.Challenge = cloneBytes(challenge.Challenge)
+	storedChallenge.UsedAt = time.Time{}
+	mem.store.webAuthnChallenges[challenge.Id] = storedChallenge
+
+	return nil
+}
+func (mem *MemoryImplementation) GetWebAuthnCredentialById(ctx context.Context, id string) (*models.WebAuthnCredential, error) {
+	defer mem.rlock()()
+
+	//* Si no hay coincidencias, devolvemos una credencial nula.
+	credential, ok := mem.store.webAuthnCredentials[id]
+	if !ok {
+		return nil, nil
+	}
+	credential.PublicKey = cloneBytes(credential.PublicKey)
+	return &credential, nil
+}
+func (mem *MemoryImplementation) ListWebAuthnCredentialsByUserId(ctx context.Context, userId string) ([]*models.WebAuthnCredential, error) {
+	defer mem.rlock()()
+
+	var credentials []*models.WebAuthnCredential
+	for _, credential := range mem.store.webAuthnCredentials {
+		if credential.UserId == userId {
+			credential := credential
+			credential.PublicKey = cloneBytes(credential.PublicKey)
+			credentials = append(credentials, &credential)
+		}
+	}
+	sort.Slice(credentials, func(i, j int) bool {
+		return credentials[i].CreatedAt.Before(credentials[j].CreatedAt)
+	})
+
+	return credentials, nil
+}
+func (mem *MemoryImplementation) GetWebAuthnChallengeById(ctx context.Context, id string) (*models.WebAuthnChallenge, error) {
+	defer mem.rlock()()
+
+	//* Si no hay coincidencias, devolvemos un desafío nulo.
+	challenge, ok := mem.store.webAuthnChallenges[id]
+	if !ok {
+		return nil, nil
+	}
+	challenge.Challenge = cloneBytes(challenge.Challenge)
+	return &challenge, nil
+}
+func (mem *MemoryImplementation) UpdateWebAuthnCredential(ctx context.Context, credential *models.WebAuthnCredential) error {
+	defer mem.lock()()
+
+	storedCredential, ok := mem.store.webAuthnCredentials[credential.Id]
+	if !ok {
+		return nil
+	}
+	storedCredential.SignCount = credential.SignCount
+	storedCredential.LastUsedAt = credential.LastUsedAt
+	mem.store.webAuthnCredentials[credential.Id] = storedCredential
+
+	return nil
+}
+func (mem *MemoryImplementation) UpdateWebAuthnChallenge(ctx context.Context, challenge *models.WebAuthnChallenge) error {
+	defer mem.lock()()
+
+	storedChallenge, ok := mem.store.webAuthnChallenges[challenge.Id]
+	if !ok || !storedChallenge.UsedAt.IsZero() {
+		return ErrTokenAlreadyUsed
+	}
+	storedChallenge.UsedAt = challenge.UsedAt
+	mem.store.webAuthnChallenges[challenge.Id] = storedChallenge
+
+	return nil
+}
+
+func (mem *MemoryImplementation) InsertSigningKey(ctx context.Context, signingKey *models.SigningKey) error {
+	defer mem.lock()()
+
+	if _, ok := mem.store.signingKeys[signingKey.Id]; ok {
+		return ErrDuplicateKey
+	}
+	storedKey := *signingKey
+	storedKey.PrivateKey = cloneBytes(signingKey.PrivateKey)
+	storedKey.RetiredAt = time.Time{}
+	mem.store.signingKeys[signingKey.Id] = storedKey
+
+	return nil
+}
+func (mem *MemoryImplementation) ListSigningKeys(ctx context.Context, retiredAfter time.Time) ([]*models.SigningKey, error) {
+	defer mem.rlock()()
+
+	//* Sólo interesan las claves en uso o retiradas tan recientemente que aún validan 'token'.
+	var signingKeys []*models.SigningKey
+	for _, signingKey := range mem.store.signingKeys {
+		if signingKey.RetiredAt.IsZero() || signingKey.RetiredAt.After(retiredAfter) {
+			signingKey := signingKey
+			signingKey.PrivateKey = cloneBytes(signingKey.PrivateKey)
+			signingKeys = append(signingKeys, &signingKey)
+		}
+	}
+	sort.Slice(signingKeys, func(i, j int) bool {
+		return signingKeys[i].CreatedAt.After(signingKeys[j].CreatedAt)
+	})
+
+	return signingKeys, nil
+}
+func (mem *MemoryImplementation) UpdateSigningKey(ctx context.Context, signingKey *models.SigningKey) error {
+	defer mem.lock()()
+
+	storedKey, ok := mem.store.signingKeys[signingKey.Id]
+	if !ok {
+		return nil
+	}
+	storedKey.RetiredAt = signingKey.RetiredAt
+	mem.store.signingKeys[signingKey.Id] = storedKey
+
+	return nil
+}
+
+func (mem *MemoryImplementation) InsertOAuthClient(ctx context.Context, client *models.OAuthClient) error {
+	defer mem.lock()()
+
+	if _, ok := mem.store.oauthClients[client.Id]; ok {
+		return ErrDuplicateKey
+	}
+	storedClient := *client
+	storedClient.RedirectURIs = cloneList(client.RedirectURIs)
+	storedClient.Scopes = cloneList(client.Scopes)
+	mem.store.oauthClients[client.Id] = storedClient
+
+	return nil
+}
+func (mem *MemoryImplementation) GetOAuthClientById(ctx context.Context, id string) (*models.OAuthClient, error) {
+	defer mem.rlock()()
+
+	//* Si no hay coincidencias, devolvemos un cliente nulo.
+	client, ok := mem.store.oauthClients[id]
+	if !ok {
+		return nil, nil
+	}
+	client.RedirectURIs = cloneList(client.RedirectURIs)
+	client.Scopes = cloneList(client.Scopes)
+	return &client, nil
+}
+func (mem *MemoryImplementation) ListOAuthClientsByCreator(ctx context.Context, createdBy string) ([]*models.OAuthClient, error) {
+	defer mem.rlock()()
+
+	var clients []*models.OAuthClient
+	for _, client := range mem.store.oauthClients {
+		if client.CreatedBy == createdBy {
+			client := client
+			client.RedirectURIs = cloneList(client.RedirectURIs)
+			client.Scopes = cloneList(client.Scopes)
+			clients = append(clients, &client)
+		}
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].CreatedAt.Before(clients[j].CreatedAt)
+	})
+
+	return clients, nil
+}
+
+func (mem *MemoryImplementation) InsertOAuthAuthorizationCode(ctx context.Context, code *models.OAuthAuthorizationCode) error {
+	defer mem.lock()()
+
+	if _, ok := mem.store.oauthClients[code.ClientId]; !ok {
+		return ErrUnknownReference
+	}
+	for id, storedCode := range mem.store.oauthAuthorizationCodes {
+		if id == code.Id || storedCode.CodeHash == code.CodeHash {
+			return ErrDuplicateKey
+		}
+	}
+	storedCode := *code
+	storedCode.Scopes = cloneList(code.Scopes)
+	storedCode.FamilyId = ""
+	storedCode.UsedAt = time.Time{}
+	mem.store.oauthAuthorizationCodes[code.Id] = storedCode
+
+	return nil
+}
+func (mem *MemoryImplementation) GetOAuthAuthorizationCodeByHash(ctx context.Context, codeHash string) (*models.OAuthAuthorizationCode, error) {
+	defer mem.rlock()()
+
+	//* Si no hay coincidencias, devolvemos un código nulo.
+	for _, code := range mem.store.oauthAuthorizationCodes {
+		if code.CodeHash == codeHash {
+			code.Scopes = cloneList(code.Scopes)
+			return &code, nil
+		}
+	}
+	return nil, nil
+}
+func (mem *MemoryImplementation) UpdateOAuthAuthorizationCode(ctx context.Context, code *models.OAuthAuthorizationCode) error {
+	defer mem.lock()()
+
+	//* Sólo se marca como usado si no lo estaba ya, así un mismo código no puede canjearse dos veces.
+	storedCode, ok := mem.store.oauthAuthorizationCodes[code.Id]
+	if !ok || !storedCode.UsedAt.IsZero() {
+		return ErrTokenAlreadyUsed
+	}
+	storedCode.UsedAt = code.UsedAt
+	storedCode.FamilyId = code.FamilyId
+	mem.store.oauthAuthorizationCodes[code.Id] = storedCode
+
+	return nil
+}
+
+func (mem *MemoryImplementation) GetOAuthConsent(ctx context.Context, userId, clientId string) (*models.OAuthConsent, error) {
+	defer mem.rlock()()
+
+	//* Si el 'user' nunca dio su consentimiento, devolvemos un valor nulo.
+	consent, ok := mem.store.oauthConsents[consentKey{UserId: userId, ClientId: clientId}]
+	if !ok {
+		return nil, nil
+	}
+	consent.Scopes = cloneList(consent.Scopes)
+	return &consent, nil
+}
+func (mem *MemoryImplementation) UpsertOAuthConsent(ctx context.Context, consent *models.OAuthConsent) error {
+	defer mem.lock()()
+
+	if _, ok := mem.store.oauthClients[consent.ClientId]; !ok {
+		return ErrUnknownReference
+	}
+
+	//* Si ya existía, conservamos el momento en el que se dio por primera vez.
+	key := consentKey{UserId: consent.UserId, ClientId: consent.ClientId}
+	storedConsent, ok := mem.store.oauthConsents[key]
+	if !ok {
+		storedConsent = *consent
+	}
+	storedConsent.Scopes = cloneList(consent.Scopes)
+	storedConsent.UpdatedAt = consent.UpdatedAt
+	mem.store.oauthConsents[key] = storedConsent
+
+	return nil
+}
+
+func (mem *MemoryImplementation) InsertOAuthDeviceCode(ctx context.Context, deviceCode *models.OAuthDeviceCode) error {
+	defer mem.lock()()
+
+	if _, ok := mem.store.oauthClients[deviceCode.ClientId]; !ok {
+		return ErrUnknownReference
+	}
+	for id, storedCode := range mem.store.oauthDeviceCodes {
+		if id == deviceCode.Id || storedCode.DeviceCodeHash == deviceCode.DeviceCodeHash || storedCode.UserCodeHash == deviceCode.UserCodeHash {
+			return ErrDuplicateKey
+		}
+	}
+
+	//* Como en Postgres, el resto de campos empiezan vacíos.
+	mem.store.oauthDeviceCodes[deviceCode.Id] = models.OAuthDeviceCode{
+		Id:             deviceCode.Id,
+		DeviceCodeHash: deviceCode.DeviceCodeHash,
+		UserCodeHash:   deviceCode.UserCodeHash,
+		ClientId:       deviceCode.ClientId,
+		Scopes:         cloneList(deviceCode.Scopes),
+		Interval:       deviceCode.Interval,
+		ExpiresAt:      deviceCode.ExpiresAt,
+		CreatedAt:      deviceCode.CreatedAt,
+	}
+
+	return nil
+}
+func (mem *MemoryImplementation) GetOAuthDeviceCodeByDeviceCodeHash(ctx context.Context, deviceCodeHash string) (*models.OAuthDeviceCode, error) {
+	return mem.getOAuthDeviceCode(func(deviceCode models.OAuthDeviceCode) bool {
+		return deviceCode.DeviceCodeHash == deviceCodeHash
+	})
+}
+func (mem *MemoryImplementation) GetOAuthDeviceCodeByUserCodeHash(ctx context.Context, userCodeHash string) (*models.OAuthDeviceCode, error) {
+	return mem.getOAuthDeviceCode(func(deviceCode models.OAuthDeviceCode) bool {
+		return deviceCode.UserCodeHash == userCodeHash
+	})
+}
+func (mem *MemoryImplementation) getOAuthDeviceCode(match func(deviceCode models.OAuthDeviceCode) bool) (*models.OAuthDeviceCode, error) {
+	defer mem.rlock()()
+
+	//* Si no hay coincidencias, devolvemos un código nulo.
+	for _, deviceCode := range mem.store.oauthDeviceCodes {
+		if match(deviceCode) {
+			deviceCode.Scopes = cloneList(deviceCode.Scopes)
+			return &deviceCode, nil
+		}
+	}
+	return nil, nil
+}
+func (mem *MemoryImplementation) UpdateOAuthDeviceCode(ctx context.Context, deviceCode *models.OAuthDeviceCode) error {
+	defer mem.lock()()
+
+	//* Un código ya canjeado no admite más cambios, así no puede emitir 'token' dos veces.
+	storedCode, ok := mem.store.oauthDeviceCodes[deviceCode.Id]
+	if !ok || !storedCode.UsedAt.IsZero() {
+		return ErrTokenAlreadyUsed
+	}
+	storedCode.UserId = deviceCode.UserId
+	storedCode.FamilyId = deviceCode.FamilyId
+	storedCode.AuthTime = deviceCode.AuthTime
+	storedCode.ApprovedAt = deviceCode.ApprovedAt
+	storedCode.DeniedAt = deviceCode.DeniedAt
+	storedCode.UsedAt = deviceCode.UsedAt
+	mem.store.oauthDeviceCodes[deviceCode.Id] = storedCode
+
+	return nil
+}
+func (mem *MemoryImplementation) UpdateOAuthDeviceCodePolling(ctx context.Context, deviceCode *models.OAuthDeviceCode) error {
+	defer mem.lock()()
+
+	//* Sólo toca los campos de sondeo, para no pisar una aprobación concurrente.
+	storedCode, ok := mem.store.oauthDeviceCodes[deviceCode.Id]
+	if !ok {
+		return nil
+	}
+	storedCode.Interval = deviceCode.Interval
+	storedCode.LastPolledAt = deviceCode.LastPolledAt
+	mem.store.oauthDeviceCodes[deviceCode.Id] = storedCode
+
+	return nil
+}
+
+func (mem *MemoryImplementation) InsertApiKey(ctx context.Context, apiKey *models.ApiKey) error {
+	defer mem.lock()()
+
+	for id, storedKey := range mem.store.apiKeys {
+		if id == apiKey.Id || storedKey.Prefix == apiKey.Prefix {
+			return ErrDuplicateKey
+		}
+	}
+	storedKey := *apiKey
+	storedKey.Scopes = cloneList(apiKey.Scopes)
+	storedKey.LastUsedAt = time.Time{}
+	storedKey.RevokedAt = time.Time{}
+	mem.store.apiKeys[apiKey.Id] = storedKey
+
+	return nil
+}
+func (mem *MemoryImplementation) GetApiKeyByPrefix(ctx context.Context, prefix string) (*models.ApiKey, error) {
+	defer mem.rlock()()
+
+	//* Si no hay coincidencias, devolvemos una clave nula.
+	for _, apiKey := range mem.store.apiKeys {
+		if apiKey.Prefix == prefix {
+			apiKey.Scopes = cloneList(apiKey.Scopes)
+			return &apiKey, nil
+		}
+	}
+	return nil, nil
+}
+func (mem *MemoryImplementation) ListApiKeysByUserId(ctx context.Context, userId string) ([]*models.ApiKey, error) {
+	defer mem.rlock()()
+
+	var apiKeys []*models.ApiKey
+	for _, apiKey := range mem.store.apiKeys {
+		if apiKey.UserId == userId {
+			apiKey := apiKey
+			apiKey.Scopes = cloneList(apiKey.Scopes)
+			apiKeys = append(apiKeys, &apiKey)
+		}
+	}
+	sort.Slice(apiKeys, func(i, j int) bool {
+		return apiKeys[i].CreatedAt.Before(apiKeys[j].CreatedAt)
+	})
+
+	return apiKeys, nil
+}
+func (mem *MemoryImplementation) UpdateApiKeyLastUsedAt(ctx context.Context, id string, lastUsedAt time.Time) error {
+	defer mem.lock()()
+
+	apiKey, ok := mem.store.apiKeys[id]
+	if !ok {
+		return nil
+	}
+	apiKey.LastUsedAt = lastUsedAt
+	mem.store.apiKeys[id] = apiKey
+
+	return nil
+}
+func (mem *MemoryImplementation) RevokeApiKey(ctx context.Context, id, userId string, revokedAt time.Time) (bool, error) {
+	defer mem.lock()()
+
+	//* Sólo el propietario puede revocarla, y sólo una vez.
+	apiKey, ok := mem.store.apiKeys[id]
+	if !ok || apiKey.UserId != userId || !apiKey.RevokedAt.IsZero() {
+		return false, nil
+	}
+	apiKey.RevokedAt = revokedAt
+	mem.store.apiKeys[id] = apiKey
+
+	return true, nil
+}
+
+func (mem *MemoryImplementation) InsertRole(ctx context.Context, role *models.Role) error {
+	defer mem.lock()()
+
+	for id, storedRole := range mem.store.roles {
+		if id == role.Id || storedRole.Name == role.Name {
+			return ErrDuplicateKey
+		}
+	}
+	//* Los permisos se guardan ordenados y sin repetir, y todos deben existir.
+	permissions := map[string]bool{}
+	for _, permission := range role.Permissions {
+		if _, ok := mem.store.permissions[permission]; !ok {
+			return ErrUnknownReference
+		}
+		if permissions[permission] {
+			return ErrDuplicateKey
+		}
+		permissions[permission] = true
+	}
+	storedRole := *role
+	storedRole.Permissions = cloneList(role.Permissions)
+	sort.Strings(storedRole.Permissions)
+	mem.store.roles[role.Id] = storedRole
+
+	return nil
+}
+func (mem *MemoryImplementation) InsertUserRole(ctx context.Context, userRole *models.UserRole) (bool, error) {
+	defer mem.lock()()
+
+	if _, ok := mem.store.roles[userRole.RoleId]; !ok {
+		return false, ErrUnknownReference
+	}
+	if _, ok := mem.store.users[userRole.UserId]; !ok {
+		return false, ErrUnknownReference
+	}
+
+	//* Asignar dos veces el mismo rol no es un error, pero no se registra de nuevo.
+	key := userRoleKey{UserId: userRole.UserId, RoleId: userRole.RoleId}
+	if _, ok := mem.store.userRoles[key]; ok {
+		return false, nil
+	}
+	mem.store.userRoles[key] = *userRole
+
+	return true, nil
+}
+func (mem *MemoryImplementation) GetRoleById(ctx context.Context, id string) (*models.Role, error) {
+	defer mem.rlock()()
+
+	//* Si no existe, devolvemos un rol nulo.
+	role, ok := mem.store.roles[id]
+	if !ok {
+		return nil, nil
+	}
+	role.Permissions = cloneList(role.Permissions)
+	return &role, nil
+}
+func (mem *MemoryImplementation) ListRoles(ctx context.Context) ([]*models.Role, error) {
+	return mem.listRoles(func(role models.Role) bool { return true })
+}
+func (mem *MemoryImplementation) ListRolesByUserId(ctx context.Context, userId string) ([]*models.Role, error) {
+	return mem.listRoles(func(role models.Role) bool {
+		_, ok := mem.store.userRoles[userRoleKey{UserId: userId, RoleId: role.Id}]
+		return ok
+	})
+}
+func (mem *MemoryImplementation) listRoles(match func(role models.Role) bool) ([]*models.Role, error) {
+	defer mem.rlock()()
+
+	var roles []*models.Role
+	for _, role := range mem.store.roles {
+		if match(role) {
+			role := role
+			role.Permissions = cloneList(role.Permissions)
+			roles = append(roles, &role)
+		}
+	}
+	sort.Slice(roles, func(i, j int) bool {
+		return roles[i].Name < roles[j].Name
+	})
+
+	return roles, nil
+}
+func (mem *MemoryImplementation) ListPermissions(ctx context.Context) ([]*models.Permission, error) {
+	defer mem.rlock()()
+
+	var permissions []*models.Permission
+	for _, permission := range mem.store.permissions {
+		permission := permission
+		permissions = append(permissions, &permission)
+	}
+	sort.Slice(permissions, func(i, j int) bool {
+		return permissions[i].Name < permissions[j].Name
+	})
+
+	return permissions, nil
+}
+func (mem *MemoryImplementation) DeleteUserRole(ctx context.Context, userId, roleId string) (bool, error) {
+	defer mem.lock()()
+
+	key := userRoleKey{UserId: userId, RoleId: roleId}
+	if _, ok := mem.store.userRoles[key]; !ok {
+		return false, nil
+	}
+	delete(mem.store.userRoles, key)
+
+	return true, nil
+}
+
+func (mem *MemoryImplementation) GetLoginThrottle(ctx context.Context, key string) (*models.LoginThrottle, error) {
+	defer mem.rlock()()
+
+	//* Si no hay coincidencias, devolvemos un registro nulo.
+	loginThrottle, ok := mem.store.loginThrottles[key]
+	if !ok {
+		return nil, nil
+	}
+	return &loginThrottle, nil
+}
+func (mem *MemoryImplementation) RegisterLoginFailure(ctx context.Context, key string, failedAt, windowStart time.Time) (*models.LoginThrottle, error) {
+	defer mem.lock()()
+
+	//* Los fallos anteriores a 'windowStart' ya no cuentan y el recuento vuelve a empezar.
+	loginThrottle, ok := mem.store.loginThrottles[key]
+	if !ok || loginThrottle.LastFailedAt.Before(windowStart) {
+		loginThrottle.Key = key
+		loginThrottle.Failures = 1
+	} else {
+		loginThrottle.Failures++
+	}
+	loginThrottle.LastFailedAt = failedAt
+	mem.store.loginThrottles[key] = loginThrottle
+
+	return &loginThrottle, nil
+}
+func (mem *MemoryImplementation) LockLoginThrottle(ctx context.Context, key string, lockedUntil time.Time) error {
+	defer mem.lock()()
+
+	//* Al bloquear, el recuento de fallos vuelve a empezar.
+	loginThrottle, ok := mem.store.loginThrottles[key]
+	if !ok {
+		return nil
+	}
+	loginThrottle.Failures = 0
+	loginThrottle.LockedUntil = lockedUntil
+	mem.store.loginThrottles[key] = loginThrottle
+
+	return nil
+}
+func (mem *MemoryImplementation) DeleteLoginThrottle(ctx context.Context, key string) error {
+	defer mem.lock()()
+
+	delete(mem.store.loginThrottles, key)
+
+	return nil
+}
@@ -0,0 +1,249 @@
+package databases
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	MIGRATION_DIALECT_POSTGRES = "postgres"
+	MIGRATION_DIALECT_SQLITE   = "sqlite"
+
+	//* Clave del bloqueo de Postgres que comparten todas las réplicas ("thisisme" en ASCII).
+	MIGRATIONS_LOCK_KEY = 0x7468697369736d65
+)
+
+var (
+	ErrUnknownSchemaVersion   = errors.New("database schema is newer than the embedded migrations")
+	ErrMigrationsNotSupported = errors.New("database driver does not support migrations")
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigratableRepository interface {
+	//* Lo cumplen los repositorios que guardan un esquema, es decir, todos menos el de memoria.
+	Migrator() (*Migrator, error)
+}
+
+type Migrator struct {
+	DB *sql.DB
+
+	Dialect    string
+	Migrations []*Migration
+}
+
+func NewMigrator(db *sql.DB, dialect string) (*Migrator, error) {
+	migrations, err := loadMigrations(dialect)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		DB:         db,
+		Dialect:    dialect,
+		Migrations: migrations,
+	}, nil
+}
+func loadMigrations(dialect string) ([]*Migration, error) {
+	//* Cada versión se compone de un fichero 'NNNN_nombre.up.sql' y de su 'NNNN_nombre.down.sql'.
+	directory := path.Join("migrations", dialect)
+	entries, err := fs.ReadDir(migrationFiles, directory)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		matches := migrationFileName.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			return nil, fmt.Errorf("invalid migration file name '%s'", entry.Name())
+		}
+		version, _ := strconv.Atoi(matches[1])
+		content, err := fs.ReadFile(migrationFiles, path.Join(directory, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != matches[2] {
+			return nil, fmt.Errorf("migration %d has two names: '%s' and '%s'", version, migration.Name, matches[2])
+		}
+		if matches[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	//* Las versiones deben ser consecutivas desde la 1 y tener ambos sentidos.
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		migrations = append(migrations, migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			return nil, fmt.Errorf("migration %d is missing", i+1)
+		}
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d must have both up and down files", migration.Version)
+		}
+	}
+	return migrations, nil
+}
+
+func (m *Migrator) LatestVersion() int {
+	return len(m.Migrations)
+}
+func (m *Migrator) Version(ctx context.Context) (int, error) {
+	//* Una DB sin la tabla 'schema_version' está en la versión 0.
+	var version int
+	err := m.inLockedTransaction(ctx, func(tx *sql.Tx) error {
+		var err error
+		version, err = currentSchemaVersion(ctx, tx)
+		return err
+	})
+	return version, err
+}
+func (m *Migrator) Up(ctx context.Context) ([]*Migration, error) {
+	return m.MigrateTo(ctx, m.LatestVersion())
+}
+func (m *Migrator) Down(ctx context.Context, steps int) ([]*Migration, error) {
+	version, err := m.Version(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if steps > version {
+		steps = version
+	}
+	return m.MigrateTo(ctx, version-steps)
+}
+func (m *Migrator) MigrateTo(ctx context.Context, target int) ([]*Migration, error) {
+	if target < 0 || target > m.LatestVersion() {
+		return nil, fmt.Errorf("unknown schema version %d", target)
+	}
+
+	//* Cada migración se aplica en su propia transacción, junto con el cambio de versión.
+	//* La versión actual se lee de nuevo tras cada bloqueo: otra réplica puede haber avanzado entretanto.
+	var applied []*Migration
+	for {
+		var migration *Migration
+		err := m.inLockedTransaction(ctx, func(tx *sql.Tx) error {
+			version, err := currentSchemaVersion(ctx, tx)
+			if err != nil {
+				return err
+			}
+			if version > m.LatestVersion() {
+				return ErrUnknownSchemaVersion
+			}
+
+			switch {
+			case version < target:
+				migration = m.Migrations[version]
+				if _, err := tx.ExecContext(ctx, migration.Up); err != nil {
+					return fmt.Errorf("migration %d up: %v", migration.Version, err)
+				}
+				_, err = tx.ExecContext(ctx, `
+					INSERT INTO schema_version (version, name, applied_at) VALUES ($1, $2, $3)
+				`, migration.Version, migration.Name, time.Now().UTC())
+				return err
+			case version > target:
+				migration = m.Migrations[version-1]
+				if _, err := tx.ExecContext(ctx, migration.Down); err != nil {
+					return fmt.Errorf("migration %d down: %v", migration.Version, err)
+				}
+				_, err = tx.ExecContext(ctx, `
+					DELETE FROM schema_version WHERE version = $1
+				`, migration.Version)
+				return err
+			default:
+				migration = nil
+				return nil
+			}
+		})
+		if err != nil {
+			return applied, err
+		}
+		if migration == nil {
+			return applied, nil
+		}
+		applied = append(applied, migration)
+	}
+}
+
+func (m *Migrator) inLockedTransaction(ctx context.Context, fn func(tx *sql.Tx) error) (err error) {
+	//* En Postgres, el bloqueo consultivo se libera solo al terminar la transacción.
+	//* En SQLite, la transacción ya empieza con el bloqueo de escritura ('_txlock=immediate').
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if m.Dialect == MIGRATION_DIALECT_POSTGRES {
+		if _, err = tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", int64(MIGRATIONS_LOCK_KEY)); err != nil {
+			return err
+		}
+	}
+	if _, err = tx.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_version(
+			"version" INTEGER NOT NULL UNIQUE,
+			"name" VARCHAR(255) NOT NULL,
+			"applied_at" TIMESTAMP NOT NULL,
+
+			PRIMARY KEY (version)
+		)
+	`); err != nil {
+		return err
+	}
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+func currentSchemaVersion(ctx context.Context, tx *sql.Tx) (int, error) {
+	var version int
+	err := tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+	return version, err
+}
+
+func RepositoryMigrator(dbr DatabaseRepository) (*Migrator, error) {
+	migratableRepository, ok := dbr.(MigratableRepository)
+	if !ok {
+		return nil, ErrMigrationsNotSupported
+	}
+	return migratableRepository.Migrator()
+}
+func (pgr *PostgresImplementation) Migrator() (*Migrator, error) {
+	return NewMigrator(pgr.DB, MIGRATION_DIALECT_POSTGRES)
+}
+func (sqr *SqliteImplementation) Migrator() (*Migrator, error) {
+	return NewMigrator(sqr.DB, MIGRATION_DIALECT_SQLITE)
+}
@@ -1,4 +1,5 @@
-DROP TABLE IF EXISTS users;
+-- Esquema de partida, idéntico al antiguo 'initial.sql'. Sólo se crea si no existe,
+-- así que una DB levantada con aquel fichero adopta las migraciones sin perder datos.
 CREATE TABLE IF NOT EXISTS users(
     "id" VARCHAR(32) NOT NULL UNIQUE,
     "email" VARCHAR(255) NOT NULL UNIQUE,
@@ -13,7 +14,6 @@ CREATE TABLE IF NOT EXISTS users(
 
     PRIMARY KEY (id)
 );
-DROP TABLE IF EXISTS users_properties_changes_history;
 CREATE TABLE IF NOT EXISTS users_properties_changes_history(
     "user_id" VARCHAR(32) NOT NULL,
     "name" VARCHAR(32) NOT NULL,
@@ -24,4 +24,4 @@ CREATE TABLE IF NOT EXISTS users_properties_changes_history(
     "created_by" VARCHAR(32) NOT NULL,
 
     FOREIGN KEY(user_id) REFERENCES users(id)
-);
\ No newline at end of file
+);
@@ -0,0 +1,7 @@
+ALTER TABLE users_properties_changes_history
+    DROP CONSTRAINT users_properties_changes_history_user_id_fkey,
+    ADD CONSTRAINT users_properties_changes_history_user_id_fkey
+        FOREIGN KEY(user_id) REFERENCES users(id);
+
+ALTER TABLE users DROP COLUMN "disabled_at";
+ALTER TABLE users DROP COLUMN "email_verified_at";
@@ -0,0 +1,8 @@
+-- Verificación del 'email' y bloqueo de cuentas. El historial se borra junto con su 'user'.
+ALTER TABLE users ADD COLUMN "email_verified_at" TIMESTAMP;
+ALTER TABLE users ADD COLUMN "disabled_at" TIMESTAMP;
+
+ALTER TABLE users_properties_changes_history
+    DROP CONSTRAINT users_properties_changes_history_user_id_fkey,
+    ADD CONSTRAINT users_properties_changes_history_user_id_fkey
+        FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE;
@@ -0,0 +1,66 @@
+-- 'Token' de un solo uso, de refresco y revocaciones de sesión.
+CREATE TABLE users_password_reset_tokens(
+    "id" VARCHAR(32) NOT NULL UNIQUE,
+    "user_id" VARCHAR(32) NOT NULL,
+    "token_hash" VARCHAR(64) NOT NULL UNIQUE,
+    "expires_at" TIMESTAMP NOT NULL,
+    "used_at" TIMESTAMP,
+
+    "created_at" TIMESTAMP NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (id),
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE users_email_verification_tokens(
+    "id" VARCHAR(32) NOT NULL UNIQUE,
+    "user_id" VARCHAR(32) NOT NULL,
+    "email" VARCHAR(255) NOT NULL,
+    "purpose" VARCHAR(32) NOT NULL,
+    "token_hash" VARCHAR(64) NOT NULL UNIQUE,
+    "expires_at" TIMESTAMP NOT NULL,
+    "used_at" TIMESTAMP,
+
+    "created_at" TIMESTAMP NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (id),
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE users_refresh_tokens(
+    "id" VARCHAR(32) NOT NULL UNIQUE,
+    "user_id" VARCHAR(32) NOT NULL,
+    "family_id" VARCHAR(32) NOT NULL,
+    "client_id" VARCHAR(32) NOT NULL DEFAULT '',
+    "scopes" VARCHAR(1024) NOT NULL DEFAULT '',
+    "token_hash" VARCHAR(64) NOT NULL UNIQUE,
+    "auth_time" TIMESTAMP,
+    "expires_at" TIMESTAMP NOT NULL,
+    "used_at" TIMESTAMP,
+    "revoked_at" TIMESTAMP,
+
+    "created_at" TIMESTAMP NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (id),
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX users_refresh_tokens_family_id_idx ON users_refresh_tokens(family_id);
+
+CREATE TABLE users_revoked_tokens(
+    "token_id" VARCHAR(32) NOT NULL UNIQUE,
+    "user_id" VARCHAR(32),
+    "client_id" VARCHAR(32) NOT NULL DEFAULT '',
+    "expires_at" TIMESTAMP NOT NULL,
+    "revoked_at" TIMESTAMP NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (token_id),
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE users_tokens_revocations(
+    "user_id" VARCHAR(32) NOT NULL UNIQUE,
+    "revoked_before" TIMESTAMP NOT NULL,
+
+    PRIMARY KEY (user_id),
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS webauthn_challenges;
+DROP TABLE IF EXISTS users_webauthn_credentials;
+DROP TABLE IF EXISTS users_recovery_codes;
+DROP TABLE IF EXISTS users_mfa;
@@ -0,0 +1,72 @@
+-- Servidor de autorización OAuth 2.0: clientes, códigos, consentimientos y dispositivos.
+CREATE TABLE oauth_clients(
+    "id" VARCHAR(32) NOT NULL UNIQUE,
+    "name" VARCHAR(255) NOT NULL,
+    "redirect_uris" VARCHAR(4096) NOT NULL,
+    "scopes" VARCHAR(1024) NOT NULL,
+    "confidential" BOOLEAN NOT NULL DEFAULT FALSE,
+    "secret_hash" VARCHAR(64) NOT NULL DEFAULT '',
+
+    "created_at" TIMESTAMP NOT NULL DEFAULT NOW(),
+    "created_by" VARCHAR(32) NOT NULL,
+
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE oauth_authorization_codes(
+    "id" VARCHAR(32) NOT NULL UNIQUE,
+    "code_hash" VARCHAR(64) NOT NULL UNIQUE,
+    "client_id" VARCHAR(32) NOT NULL,
+    "user_id" VARCHAR(32) NOT NULL,
+    "redirect_uri" VARCHAR(2048) NOT NULL,
+    "scopes" VARCHAR(1024) NOT NULL,
+    "code_challenge" VARCHAR(128) NOT NULL,
+    "code_challenge_method" VARCHAR(8) NOT NULL,
+    "nonce" VARCHAR(255) NOT NULL DEFAULT '',
+    "auth_time" TIMESTAMP,
+    "family_id" VARCHAR(32),
+    "expires_at" TIMESTAMP NOT NULL,
+    "used_at" TIMESTAMP,
+
+    "created_at" TIMESTAMP NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (id),
+    FOREIGN KEY(client_id) REFERENCES oauth_clients(id),
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE oauth_consents(
+    "user_id" VARCHAR(32) NOT NULL,
+    "client_id" VARCHAR(32) NOT NULL,
+    "scopes" VARCHAR(1024) NOT NULL,
+
+    "created_at" TIMESTAMP NOT NULL DEFAULT NOW(),
+    "updated_at" TIMESTAMP NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (user_id, client_id),
+    FOREIGN KEY(client_id) REFERENCES oauth_clients(id),
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE oauth_device_codes(
+    "id" VARCHAR(32) NOT NULL UNIQUE,
+    "device_code_hash" VARCHAR(64) NOT NULL UNIQUE,
+    "user_code_hash" VARCHAR(64) NOT NULL UNIQUE,
+    "client_id" VARCHAR(32) NOT NULL,
+    "scopes" VARCHAR(1024) NOT NULL,
+    "user_id" VARCHAR(32),
+    "family_id" VARCHAR(32),
+    "interval" INTEGER NOT NULL,
+    "auth_time" TIMESTAMP,
+    "approved_at" TIMESTAMP,
+    "denied_at" TIMESTAMP,
+    "last_polled_at" TIMESTAMP,
+    "expires_at" TIMESTAMP NOT NULL,
+    "used_at" TIMESTAMP,
+
+    "created_at" TIMESTAMP NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (id),
+    FOREIGN KEY(client_id) REFERENCES oauth_clients(id),
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
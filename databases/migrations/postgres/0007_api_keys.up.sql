@@ -0,0 +1,18 @@
+-- Claves personales de los 'user'.
+CREATE TABLE users_api_keys(
+    "id" VARCHAR(32) NOT NULL UNIQUE,
+    "user_id" VARCHAR(32) NOT NULL,
+    "name" VARCHAR(255) NOT NULL,
+    "prefix" VARCHAR(32) NOT NULL UNIQUE,
+    "secret_hash" VARCHAR(64) NOT NULL,
+    "scopes" VARCHAR(1024) NOT NULL DEFAULT '',
+    "expires_at" TIMESTAMP,
+    "last_used_at" TIMESTAMP,
+    "revoked_at" TIMESTAMP,
+
+    "created_at" TIMESTAMP NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (id),
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX users_api_keys_user_id_idx ON users_api_keys(user_id);
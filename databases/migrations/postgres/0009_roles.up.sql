@@ -0,0 +1,53 @@
+-- Roles y permisos.
+CREATE TABLE permissions(
+    "name" VARCHAR(64) NOT NULL UNIQUE,
+    "description" VARCHAR(255) NOT NULL DEFAULT '',
+
+    PRIMARY KEY (name)
+);
+
+CREATE TABLE roles(
+    "id" VARCHAR(32) NOT NULL UNIQUE,
+    "name" VARCHAR(64) NOT NULL UNIQUE,
+    "description" VARCHAR(255) NOT NULL DEFAULT '',
+
+    "created_at" TIMESTAMP NOT NULL DEFAULT NOW(),
+    "created_by" VARCHAR(32) NOT NULL,
+
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE roles_permissions(
+    "role_id" VARCHAR(32) NOT NULL,
+    "permission_name" VARCHAR(64) NOT NULL,
+
+    PRIMARY KEY (role_id, permission_name),
+    FOREIGN KEY(role_id) REFERENCES roles(id),
+    FOREIGN KEY(permission_name) REFERENCES permissions(name)
+);
+
+CREATE TABLE users_roles(
+    "user_id" VARCHAR(32) NOT NULL,
+    "role_id" VARCHAR(32) NOT NULL,
+
+    "created_at" TIMESTAMP NOT NULL DEFAULT NOW(),
+    "created_by" VARCHAR(32) NOT NULL,
+
+    PRIMARY KEY (user_id, role_id),
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY(role_id) REFERENCES roles(id)
+);
+
+-- El primer administrador se asigna a mano:
+-- INSERT INTO users_roles (user_id, role_id, created_by) VALUES ('<user id>', 'admin', '<user id>');
+INSERT INTO permissions (name, description) VALUES
+    ('roles:manage', 'Create roles and assign them to users'),
+    ('users:manage', 'List, disable and delete user accounts')
+ON CONFLICT DO NOTHING;
+INSERT INTO roles (id, name, description, created_by) VALUES
+    ('admin', 'admin', 'Full administrative access', 'system')
+ON CONFLICT DO NOTHING;
+INSERT INTO roles_permissions (role_id, permission_name) VALUES
+    ('admin', 'roles:manage'),
+    ('admin', 'users:manage')
+ON CONFLICT DO NOTHING;
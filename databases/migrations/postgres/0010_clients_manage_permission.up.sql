@@ -0,0 +1,7 @@
+-- Los clientes confidenciales y los ámbitos privilegiados sólo los registra quien tenga este permiso.
+INSERT INTO permissions (name, description) VALUES
+    ('clients:manage', 'Register confidential and privileged OAuth clients')
+ON CONFLICT DO NOTHING;
+INSERT INTO roles_permissions (role_id, permission_name) VALUES
+    ('admin', 'clients:manage')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,6 @@
+-- La clave ajena no admite historial de 'user' ya purgados: se descarta.
+DELETE FROM users_properties_changes_history
+    WHERE user_id NOT IN (SELECT id FROM users);
+ALTER TABLE users_properties_changes_history
+    ADD CONSTRAINT users_properties_changes_history_user_id_fkey
+        FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE;
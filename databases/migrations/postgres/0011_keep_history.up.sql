@@ -0,0 +1,3 @@
+-- El historial es un registro de auditoría: sobrevive a la purga de su 'user', que sólo borra sus valores.
+ALTER TABLE users_properties_changes_history
+    DROP CONSTRAINT users_properties_changes_history_user_id_fkey;
@@ -0,0 +1,3 @@
+-- El esquema de partida puede existir desde antes que las migraciones y guardar todos los 'user':
+-- volver a la versión 0 sólo deja de registrarlo, nunca borra sus tablas.
+SELECT 1;
@@ -0,0 +1,19 @@
+-- Verificación del 'email' y bloqueo de cuentas. El historial se borra junto con su 'user'.
+ALTER TABLE users ADD COLUMN "email_verified_at" TIMESTAMP;
+ALTER TABLE users ADD COLUMN "disabled_at" TIMESTAMP;
+
+-- SQLite no permite cambiar una clave ajena: reconstruimos la tabla.
+CREATE TABLE users_properties_changes_history_new(
+    "user_id" VARCHAR(32) NOT NULL,
+    "name" VARCHAR(32) NOT NULL,
+    "changed_from" VARCHAR(255),
+    "changed_to" VARCHAR(255) NOT NULL,
+
+    "created_at" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "created_by" VARCHAR(32) NOT NULL,
+
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+INSERT INTO users_properties_changes_history_new SELECT * FROM users_properties_changes_history;
+DROP TABLE users_properties_changes_history;
+ALTER TABLE users_properties_changes_history_new RENAME TO users_properties_changes_history;
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS users_tokens_revocations;
+DROP TABLE IF EXISTS users_revoked_tokens;
+DROP TABLE IF EXISTS users_refresh_tokens;
+DROP TABLE IF EXISTS users_email_verification_tokens;
+DROP TABLE IF EXISTS users_password_reset_tokens;
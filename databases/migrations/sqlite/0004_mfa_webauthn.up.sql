@@ -0,0 +1,51 @@
+-- Segundo factor (TOTP y códigos de recuperación) y 'passkeys'.
+CREATE TABLE users_mfa(
+    "user_id" VARCHAR(32) NOT NULL UNIQUE,
+    "secret" VARCHAR(64) NOT NULL,
+    "last_used_step" BIGINT NOT NULL DEFAULT 0,
+    "enabled_at" TIMESTAMP,
+
+    "created_at" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (user_id),
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE users_recovery_codes(
+    "id" VARCHAR(32) NOT NULL UNIQUE,
+    "user_id" VARCHAR(32) NOT NULL,
+    "code_hash" VARCHAR(64) NOT NULL,
+    "used_at" TIMESTAMP,
+
+    "created_at" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (id),
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE users_webauthn_credentials(
+    "id" VARCHAR(1366) NOT NULL UNIQUE,
+    "user_id" VARCHAR(32) NOT NULL,
+    "name" VARCHAR(255) NOT NULL,
+    "public_key" BLOB NOT NULL,
+    "sign_count" BIGINT NOT NULL DEFAULT 0,
+    "last_used_at" TIMESTAMP,
+
+    "created_at" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (id),
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE webauthn_challenges(
+    "id" VARCHAR(32) NOT NULL UNIQUE,
+    "user_id" VARCHAR(32),
+    "ceremony" VARCHAR(32) NOT NULL,
+    "challenge" BLOB NOT NULL,
+    "expires_at" TIMESTAMP NOT NULL,
+    "used_at" TIMESTAMP,
+
+    "created_at" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (id)
+);
@@ -0,0 +1,11 @@
+-- Claves asimétricas con las que se firman los 'token' de acceso.
+CREATE TABLE signing_keys(
+    "id" VARCHAR(32) NOT NULL UNIQUE,
+    "algorithm" VARCHAR(16) NOT NULL,
+    "private_key" BLOB NOT NULL,
+
+    "created_at" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "retired_at" TIMESTAMP,
+
+    PRIMARY KEY (id)
+);
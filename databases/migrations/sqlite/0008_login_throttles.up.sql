@@ -0,0 +1,9 @@
+-- Las claves son 'account:<email>' o 'address:<ip>': no dependen de que el 'user' exista.
+CREATE TABLE login_throttles(
+    "key" VARCHAR(320) NOT NULL UNIQUE,
+    "failures" INTEGER NOT NULL DEFAULT 0,
+    "last_failed_at" TIMESTAMP NOT NULL,
+    "locked_until" TIMESTAMP,
+
+    PRIMARY KEY (key)
+);
@@ -0,0 +1,2 @@
+DELETE FROM roles_permissions WHERE permission_name = 'clients:manage';
+DELETE FROM permissions WHERE name = 'clients:manage';
@@ -0,0 +1,5 @@
+-- Los clientes confidenciales y los ámbitos privilegiados sólo los registra quien tenga este permiso.
+INSERT OR IGNORE INTO permissions (name, description) VALUES
+    ('clients:manage', 'Register confidential and privileged OAuth clients');
+INSERT OR IGNORE INTO roles_permissions (role_id, permission_name) VALUES
+    ('admin', 'clients:manage');
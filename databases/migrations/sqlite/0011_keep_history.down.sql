@@ -0,0 +1,17 @@
+-- La clave ajena no admite historial de 'user' ya purgados: se descarta.
+CREATE TABLE users_properties_changes_history_old(
+    "user_id" VARCHAR(32) NOT NULL,
+    "name" VARCHAR(32) NOT NULL,
+    "changed_from" VARCHAR(255),
+    "changed_to" VARCHAR(255) NOT NULL,
+
+    "created_at" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "created_by" VARCHAR(32) NOT NULL,
+
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+INSERT INTO users_properties_changes_history_old
+    SELECT * FROM users_properties_changes_history
+    WHERE user_id IN (SELECT id FROM users);
+DROP TABLE users_properties_changes_history;
+ALTER TABLE users_properties_changes_history_old RENAME TO users_properties_changes_history;
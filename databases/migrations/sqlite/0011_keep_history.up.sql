@@ -0,0 +1,14 @@
+-- El historial es un registro de auditoría: sobrevive a la purga de su 'user', que sólo borra sus valores.
+-- SQLite no permite quitar una clave ajena: reconstruimos la tabla.
+CREATE TABLE users_properties_changes_history_new(
+    "user_id" VARCHAR(32) NOT NULL,
+    "name" VARCHAR(32) NOT NULL,
+    "changed_from" VARCHAR(255),
+    "changed_to" VARCHAR(255) NOT NULL,
+
+    "created_at" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "created_by" VARCHAR(32) NOT NULL
+);
+INSERT INTO users_properties_changes_history_new SELECT * FROM users_properties_changes_history;
+DROP TABLE users_properties_changes_history;
+ALTER TABLE users_properties_changes_history_new RENAME TO users_properties_changes_history;
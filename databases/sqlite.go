@@ -0,0 +1,2602 @@
+package databases
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aerodinamicat/thisisme02/models"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+const (
+	DEFAULT_SQLITE_PATH = "thisisme.db"
+)
+
+type SqliteImplementation struct {
+	DB *sql.DB
+	//* Sólo en los repositorios creados por 'RunInTransaction'.
+	tx *sql.Tx
+
+	Name string
+
+	DatabasePath string
+}
+
+func NewSqliteImplementation(path string) (*SqliteImplementation, error) {
+	name := "sqlite"
+	if path == "" {
+		path = DEFAULT_SQLITE_PATH
+	}
+
+	//* Las claves ajenas están desactivadas por defecto en SQLite y sin ellas no se borraría en cascada.
+	//* Los momentos se escriben en un formato que, en UTC, se ordena igual como texto que como fecha.
+	query := url.Values{}
+	query.Add("_pragma", "foreign_keys(1)")
+	query.Add("_pragma", "busy_timeout(5000)")
+	query.Set("_time_format", "sqlite")
+	//* Las transacciones toman el bloqueo de escritura al empezar, así las migraciones de varias réplicas no se cruzan.
+	query.Set("_txlock", "immediate")
+	db, err := sql.Open(name, fmt.Sprintf("file:%s?%s", path, query.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	//* SQLite admite un único escritor: usar una sola conexión evita los bloqueos entre transacciones.
+	db.SetMaxOpenConns(1)
+
+	return &SqliteImplementation{
+		DB:           db,
+		Name:         name,
+		DatabasePath: path,
+	}, nil
+}
+
+func (sqr *SqliteImplementation) CloseDatabaseConnection() error {
+	return sqr.DB.Close()
+}
+
+type sqliteExecutor struct {
+	executor sqlExecutor
+}
+
+func (se sqliteExecutor) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return se.executor.ExecContext(ctx, query, utcArgs(args)...)
+}
+func (se sqliteExecutor) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return se.executor.QueryContext(ctx, query, utcArgs(args)...)
+}
+func (se sqliteExecutor) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return se.executor.QueryRowContext(ctx, query, utcArgs(args)...)
+}
+func utcArgs(args []interface{}) []interface{} {
+	//* SQLite guarda los momentos como texto y los compara como tal, así que todos deben ir en UTC.
+	utc := make([]interface{}, len(args))
+	for i, arg := range args {
+		switch value := arg.(type) {
+		case time.Time:
+			utc[i] = value.UTC()
+		case sql.NullTime:
+			value.Time = value.Time.UTC()
+			utc[i] = value
+		default:
+			utc[i] = arg
+		}
+	}
+	return utc
+}
+
+func (sqr *SqliteImplementation) executor() sqlExecutor {
+	//* Las sentencias van a la transacción si la hay y, si no, directamente a la conexión.
+	if sqr.tx != nil {
+		return sqliteExecutor{executor: sqr.tx}
+	}
+	return sqliteExecutor{executor: sqr.DB}
+}
+func (sqr *SqliteImplementation) RunInTransaction(ctx context.Context, fn func(dbr DatabaseRepository) error) (err error) {
+	//* Las transacciones anidadas se integran en la que ya está en curso.
+	if sqr.tx != nil {
+		return fn(sqr)
+	}
+
+	tx, err := sqr.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	//* Si 'fn' falla o entra en pánico, deshacemos la transacción.
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			tx.Rollback()
+			panic(recovered)
+		}
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	txRepository := *sqr
+	txRepository.tx = tx
+	if err = fn(&txRepository); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func isSqliteUniqueViolation(err error) bool {
+	var sqliteError *sqlite.Error
+	if !errors.As(err, &sqliteError) {
+		return false
+	}
+	return sqliteError.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || sqliteError.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+}
+func (sqr *SqliteImplementation) InsertUser(ctx context.Context, user *models.User) error {
+	//* Construimos la sentencia SQL.
+	querySentence := `
+		INSERT INTO users (
+			id, email, email_verified_at, password, created_at, created_by, updated_at, updated_by
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	//* Ejecutamos la sentencia.
+	if _, err := sqr.executor().ExecContext(ctx, querySentence,
+		user.Id,
+		user.Email,
+		nullTime(user.EmailVerifiedAt),
+		user.Password,
+		user.CreatedAt,
+		user.CreatedBy,
+		user.UpdatedAt,
+		user.UpdatedBy,
+	); err != nil {
+		//* El 'id' o el 'email' ya existen, aunque sea en un 'user' eliminado.
+		if isSqliteUniqueViolation(err) {
+			return ErrDuplicateKey
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (sqr *SqliteImplementation) GetUserById(ctx context.Context, id string) (*models.User, error) {
+	//* Construimos la consulta SQL.
+	querySentence := `
+		SELECT
+			id, email, email_verified_at, password, disabled_at, created_at, created_by, updated_at, updated_by, deleted_at, deleted_by
+		FROM users
+		WHERE id = $1
+	`
+	//* Ejecutamos la consulta.
+	rows, err := sqr.executor().QueryContext(ctx, querySentence,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	//* Cerramos la consulta al final de éste proceso.
+	defer rows.Close()
+
+	//* Obtenemos los resultados de la ejecución.
+	var user = new(models.User)
+	for rows.Next() {
+		var emailVerifiedAt, disabledAt, deletedAt sql.NullTime
+		var deletedBy sql.NullString
+		if err := rows.Scan(
+			&user.Id,
+			&user.Email,
+			&emailVerifiedAt,
+			&user.Password,
+			&disabledAt,
+			&user.CreatedAt,
+			&user.CreatedBy,
+			&user.UpdatedAt,
+			&user.UpdatedBy,
+			&deletedAt,
+			&deletedBy,
+		); err != nil {
+			return nil, err
+		}
+
+		//* Si los campos 'sql.NullTime' son válidos, es decir que no son nulos, los asignamos a 'user'.
+		if emailVerifiedAt.Valid {
+			user.EmailVerifiedAt = emailVerifiedAt.Time
+		}
+		if disabledAt.Valid {
+			user.DisabledAt = disabledAt.Time
+		}
+		if deletedAt.Valid {
+			user.DeletedAt = deletedAt.Time
+		}
+		if deletedBy.Valid {
+			user.DeletedBy = deletedBy.String
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	//* Devolvemos la información obtenida.
+	return user, nil
+}
+func (sqr *SqliteImplementation) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	//* Contruimos la consulta SQL.
+	querySentence := `
+		SELECT
+			id, email, email_verified_at, password, disabled_at, created_at, created_by, updated_at, updated_by, deleted_at, deleted_by
+		FROM users
+		WHERE email = $1 AND deleted_at IS NULL
+	`
+	//* Ejecutamos la consulta.
+	rows, err := sqr.executor().QueryContext(ctx, querySentence, email)
+	if err != nil {
+		return nil, err
+	}
+	//* Cerramos la consulta al final de éste proceso.
+	defer rows.Close()
+
+	//* Obtenemos los resultados de la ejecución.
+	user := new(models.User)
+	for rows.Next() {
+		var emailVerifiedAt, disabledAt, deletedAt sql.NullTime
+		var deletedBy sql.NullString
+		if err := rows.Scan(
+			&user.Id,
+			&user.Email,
+			&emailVerifiedAt,
+			&user.Password,
+			&disabledAt,
+			&user.CreatedAt,
+			&user.CreatedBy,
+			&user.UpdatedAt,
+			&user.UpdatedBy,
+			&deletedAt,
+			&deletedBy,
+		); err != nil {
+			return nil, err
+		}
+
+		//* Si los campos 'sql.NullTime' son válidos, es decir que no son nulos, los asignamos a 'user'.
+		if emailVerifiedAt.Valid {
+			user.EmailVerifiedAt = emailVerifiedAt.Time
+		}
+		if disabledAt.Valid {
+			user.DisabledAt = disabledAt.Time
+		}
+		if deletedAt.Valid {
+			user.DeletedAt = deletedAt.Time
+		}
+		if deletedBy.Valid {
+			user.DeletedBy = deletedBy.String
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	//* Devolvemos la información obtenida.
+	return user, nil
+}
+func (sqr *SqliteImplementation) IsEmailInUse(ctx context.Context, email string) (bool, error) {
+	//* Construimos la consulta SQL.
+	//* Cuenta también los 'user' eliminados: su 'email' sigue reservado hasta que se purgan.
+	querySentence := `
+		SELECT count(*) AS total_items
+		FROM users
+		WHERE email = $1
+	`
+	//* Ejecutamos la consulta.
+	var totalItems int
+	if err := sqr.executor().QueryRowContext(ctx, querySentence,
+		email,
+	).Scan(&totalItems); err != nil {
+		return false, err
+	}
+
+	//* Devolvemos la información obtenida.
+	return totalItems > 0, nil
+}
+func (sqr *SqliteImplementation) ListUsers(ctx context.Context, pageInfo *models.PageInfo) ([]*models.User, *models.PageInfo, error) {
+	return sqr.listUsers(ctx, "", pageInfo)
+}
+func (sqr *SqliteImplementation) SearchUsersByEmail(ctx context.Context, search string, pageInfo *models.PageInfo) ([]*models.User, *models.PageInfo, error) {
+	//* Escapamos los comodines de 'LIKE' para que 'search' se busque literalmente.
+	//* En SQLite, 'LIKE' ya no distingue mayúsculas, pero hay que declarar el carácter de escape.
+	pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(search) + "%"
+	return sqr.listUsers(ctx, "WHERE email LIKE $1 ESCAPE '\\'", pageInfo, pattern)
+}
+func (sqr *SqliteImplementation) listUsers(ctx context.Context, condition string, pageInfo *models.PageInfo, args ...interface{}) ([]*models.User, *models.PageInfo, error) {
+	//* Si 'pageInfo' no tiene valores, lo poblamos.
+	pageInfo.OrderBy = DEFAULT_ORDER_BY
+	if pageInfo.Size == 0 {
+		pageInfo.Size = DEFAULT_PAGE_SIZE
+	}
+
+	if pageInfo.TotalPages == 0 || pageInfo.TotalItems == 0 {
+		//* Construimos la consulta SQL. 'condition' nunca procede de la petición.
+		querySentence := fmt.Sprintf(`
+			SELECT count(*) AS total_items
+			FROM users %s
+		`, condition)
+		//* Ejecutamos la consulta.
+		rows, err := sqr.executor().QueryContext(ctx, querySentence, args...)
+		if err != nil {
+			pageInfo.TotalPages = 0
+			pageInfo.TotalItems = 0
+
+			return nil, pageInfo, err
+		}
+		//* Cerramos la consulta al final de éste proceso.
+		defer rows.Close()
+
+		//* Obtenemos los resultado de la ejecución.
+		for rows.Next() {
+			if err = rows.Scan(
+				&pageInfo.TotalItems,
+			); err != nil {
+				pageInfo.TotalPages = 0
+				pageInfo.TotalItems = 0
+
+				return nil, pageInfo, err
+			}
+		}
+		if err = rows.Err(); err != nil {
+			pageInfo.TotalPages = 0
+			pageInfo.TotalItems = 0
+
+			return nil, pageInfo, err
+		}
+
+		//* Calculamos el total de páginas en función del número de elementos por cada una.
+		pageInfo.TotalPages = pageInfo.TotalItems / pageInfo.Size
+		//* Si los elementos no caben en un total de páginas exacto, añadimos una página mas.
+		if pageInfo.TotalItems%pageInfo.Size != 0 {
+			pageInfo.TotalPages++
+		}
+		pageInfo.Token = 1
+	}
+
+	//* Construimos la consulta SQL. Los parámetros de paginación van detrás de los de 'condition'.
+	querySentence := fmt.Sprintf(`
+		SELECT
+			id, email, email_verified_at, password, disabled_at, created_at, created_by, updated_at, updated_by, deleted_at, deleted_by
+		FROM users %s
+		ORDER BY %s, id LIMIT $%d OFFSET $%d
+	`, condition, pageInfo.OrderBy, len(args)+1, len(args)+2)
+	//* Ejecutamos la consulta.
+	rows, err := sqr.executor().QueryContext(ctx, querySentence, append(args,
+		pageInfo.Size,
+		(pageInfo.Token-1)*pageInfo.Size,
+	)...)
+	if err != nil {
+		pageInfo.TotalPages = 0
+		pageInfo.TotalItems = 0
+
+		return nil, pageInfo, err
+	}
+	//* Cerramos la consulta al final de éste proceso.
+	defer rows.Close()
+
+	//* Obtenemos los resultados de la consulta.
+	//* Dado que esperamos una lista, usamos un 'array' vacío.
+	var users []*models.User
+	for rows.Next() {
+		//* En cada iteración:
+		//* Creamos un usuario vacío y los campos nulables necesarios nuevamente.
+		user := new(models.User)
+		var emailVerifiedAt, disabledAt, deletedAt sql.NullTime
+		var deletedBy sql.NullString
+
+		//* Poblamos 'user' y los campos nulables.
+		if err = rows.Scan(
+			&user.Id,
+			&user.Email,
+			&emailVerifiedAt,
+			&user.Password,
+			&disabledAt,
+			&user.CreatedAt,
+			&user.CreatedBy,
+			&user.UpdatedAt,
+			&user.UpdatedBy,
+			&deletedAt,
+			&deletedBy,
+		); err != nil {
+			pageInfo.TotalPages = 0
+			pageInfo.TotalItems = 0
+
+			return nil, pageInfo, err
+		}
+
+		//* Si los campos 'sql.NullTime' son válidos, es decir que no son nulos, los asignamos a 'user'.
+		if emailVerifiedAt.Valid {
+			user.EmailVerifiedAt = emailVerifiedAt.Time
+		}
+		if disabledAt.Valid {
+			user.DisabledAt = disabledAt.Time
+		}
+		if deletedAt.Valid {
+			user.DeletedAt = deletedAt.Time
+		}
+		if deletedBy.Valid {
+			user.DeletedBy = deletedBy.String
+		}
+
+		//* Añadimos al 'array' el nuevo usuario.
+		users = append(users, user)
+	}
+	if err = rows.Err(); err != nil {
+		pageInfo.TotalPages = 0
+		pageInfo.TotalItems = 0
+
+		return nil, pageInfo, err
+	}
+
+	//* Actualizamos 'pageInfo' y la preparamos para la siguiente iteración, si la hubiera.
+	pageInfo.Token++
+
+	//* Devolvemos la información obtenida.
+	return users, pageInfo, nil
+}
+func (sqr *SqliteImplementation) UpdateUser(ctx context.Context, user *models.User) error {
+	//* Construimos la sentencia SQL.
+	querySentence := `
+		UPDATE users SET
+			email = $1, email_verified_at = $2, password = $3, disabled_at = $4, updated_at = $5, updated_by = $6
+		WHERE id = $7
+	`
+
+	//* Ejecutamos la sentencia.
+	if _, err := sqr.executor().ExecContext(ctx, querySentence,
+		user.Email,
+		nullTime(user.EmailVerifiedAt),
+		user.Password,
+		nullTime(user.DisabledAt),
+		user.UpdatedAt,
+		user.UpdatedBy,
+		user.Id,
+	); err != nil {
+		//* El 'id' o el 'email' ya existen, aunque sea en un 'user' eliminado.
+		if isSqliteUniqueViolation(err) {
+			return ErrDuplicateKey
+		}
+		return err
+	}
+
+	return nil
+}
+func (sqr *SqliteImplementation) RestoreUser(ctx context.Context, user *models.User) error {
+	//* Construimos la sentencia SQL.
+	querySentence := `
+		UPDATE users SET
+			deleted_at = NULL, deleted_by = NULL, updated_at = $1, updated_by = $2
+		WHERE id = $3 AND deleted_at IS NOT NULL
+	`
+	//* Ejecutamos la sentencia.
+	if _, err := sqr.executor().ExecContext(ctx, querySentence,
+		user.UpdatedAt,
+		user.UpdatedBy,
+		user.Id,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+func (sqr *SqliteImplementation) DeleteUser(ctx context.Context, user *models.User) error {
+	//* Construímos las sentencia SQL. El 'user' se marca como eliminado para conservar su historial
+	//* hasta que 'PurgeDeletedUsers' lo borre definitivamente.
+	querySentence := `
+		UPDATE users SET
+			deleted_at = $1, deleted_by = $2
+		WHERE id = $3 AND deleted_at IS NULL
+	`
+	//* Ejecutamos la sentencia.
+	if _, err := sqr.executor().ExecContext(ctx, querySentence,
+		user.DeletedAt,
+		user.DeletedBy,
+		user.Id,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+func (sqr *SqliteImplementation) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	//* Construímos las sentencia SQL. El historial se conserva, pero sin los valores, que contienen datos personales.
+	//* Si el borrado posterior falla, la siguiente purga lo repite: anonimizar dos veces no cambia nada.
+	querySentence := `
+		UPDATE users_properties_changes_history SET
+			changed_from = '', changed_to = ''
+		WHERE user_id IN (
+			SELECT id FROM users
+			WHERE deleted_at IS NOT NULL AND deleted_at < $1
+		)
+	`
+	//* Ejecutamos la sentencia.
+	if _, err := sqr.executor().ExecContext(ctx, querySentence,
+		deletedBefore,
+	); err != nil {
+		return 0, err
+	}
+
+	//* Construímos las sentencia SQL. El resto de tablas del 'user' se borran en cascada.
+	querySentence = `
+		DELETE FROM users
+		WHERE deleted_at IS NOT NULL AND deleted_at < $1
+	`
+	//* Ejecutamos la sentencia.
+	result, err := sqr.executor().ExecContext(ctx, querySentence,
+		deletedBefore,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func (sqr *SqliteImplementation) InsertPropertyChangeLog(ctx context.Context, propertyChange *models.PropertyChange) error {
+	//* Construímos las sentencia SQL.
+	querySentence := `
+		INSERT INTO users_properties_changes_history (
+			user_id, name, changed_from, changed_to, created_at, created_by
+		) VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	//* Ejecutamos la sentencia.
+	if _, err := sqr.executor().ExecContext(ctx, querySentence,
+		propertyChange.UserId,
+		propertyChange.Name,
+		propertyChange.From,
+		propertyChange.To,
+		propertyChange.CreatedAt,
+		propertyChange.CreatedBy,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+func (sqr *SqliteImplementation) ListPropertyChangesByUserId(ctx context.Context, id string, pageInfo *models.PageInfo) ([]*models.PropertyChange, *models.PageInfo, error) {
+	//* Si 'pageInfo' no tiene valores, lo poblamos.
+	pageInfo.OrderBy = DEFAULT_ORDER_BY
+	if pageInfo.Size == 0 {
+		pageInfo.Size = DEFAULT_PAGE_SIZE
+	}
+
+	if pageInfo.TotalPages == 0 || pageInfo.TotalItems == 0 {
+		//* Construimos la consulta SQL.
+		querySentence := `
+			SELECT count(*) AS total_items
+			FROM users_properties_changes_history WHERE user_id = $1
+		`
+		//* Ejecutamos la consulta.
+		rows, err := sqr.executor().QueryContext(ctx, querySentence,
+			id,
+		)
+		if err != nil {
+			pageInfo.TotalPages = 0
+			pageInfo.TotalItems = 0
+
+			return nil, pageInfo, err
+		}
+		//* Cerramos la consulta al final de éste proceso.
+		defer rows.Close()
+
+		//* Obtenemos los resultado de la ejecución.
+		for rows.Next() {
+			if err = rows.Scan(
+				&pageInfo.TotalItems,
+			); err != nil {
+				pageInfo.TotalPages = 0
+				pageInfo.TotalItems = 0
+
+				return nil, pageInfo, err
+			}
+		}
+		if err = rows.Err(); err != nil {
+			pageInfo.TotalPages = 0
+			pageInfo.TotalItems = 0
+
+			return nil, pageInfo, err
+		}
+
+		//* Calculamos el total de páginas en función del número de elementos por cada una.
+		pageInfo.TotalPages = pageInfo.TotalItems / pageInfo.Size
+		//* Si los elementos no caben en un total de páginas exacto, añadimos una página mas.
+		if pageInfo.TotalItems%pageInfo.Size != 0 {
+			pageInfo.TotalPages++
+		}
+		pageInfo.Token = 1
+	}
+
+	//* Construimos la consulta SQL.
+	querySentence := fmt.Sprintf(`
+		SELECT
+			user_id, name, changed_from, changed_to, created_at, created_by
+		FROM users_properties_changes_history WHERE user_id = $1
+		ORDER BY %s LIMIT $2 OFFSET $3
+	`, pageInfo.OrderBy)
+	//* Ejecutamos la consulta.
+	rows, err := sqr.executor().QueryContext(ctx, querySentence,
+		id,
+		pageInfo.Size,
+		(pageInfo.Token-1)*pageInfo.Size,
+	)
+	if err != nil {
+		pageInfo.TotalPages = 0
+		pageInfo.TotalItems = 0
+
+		return nil, pageInfo, err
+	}
+	//* Cerramos la consulta al final de éste proceso.
+	defer rows.Close()
+
+	//* Obtenemos los resultados de la consulta.
+	//* Dado que esperamos una lista, usamos un 'array' vacío.
+	var propertyChanges []*models.PropertyChange
+	for rows.Next() {
+		//* En cada iteración:
+		//* Creamos un usuario vacío y los campos de tiempo adicionales necesarios nuevamente.
+		propertyChange := new(models.PropertyChange)
+		var createdAt sql.NullTime
+
+		//* Poblamos 'user' y los campos de tiempo.
+		if err = rows.Scan(
+			&propertyChange.UserId,
+			&propertyChange.Name,
+			&propertyChange.From,
+			&propertyChange.To,
+			&createdAt,
+			&propertyChange.CreatedBy,
+		); err != nil {
+			pageInfo.TotalPages = 0
+			pageInfo.TotalItems = 0
+
+			return nil, pageInfo, err
+		}
+
+		//* Si los campos 'sql.NullTime' son válidos, es decir que no son nulos, los asignamos a 'user'.
+		if createdAt.Valid {
+			propertyChange.CreatedAt = createdAt.Time
+		}
+
+		//* Añadimos al 'array' el nuevo usuario.
+		propertyChanges = append(propertyChanges, propertyChange)
+	}
+	if err = rows.Err(); err != nil {
+		pageInfo.TotalPages = 0
+		pageInfo.TotalItems = 0
+
+		return nil, pageInfo, err
+	}
+
+	//* Actualizamos 'pageInfo' y la preparamos para la siguiente iteración, si la hubiera.
+	pageInfo.Token++
+
+	//* Devolvemos la información obtenida.
+	return propertyChanges, pageInfo, nil
+}
+func (sqr *SqliteImplementation) ListPropertyChangesByUserIdAndName(ctx context.Context, id, name string, pageInfo *models.PageInfo) ([]*models.PropertyChange, *models.PageInfo, error) {
+	//* Si 'pageInfo' no tiene valores, lo poblamos.
+	pageInfo.OrderBy = DEFAULT_ORDER_BY
+	if pageInfo.Size == 0 {
+		pageInfo.Size = DEFAULT_PAGE_SIZE
+	}
+
+	if pageInfo.TotalPages == 0 || pageInfo.TotalItems == 0 {
+		//* Construimos la consulta SQL.
+		querySentence := `
+			SELECT count(*) AS total_items
+			FROM users_properties_changes_history WHERE user_id = $1 AND name = $2
+		`
+		//* Ejecutamos la consulta.
+		rows, err := sqr.executor().QueryContext(ctx, querySentence,
+			id,
+			name,
+		)
+		if err != nil {
+			pageInfo.TotalPages = 0
+			pageInfo.TotalItems = 0
+
+			return nil, pageInfo, err
+		}
+		//* Cerramos la consulta al final de éste proceso.
+		defer rows.Close()
+
+		//* Obtenemos los resultado de la ejecución.
+		for rows.Next() {
+			if err = rows.Scan(
+				&pageInfo.TotalItems,
+			); err != nil {
+				pageInfo.TotalPages = 0
+				pageInfo.TotalItems = 0
+
+				return nil, pageInfo, err
+			}
+		}
+		if err = rows.Err(); err != nil {
+			pageInfo.TotalPages = 0
+			pageInfo.TotalItems = 0
+
+			return nil, pageInfo, err
+		}
+
+		//* Calculamos el total de páginas en función del número de elementos por cada una.
+		pageInfo.TotalPages = pageInfo.TotalItems / pageInfo.Size
+		//* Si los elementos no caben en un total de páginas exacto, añadimos una página mas.
+		if pageInfo.TotalItems%pageInfo.Size != 0 {
+			pageInfo.TotalPages++
+		}
+		pageInfo.Token = 1
+	}
+
+	//* Construimos la consulta SQL.
+	querySentence := fmt.Sprintf(`
+		SELECT
+			user_id, name, changed_from, changed_to, created_at, created_by
+		FROM users_properties_changes_history WHERE user_id = $1 AND name = $2
+		ORDER BY %s LIMIT $3 OFFSET $4
+	`, pageInfo.OrderBy)
+	//* Ejecutamos la consulta.
+	rows, err := sqr.executor().QueryContext(ctx, querySentence,
+		id,
+		name,
+		pageInfo.Size,
+		(pageInfo.Token-1)*pageInfo.Size,
+	)
+	if err != nil {
+		pageInfo.TotalPages = 0
+		pageInfo.TotalItems = 0
+
+		return nil, pageInfo, err
+	}
+	//* Cerramos la consulta al final de éste proceso.
+	defer rows.Close()
+
+	//* Obtenemos los resultados de la consulta.
+	//* Dado que esperamos una lista, usamos un 'array' vacío.
+	var propertyChanges []*models.PropertyChange
+	for rows.Next() {
+		//* En cada iteración:
+		//* Creamos un usuario vacío y los campos de tiempo adicionales necesarios nuevamente.
+		propertyChange := new(models.PropertyChange)
+		var createdAt sql.NullTime
+
+		//* Poblamos 'user' y los campos de tiempo.
+		if err = rows.Scan(
+			&propertyChange.UserId,
+			&propertyChange.Name,
+			&propertyChange.From,
+			&propertyChange.To,
+			&createdAt,
+			&propertyChange.CreatedBy,
+		); err != nil {
+			pageInfo.TotalPages = 0
+			pageInfo.TotalItems = 0
+
+			return nil, pageInfo, err
+		}
+
+		//* Si los campos 'sql.NullTime' son válidos, es decir que no son nulos, los asignamos a 'user'.
+		if createdAt.Valid {
+			propertyChange.CreatedAt = createdAt.Time
+		}
+
+		//* Añadimos al 'array' el nuevo usuario.
+		propertyChanges = append(propertyChanges, propertyChange)
+	}
+	if err = rows.Err(); err != nil {
+		pageInfo.TotalPages = 0
+		pageInfo.TotalItems = 0
+
+		return nil, pageInfo, err
+	}
+
+	//* Actualizamos 'pageInfo' y la preparamos para la siguiente iteración, si la hubiera.
+	pageInfo.Token++
+
+	//* Devolvemos la información obtenida.
+	return propertyChanges, pageInfo, nil
+}
+
+func (sqr *SqliteImplementation) InsertPasswordResetToken(ctx context.Context, passwordResetToken *models.PasswordResetToken) error {
+	//* Construimos la sentencia SQL.
+	querySentence := `
+		INSERT INTO users_password_reset_tokens (
+			id, user_id, token_hash, expires_at, created_at
+		) VALUES ($1, $2, $3, $4, $5)
+	`
+	//* Ejecutamos la sentencia.
+	if _, err := sqr.executor().ExecContext(ctx, querySentence,
+		passwordResetToken.Id,
+		passwordResetToken.UserId,
+		passwordResetToken.TokenHash,
+		passwordResetToken.ExpiresAt,
+		passwordResetToken.CreatedAt,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+func (sqr *SqliteImplementation) GetPasswordResetTokenByHash(ctx context.Context, tokenHash string) (*models.PasswordResetToken, error) {
+	//* Construimos la consulta SQL.
+	querySentence := `
+		SELECT
+			id, user_id, token_hash, expires_at, used_at, created_at
+		FROM users_password_reset_tokens
+		WHERE token_hash = $1
+	`
+	//* Ejecutamos la consulta.
+	rows, err := sqr.executor().QueryContext(ctx, querySentence,
+		tokenHash,
+	)
+	if err != nil {
+		return nil, err
+	}
+	//* Cerramos la consulta al final de éste proceso.
+	defer rows.Close()
+
+	//* Obtenemos los resultados de la ejecución.
+	//* Si no hay coincidencias, devolvemos un 'token' nulo.
+	var passwordResetToken *models.PasswordResetToken
+	for rows.Next() {
+		passwordResetToken = new(models.PasswordResetToken)
+		var usedAt sql.NullTime
+		if err := rows.Scan(
+			&passwordResetToken.Id,
+			&passwordResetToken.UserId,
+			&passwordResetToken.TokenHash,
+			&passwordResetToken.ExpiresAt,
+			&usedAt,
+			&passwordResetToken.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		//* Si los campos 'sql.NullTime' son válidos, es decir que no son nulos, los asignamos al 'token'.
+		if usedAt.Valid {
+			passwordResetToken.UsedAt = usedAt.Time
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	//* Devolvemos la información obtenida.
+	return passwordResetToken, nil
+}
+func (sqr *SqliteImplementation) UpdatePasswordResetToken(ctx context.Context, passwordResetToken *models.PasswordResetToken) error {
+	//* Construimos la sentencia SQL.
+	//* Sólo se marca como usado si no lo estaba ya, así un mismo 'token' no puede consumirse dos veces.
+	querySentence := `
+		UPDATE users_password_reset_tokens SET
+			used_at = $1
+		WHERE id = $2 AND used_at IS NULL
+	`
+	//* Ejecutamos la sentencia.
+	result, err := sqr.executor().ExecContext(ctx, querySentence,
+		passwordResetToken.UsedAt,
+		passwordResetToken.Id,
+	)
+	if err != nil {
+		return err
+	}
+	affectedRows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affectedRows == 0 {
+		return ErrTokenAlreadyUsed
+	}
+
+	return nil
+}
+func (sqr *SqliteImplementation) UsePasswordResetTokensByUserId(ctx context.Context, userId string, usedAt time.Time) error {
+	//* Construimos la sentencia SQL.
+	querySentence := `
+		UPDATE users_password_reset_tokens SET
+			used_at = $1
+		WHERE user_id = $2 AND used_at IS NULL
+	`
+	//* Ejecutamos la sentencia.
+	if _, err := sqr.executor().ExecContext(ctx, querySentence,
+		usedAt,
+		userId,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (sqr *SqliteImplementation) InsertEmailVerificationToken(ctx context.Context, emailVerificationToken *models.EmailVerificationToken) error {
+	//* Construimos la sentencia SQL.
+	querySentence := `
+		INSERT INTO users_email_verification_tokens (
+			id, user_id, email, purpose, token_hash, expires_at, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	//* Ejecutamos la sentencia.
+	if _, err := sqr.executor().ExecContext(ctx, querySentence,
+		emailVerificationToken.Id,
+		emailVerificationToken.UserId,
+		emailVerificationToken.Email,
+		emailVerificationToken.Purpose,
+		emailVerificationToken.TokenHash,
+		emailVerificationToken.ExpiresAt,
+		emailVerificationToken.CreatedAt,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+func (sqr *SqliteImplementation) GetEmailVerificationTokenByHash(ctx context.Context, tokenHash string) (*models.EmailVerificationToken, error) {
+	//* Construimos la consulta SQL.
+	querySentence := `
+		SELECT
+			id, user_id, email, purpose, token_hash, expires_at, used_at, created_at
+		FROM users_email_verification_tokens
+		WHERE token_hash = $1
+	`
+	//* Ejecutamos la consulta.
+	rows, err := sqr.executor().QueryContext(ctx, querySentence,
+		tokenHash,
+	)
+	if err != nil {
+		return nil, err
+	}
+	//* Cerramos la consulta al final de éste proceso.
+	defer rows.Close()
+
+	//* Obtenemos los resultados de la ejecución.
+	//* Si no hay coincidencias, devolvemos un 'token' nulo.
+	var emailVerificationToken *models.EmailVerificationToken
+	for rows.Next() {
+		emailVerificationToken = new(models.EmailVerificationToken)
+		var usedAt sql.NullTime
+		if err := rows.Scan(
+			&emailVerificationToken.Id,
+			&emailVerificationToken.UserId,
+			&emailVerificationToken.Email,
+			&emailVerificationToken.Purpose,
+			&emailVerificationToken.TokenHash,
+			&emailVerificationToken.ExpiresAt,
+			&usedAt,
+			&emailVerificationToken.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		//* Si los campos 'sql.NullTime' son válidos, es decir que no son nulos, los asignamos al 'token'.
+		if usedAt.Valid {
+			emailVerificationToken.UsedAt = usedAt.Time
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	//* Devolvemos la información obtenida.
+	return emailVerificationToken, nil
+}
+func (sqr *SqliteImplementation) UpdateEmailVerificationToken(ctx context.Context, emailVerificationToken *models.EmailVerificationToken) error {
+	//* Construimos la sentencia SQL.
+	//* Sólo se marca como usado si no lo estaba ya, así un mismo 'token' no puede consumirse dos veces.
+	querySentence := `
+		UPDATE users_email_verification_tokens SET
+			used_at = $1
+		WHERE id = $2 AND used_at IS NULL
+	`
+	//* Ejecutamos la sentencia.
+	result, err := sqr.executor().ExecContext(ctx, querySentence,
+		emailVerificationToken.UsedAt,
+		emailVerificationToken.Id,
+	)
+	if err != nil {
+		return err
+	}
+	affectedRows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affectedRows == 0 {
+		return ErrTokenAlreadyUsed
+	}
+
+	return nil
+}
+
+func (sqr *SqliteImplementation) InsertRefreshToken(ctx context.Context, refreshToken *models.RefreshToken) error {
+	//* Construimos la sentencia SQL.
+	querySentence := `
+		INSERT INTO users_refresh_tokens (
+			id, user_id, family_id, client_id, scopes, token_hash, auth_time, expires_at, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+	//* Ejecutamos la sentencia.
+	if _, err := sqr.executor().ExecContext(ctx, querySentence,
+		refreshToken.Id,
+		refreshToken.UserId,
+		refreshToken.FamilyId,
+		refreshToken.ClientId,
+		joinList(refreshToken.Scopes),
+		refreshToken.TokenHash,
+		nullTime(refreshToken.AuthTime),
+		refreshToken.ExpiresAt,
+		refreshToken.CreatedAt,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+func (sqr *SqliteImplementation) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	//* Construimos la consulta SQL.
+	querySentence := `
+		SELECT
+			id, user_id, family_id, client_id, scopes, token_hash, auth_time, expires_at, used_at, revoked_at, created_at
+		FROM users_refresh_tokens
+		WHERE token_hash = $1
+	`
+	//* Ejecutamos la consulta.
+	rows, err := sqr.executor().QueryContext(ctx, querySentence,
+		tokenHash,
+	)
+	if err != nil {
+		return nil, err
+	}
+	//* Cerramos la consulta al final de éste proceso.
+	defer rows.Close()
+
+	//* Obtenemos los resultados de la ejecución.
+	//* Si no hay coincidencias, devolvemos un 'token' nulo.
+	var refreshToken *models.RefreshToken
+	for rows.Next() {
+		refreshToken = new(models.RefreshToken)
+		var scopes string
+		var authTime, usedAt, revokedAt sql.NullTime
+		if err := rows.Scan(
+			&refreshToken.Id,
+			&refreshToken.UserId,
+			&refreshToken.FamilyId,
+			&refreshToken.ClientId,
+			&scopes,
+			&refreshToken.TokenHash,
+			&authTime,
+			&refreshToken.ExpiresAt,
+			&usedAt,
+			&revokedAt,
+			&refreshToken.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		refreshToken.Scopes = splitList(scopes)
+
+		//* Si los campos 'sql.NullTime' son válidos, es decir que no son nulos, los asignamos al 'token'.
+		if authTime.Valid {
+			refreshToken.AuthTime = authTime.Time
+		}
+		if usedAt.Valid {
+			refreshToken.UsedAt = usedAt.Time
+		}
+		if revokedAt.Valid {
+			refreshToken.RevokedAt = revokedAt.Time
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	//* Devolvemos la información obtenida.
+	return refreshToken, nil
+}
+func (sqr *SqliteImplementation) UpdateRefreshToken(ctx context.Context, refreshToken *models.RefreshToken) error {
+	//* Construimos la sentencia SQL.
+	//* Sólo se marca como usado si no lo estaba ya, así dos peticiones simultáneas no pueden rotar el mismo 'token'.
+	querySentence := `
+		UPDATE users_refresh_tokens SET
+			used_at = $1
+		WHERE id = $2 AND used_at IS NULL
+	`
+	//* Ejecutamos la sentencia.
+	result, err := sqr.executor().ExecContext(ctx, querySentence,
+		refreshToken.UsedAt,
+		refreshToken.Id,
+	)
+	if err != nil {
+		return err
+	}
+	affectedRows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affectedRows == 0 {
+		return ErrTokenAlreadyUsed
+	}
+
+	return nil
+}
+func (sqr *SqliteImplementation) RevokeRefreshTokenFamily(ctx context.Context, familyId string, revokedAt time.Time) error {
+	//* Construimos la sentencia SQL.
+	querySentence := `
+		UPDATE users_refresh_tokens SET
+			revoked_at = $1
+		WHERE family_id = $2 AND revoked_at IS NULL
+	`
+	//* Ejecutamos la sentencia.
+	if _, err := sqr.executor().ExecContext(ctx, querySentence,
+		revokedAt,
+		familyId,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+func (sqr *SqliteImplementation) RevokeRefreshTokensByUserId(ctx context.Context, userId string, revokedAt time.Time) error {
+	//* Construimos la sentencia SQL.
+	querySentence := `
+		UPDATE users_refresh_tokens SET
+			revoked_at = $1
+		WHERE user_id = $2 AND revoked_at IS NULL
+	`
+	//* Ejecutamos la sentencia.
+	if _, err := sqr.executor().ExecContext(ctx, querySentence,
+		revokedAt,
+		userId,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (sqr *SqliteImplementation) InsertRevokedToken(ctx context.Context, revokedToken *models.RevokedToken) error {
+	//* Construimos la sentencia SQL.
+	//* Revocar dos veces el mismo 'token' no es un error.
+	querySentence := `
+		INSERT INTO users_revoked_tokens (
+			token_id, user_id, client_id, expires_at, revoked_at
+		) VALUES ($1, NULLIF($2, ''), $3, $4, $5)
+		ON CONFLICT (token_id) DO NOTHING
+	`
+	//* Ejecutamos la sentencia.
+	//* Los 'token' de cuentas de servicio no tienen 'user', sólo cliente.
+	if _, err := sqr.executor().ExecContext(ctx, querySentence,
+		revokedToken.TokenId,
+		revokedToken.UserId,
+		revokedToken.ClientId,
+		revokedToken.ExpiresAt,
+		revokedToken.RevokedAt,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+func (sqr *SqliteImplementation) IsTokenRevoked(ctx context.Context, tokenId string) (bool, error) {
+	//* Construimos la consulta SQL.
+	querySentence := `
+		SELECT count(*) AS total_items
+		FROM users_revoked_tokens
+		WHERE token_id = $1
+	`
+	//* Ejecutamos la consulta.
+	var totalItems int
+	if err := sqr.executor().QueryRowContext(ctx, querySentence,
+		tokenId,
+	).Scan(&totalItems); err != nil {
+		return false, err
+	}
+
+	//* Devolvemos la información obtenida.
+	return totalItems > 0, nil
+}
+func (sqr *SqliteImplementation) GetUserTokensRevokedBefore(ctx context.Context, userId string) (time.Time, error) {
+	//* Construimos la consulta SQL.
+	querySentence := `
+		SELECT revoked_before
+		FROM users_tokens_revocations
+		WHERE user_id = $1
+	`
+	//* Ejecutamos la consulta.
+	//* Si el 'user' nunca cerró todas sus sesiones, devolvemos un momento nulo.
+	var revokedBefore time.Time
+	if err := sqr.executor().QueryRowContext(ctx, querySentence,
+		userId,
+	).Scan(&revokedBefore); err != nil && err != sql.ErrNoRows {
+		return time.Time{}, err
+	}
+
+	//* Devolvemos la información obtenida.
+	return revokedBefore, nil
+}
+func (sqr *SqliteImplementation) SetUserTokensRevokedBefore(ctx context.Context, userId string, revokedBefore time.Time) error {
+	//* Construimos la sentencia SQL.
+	querySentence := `
+		INSERT INTO users_tokens_revocations (
+			user_id, revoked_before
+		) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET revoked_before = EXCLUDED.revoked_before
+	`
+	//* Ejecutamos la sentencia.
+	if _, err := sqr.executor().ExecContext(ctx, querySentence,
+		userId,
+		revokedBefore,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (sqr *SqliteImplementation) UpsertUserMfa(ctx context.Context, userMfa *models.UserMfa) error {
+	//* Construimos la sentencia SQL.
+	//* Un 'user' sólo tiene un secreto: si repite el alta antes de confirmarla, sustituimos el anterior.
+	querySentence := `
+		INSERT INTO users_mfa (
+			user_id, secret, last_used_step, enabled_at, created_at
+		) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id) DO UPDATE SET
+			secret = EXCLUDED.secret, last_used_step = EXCLUDED.last_used_step,
+			enabled_at = EXCLUDED.enabled_at, created_at = EXCLUDED.created_at
+	`
+	//* Ejecutamos la sentencia.
+	if _, err := sqr.executor().ExecContext(ctx, querySentence,
+		userMfa.UserId,
+		userMfa.Secret,
+		userMfa.LastUsedStep,
+		nullTime(userMfa.EnabledAt),
+		userMfa.CreatedAt,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+func (sqr *SqliteImplementation) InsertRecoveryCode(ctx context.Context, recoveryCode *models.RecoveryCode) error {
+	//* Construimos la sentencia SQL.
+	querySentence := `
+		INSERT INTO users_recovery_codes (
+			id, user_id, code_hash, created_at
+		) VALUES ($1, $2, $3, $4)
+	`
+	//* Ejecutamos la sentencia.
+	if _, err := sqr.executor().ExecContext(ctx, querySentence,
+		recoveryCode.Id,
+		recoveryCode.UserId,
+		recoveryCode.CodeHash,
+		recoveryCode.CreatedAt,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+func (sqr *SqliteImplementation) GetUserMfaByUserId(ctx context.Context, userId string) (*models.UserMfa, error) {
+	//* Construimos la consulta SQL.
+	querySentence := `
+		SELECT
+			user_id, secret, last_used_step, enabled_at, created_at
+		FROM users_mfa
+		WHERE user_id = $1
+	`
+	//* Ejecutamos la consulta.
+	rows, err := sqr.executor().QueryContext(ctx, querySentence,
+		userId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	//* Cerramos la consulta al final de éste proceso.
+	defer rows.Close()
+
+	//* Obtenemos los resultados de la ejecución.
+	//* Si el 'user' no tiene MFA, devolvemos un valor nulo.
+	var userMfa *models.UserMfa
+	for rows.Next() {
+		userMfa = new(models.UserMfa)
+		var enabledAt sql.NullTime
+		if err := rows.Scan(
+			&userMfa.UserId,
+			&userMfa.Secret,
+			&userMfa.LastUsedStep,
+			&enabledAt,
+			&userMfa.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		//* Si los campos 'sql.NullTime' son válidos, es decir que no son nulos, los asignamos.
+		if enabledAt.Valid {
+			userMfa.EnabledAt = enabledAt.Time
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	//* Devolvemos la información obtenida.
+	return userMfa, nil
+}
+func (sqr *SqliteImplementation) GetRecoveryCodeByUserIdAndHash(ctx context.Context, userId, codeHash string) (*models.RecoveryCode, error) {
+	//* Construimos la consulta SQL.
+	querySentence := `
+		SELECT
+			id, user_id, code_hash, used_at, created_at
+		FROM users_recovery_codes
+		WHERE user_id = $1 AND code_hash = $2
+	`
+	//* Ejecutamos la consulta.
+	rows, err := sqr.executor().QueryContext(ctx, querySentence,
+		userId,
+		codeHash,
+	)
+	if err != nil {
+		return nil, err
+	}
+	//* Cerramos la consulta al final de éste proceso.
+	defer rows.Close()
+
+	//* Obtenemos los resultados de la ejecución.
+	//* Si no hay coincidencias, devolvemos un código nulo.
+	var recoveryCode *models.RecoveryCode
+	for rows.Next() {
+		recoveryCode = new(models.RecoveryCode)
+		var usedAt sql.NullTime
+		if err := rows.Scan(
+			&recoveryCode.Id,
+			&recoveryCode.UserId,
+			&recoveryCode.CodeHash,
+			&usedAt,
+			&recoveryCode.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		//* Si los campos 'sql.NullTime' son válidos, es decir que no son nulos, los asignamos.
+		if usedAt.Valid {
+			recoveryCode.UsedAt = usedAt.Time
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	//* Devolvemos la información obtenida.
+	return recoveryCode, nil
+}
+func (sqr *SqliteImplementation) UpdateUserMfa(ctx context.Context, userMfa *models.UserMfa) error {
+	//* Construimos la sentencia SQL.
+	//* El paso sólo puede avanzar: así un mismo código TOTP no sirve dos veces.
+	querySentence := `
+		UPDATE users_mfa SET
+			last_used_step = $1, enabled_at = $2
+		WHERE user_id = $3 AND last_used_step < $1
+	`
+	//* Ejecutamos la sentencia.
+	result, err := sqr.executor().ExecContext(ctx, querySentence,
+		userMfa.LastUsedStep,
+		nullTime(userMfa.EnabledAt),
+		userMfa.UserId,
+	)
+	if err != nil {
+		return err
+	}
+	affectedRows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affectedRows == 0 {
+		return ErrTokenAlreadyUsed
+	}
+
+	return nil
+}
+func (sqr *SqliteImplementation) UpdateRecoveryCode(ctx context.Context, recoveryCode *models.RecoveryCode) error {
+	//* Construimos la sentencia SQL.
+	querySentence := `
+		UPDATE users_recovery_codes SET
+			used_at = $1
+		WHERE id = $2 AND used_at IS NULL
+	`
+	//* Ejecutamos la sentencia.
+	result, err := sqr.executor().ExecContext(ctx, querySentence,
+		recoveryCode.UsedAt,
+		recoveryCode.Id,
+	)
+	if err != nil {
+		return err
+	}
+	affectedRows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affectedRows == 0 {
+		return ErrTokenAlreadyUsed
+	}
+
+	return nil
+}
+func (sqr *SqliteImplementation) DeleteUserMfa(ctx context.Context, userId string) error {
+	//* Construímos las sentencia SQL.
+	querySentence := `
+		DELETE FROM users_mfa
+		WHERE user_id = $1
+	`
+	//* Ejecutamos la sentencia.
+	if _, err := sqr.executor().ExecContext(ctx, querySentence,
+		userId,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+func (sqr *SqliteImplementation) DeleteRecoveryCodesByUserId(ctx context.Context, userId string) error {
+	//* Construímos las sentencia SQL.
+	querySentence := `
+		DELETE FROM users_recovery_codes
+		WHERE user_id = $1
+	`
+	//* Ejecutamos la sentencia.
+	if _, err := sqr.executor().ExecContext(ctx, querySentence,
+		userId,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (sqr *SqliteImplementation) InsertWebAuthnCredential(ctx context.Context, credential *models.WebAuthnCredential) error {
+	//* Construimos la sentencia SQL.
+	querySentence := `
+		INSERT INTO users_webauthn_credentials (
+			id, user_id, name, public_key, sign_count, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	//* Ejecutamos la sentencia.
+	if _, err := sqr.executor().ExecContext(ctx, querySentence,
+		credential.Id,
+		credential.UserId,
+		credential.Name,
+		credential.PublicKey,
+		int64(credential.SignCount),
+		credential.CreatedAt,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+func (sqr *SqliteImplementation) InsertWebAuthnChallenge(ctx context.Context, challenge *models.WebAuthnChallenge) error {
+	//* Construimos la sentencia SQL.
+	querySentence := `
+		INSERT INTO webauthn_challenges (
+			id, user_id, ceremony, challenge, expires_at, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	//* Ejecutamos la sentencia.
+	if _, err := sqr.executor().ExecContext(ctx, querySentence,
+		challenge.Id,
+		challenge.UserId,
+		challenge.Ceremony,
+		challenge.Challenge,
+		challenge.ExpiresAt,
+		challenge.CreatedAt,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+func (sqr *SqliteImplementation) GetWebAuthnCredentialById(ctx context.Context, id string) (*models.WebAuthnCredential, error) {
+	//* Construimos la consulta SQL.
+	querySentence := `
+		SELECT
+			id, user_id, name, public_key, sign_count, last_used_at, created_at
+		FROM users_webauthn_credentials
+		WHERE id = $1
+	`
+	//* Ejecutamos la consulta.
+	rows, err := sqr.executor().QueryContext(ctx, querySentence,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	//* Cerramos la consulta al final de éste proceso.
+	defer rows.Close()
+
+	//* Obtenemos los resultados de la ejecución.
+	//* Si no hay coincidencias, devolvemos una credencial nula.
+	var credential *models.WebAuthnCredential
+	for rows.Next() {
+		if credential, err = scanWebAuthnCredential(rows); err != nil {
+			return nil, err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	//* Devolvemos la información obtenida.
+	return credential, nil
+}
+func (sqr *SqliteImplementation) ListWebAuthnCredentialsByUserId(ctx context.Context, userId string) ([]*models.WebAuthnCredential, error) {
+	//* Construimos la consulta SQL.
+	querySentence := `
+		SELECT
+			id, user_id, name, public_key, sign_count, last_used_at, created_at
+		FROM users_webauthn_credentials
+		WHERE user_id = $1
+		ORDER BY created_at
+	`
+	//* Ejecutamos la consulta.
+	rows, err := sqr.executor().QueryContext(ctx, querySentence,
+		userId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	//* Cerramos la consulta al final de éste proceso.
+	defer rows.Close()
+
+	//* Obtenemos los resultados de la consulta.
+	//* Dado que esperamos una lista, usamos un 'array' vacío.
+	var credentials []*models.WebAuthnCredential
+	for rows.Next() {
+		credential, err := scanWebAuthnCredential(rows)
+		if err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, credential)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	//* Devolvemos la información obtenida.
+	return credentials, nil
+}
+
+func (sqr *SqliteImplementation) GetWebAuthnChallengeById(ctx context.Context, id string) (*models.WebAuthnChallenge, error) {
+	//* Construimos la consulta SQL.
+	querySentence := `
+		SELECT
+			id, user_id, ceremony, challenge, expires_at, used_at, created_at
+		FROM webauthn_challenges
+		WHERE id = $1
+	`
+	//* Ejecutamos la consulta.
+	rows, err := sqr.executor().QueryContext(ctx, querySentence,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	//* Cerramos la consulta al final de éste proceso.
+	defer rows.Close()
+
+	//* Obtenemos los resultados de la ejecución.
+	//* Si no hay coincidencias, devolvemos un desafío nulo.
+	var challenge *models.WebAuthnChallenge
+	for rows.Next() {
+		challenge = new(models.WebAuthnChallenge)
+		var userId sql.NullString
+		var usedAt sql.NullTime
+		if err := rows.Scan(
+			&challenge.Id,
+			&userId,
+			&challenge.Ceremony,
+			&challenge.Challenge,
+			&challenge.ExpiresAt,
+			&usedAt,
+			&challenge.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		//* Si los campos 'sql.Null*' son válidos, es decir que no son nulos, los asignamos.
+		if userId.Valid {
+			challenge.UserId = userId.String
+		}
+		if usedAt.Valid {
+			challenge.UsedAt = usedAt.Time
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	//* Devolvemos la información obtenida.
+	return challenge, nil
+}
+func (sqr *SqliteImplementation) UpdateWebAuthnCredential(ctx context.Context, credential *models.WebAuthnCredential) error {
+	//* Construimos la sentencia SQL.
+	querySentence := `
+		UPDATE users_webauthn_credentials SET
+			sign_count = $1, last_used_at = $2
+		WHERE id = $3
+	`
+	//* Ejecutamos la sentencia.
+	if _, err := sqr.executor().ExecContext(ctx, querySentence,
+		int64(credential.SignCount),
+		nullTime(credential.LastUsedAt),
+		credential.Id,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+func (sqr *SqliteImplementation) UpdateWebAuthnChallenge(ctx context.Context, challenge *models.WebAuthnChallenge) error {
+	//* Construimos la sentencia SQL.
+	querySentence := `
+		UPDATE webauthn_challenges SET
+			used_at = $1
+		WHERE id = $2 AND used_at IS NULL
+	`
+	//* Ejecutamos la sentencia.
+	result, err := sqr.executor().ExecContext(ctx, querySentence,
+		challenge.UsedAt,
+		challenge.Id,
+	)
+	if err != nil {
+		return err
+	}
+	affectedRows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affectedRows == 0 {
+		return ErrTokenAlreadyUsed
+	}
+
+	return nil
+}
+
+func (sqr *SqliteImplementation) InsertSigningKey(ctx context.Context, signingKey *models.SigningKey) error {
+	//* Construimos la sentencia SQL.
+	querySentence := `
+		INSERT INTO signing_keys (
+			id, algorithm, private_key, created_at
+		) VALUES ($1, $2, $3, $4)
+	`
+	//* Ejecutamos la sentencia.
+	if _, err := sqr.executor().ExecContext(ctx, querySentence,
+		signingKey.Id,
+		signingKey.Algorithm,
+		signingKey.PrivateKey,
+		signingKey.CreatedAt,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+func (sqr *SqliteImplementation) ListSigningKeys(ctx context.Context, retiredAfter time.Time) ([]*models.SigningKey, error) {
+	//* Construimos la consulta SQL.
+	//* Sólo interesan las claves en uso o retiradas tan recientemente que aún validan 'token'.
+	querySentence := `
+		SELECT
+			id, algorithm, private_key, created_at, retired_at
+		FROM signing_keys
+		WHERE retired_at IS NULL OR retired_at > $1
+		ORDER BY created_at DESC
+	`
+	//* Ejecutamos la consulta.
+	rows, err := sqr.executor().QueryContext(ctx, querySentence,
+		retiredAfter,
+	)
+	if err != nil {
+		return nil, err
+	}
+	//* Cerramos la consulta al final de éste proceso.
+	defer rows.Close()
+
+	//* Obtenemos los resultados de la consulta.
+	//* Dado que esperamos una lista, usamos un 'array' vacío.
+	var signingKeys []*models.SigningKey
+	for rows.Next() {
+		signingKey := new(models.SigningKey)
+		var retiredAt sql.NullTime
+		if err := rows.Scan(
+			&signingKey.Id,
+			&signingKey.Algorithm,
+			&signingKey.PrivateKey,
+			&signingKey.CreatedAt,
+			&retiredAt,
+		); err != nil {
+			return nil, err
+		}
+
+		//* Si los campos 'sql.NullTime' son válidos, es decir que no son nulos, los asignamos.
+		if retiredAt.Valid {
+			signingKey.RetiredAt = retiredAt.Time
+		}
+
+		signingKeys = append(signingKeys, signingKey)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	//* Devolvemos la información obtenida.
+	return signingKeys, nil
+}
+func (sqr *SqliteImplementation) UpdateSigningKey(ctx context.Context, signingKey *models.SigningKey) error {
+	//* Construimos la sentencia SQL.
+	querySentence := `
+		UPDATE signing_keys SET
+			retired_at = $1
+		WHERE id = $2
+	`
+	//* Ejecutamos la sentencia.
+	if _, err := sqr.executor().ExecContext(ctx, querySentence,
+		nullTime(signingKey.RetiredAt),
+		signingKey.Id,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (sqr *SqliteImplementation) InsertOAuthClient(ctx context.Context, client *models.OAuthClient) error {
+	//* Construimos la sentencia SQL.
+	querySentence := `
+		INSERT INTO oauth_clients (
+			id, name, redirect_uris, scopes, confidential, secret_hash, created_at, created_by
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	//* Ejecutamos la sentencia.
+	if _, err := sqr.executor().ExecContext(ctx, querySentence,
+		client.Id,
+		client.Name,
+		joinList(client.RedirectURIs),
+		joinList(client.Scopes),
+		client.Confidential,
+		client.SecretHash,
+		client.CreatedAt,
+		client.CreatedBy,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+func (sqr *SqliteImplementation) GetOAuthClientById(ctx context.Context, id string) (*models.OAuthClient, error) {
+	//* Construimos la consulta SQL.
+	querySentence := `
+		SELECT
+			id, name, redirect_uris, scopes, confidential, secret_hash, created_at, created_by
+		FROM oauth_clients
+		WHERE id = $1
+	`
+	//* Ejecutamos la consulta.
+	rows, err := sqr.executor().QueryContext(ctx, querySentence,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	//* Cerramos la consulta al final de éste proceso.
+	defer rows.Close()
+
+	//* Obtenemos los resultados de la ejecución.
+	//* Si no hay coincidencias, devolvemos un cliente nulo.
+	var client *models.OAuthClient
+	for rows.Next() {
+		if client, err = scanOAuthClient(rows); err != nil {
+			return nil, err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	//* Devolvemos la información obtenida.
+	return client, nil
+}
+func (sqr *SqliteImplementation) ListOAuthClientsByCreator(ctx context.Context, createdBy string) ([]*models.OAuthClient, error) {
+	//* Construimos la consulta SQL.
+	querySentence := `
+		SELECT
+			id, name, redirect_uris, scopes, confidential, secret_hash, created_at, created_by
+		FROM oauth_clients
+		WHERE created_by = $1
+		ORDER BY created_at
+	`
+	//* Ejecutamos la consulta.
+	rows, err := sqr.executor().QueryContext(ctx, querySentence,
+		createdBy,
+	)
+	if err != nil {
+		return nil, err
+	}
+	//* Cerramos la consulta al final de éste proceso.
+	defer rows.Close()
+
+	//* Obtenemos los resultados de la consulta.
+	//* Dado que esperamos una lista, usamos un 'array' vacío.
+	var clients []*models.OAuthClient
+	for rows.Next() {
+		client, err := scanOAuthClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	//* Devolvemos la información obtenida.
+	return clients, nil
+}
+
+func (sqr *SqliteImplementation) InsertOAuthAuthorizationCode(ctx context.Context, code *models.OAuthAuthorizationCode) error {
+	//* Construimos la sentencia SQL.
+	querySentence := `
+		INSERT INTO oauth_authorization_codes (
+			id, code_hash, client_id, user_id, redirect_uri, scopes,
+			code_challenge, code_challenge_method, nonce, auth_time, expires_at, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	`
+	//* Ejecutamos la sentencia.
+	if _, err := sqr.executor().ExecContext(ctx, querySentence,
+		code.Id,
+		code.CodeHash,
+		code.ClientId,
+		code.UserId,
+		code.RedirectURI,
+		joinList(code.Scopes),
+		code.CodeChallenge,
+		code.CodeChallengeMethod,
+		code.Nonce,
+		nullTime(code.AuthTime),
+		code.ExpiresAt,
+		code.CreatedAt,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+func (sqr *SqliteImplementation) GetOAuthAuthorizationCodeByHash(ctx context.Context, codeHash string) (*models.OAuthAuthorizationCode, error) {
+	//* Construimos la consulta SQL.
+	querySentence := `
+		SELECT
+			id, code_hash, client_id, user_id, redirect_uri, scopes,
+			code_challenge, code_challenge_method, nonce, auth_time, family_id, expires_at, used_at, created_at
+		FROM oauth_authorization_codes
+		WHERE code_hash = $1
+	`
+	//* Ejecutamos la consulta.
+	rows, err := sqr.executor().QueryContext(ctx, querySentence,
+		codeHash,
+	)
+	if err != nil {
+		return nil, err
+	}
+	//* Cerramos la consulta al final de éste proceso.
+	defer rows.Close()
+
+	//* Obtenemos los resultados de la ejecución.
+	//* Si no hay coincidencias, devolvemos un código nulo.
+	var code *models.OAuthAuthorizationCode
+	for rows.Next() {
+		code = new(models.OAuthAuthorizationCode)
+		var scopes string
+		var familyId sql.NullString
+		var authTime, usedAt sql.NullTime
+		if err := rows.Scan(
+			&code.Id,
+			&code.CodeHash,
+			&code.ClientId,
+			&code.UserId,
+			&code.RedirectURI,
+			&scopes,
+			&code.CodeChallenge,
+			&code.CodeChallengeMethod,
+			&code.Nonce,
+			&authTime,
+			&familyId,
+			&code.ExpiresAt,
+			&usedAt,
+			&code.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		code.Scopes = splitList(scopes)
+
+		//* Si los campos 'sql.Null*' son válidos, es decir que no son nulos, los asignamos.
+		if familyId.Valid {
+			code.FamilyId = familyId.String
+		}
+		if authTime.Valid {
+			code.AuthTime = authTime.Time
+		}
+		if usedAt.Valid {
+			code.UsedAt = usedAt.Time
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	//* Devolvemos la información obtenida.
+	return code, nil
+}
+func (sqr *SqliteImplementation) UpdateOAuthAuthorizationCode(ctx context.Context, code *models.OAuthAuthorizationCode) error {
+	//* Construimos la sentencia SQL.
+	//* Sólo se marca como usado si no lo estaba ya, así un mismo código no puede canjearse dos veces.
+	querySentence := `
+		UPDATE oauth_authorization_codes SET
+			used_at = $1, family_id = $2
+		WHERE id = $3 AND used_at IS NULL
+	`
+	//* Ejecutamos la sentencia.
+	result, err := sqr.executor().ExecContext(ctx, querySentence,
+		code.UsedAt,
+		code.FamilyId,
+		code.Id,
+	)
+	if err != nil {
+		return err
+	}
+	affectedRows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affectedRows == 0 {
+		return ErrTokenAlreadyUsed
+	}
+
+	return nil
+}
+
+func (sqr *SqliteImplementation) GetOAuthConsent(ctx context.Context, userId, clientId string) (*models.OAuthConsent, error) {
+	//* Construimos la consulta SQL.
+	querySentence := `
+		SELECT
+			user_id, client_id, scopes, created_at, updated_at
+		FROM oauth_consents
+		WHERE user_id = $1 AND client_id = $2
+	`
+	//* Ejecutamos la consulta.
+	rows, err := sqr.executor().QueryContext(ctx, querySentence,
+		userId,
+		clientId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	//* Cerramos la consulta al final de éste proceso.
+	defer rows.Close()
+
+	//* Obtenemos los resultados de la ejecución.
+	//* Si el 'user' nunca dio su consentimiento, devolvemos un valor nulo.
+	var consent *models.OAuthConsent
+	for rows.Next() {
+		consent = new(models.OAuthConsent)
+		var scopes string
+		if err := rows.Scan(
+			&consent.UserId,
+			&consent.ClientId,
+			&scopes,
+			&consent.CreatedAt,
+			&consent.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		consent.Scopes = splitList(scopes)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	//* Devolvemos la información obtenida.
+	return consent, nil
+}
+func (sqr *SqliteImplementation) UpsertOAuthConsent(ctx context.Context, consent *models.OAuthConsent) error {
+	//* Construimos la sentencia SQL.
+	querySentence := `
+		INSERT INTO oauth_consents (
+			user_id, client_id, scopes, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, client_id) DO UPDATE SET
+			scopes = EXCLUDED.scopes, updated_at = EXCLUDED.updated_at
+	`
+	//* Ejecutamos la sentencia.
+	if _, err := sqr.executor().ExecContext(ctx, querySentence,
+		consent.UserId,
+		consent.ClientId,
+		joinList(consent.Scopes),
+		consent.CreatedAt,
+		consent.UpdatedAt,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (sqr *SqliteImplementation) InsertOAuthDeviceCode(ctx context.Context, deviceCode *models.OAuthDeviceCode) error {
+	//* Construimos la sentencia SQL.
+	querySentence := `
+		INSERT INTO oauth_device_codes (
+			id, device_code_hash, user_code_hash, client_id, scopes, interval, expires_at, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	//* Ejecutamos la sentencia.
+	if _, err := sqr.executor().ExecContext(ctx, querySentence,
+		deviceCode.Id,
+		deviceCode.DeviceCodeHash,
+		deviceCode.UserCodeHash,
+		deviceCode.ClientId,
+		joinList(deviceCode.Scopes),
+		deviceCode.Interval,
+		deviceCode.ExpiresAt,
+		deviceCode.CreatedAt,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+func (sqr *SqliteImplementation) GetOAuthDeviceCodeByDeviceCodeHash(ctx context.Context, deviceCodeHash string) (*models.OAuthDeviceCode, error) {
+	return sqr.getOAuthDeviceCode(ctx, "device_code_hash", deviceCodeHash)
+}
+func (sqr *SqliteImplementation) GetOAuthDeviceCodeByUserCodeHash(ctx context.Context, userCodeHash string) (*models.OAuthDeviceCode, error) {
+	return sqr.getOAuthDeviceCode(ctx, "user_code_hash", userCodeHash)
+}
+func (sqr *SqliteImplementation) getOAuthDeviceCode(ctx context.Context, column, hash string) (*models.OAuthDeviceCode, error) {
+	//* Construimos la consulta SQL. 'column' nunca procede de la petición.
+	querySentence := fmt.Sprintf(`
+		SELECT
+			id, device_code_hash, user_code_hash, client_id, scopes, user_id, family_id, interval,
+			auth_time, approved_at, denied_at, last_polled_at, expires_at, used_at, created_at
+		FROM oauth_device_codes
+		WHERE %s = $1
+	`, column)
+	//* Ejecutamos la consulta.
+	rows, err := sqr.executor().QueryContext(ctx, querySentence,
+		hash,
+	)
+	if err != nil {
+		return nil, err
+	}
+	//* Cerramos la consulta al final de éste proceso.
+	defer rows.Close()
+
+	//* Obtenemos los resultados de la ejecución.
+	//* Si no hay coincidencias, devolvemos un código nulo.
+	var deviceCode *models.OAuthDeviceCode
+	for rows.Next() {
+		deviceCode = new(models.OAuthDeviceCode)
+		var scopes string
+		var userId, familyId sql.NullString
+		var authTime, approvedAt, deniedAt, lastPolledAt, usedAt sql.NullTime
+		if err := rows.Scan(
+			&deviceCode.Id,
+			&deviceCode.DeviceCodeHash,
+			&deviceCode.UserCodeHash,
+			&deviceCode.ClientId,
+			&scopes,
+			&userId,
+			&familyId,
+			&deviceCode.Interval,
+			&authTime,
+			&approvedAt,
+			&deniedAt,
+			&lastPolledAt,
+			&deviceCode.ExpiresAt,
+			&usedAt,
+			&deviceCode.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		deviceCode.Scopes = splitList(scopes)
+
+		//* Si los campos 'sql.Null*' son válidos, es decir que no son nulos, los asignamos.
+		deviceCode.UserId = userId.String
+		deviceCode.FamilyId = familyId.String
+		deviceCode.AuthTime = authTime.Time
+		deviceCode.ApprovedAt = approvedAt.Time
+		deviceCode.DeniedAt = deniedAt.Time
+		deviceCode.LastPolledAt = lastPolledAt.Time
+		deviceCode.UsedAt = usedAt.Time
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	//* Devolvemos la información obtenida.
+	return deviceCode, nil
+}
+func (sqr *SqliteImplementation) UpdateOAuthDeviceCode(ctx context.Context, deviceCode *models.OAuthDeviceCode) error {
+	//* Construimos la sentencia SQL.
+	//* Un código ya canjeado no admite más cambios, así no puede emitir 'token' dos veces.
+	querySentence := `
+		UPDATE oauth_device_codes SET
+			user_id = NULLIF($1, ''), family_id = NULLIF($2, ''), auth_time = $3,
+			approved_at = $4, denied_at = $5, used_at = $6
+		WHERE id = $7 AND used_at IS NULL
+	`
+	//* Ejecutamos la sentencia.
+	result, err := sqr.executor().ExecContext(ctx, querySentence,
+		deviceCode.UserId,
+		deviceCode.FamilyId,
+		nullTime(deviceCode.AuthTime),
+		nullTime(deviceCode.ApprovedAt),
+		nullTime(deviceCode.DeniedAt),
+		nullTime(deviceCode.UsedAt),
+		deviceCode.Id,
+	)
+	if err != nil {
+		return err
+	}
+	affectedRows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affectedRows == 0 {
+		return ErrTokenAlreadyUsed
+	}
+
+	return nil
+}
+func (sqr *SqliteImplementation) UpdateOAuthDeviceCodePolling(ctx context.Context, deviceCode *models.OAuthDeviceCode) error {
+	//* Construimos la sentencia SQL.
+	//* Sólo toca los campos de sondeo, para no pisar una aprobación concurrente.
+	querySentence := `
+		UPDATE oauth_device_codes SET
+			interval = $1, last_polled_at = $2
+		WHERE id = $3
+	`
+	//* Ejecutamos la sentencia.
+	if _, err := sqr.executor().ExecContext(ctx, querySentence,
+		deviceCode.Interval,
+		nullTime(deviceCode.LastPolledAt),
+		deviceCode.Id,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (sqr *SqliteImplementation) InsertApiKey(ctx context.Context, apiKey *models.ApiKey) error {
+	//* Construimos la sentencia SQL.
+	querySentence := `
+		INSERT INTO users_api_keys (
+			id, user_id, name, prefix, secret_hash, scopes, expires_at, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	//* Ejecutamos la sentencia.
+	if _, err := sqr.executor().ExecContext(ctx, querySentence,
+		apiKey.Id,
+		apiKey.UserId,
+		apiKey.Name,
+		apiKey.Prefix,
+		apiKey.SecretHash,
+		joinList(apiKey.Scopes),
+		nullTime(apiKey.ExpiresAt),
+		apiKey.CreatedAt,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+func (sqr *SqliteImplementation) GetApiKeyByPrefix(ctx context.Context, prefix string) (*models.ApiKey, error) {
+	//* Construimos la consulta SQL.
+	querySentence := `
+		SELECT
+			id, user_id, name, prefix, secret_hash, scopes, expires_at, last_used_at, revoked_at, created_at
+		FROM users_api_keys
+		WHERE prefix = $1
+	`
+	//* Ejecutamos la consulta.
+	rows, err := sqr.executor().QueryContext(ctx, querySentence,
+		prefix,
+	)
+	if err != nil {
+		return nil, err
+	}
+	//* Cerramos la consulta al final de éste proceso.
+	defer rows.Close()
+
+	//* Obtenemos los resultados de la ejecución.
+	//* Si no hay coincidencias, devolvemos una clave nula.
+	var apiKey *models.ApiKey
+	for rows.Next() {
+		if apiKey, err = scanApiKey(rows); err != nil {
+			return nil, err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	//* Devolvemos la información obtenida.
+	return apiKey, nil
+}
+func (sqr *SqliteImplementation) ListApiKeysByUserId(ctx context.Context, userId string) ([]*models.ApiKey, error) {
+	//* Construimos la consulta SQL.
+	querySentence := `
+		SELECT
+			id, user_id, name, prefix, secret_hash, scopes, expires_at, last_used_at, revoked_at, created_at
+		FROM users_api_keys
+		WHERE user_id = $1
+		ORDER BY created_at
+	`
+	//* Ejecutamos la consulta.
+	rows, err := sqr.executor().QueryContext(ctx, querySentence,
+		userId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	//* Cerramos la consulta al final de éste proceso.
+	defer rows.Close()
+
+	//* Obtenemos los resultados de la consulta.
+	//* Dado que esperamos una lista, usamos un 'array' vacío.
+	var apiKeys []*models.ApiKey
+	for rows.Next() {
+		apiKey, err := scanApiKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		apiKeys = append(apiKeys, apiKey)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	//* Devolvemos la información obtenida.
+	return apiKeys, nil
+}
+
+func (sqr *SqliteImplementation) UpdateApiKeyLastUsedAt(ctx context.Context, id string, lastUsedAt time.Time) error {
+	//* Construimos la sentencia SQL.
+	querySentence := `
+		UPDATE users_api_keys SET
+			last_used_at = $1
+		WHERE id = $2
+	`
+	//* Ejecutamos la sentencia.
+	if _, err := sqr.executor().ExecContext(ctx, querySentence,
+		lastUsedAt,
+		id,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+func (sqr *SqliteImplementation) RevokeApiKey(ctx context.Context, id, userId string, revokedAt time.Time) (bool, error) {
+	//* Construimos la sentencia SQL.
+	//* Sólo el propietario puede revocarla, y sólo una vez.
+	querySentence := `
+		UPDATE users_api_keys SET
+			revoked_at = $1
+		WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL
+	`
+	//* Ejecutamos la sentencia.
+	result, err := sqr.executor().ExecContext(ctx, querySentence,
+		revokedAt,
+		id,
+		userId,
+	)
+	if err != nil {
+		return false, err
+	}
+	affectedRows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affectedRows > 0, nil
+}
+
+func (sqr *SqliteImplementation) InsertRole(ctx context.Context, role *models.Role) error {
+	//* SQLite no admite 'INSERT' dentro de 'WITH', así que guardamos el rol y sus permisos
+	//* en una transacción para que no quede a medias.
+	return sqr.RunInTransaction(ctx, func(dbr DatabaseRepository) error {
+		txExecutor := dbr.(*SqliteImplementation).executor()
+
+		//* Construimos la sentencia SQL.
+		querySentence := `
+			INSERT INTO roles (
+				id, name, description, created_at, created_by
+			) VALUES ($1, $2, $3, $4, $5)
+		`
+		//* Ejecutamos la sentencia.
+		if _, err := txExecutor.ExecContext(ctx, querySentence,
+			role.Id,
+			role.Name,
+			role.Description,
+			role.CreatedAt,
+			role.CreatedBy,
+		); err != nil {
+			return err
+		}
+
+		//* Construimos la sentencia SQL y la ejecutamos con cada permiso.
+		querySentence = `
+			INSERT INTO roles_permissions (role_id, permission_name)
+			VALUES ($1, $2)
+		`
+		for _, permission := range role.Permissions {
+			if _, err := txExecutor.ExecContext(ctx, querySentence,
+				role.Id,
+				permission,
+			); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+func (sqr *SqliteImplementation) InsertUserRole(ctx context.Context, userRole *models.UserRole) (bool, error) {
+	//* Construimos la sentencia SQL.
+	//* Asignar dos veces el mismo rol no es un error, pero no se registra de nuevo.
+	querySentence := `
+		INSERT INTO users_roles (
+			user_id, role_id, created_at, created_by
+		) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, role_id) DO NOTHING
+	`
+	//* Ejecutamos la sentencia.
+	result, err := sqr.executor().ExecContext(ctx, querySentence,
+		userRole.UserId,
+		userRole.RoleId,
+		userRole.CreatedAt,
+		userRole.CreatedBy,
+	)
+	if err != nil {
+		return false, err
+	}
+	affectedRows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affectedRows > 0, nil
+}
+func (sqr *SqliteImplementation) GetRoleById(ctx context.Context, id string) (*models.Role, error) {
+	//* Solicitamos el rol con sus permisos. Si no existe, devolvemos un rol nulo.
+	roles, err := sqr.listRoles(ctx, "WHERE roles.id = $1", id)
+	if err != nil || len(roles) == 0 {
+		return nil, err
+	}
+	return roles[0], nil
+}
+func (sqr *SqliteImplementation) ListRoles(ctx context.Context) ([]*models.Role, error) {
+	return sqr.listRoles(ctx, "")
+}
+func (sqr *SqliteImplementation) ListRolesByUserId(ctx context.Context, userId string) ([]*models.Role, error) {
+	return sqr.listRoles(ctx, "WHERE roles.id IN (SELECT role_id FROM users_roles WHERE user_id = $1)", userId)
+}
+func (sqr *SqliteImplementation) listRoles(ctx context.Context, condition string, args ...interface{}) ([]*models.Role, error) {
+	//* Construimos la consulta SQL. 'condition' nunca procede de la petición.
+	querySentence := fmt.Sprintf(`
+		SELECT
+			roles.id, roles.name, roles.description, roles.created_at, roles.created_by,
+			COALESCE(group_concat(roles_permissions.permission_name, ' '), '')
+		FROM roles
+		LEFT JOIN roles_permissions ON roles_permissions.role_id = roles.id
+		%s
+		GROUP BY roles.id
+		ORDER BY roles.name
+	`, condition)
+	//* Ejecutamos la consulta.
+	rows, err := sqr.executor().QueryContext(ctx, querySentence, args...)
+	if err != nil {
+		return nil, err
+	}
+	//* Cerramos la consulta al final de éste proceso.
+	defer rows.Close()
+
+	//* Obtenemos los resultados de la consulta.
+	//* Dado que esperamos una lista, usamos un 'array' vacío.
+	var roles []*models.Role
+	for rows.Next() {
+		role := new(models.Role)
+		var permissions string
+		if err := rows.Scan(
+			&role.Id,
+			&role.Name,
+			&role.Description,
+			&role.CreatedAt,
+			&role.CreatedBy,
+			&permissions,
+		); err != nil {
+			return nil, err
+		}
+		//* 'group_concat' no garantiza el orden, así que ordenamos los permisos aquí.
+		role.Permissions = splitList(permissions)
+		sort.Strings(role.Permissions)
+		roles = append(roles, role)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	//* Devolvemos la información obtenida.
+	return roles, nil
+}
+func (sqr *SqliteImplementation) ListPermissions(ctx context.Context) ([]*models.Permission, error) {
+	//* Construimos la consulta SQL.
+	querySentence := `
+		SELECT
+			name, description
+		FROM permissions
+		ORDER BY name
+	`
+	//* Ejecutamos la consulta.
+	rows, err := sqr.executor().QueryContext(ctx, querySentence)
+	if err != nil {
+		return nil, err
+	}
+	//* Cerramos la consulta al final de éste proceso.
+	defer rows.Close()
+
+	//* Obtenemos los resultados de la consulta.
+	//* Dado que esperamos una lista, usamos un 'array' vacío.
+	var permissions []*models.Permission
+	for rows.Next() {
+		permission := new(models.Permission)
+		if err := rows.Scan(
+			&permission.Name,
+			&permission.Description,
+		); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	//* Devolvemos la información obtenida.
+	return permissions, nil
+}
+func (sqr *SqliteImplementation) DeleteUserRole(ctx context.Context, userId, roleId string) (bool, error) {
+	//* Construimos la sentencia SQL.
+	querySentence := `
+		DELETE FROM users_roles
+		WHERE user_id = $1 AND role_id = $2
+	`
+	//* Ejecutamos la sentencia.
+	result, err := sqr.executor().ExecContext(ctx, querySentence,
+		userId,
+		roleId,
+	)
+	if err != nil {
+		return false, err
+	}
+	affectedRows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affectedRows > 0, nil
+}
+
+func (sqr *SqliteImplementation) GetLoginThrottle(ctx context.Context, key string) (*models.LoginThrottle, error) {
+	//* Construimos la consulta SQL.
+	querySentence := `
+		SELECT
+			key, failures, last_failed_at, locked_until
+		FROM login_throttles
+		WHERE key = $1
+	`
+	//* Ejecutamos la consulta.
+	rows, err := sqr.executor().QueryContext(ctx, querySentence,
+		key,
+	)
+	if err != nil {
+		return nil, err
+	}
+	//* Cerramos la consulta al final de éste proceso.
+	defer rows.Close()
+
+	//* Obtenemos los resultados de la ejecución.
+	//* Si no hay coincidencias, devolvemos un registro nulo.
+	var loginThrottle *models.LoginThrottle
+	for rows.Next() {
+		if loginThrottle, err = scanLoginThrottle(rows); err != nil {
+			return nil, err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	//* Devolvemos la información obtenida.
+	return loginThrottle, nil
+}
+func (sqr *SqliteImplementation) RegisterLoginFailure(ctx context.Context, key string, failedAt, windowStart time.Time) (*models.LoginThrottle, error) {
+	//* Construimos la sentencia SQL.
+	//* El incremento se hace en DB para que los intentos simultáneos no se pisen. Los fallos
+	//* anteriores a 'windowStart' ya no cuentan y el recuento vuelve a empezar.
+	querySentence := `
+		INSERT INTO login_throttles (
+			key, failures, last_failed_at
+		) VALUES ($1, 1, $2)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN login_throttles.last_failed_at < $3 THEN 1 ELSE login_throttles.failures + 1 END,
+			last_failed_at = EXCLUDED.last_failed_at
+		RETURNING key, failures, last_failed_at, locked_until
+	`
+	//* Ejecutamos la sentencia.
+	rows, err := sqr.executor().QueryContext(ctx, querySentence,
+		key,
+		failedAt,
+		windowStart,
+	)
+	if err != nil {
+		return nil, err
+	}
+	//* Cerramos la consulta al final de éste proceso.
+	defer rows.Close()
+
+	//* Obtenemos el registro actualizado.
+	var loginThrottle *models.LoginThrottle
+	for rows.Next() {
+		if loginThrottle, err = scanLoginThrottle(rows); err != nil {
+			return nil, err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	//* Devolvemos la información obtenida.
+	return loginThrottle, nil
+}
+func (sqr *SqliteImplementation) LockLoginThrottle(ctx context.Context, key string, lockedUntil time.Time) error {
+	//* Construimos la sentencia SQL. Al bloquear, el recuento de fallos vuelve a empezar.
+	querySentence := `
+		UPDATE login_throttles SET
+			failures = 0, locked_until = $1
+		WHERE key = $2
+	`
+	//* Ejecutamos la sentencia.
+	if _, err := sqr.executor().ExecContext(ctx, querySentence,
+		lockedUntil,
+		key,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+func (sqr *SqliteImplementation) DeleteLoginThrottle(ctx context.Context, key string) error {
+	//* Construímos las sentencia SQL.
+	querySentence := `
+		DELETE FROM login_throttles
+		WHERE key = $1
+	`
+	//* Ejecutamos la sentencia.
+	if _, err := sqr.executor().ExecContext(ctx, querySentence,
+		key,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/aerodinamicat/thisisme02/databases"
+	"github.com/aerodinamicat/thisisme02/models"
+	"github.com/aerodinamicat/thisisme02/principals"
+	"github.com/aerodinamicat/thisisme02/servers"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrAccountDeletedByAdmin = errors.New("account deleted by an administrator")
+)
+
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+type DeleteAccountResponse struct {
+	Result  bool      `json:"result"`
+	PurgeAt time.Time `json:"purgeAt"`
+}
+
+type RestoreAccountRequest struct {
+	Token string `json:"token"`
+}
+type RestoreAccountResponse struct {
+	Result bool `json:"result"`
+}
+
+func restoreUser(ctx context.Context, user *models.User, restoredBy string, currentTime time.Time) error {
+	//* Instanciamos un 'propertyChange' que deja constancia de la recuperación.
+	propertyChange := &models.PropertyChange{
+		UserId:    user.Id,
+		Name:      "status",
+		From:      userStatus(user),
+		CreatedAt: currentTime,
+		CreatedBy: restoredBy,
+	}
+
+	//* Retiramos la marca de eliminación, atribuyendo el cambio a quien lo solicita.
+	user.DeletedAt = time.Time{}
+	user.DeletedBy = ""
+	user.UpdatedAt = currentTime
+	user.UpdatedBy = restoredBy
+	propertyChange.To = userStatus(user)
+	if err := databases.RestoreUser(ctx, user); err != nil {
+		return err
+	}
+
+	//* Guardamos 'propertyChange' en DB.
+	return databases.InsertPropertyChangeLog(ctx, propertyChange)
+}
+
+func DeleteAccountHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Esta función requiere autenticación de usuario.
+		//* Obtenemos la identidad que 'CheckAuthMiddleware' dejó en el contexto de la petición.
+		principal, ok := principals.FromContext(request.Context())
+		if !ok {
+			http.Error(writer, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		//* Sólo el propio 'user' puede eliminar su cuenta, no una clave ni un cliente OAuth en su nombre.
+		if principal.AuthMethod == principals.AUTH_METHOD_API_KEY || principal.ClientId != "" {
+			http.Error(writer, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		//* Preparamos la petición y la recibimos.
+		var decodedRequest = new(DeleteAccountRequest)
+		if err := json.NewDecoder(request.Body).Decode(&decodedRequest); err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		//* Solicitamos un 'user' a DB.
+		user, err := databases.GetUserById(request.Context(), principal.UserId)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if user == nil || user.Id == "" || !user.DeletedAt.IsZero() {
+			http.Error(writer, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		//* Pedimos de nuevo la 'password' para confirmar una acción tan delicada.
+		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(decodedRequest.Password)); err != nil {
+			http.Error(writer, "Invalid credentials", http.StatusUnauthorized)
+			return
+		}
+
+		//* Guardamos el momento en el que se produjo el registro.
+		currentTime := time.Now()
+
+		//* Instanciamos un 'propertyChange' que deja constancia de la eliminación.
+		propertyChange := &models.PropertyChange{
+			UserId:    user.Id,
+			Name:      "status",
+			From:      userStatus(user),
+			To:        USER_STATUS_DELETED,
+			CreatedAt: currentTime,
+			CreatedBy: user.Id,
+		}
+
+		//* Marcamos el 'user' como eliminado. Se borrará definitivamente al vencer el plazo de gracia.
+		user.DeletedAt = currentTime
+		user.DeletedBy = user.Id
+		gracePeriod := server.Config.AccountDeletionGracePeriod
+		err = databases.RunInTransaction(request.Context(), func(ctx context.Context) error {
+			if err := databases.DeleteUser(ctx, user); err != nil {
+				return err
+			}
+
+			//* Guardamos 'propertyChange' en DB y cerramos todas sus sesiones.
+			if err := databases.InsertPropertyChangeLog(ctx, propertyChange); err != nil {
+				return err
+			}
+			if err := revokeUserSessions(ctx, user.Id, currentTime); err != nil {
+				return err
+			}
+
+			//* Enviamos al 'email' del 'user' un 'token' con el que recuperar la cuenta durante el plazo de gracia.
+			return sendEmailToken(ctx, user.Id, user.Email, EMAIL_TOKEN_PURPOSE_RESTORE, gracePeriod,
+				"Your account has been deleted", "If this was a mistake, use this token to restore your account")
+		})
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Preparamos la respuesta y la enviamos.
+		notEncodedResponse := DeleteAccountResponse{
+			Result:  true,
+			PurgeAt: currentTime.Add(gracePeriod),
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
+func RestoreAccountHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Preparamos la petición y la recibimos.
+		var decodedRequest = new(RestoreAccountRequest)
+		if err := json.NewDecoder(request.Body).Decode(&decodedRequest); err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		//* Consumimos el 'token' enviado al eliminar la cuenta y recuperamos el 'user', todo o nada.
+		err := databases.RunInTransaction(request.Context(), func(ctx context.Context) error {
+			emailVerificationToken, err := consumeEmailToken(ctx, decodedRequest.Token, EMAIL_TOKEN_PURPOSE_RESTORE)
+			if err != nil {
+				return err
+			}
+
+			//* Solicitamos el 'user' a DB. Si ya se purgó, el 'token' se habría borrado con él.
+			user, err := databases.GetUserById(ctx, emailVerificationToken.UserId)
+			if err != nil {
+				return err
+			}
+			if user == nil || user.Id == "" {
+				return ErrInvalidToken
+			}
+
+			//* Una eliminación hecha por un administrador sólo puede deshacerla un administrador.
+			if user.DeletedAt.IsZero() {
+				return nil
+			}
+			if user.DeletedBy != user.Id {
+				return ErrAccountDeletedByAdmin
+			}
+			return restoreUser(ctx, user, user.Id, time.Now())
+		})
+		switch err {
+		case nil:
+		case ErrInvalidToken:
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		case ErrAccountDeletedByAdmin:
+			http.Error(writer, "Account deleted by an administrator", http.StatusForbidden)
+			return
+		default:
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Preparamos la respuesta y la enviamos.
+		notEncodedResponse := RestoreAccountResponse{
+			Result: true,
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
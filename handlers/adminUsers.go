@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aerodinamicat/thisisme02/databases"
+	"github.com/aerodinamicat/thisisme02/models"
+	"github.com/aerodinamicat/thisisme02/principals"
+	"github.com/aerodinamicat/thisisme02/servers"
+	"github.com/gorilla/mux"
+)
+
+const (
+	USER_STATUS_ACTIVE   = "active"
+	USER_STATUS_DISABLED = "disabled"
+	USER_STATUS_DELETED  = "deleted"
+)
+
+type UsersListRequest struct {
+	PageInfo models.PageInfo `json:"pageInfo"`
+	Search   string          `json:"search"`
+}
+type UsersListResponse struct {
+	PageInfo *models.PageInfo `json:"pageInfo"`
+	Users    []*models.User   `json:"users"`
+}
+
+type UserResponse struct {
+	User *models.User `json:"user"`
+}
+
+type UserStatusResponse struct {
+	Result bool `json:"result"`
+}
+
+func isUserDisabled(user *models.User) bool {
+	return !user.DisabledAt.IsZero() || !user.DeletedAt.IsZero()
+}
+func userStatus(user *models.User) string {
+	if !user.DeletedAt.IsZero() {
+		return USER_STATUS_DELETED
+	}
+	if !user.DisabledAt.IsZero() {
+		return USER_STATUS_DISABLED
+	}
+	return USER_STATUS_ACTIVE
+}
+func redactUser(user *models.User) *models.User {
+	//* Nunca devolvemos el 'hash' de la 'password', ni siquiera a un administrador.
+	redactedUser := *user
+	redactedUser.Password = ""
+	return &redactedUser
+}
+func revokeUserSessions(ctx context.Context, userId string, currentTime time.Time) error {
+	//* Todo 'token' de acceso emitido hasta ahora deja de ser válido, y también los de refresco.
+	//* Redondeamos hacia arriba al microsegundo, la precisión de la DB, para no dejar fuera ningún 'token' anterior.
+	revokedBefore := time.Now().Truncate(time.Microsecond).Add(time.Microsecond)
+	if err := databases.SetUserTokensRevokedBefore(ctx, userId, revokedBefore); err != nil {
+		return err
+	}
+	return databases.RevokeRefreshTokensByUserId(ctx, userId, currentTime)
+}
+
+func getManagedUser(writer http.ResponseWriter, request *http.Request) (*principals.Principal, *models.User, bool) {
+	//* Obtenemos la identidad que 'CheckAuthMiddleware' dejó en el contexto de la petición.
+	principal, ok := principals.FromContext(request.Context())
+	if !ok {
+		http.Error(writer, "Unauthorized", http.StatusUnauthorized)
+		return nil, nil, false
+	}
+
+	//* Solicitamos a DB el 'user' indicado en la ruta.
+	user, err := databases.GetUserById(request.Context(), mux.Vars(request)["id"])
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	if user == nil || user.Id == "" {
+		http.Error(writer, "User not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+
+	return principal, user, true
+}
+func changeUserStatus(writer http.ResponseWriter, request *http.Request, disable bool) {
+	principal, user, ok := getManagedUser(writer, request)
+	if !ok {
+		return
+	}
+	//* Un administrador no puede bloquearse a sí mismo.
+	if user.Id == principal.UserId {
+		http.Error(writer, "Cannot change the status of your own account", http.StatusBadRequest)
+		return
+	}
+	if !user.DeletedAt.IsZero() {
+		http.Error(writer, "User is deleted", http.StatusConflict)
+		return
+	}
+
+	//* Si el 'user' ya está en el estado pedido, no hay nada que hacer.
+	if disable == !user.DisabledAt.IsZero() {
+		notEncodedResponse := UserStatusResponse{
+			Result: true,
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+		return
+	}
+
+	//* Guardamos el momento en el que se produjo el registro.
+	currentTime := time.Now()
+
+	//* Instanciamos un 'propertyChange' que deja constancia del cambio de estado.
+	propertyChange := &models.PropertyChange{
+		UserId:    user.Id,
+		Name:      "status",
+		From:      userStatus(user),
+		CreatedAt: currentTime,
+		CreatedBy: principal.UserId,
+	}
+
+	//* Realizamos el cambio en 'user', atribuyéndolo al administrador.
+	if disable {
+		user.DisabledAt = currentTime
+	} else {
+		user.DisabledAt = time.Time{}
+	}
+	user.UpdatedAt = currentTime
+	user.UpdatedBy = principal.UserId
+	propertyChange.To = userStatus(user)
+
+	//* Guardamos 'user' y 'propertyChange' en DB. Al bloquear la cuenta, cerramos todas sus sesiones.
+	err := databases.RunInTransaction(request.Context(), func(ctx context.Context) error {
+		if err := databases.UpdateUser(ctx, user); err != nil {
+			return err
+		}
+		if err := databases.InsertPropertyChangeLog(ctx, propertyChange); err != nil {
+			return err
+		}
+		if disable {
+			return revokeUserSessions(ctx, user.Id, currentTime)
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	//* Preparamos la respuesta y la enviamos.
+	notEncodedResponse := UserStatusResponse{
+		Result: true,
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(writer).Encode(notEncodedResponse)
+}
+
+func ListUsersHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Esta función requiere el permiso 'users:manage', que comprueba 'CheckAuthMiddleware'.
+		//* Preparamos la petición y la recibimos.
+		var decodedRequest = new(UsersListRequest)
+		if err := json.NewDecoder(request.Body).Decode(&decodedRequest); err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		//* Solicitamos a DB un listado de 'user', filtrado por 'email' si nos facilitan una búsqueda.
+		var users []*models.User
+		var pageInfo *models.PageInfo
+		var err error
+		if search := strings.TrimSpace(decodedRequest.Search); search != "" {
+			users, pageInfo, err = databases.SearchUsersByEmail(request.Context(), search, &decodedRequest.PageInfo)
+		} else {
+			users, pageInfo, err = databases.ListUsers(request.Context(), &decodedRequest.PageInfo)
+		}
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for i, user := range users {
+			users[i] = redactUser(user)
+		}
+
+		//* Preparamos la respuesta y la enviamos.
+		notEncodedResponse := &UsersListResponse{
+			PageInfo: pageInfo,
+			Users:    users,
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
+func GetUserHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Esta función requiere el permiso 'users:manage', que comprueba 'CheckAuthMiddleware'.
+		_, user, ok := getManagedUser(writer, request)
+		if !ok {
+			return
+		}
+
+		//* Preparamos la respuesta y la enviamos.
+		notEncodedResponse := UserResponse{
+			User: redactUser(user),
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
+func DisableUserHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Esta función requiere el permiso 'users:manage', que comprueba 'CheckAuthMiddleware'.
+		changeUserStatus(writer, request, true)
+	}
+}
+func EnableUserHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Esta función requiere el permiso 'users:manage', que comprueba 'CheckAuthMiddleware'.
+		changeUserStatus(writer, request, false)
+	}
+}
+func DeleteUserHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Esta función requiere el permiso 'users:manage', que comprueba 'CheckAuthMiddleware'.
+		principal, user, ok := getManagedUser(writer, request)
+		if !ok {
+			return
+		}
+		if user.Id == principal.UserId {
+			http.Error(writer, "Cannot delete your own account", http.StatusBadRequest)
+			return
+		}
+		if !user.DeletedAt.IsZero() {
+			http.Error(writer, "User not found", http.StatusNotFound)
+			return
+		}
+
+		//* Guardamos el momento en el que se produjo el registro.
+		currentTime := time.Now()
+
+		//* Instanciamos un 'propertyChange' que deja constancia de la eliminación.
+		propertyChange := &models.PropertyChange{
+			UserId:    user.Id,
+			Name:      "status",
+			From:      userStatus(user),
+			To:        USER_STATUS_DELETED,
+			CreatedAt: currentTime,
+			CreatedBy: principal.UserId,
+		}
+
+		//* Marcamos el 'user' como eliminado, atribuyéndolo al administrador.
+		//* Guardamos 'propertyChange' en DB y cerramos todas sus sesiones.
+		user.DeletedAt = currentTime
+		user.DeletedBy = principal.UserId
+		err := databases.RunInTransaction(request.Context(), func(ctx context.Context) error {
+			if err := databases.DeleteUser(ctx, user); err != nil {
+				return err
+			}
+			if err := databases.InsertPropertyChangeLog(ctx, propertyChange); err != nil {
+				return err
+			}
+			return revokeUserSessions(ctx, user.Id, currentTime)
+		})
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Preparamos la respuesta y la enviamos.
+		notEncodedResponse := UserStatusResponse{
+			Result: true,
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
+func RestoreUserHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Esta función requiere el permiso 'users:manage', que comprueba 'CheckAuthMiddleware'.
+		principal, user, ok := getManagedUser(writer, request)
+		if !ok {
+			return
+		}
+		if user.DeletedAt.IsZero() {
+			http.Error(writer, "User is not deleted", http.StatusConflict)
+			return
+		}
+
+		//* Recuperamos el 'user', atribuyéndolo al administrador.
+		err := databases.RunInTransaction(request.Context(), func(ctx context.Context) error {
+			return restoreUser(ctx, user, principal.UserId, time.Now())
+		})
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Preparamos la respuesta y la enviamos.
+		notEncodedResponse := UserStatusResponse{
+			Result: true,
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
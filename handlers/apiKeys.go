@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aerodinamicat/thisisme02/databases"
+	"github.com/aerodinamicat/thisisme02/models"
+	"github.com/aerodinamicat/thisisme02/principals"
+	"github.com/aerodinamicat/thisisme02/servers"
+	"github.com/gorilla/mux"
+	"github.com/segmentio/ksuid"
+)
+
+const (
+	AUTHORIZATION_SCHEME_API_KEY = "ApiKey"
+
+	//* Las claves tienen la forma 'tim_<prefijo>_<secreto>'. El prefijo es visible e identifica la clave.
+	API_KEY_PREFIX_TAG  = "tim_"
+	API_KEY_PREFIX_SIZE = 6
+	//* No actualizamos el último uso en cada petición, sólo con esta resolución.
+	API_KEY_LAST_USED_RESOLUTION = 1 * time.Minute
+)
+
+var (
+	ErrInvalidApiKey = errors.New("invalid api key")
+)
+
+type CreateApiKeyRequest struct {
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+type CreateApiKeyResponse struct {
+	ApiKey *models.ApiKey `json:"apiKey"`
+	Key    string         `json:"key"`
+}
+
+type ApiKeysListResponse struct {
+	ApiKeys []*models.ApiKey `json:"apiKeys"`
+}
+
+type RevokeApiKeyResponse struct {
+	Result bool `json:"result"`
+}
+
+func newApiKey() (string, string, string, error) {
+	//* Generamos el prefijo visible y el secreto. Al cliente se le entrega la clave completa
+	//* y en DB sólo se guarda el prefijo y el 'hash' del secreto.
+	randomBytes := make([]byte, API_KEY_PREFIX_SIZE)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", "", "", err
+	}
+	prefix := API_KEY_PREFIX_TAG + hex.EncodeToString(randomBytes)
+	secret, secretHash, err := newOpaqueToken()
+	if err != nil {
+		return "", "", "", err
+	}
+
+	return prefix + "_" + secret, prefix, secretHash, nil
+}
+func splitApiKey(key string) (string, string, bool) {
+	prefixLength := len(API_KEY_PREFIX_TAG) + 2*API_KEY_PREFIX_SIZE
+	if len(key) <= prefixLength+1 || !strings.HasPrefix(key, API_KEY_PREFIX_TAG) || key[prefixLength] != '_' {
+		return "", "", false
+	}
+	return key[:prefixLength], key[prefixLength+1:], true
+}
+
+func AuthenticateApiKey(ctx context.Context, key string) (*principals.Principal, error) {
+	//* Localizamos la clave por su prefijo y comprobamos el secreto.
+	prefix, secret, ok := splitApiKey(key)
+	if !ok {
+		return nil, ErrInvalidApiKey
+	}
+	apiKey, err := databases.GetApiKeyByPrefix(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if apiKey == nil || subtle.ConstantTimeCompare([]byte(hashOpaqueToken(secret)), []byte(apiKey.SecretHash)) != 1 {
+		return nil, ErrInvalidApiKey
+	}
+
+	//* Guardamos el momento en el que se produjo el registro.
+	currentTime := time.Now()
+
+	//* Una clave revocada o caducada no autentica.
+	if !apiKey.RevokedAt.IsZero() || (!apiKey.ExpiresAt.IsZero() && currentTime.After(apiKey.ExpiresAt)) {
+		return nil, ErrInvalidApiKey
+	}
+
+	//* Tampoco autentica si la cuenta de su dueño está bloqueada o eliminada.
+	user, err := databases.GetUserById(ctx, apiKey.UserId)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || user.Id == "" || isUserDisabled(user) {
+		return nil, ErrInvalidApiKey
+	}
+
+	//* Registramos el último uso.
+	if currentTime.Sub(apiKey.LastUsedAt) >= API_KEY_LAST_USED_RESOLUTION {
+		if err := databases.UpdateApiKeyLastUsedAt(ctx, apiKey.Id, currentTime); err != nil {
+			return nil, err
+		}
+	}
+
+	return &principals.Principal{
+		SubjectType: principals.SUBJECT_TYPE_USER,
+		UserId:      apiKey.UserId,
+		Scopes:      apiKey.Scopes,
+		TokenId:     apiKey.Id,
+		AuthMethod:  principals.AUTH_METHOD_API_KEY,
+		ExpiresAt:   apiKey.ExpiresAt,
+	}, nil
+}
+
+func CreateApiKeyHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Esta función requiere autenticación de usuario.
+		//* Obtenemos la identidad que 'CheckAuthMiddleware' dejó en el contexto de la petición.
+		principal, ok := principals.FromContext(request.Context())
+		if !ok {
+			http.Error(writer, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		//* Una clave no puede crear otras claves, ni un cliente OAuth en nombre del 'user'.
+		if principal.AuthMethod == principals.AUTH_METHOD_API_KEY || principal.ClientId != "" {
+			http.Error(writer, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		//* Preparamos la petición y la recibimos.
+		var decodedRequest = new(CreateApiKeyRequest)
+		if err := json.NewDecoder(request.Body).Decode(&decodedRequest); err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		//* Guardamos el momento en el que se produjo el registro.
+		currentTime := time.Now()
+
+		//* Comprobamos el nombre, los ámbitos y, si la hay, la caducidad.
+		if strings.TrimSpace(decodedRequest.Name) == "" {
+			http.Error(writer, "Name is required", http.StatusBadRequest)
+			return
+		}
+		//* Una clave actúa en nombre de su 'user': nunca recibe ámbitos privilegiados.
+		if !containsAll(GRANTABLE_SCOPES, decodedRequest.Scopes) {
+			http.Error(writer, "Invalid scope", http.StatusBadRequest)
+			return
+		}
+		if !decodedRequest.ExpiresAt.IsZero() && !decodedRequest.ExpiresAt.After(currentTime) {
+			http.Error(writer, "Expiration must be in the future", http.StatusBadRequest)
+			return
+		}
+
+		//* Generamos un nuevo 'id' aleatorio y la clave.
+		id, err := ksuid.NewRandom()
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		key, prefix, secretHash, err := newApiKey()
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Instanciamos la clave y la guardamos en DB.
+		apiKey := &models.ApiKey{
+			Id:         id.String(),
+			UserId:     principal.UserId,
+			Name:       decodedRequest.Name,
+			Prefix:     prefix,
+			SecretHash: secretHash,
+			Scopes:     decodedRequest.Scopes,
+			ExpiresAt:  decodedRequest.ExpiresAt,
+			CreatedAt:  currentTime,
+		}
+		if err := databases.InsertApiKey(request.Context(), apiKey); err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Preparamos la respuesta y la enviamos. La clave completa sólo se muestra ahora.
+		notEncodedResponse := CreateApiKeyResponse{
+			ApiKey: apiKey,
+			Key:    key,
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Header().Set("Cache-Control", "no-store")
+		writer.WriteHeader(http.StatusCreated)
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
+func ListApiKeysHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Esta función requiere autenticación de usuario.
+		//* Obtenemos la identidad que 'CheckAuthMiddleware' dejó en el contexto de la petición.
+		principal, ok := principals.FromContext(request.Context())
+		if !ok {
+			http.Error(writer, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		//* Solicitamos a DB las claves del 'user'.
+		apiKeys, err := databases.ListApiKeysByUserId(request.Context(), principal.UserId)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Preparamos la respuesta y la enviamos.
+		notEncodedResponse := ApiKeysListResponse{
+			ApiKeys: apiKeys,
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
+func RevokeApiKeyHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Esta función requiere autenticación de usuario.
+		//* Obtenemos la identidad que 'CheckAuthMiddleware' dejó en el contexto de la petición.
+		principal, ok := principals.FromContext(request.Context())
+		if !ok {
+			http.Error(writer, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		//* Revocamos la clave indicada en la ruta, si pertenece al 'user'.
+		revoked, err := databases.RevokeApiKey(request.Context(), mux.Vars(request)["id"], principal.UserId, time.Now())
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !revoked {
+			http.Error(writer, "API key not found", http.StatusNotFound)
+			return
+		}
+
+		//* Preparamos la respuesta y la enviamos.
+		notEncodedResponse := RevokeApiKeyResponse{
+			Result: true,
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aerodinamicat/thisisme02/databases"
+	"github.com/aerodinamicat/thisisme02/principals"
+	"github.com/aerodinamicat/thisisme02/servers"
+	"github.com/golang-jwt/jwt"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrEmailInUse   = errors.New("email already in use")
+)
+
+func ParseUserClaim(ctx context.Context, server *servers.HttpServer, authorizationToken string) (*UserClaim, error) {
+	//* Decodificamos el 'token' y comprobamos su firma, con la clave del anillo indicada en 'kid', y su caducidad.
+	token, err := jwt.ParseWithClaims(authorizationToken, &UserClaim{}, server.KeyRing.Keyfunc)
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(*UserClaim)
+	if !ok || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	//* Los desafíos MFA comparten firma pero no sirven como 'token' de acceso.
+	if tokenType, _ := token.Header["typ"].(string); tokenType == MFA_CHALLENGE_TOKEN_TYPE || claims.Audience == MFA_CHALLENGE_AUDIENCE {
+		return nil, ErrInvalidToken
+	}
+	//* Los 'token' de cuentas de servicio identifican al cliente y no a un 'user'.
+	//* Los de identidad OIDC no llevan 'UserId' ni tipo de sujeto: no sirven como 'token' de acceso.
+	isService := claims.SubjectType == principals.SUBJECT_TYPE_SERVICE
+	if isService && (claims.ClientId == "" || claims.Subject != claims.ClientId || claims.UserId != "") {
+		return nil, ErrInvalidToken
+	}
+	if !isService && (claims.UserId == "" || claims.SubjectType != "") {
+		return nil, ErrInvalidToken
+	}
+
+	//* Comprobamos que el 'token' no haya sido revocado individualmente mediante '/logout'.
+	revoked, err := databases.IsTokenRevoked(ctx, claims.Id)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, databases.ErrTokenRevoked
+	}
+	if isService {
+		return claims, nil
+	}
+
+	//* Comprobamos que no se emitiera antes de un '/logout/all' del 'user', con precisión de microsegundos.
+	//* Los 'token' sin 'iat_us' sólo tienen segundos: si coinciden con el de la revocación, se rechazan.
+	revokedBefore, err := databases.GetUserTokensRevokedBefore(ctx, claims.UserId)
+	if err != nil {
+		return nil, err
+	}
+	if !revokedBefore.IsZero() {
+		if claims.IssuedAtMicro != 0 && claims.IssuedAtMicro < revokedBefore.UnixMicro() {
+			return nil, databases.ErrTokenRevoked
+		}
+		if claims.IssuedAtMicro == 0 && claims.IssuedAt <= revokedBefore.Unix() {
+			return nil, databases.ErrTokenRevoked
+		}
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aerodinamicat/thisisme02/databases"
+	"github.com/aerodinamicat/thisisme02/models"
+	"github.com/aerodinamicat/thisisme02/principals"
+	"github.com/aerodinamicat/thisisme02/servers"
+	"github.com/segmentio/ksuid"
+)
+
+const (
+	OAUTH_GRANT_TYPE_DEVICE_CODE = "urn:ietf:params:oauth:grant-type:device_code"
+
+	OAUTH_ERROR_AUTHORIZATION_PENDING = "authorization_pending"
+	OAUTH_ERROR_SLOW_DOWN             = "slow_down"
+	OAUTH_ERROR_EXPIRED_TOKEN         = "expired_token"
+
+	DEVICE_CODE_EXPIRE_TIME = 10 * time.Minute
+	DEVICE_CODE_INTERVAL    = 5
+	DEVICE_CODE_SLOW_DOWN   = 5
+	USER_CODE_SIZE          = 8
+	//* Sólo consonantes, para no formar palabras ni confundir caracteres al teclear (RFC 8628, 6.1).
+	USER_CODE_ALPHABET = "BCDFGHJKLMNPQRSTVWXZ"
+)
+
+type DeviceCodeResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+type DeviceLookupResponse struct {
+	Client *models.OAuthClient `json:"client"`
+	Scopes []string            `json:"scopes"`
+}
+
+type DeviceApproveRequest struct {
+	UserCode string `json:"userCode"`
+	Approve  bool   `json:"approve"`
+}
+type DeviceApproveResponse struct {
+	Result bool `json:"result"`
+}
+
+func newUserCode() (string, error) {
+	//* Descartamos los valores que sesgarían el reparto sobre el alfabeto.
+	limit := byte(256 - 256%len(USER_CODE_ALPHABET))
+	code := make([]byte, 0, USER_CODE_SIZE)
+	randomByte := make([]byte, 1)
+	for len(code) < USER_CODE_SIZE {
+		if _, err := rand.Read(randomByte); err != nil {
+			return "", err
+		}
+		if randomByte[0] >= limit {
+			continue
+		}
+		code = append(code, USER_CODE_ALPHABET[int(randomByte[0])%len(USER_CODE_ALPHABET)])
+	}
+
+	return string(code[:USER_CODE_SIZE/2]) + "-" + string(code[USER_CODE_SIZE/2:]), nil
+}
+func hashUserCode(userCode string) string {
+	//* El 'user' puede teclearlo en minúsculas, con espacios o sin guion.
+	normalizedCode := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(userCode))
+	return hashOpaqueToken(normalizedCode)
+}
+func getPendingDeviceCode(writer http.ResponseWriter, request *http.Request, userCode string) *models.OAuthDeviceCode {
+	//* Solicitamos a DB el código a partir del código de usuario.
+	deviceCode, err := databases.GetOAuthDeviceCodeByUserCodeHash(request.Context(), hashUserCode(userCode))
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return nil
+	}
+	//* Si no existe, ha caducado o ya se decidió, respondemos 'No encontrado'.
+	if deviceCode == nil || time.Now().After(deviceCode.ExpiresAt) ||
+		!deviceCode.ApprovedAt.IsZero() || !deviceCode.DeniedAt.IsZero() || !deviceCode.UsedAt.IsZero() {
+		http.Error(writer, "Invalid or expired user code", http.StatusNotFound)
+		return nil
+	}
+	return deviceCode
+}
+
+func DeviceCodeHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Según RFC 8628, la petición llega codificada como formulario.
+		if err := request.ParseForm(); err != nil {
+			writeOAuthError(writer, http.StatusBadRequest, OAUTH_ERROR_INVALID_REQUEST, err.Error())
+			return
+		}
+
+		//* Identificamos al cliente y, si es confidencial, comprobamos su secreto.
+		client, err := authenticateOAuthClient(request)
+		if err != nil {
+			writeOAuthError(writer, http.StatusInternalServerError, OAUTH_ERROR_SERVER_ERROR, err.Error())
+			return
+		}
+		if client == nil {
+			writeOAuthError(writer, http.StatusUnauthorized, OAUTH_ERROR_INVALID_CLIENT, "Client authentication failed")
+			return
+		}
+
+		//* Si no se piden ámbitos concretos, se conceden todos los registrados para el cliente.
+		scopes := strings.Fields(request.PostForm.Get("scope"))
+		if len(scopes) == 0 {
+			scopes = client.Scopes
+		}
+		if !containsAll(client.Scopes, scopes) {
+			writeOAuthError(writer, http.StatusBadRequest, OAUTH_ERROR_INVALID_SCOPE, "Requested scope is not allowed for this client")
+			return
+		}
+
+		//* Generamos el código del dispositivo, opaco, y el código que teclea el 'user'.
+		//* En DB sólo se guardan sus 'hash'.
+		id, err := ksuid.NewRandom()
+		if err != nil {
+			writeOAuthError(writer, http.StatusInternalServerError, OAUTH_ERROR_SERVER_ERROR, err.Error())
+			return
+		}
+		deviceCodeToken, deviceCodeHash, err := newOpaqueToken()
+		if err != nil {
+			writeOAuthError(writer, http.StatusInternalServerError, OAUTH_ERROR_SERVER_ERROR, err.Error())
+			return
+		}
+		userCode, err := newUserCode()
+		if err != nil {
+			writeOAuthError(writer, http.StatusInternalServerError, OAUTH_ERROR_SERVER_ERROR, err.Error())
+			return
+		}
+
+		//* Guardamos el momento en el que se produjo el registro.
+		currentTime := time.Now()
+
+		//* Instanciamos el código y lo guardamos en DB.
+		deviceCode := &models.OAuthDeviceCode{
+			Id:             id.String(),
+			DeviceCodeHash: deviceCodeHash,
+			UserCodeHash:   hashUserCode(userCode),
+			ClientId:       client.Id,
+			Scopes:         scopes,
+			Interval:       DEVICE_CODE_INTERVAL,
+			ExpiresAt:      currentTime.Add(DEVICE_CODE_EXPIRE_TIME),
+			CreatedAt:      currentTime,
+		}
+		if err := databases.InsertOAuthDeviceCode(request.Context(), deviceCode); err != nil {
+			writeOAuthError(writer, http.StatusInternalServerError, OAUTH_ERROR_SERVER_ERROR, err.Error())
+			return
+		}
+
+		//* Preparamos la respuesta y la enviamos.
+		verificationURI := server.Config.Issuer + "/device"
+		notEncodedResponse := DeviceCodeResponse{
+			DeviceCode:              deviceCodeToken,
+			UserCode:                userCode,
+			VerificationURI:         verificationURI,
+			VerificationURIComplete: verificationURI + "?user_code=" + userCode,
+			ExpiresIn:               int64(DEVICE_CODE_EXPIRE_TIME.Seconds()),
+			Interval:                DEVICE_CODE_INTERVAL,
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
+func DeviceLookupHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Esta función requiere autenticación de usuario.
+		//* Obtenemos la identidad que 'CheckAuthMiddleware' dejó en el contexto de la petición.
+		principal, ok := principals.FromContext(request.Context())
+		if !ok {
+			http.Error(writer, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		//* Un cliente OAuth no puede autorizar a otro en nombre del 'user'.
+		if principal.ClientId != "" {
+			http.Error(writer, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		//* Obtenemos el código pendiente a partir del que teclea el 'user'.
+		deviceCode := getPendingDeviceCode(writer, request, request.URL.Query().Get("user_code"))
+		if deviceCode == nil {
+			return
+		}
+
+		//* Solicitamos el cliente a DB para mostrar al 'user' quién pide acceso.
+		client, err := databases.GetOAuthClientById(request.Context(), deviceCode.ClientId)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Preparamos la respuesta y la enviamos.
+		notEncodedResponse := DeviceLookupResponse{
+			Client: client,
+			Scopes: deviceCode.Scopes,
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
+func DeviceApproveHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Esta función requiere autenticación de usuario.
+		//* Obtenemos la identidad que 'CheckAuthMiddleware' dejó en el contexto de la petición.
+		principal, ok := principals.FromContext(request.Context())
+		if !ok {
+			http.Error(writer, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		//* Un cliente OAuth no puede autorizar a otro en nombre del 'user'.
+		if principal.ClientId != "" {
+			http.Error(writer, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		//* Preparamos la petición y la recibimos.
+		var decodedRequest = new(DeviceApproveRequest)
+		if err := json.NewDecoder(request.Body).Decode(&decodedRequest); err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		//* Obtenemos el código pendiente a partir del que teclea el 'user'.
+		deviceCode := getPendingDeviceCode(writer, request, decodedRequest.UserCode)
+		if deviceCode == nil {
+			return
+		}
+
+		//* Guardamos el momento en el que se produjo el registro.
+		currentTime := time.Now()
+
+		//* Registramos la decisión del 'user'. El dispositivo la recogerá en su siguiente sondeo.
+		deviceCode.UserId = principal.UserId
+		if decodedRequest.Approve {
+			deviceCode.ApprovedAt = currentTime
+			deviceCode.AuthTime = principal.AuthTime
+		} else {
+			deviceCode.DeniedAt = currentTime
+		}
+		if err := databases.UpdateOAuthDeviceCode(request.Context(), deviceCode); err != nil {
+			if err == databases.ErrTokenAlreadyUsed {
+				http.Error(writer, "Invalid or expired user code", http.StatusNotFound)
+				return
+			}
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Preparamos la respuesta y la enviamos.
+		notEncodedResponse := DeviceApproveResponse{
+			Result: true,
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
+
+func exchangeDeviceCode(writer http.ResponseWriter, request *http.Request, server *servers.HttpServer, client *models.OAuthClient) {
+	//* Guardamos el momento en el que se produjo el registro.
+	currentTime := time.Now()
+
+	//* Solicitamos a DB el código a partir de su 'hash'. Debe pertenecer al cliente que lo presenta.
+	deviceCode, err := databases.GetOAuthDeviceCodeByDeviceCodeHash(request.Context(), hashOpaqueToken(request.PostForm.Get("device_code")))
+	if err != nil {
+		writeOAuthError(writer, http.StatusInternalServerError, OAUTH_ERROR_SERVER_ERROR, err.Error())
+		return
+	}
+	if deviceCode == nil || deviceCode.ClientId != client.Id || !deviceCode.UsedAt.IsZero() {
+		writeOAuthError(writer, http.StatusBadRequest, OAUTH_ERROR_INVALID_GRANT, "Invalid device code")
+		return
+	}
+	if currentTime.After(deviceCode.ExpiresAt) {
+		writeOAuthError(writer, http.StatusBadRequest, OAUTH_ERROR_EXPIRED_TOKEN, "Device code expired")
+		return
+	}
+	if !deviceCode.DeniedAt.IsZero() {
+		writeOAuthError(writer, http.StatusBadRequest, OAUTH_ERROR_ACCESS_DENIED, "The user denied the request")
+		return
+	}
+
+	//* Mientras el 'user' no decida, el dispositivo sigue sondeando.
+	//* Si lo hace más deprisa de lo indicado, ampliamos el intervalo y se lo pedimos (RFC 8628, 3.5).
+	if deviceCode.ApprovedAt.IsZero() {
+		pollError := OAUTH_ERROR_AUTHORIZATION_PENDING
+		if !deviceCode.LastPolledAt.IsZero() && currentTime.Sub(deviceCode.LastPolledAt) < time.Duration(deviceCode.Interval)*time.Second {
+			deviceCode.Interval += DEVICE_CODE_SLOW_DOWN
+			pollError = OAUTH_ERROR_SLOW_DOWN
+		}
+		deviceCode.LastPolledAt = currentTime
+		if err := databases.UpdateOAuthDeviceCodePolling(request.Context(), deviceCode); err != nil {
+			writeOAuthError(writer, http.StatusInternalServerError, OAUTH_ERROR_SERVER_ERROR, err.Error())
+			return
+		}
+		writeOAuthError(writer, http.StatusBadRequest, pollError, "The authorization request is still pending")
+		return
+	}
+
+	//* Marcamos el código como usado, reservando la familia de los 'token' que vamos a emitir, y los emitimos.
+	var notEncodedResponse *OAuthTokenResponse
+	err = databases.RunInTransaction(request.Context(), func(ctx context.Context) error {
+		deviceCode.UsedAt = currentTime
+		deviceCode.FamilyId = ksuid.New().String()
+		if err := databases.UpdateOAuthDeviceCode(ctx, deviceCode); err != nil {
+			return err
+		}
+		notEncodedResponse, err = issueOAuthTokens(ctx, server, deviceCode.UserId, deviceCode.FamilyId, client.Id, deviceCode.Scopes, deviceCode.AuthTime, "")
+		return err
+	})
+	if err == databases.ErrTokenAlreadyUsed {
+		writeOAuthError(writer, http.StatusBadRequest, OAUTH_ERROR_INVALID_GRANT, "Invalid device code")
+		return
+	}
+	if err != nil {
+		writeOAuthError(writer, http.StatusInternalServerError, OAUTH_ERROR_SERVER_ERROR, err.Error())
+		return
+	}
+
+	//* Enviamos la respuesta.
+	writeOAuthTokenResponse(writer, notEncodedResponse)
+}
@@ -0,0 +1,40 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/aerodinamicat/thisisme02/handlers"
+)
+
+func TestDeviceCodePolling(t *testing.T) {
+	ts := newTestServer(t)
+	ts.insertUser("device@example.com")
+	authorization := ts.logIn("device@example.com").Authorization
+	client := ts.createPublicClient(authorization, handlers.OIDC_SCOPE_OPENID)
+
+	var deviceCode handlers.DeviceCodeResponse
+	decodeResponse(t, ts.doForm("/device/code", "", url.Values{"client_id": {client.Id}}), http.StatusOK, &deviceCode)
+	if deviceCode.Interval != handlers.DEVICE_CODE_INTERVAL {
+		t.Fatalf("interval = %d, want %d", deviceCode.Interval, handlers.DEVICE_CODE_INTERVAL)
+	}
+	poll := url.Values{
+		"grant_type":  {handlers.OAUTH_GRANT_TYPE_DEVICE_CODE},
+		"client_id":   {client.Id},
+		"device_code": {deviceCode.DeviceCode},
+	}
+
+	//* Mientras el 'user' no decide, el primer sondeo queda pendiente y el siguiente, demasiado pronto, se frena.
+	expectOAuthError(t, ts.doForm("/token", "", poll), "authorization_pending")
+	expectOAuthError(t, ts.doForm("/token", "", poll), "slow_down")
+
+	//* Una vez aprobado, el sondeo recibe los 'token', y sólo una vez.
+	expectStatus(t, ts.doJSON(http.MethodPost, "/device/approve", authorization, handlers.DeviceApproveRequest{UserCode: deviceCode.UserCode, Approve: true}), http.StatusOK)
+	var tokens handlers.OAuthTokenResponse
+	decodeResponse(t, ts.doForm("/token", "", poll), http.StatusOK, &tokens)
+	if tokens.AccessToken == "" {
+		t.Fatal("no access token issued")
+	}
+	expectOAuthError(t, ts.doForm("/token", "", poll), "invalid_grant")
+}
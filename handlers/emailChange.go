@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/aerodinamicat/thisisme02/databases"
+	"github.com/aerodinamicat/thisisme02/models"
+	"github.com/aerodinamicat/thisisme02/servers"
+)
+
+const (
+	EMAIL_CHANGE_EXPIRE_TIME = 1 * time.Hour * 24
+	EMAIL_REVERT_EXPIRE_TIME = 7 * time.Hour * 24
+)
+
+type ConfirmEmailChangeRequest struct {
+	Token string `json:"token"`
+}
+type ConfirmEmailChangeResponse struct {
+	Result bool `json:"result"`
+}
+
+type RevertEmailChangeRequest struct {
+	Token string `json:"token"`
+}
+type RevertEmailChangeResponse struct {
+	Result bool `json:"result"`
+}
+
+func ConfirmEmailChangeHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Preparamos la petición y la recibimos.
+		var decodedRequest = new(ConfirmEmailChangeRequest)
+		if err := json.NewDecoder(request.Body).Decode(&decodedRequest); err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		//* Consumimos el 'token' y aplicamos el cambio en una única transacción: si algo falla, el 'token' sigue sin usar.
+		if err := databases.RunInTransaction(request.Context(), func(ctx context.Context) error {
+			//* Consumimos el 'token' enviado al nuevo 'email'.
+			emailVerificationToken, err := consumeEmailToken(ctx, decodedRequest.Token, EMAIL_TOKEN_PURPOSE_CHANGE)
+			if err != nil {
+				return err
+			}
+
+			//* Solicitamos el 'user' al que pertenece el 'token'.
+			user, err := databases.GetUserById(ctx, emailVerificationToken.UserId)
+			if err != nil {
+				return err
+			}
+
+			//* Volvemos a comprobar que nadie haya ocupado el nuevo 'email' mientras tanto.
+			emailInUse, err := databases.IsEmailInUse(ctx, emailVerificationToken.Email)
+			if err != nil {
+				return err
+			}
+			if emailInUse {
+				return ErrEmailInUse
+			}
+
+			//* Guardamos el momento en el que se produjo el registro.
+			currentTime := time.Now()
+			previousEmail := user.Email
+
+			//* Instanciamos un 'propertyChange'.
+			propertyChange := &models.PropertyChange{
+				UserId:    user.Id,
+				Name:      "email",
+				From:      previousEmail,
+				To:        emailVerificationToken.Email,
+				CreatedAt: currentTime,
+				CreatedBy: user.Id,
+			}
+
+			//* Realizamos el cambio en 'user'. Al confirmar desde el buzón, el nuevo 'email' queda verificado.
+			user.Email = emailVerificationToken.Email
+			user.EmailVerifiedAt = currentTime
+			user.UpdatedAt = currentTime
+			user.UpdatedBy = user.Id
+
+			//* Guardamos 'user' en DB.
+			if err := databases.UpdateUser(ctx, user); err != nil {
+				return err
+			}
+
+			//* Guardamos 'propertyChange' en DB.
+			if err := databases.InsertPropertyChangeLog(ctx, propertyChange); err != nil {
+				return err
+			}
+
+			//* Avisamos al 'email' anterior con un 'token' para deshacer el cambio si no lo pidió su dueño.
+			return sendEmailToken(ctx, user.Id, previousEmail, EMAIL_TOKEN_PURPOSE_REVERT, EMAIL_REVERT_EXPIRE_TIME,
+				"Your email address was changed", "If you did not request this change, use this token to revert it")
+		}); err != nil {
+			//* Si el 'token' no es válido, respondemos 'No autorizado'.
+			if err == ErrInvalidToken {
+				http.Error(writer, "Invalid or expired token", http.StatusUnauthorized)
+				return
+			}
+			if err == ErrEmailInUse || err == databases.ErrDuplicateKey {
+				http.Error(writer, "Email already in use", http.StatusConflict)
+				return
+			}
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Preparamos la respuesta y la enviamos.
+		notEncodedResponse := ConfirmEmailChangeResponse{
+			Result: true,
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
+func RevertEmailChangeHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Preparamos la petición y la recibimos.
+		var decodedRequest = new(RevertEmailChangeRequest)
+		if err := json.NewDecoder(request.Body).Decode(&decodedRequest); err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		//* Consumimos el 'token' y deshacemos el cambio en una única transacción: si algo falla, el 'token' sigue sin usar.
+		if err := databases.RunInTransaction(request.Context(), func(ctx context.Context) error {
+			//* Consumimos el 'token' enviado al 'email' anterior.
+			emailVerificationToken, err := consumeEmailToken(ctx, decodedRequest.Token, EMAIL_TOKEN_PURPOSE_REVERT)
+			if err != nil {
+				return err
+			}
+
+			//* Solicitamos el 'user' al que pertenece el 'token'.
+			user, err := databases.GetUserById(ctx, emailVerificationToken.UserId)
+			if err != nil {
+				return err
+			}
+
+			//* Guardamos el momento en el que se produjo el registro.
+			currentTime := time.Now()
+
+			if user.Email != emailVerificationToken.Email {
+				//* Comprobamos que nadie haya ocupado el 'email' anterior mientras tanto.
+				emailInUse, err := databases.IsEmailInUse(ctx, emailVerificationToken.Email)
+				if err != nil {
+					return err
+				}
+				if emailInUse {
+					return ErrEmailInUse
+				}
+
+				//* Instanciamos un 'propertyChange'.
+				propertyChange := &models.PropertyChange{
+					UserId:    user.Id,
+					Name:      "email",
+					From:      user.Email,
+					To:        emailVerificationToken.Email,
+					CreatedAt: currentTime,
+					CreatedBy: user.Id,
+				}
+
+				//* Restauramos el 'email' anterior, cuyo control acaba de demostrarse.
+				user.Email = emailVerificationToken.Email
+				user.EmailVerifiedAt = currentTime
+				user.UpdatedAt = currentTime
+				user.UpdatedBy = user.Id
+
+				//* Guardamos 'user' en DB.
+				if err := databases.UpdateUser(ctx, user); err != nil {
+					return err
+				}
+
+				//* Guardamos 'propertyChange' en DB.
+				if err := databases.InsertPropertyChangeLog(ctx, propertyChange); err != nil {
+					return err
+				}
+			}
+
+			//* Quien cambió el 'email' pudo hacerlo con una sesión robada: cerramos todas las sesiones.
+			return revokeUserSessions(ctx, user.Id, currentTime)
+		}); err != nil {
+			//* Si el 'token' no es válido, respondemos 'No autorizado'.
+			if err == ErrInvalidToken {
+				http.Error(writer, "Invalid or expired token", http.StatusUnauthorized)
+				return
+			}
+			if err == ErrEmailInUse || err == databases.ErrDuplicateKey {
+				http.Error(writer, "Email already in use", http.StatusConflict)
+				return
+			}
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Preparamos la respuesta y la enviamos.
+		notEncodedResponse := RevertEmailChangeResponse{
+			Result: true,
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aerodinamicat/thisisme02/databases"
+	"github.com/aerodinamicat/thisisme02/models"
+	"github.com/aerodinamicat/thisisme02/notifications"
+	"github.com/aerodinamicat/thisisme02/servers"
+	"github.com/segmentio/ksuid"
+)
+
+const (
+	EMAIL_TOKEN_PURPOSE_VERIFY  = "verify"
+	EMAIL_TOKEN_PURPOSE_CHANGE  = "change"
+	EMAIL_TOKEN_PURPOSE_REVERT  = "revert"
+	EMAIL_TOKEN_PURPOSE_RESTORE = "restore"
+
+	EMAIL_VERIFICATION_EXPIRE_TIME = 1 * time.Hour * 24
+)
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+type VerifyEmailResponse struct {
+	Result bool `json:"result"`
+}
+
+type ResendEmailVerificationRequest struct {
+	Email string `json:"email"`
+}
+type ResendEmailVerificationResponse struct {
+	Result bool `json:"result"`
+}
+
+func sendEmailToken(ctx context.Context, userId, email, purpose string, expireTime time.Duration, subject, message string) error {
+	//* Generamos el 'token'.
+	token, tokenHash, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	//* Instanciamos un 'emailVerificationToken' y lo guardamos en DB.
+	currentTime := time.Now()
+	emailVerificationToken := &models.EmailVerificationToken{
+		Id:        ksuid.New().String(),
+		UserId:    userId,
+		Email:     email,
+		Purpose:   purpose,
+		TokenHash: tokenHash,
+		ExpiresAt: currentTime.Add(expireTime),
+		CreatedAt: currentTime,
+	}
+	if err := databases.InsertEmailVerificationToken(ctx, emailVerificationToken); err != nil {
+		return err
+	}
+
+	//* Enviamos el 'token' a la dirección indicada.
+	body := fmt.Sprintf("%s before %s: %s", message, emailVerificationToken.ExpiresAt.Format(time.RFC3339), token)
+	return notifications.Send(ctx, email, subject, body)
+}
+func sendEmailVerificationToken(ctx context.Context, userId, email string) error {
+	return sendEmailToken(ctx, userId, email, EMAIL_TOKEN_PURPOSE_VERIFY, EMAIL_VERIFICATION_EXPIRE_TIME,
+		"Verify your email address", "Use this token to verify your email address")
+}
+func consumeEmailToken(ctx context.Context, token, purpose string) (*models.EmailVerificationToken, error) {
+	//* Solicitamos a DB el 'token' a partir de su 'hash'.
+	emailVerificationToken, err := databases.GetEmailVerificationTokenByHash(ctx, hashOpaqueToken(token))
+	if err != nil {
+		return nil, err
+	}
+
+	//* Si no existe, es de otro tipo, ya se usó o ha caducado, no es válido.
+	currentTime := time.Now()
+	if emailVerificationToken == nil || emailVerificationToken.Purpose != purpose || !emailVerificationToken.UsedAt.IsZero() || currentTime.After(emailVerificationToken.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+
+	//* Lo marcamos como usado.
+	emailVerificationToken.UsedAt = currentTime
+	if err := databases.UpdateEmailVerificationToken(ctx, emailVerificationToken); err != nil {
+		if err == databases.ErrTokenAlreadyUsed {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	return emailVerificationToken, nil
+}
+func isEmailVerificationPending(server *servers.HttpServer, user *models.User) bool {
+	return server.Config.EmailVerificationPolicy == servers.EMAIL_VERIFICATION_REQUIRED && user.EmailVerifiedAt.IsZero()
+}
+
+func VerifyEmailHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Preparamos la petición y la recibimos.
+		var decodedRequest = new(VerifyEmailRequest)
+		if err := json.NewDecoder(request.Body).Decode(&decodedRequest); err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		//* Consumimos el 'token' y verificamos el 'email' en una única transacción.
+		if err := databases.RunInTransaction(request.Context(), func(ctx context.Context) error {
+			//* Consumimos el 'token'.
+			emailVerificationToken, err := consumeEmailToken(ctx, decodedRequest.Token, EMAIL_TOKEN_PURPOSE_VERIFY)
+			if err != nil {
+				return err
+			}
+
+			//* Solicitamos el 'user' al que pertenece el 'token'.
+			//* Si desde entonces cambió de 'email', el 'token' ya no verifica nada.
+			user, err := databases.GetUserById(ctx, emailVerificationToken.UserId)
+			if err != nil {
+				return err
+			}
+			if user.Email != emailVerificationToken.Email {
+				return ErrInvalidToken
+			}
+
+			//* Si ya estaba verificado no hay nada más que hacer.
+			if !user.EmailVerifiedAt.IsZero() {
+				return nil
+			}
+
+			//* Guardamos el momento en el que se produjo el registro.
+			currentTime := time.Now()
+
+			//* Instanciamos un 'propertyChange'.
+			propertyChange := &models.PropertyChange{
+				UserId:    user.Id,
+				Name:      "emailVerified",
+				From:      "false",
+				To:        "true",
+				CreatedAt: currentTime,
+				CreatedBy: user.Id,
+			}
+
+			//* Realizamos el cambio en 'user' y lo guardamos en DB.
+			user.EmailVerifiedAt = currentTime
+			user.UpdatedAt = currentTime
+			user.UpdatedBy = user.Id
+			if err := databases.UpdateUser(ctx, user); err != nil {
+				return err
+			}
+
+			//* Guardamos 'propertyChange' en DB.
+			return databases.InsertPropertyChangeLog(ctx, propertyChange)
+		}); err != nil {
+			//* Si el 'token' no es válido, respondemos 'No autorizado'.
+			if err == ErrInvalidToken {
+				http.Error(writer, "Invalid or expired token", http.StatusUnauthorized)
+				return
+			}
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Preparamos la respuesta y la enviamos.
+		notEncodedResponse := VerifyEmailResponse{
+			Result: true,
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
+func ResendEmailVerificationHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Preparamos la petición y la recibimos.
+		var decodedRequest = new(ResendEmailVerificationRequest)
+		if err := json.NewDecoder(request.Body).Decode(&decodedRequest); err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		//* Solicitamos a DB un 'user' con el 'email' facilitado.
+		//* La respuesta es siempre la misma para no desvelar qué 'email' están registrados.
+		user, err := databases.GetUserByEmail(request.Context(), decodedRequest.Email)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if user != nil && user.Id != "" && user.EmailVerifiedAt.IsZero() {
+			if err := sendEmailVerificationToken(request.Context(), user.Id, user.Email); err != nil {
+				http.Error(writer, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		//* Preparamos la respuesta y la enviamos.
+		notEncodedResponse := ResendEmailVerificationResponse{
+			Result: true,
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
@@ -0,0 +1,212 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aerodinamicat/thisisme02/databases"
+	"github.com/aerodinamicat/thisisme02/handlers"
+	"github.com/aerodinamicat/thisisme02/middlewares"
+	"github.com/aerodinamicat/thisisme02/models"
+	"github.com/aerodinamicat/thisisme02/notifications"
+	"github.com/aerodinamicat/thisisme02/principals"
+	"github.com/aerodinamicat/thisisme02/servers"
+	"github.com/golang-jwt/jwt"
+	"github.com/gorilla/mux"
+	"github.com/segmentio/ksuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	TEST_PASSWORD     = "correct horse battery staple"
+	TEST_REDIRECT_URI = "http://localhost/callback"
+	//* La dirección que 'httptest.NewRequest' asigna a todas las peticiones.
+	TEST_CLIENT_ADDRESS = "192.0.2.1"
+)
+
+type notification struct {
+	to, subject, body string
+}
+
+type recordingSender struct {
+	mutex         sync.Mutex
+	notifications []notification
+}
+
+func (rs *recordingSender) Send(ctx context.Context, to, subject, body string) error {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+	rs.notifications = append(rs.notifications, notification{to: to, subject: subject, body: body})
+	return nil
+}
+func (rs *recordingSender) lastToken(t *testing.T, to string) string {
+	t.Helper()
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+	//* Los mensajes terminan con el 'token' de un solo uso.
+	for i := len(rs.notifications) - 1; i >= 0; i-- {
+		if rs.notifications[i].to == to {
+			body := rs.notifications[i].body
+			return body[strings.LastIndex(body, " ")+1:]
+		}
+	}
+	t.Fatalf("no notification sent to %s", to)
+	return ""
+}
+
+type testServer struct {
+	t      *testing.T
+	server *servers.HttpServer
+	router *mux.Router
+	sender *recordingSender
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	ctx := context.Background()
+	//* Cada prueba parte de una DB en memoria vacía, así que no pueden ejecutarse en paralelo.
+	databases.SetDatabaseRepository(databases.NewMemoryImplementation())
+	sender := &recordingSender{}
+	notifications.SetSender(sender)
+	t.Cleanup(func() { notifications.SetSender(notifications.NewLogSender(false)) })
+
+	server := servers.NewHttpServer(ctx, &servers.Config{RelyingPartyOrigin: "http://localhost"}, &servers.DBConfig{Driver: servers.DATABASE_DRIVER_MEMORY})
+	if err := server.KeyRing.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	//* Las rutas que se prueban, con las mismas políticas que en 'cmd/service'.
+	router := mux.NewRouter()
+	policies := middlewares.NewRoutePolicies()
+	router.Use(middlewares.CheckAuthMiddleware(server, policies))
+	policies.Public(router.HandleFunc("/login", handlers.LogInHandler(server)).Methods(http.MethodPost))
+	policies.Public(router.HandleFunc("/login/mfa", handlers.LogInMfaHandler(server)).Methods(http.MethodPost))
+	policies.Public(router.HandleFunc("/token/refresh", handlers.RefreshTokenHandler(server)).Methods(http.MethodPost))
+	policies.Authenticated(router.HandleFunc("/oauth/clients", handlers.CreateOAuthClientHandler(server)).Methods(http.MethodPost))
+	policies.Authenticated(router.HandleFunc("/authorize", handlers.AuthorizeHandler(server)).Methods(http.MethodGet, http.MethodPost))
+	policies.Public(router.HandleFunc("/token", handlers.OAuthTokenHandler(server)).Methods(http.MethodPost))
+	policies.Public(router.HandleFunc("/device/code", handlers.DeviceCodeHandler(server)).Methods(http.MethodPost))
+	policies.Authenticated(router.HandleFunc("/device/approve", handlers.DeviceApproveHandler(server)).Methods(http.MethodPost))
+	policies.AllowServices(router.HandleFunc("/introspect", handlers.IntrospectHandler(server)).Methods(http.MethodPost), handlers.INTROSPECT_SCOPE)
+	policies.Authenticated(router.HandleFunc("/logout", handlers.LogOutHandler(server)).Methods(http.MethodPost))
+	policies.Authenticated(router.HandleFunc("/user/mfa/enroll", handlers.MfaEnrollHandler(server)).Methods(http.MethodPost))
+	policies.Authenticated(router.HandleFunc("/user/mfa/confirm", handlers.MfaConfirmHandler(server)).Methods(http.MethodPost))
+	policies.RequirePermissions(router.HandleFunc("/roles", handlers.CreateRoleHandler(server)).Methods(http.MethodPost), principals.PERMISSION_ROLES_MANAGE)
+	policies.RequirePermissions(router.HandleFunc("/users", handlers.ListUsersHandler(server)).Methods(http.MethodGet), principals.PERMISSION_USERS_MANAGE)
+	policies.RequirePermissions(router.HandleFunc("/users/{id}/roles", handlers.AssignUserRoleHandler(server)).Methods(http.MethodPost), principals.PERMISSION_ROLES_MANAGE)
+	policies.RequirePermissions(router.HandleFunc("/users/{id}/roles/{roleId}", handlers.RevokeUserRoleHandler(server)).Methods(http.MethodDelete), principals.PERMISSION_ROLES_MANAGE)
+	policies.Public(router.HandleFunc("/password/forgot", handlers.ForgotPasswordHandler(server)).Methods(http.MethodPost))
+	policies.Public(router.HandleFunc("/password/reset", handlers.ResetPasswordHandler(server)).Methods(http.MethodPost))
+
+	return &testServer{
+		t:      t,
+		server: server,
+		router: router,
+		sender: sender,
+	}
+}
+
+func (ts *testServer) serve(request *http.Request, authorization string) *httptest.ResponseRecorder {
+	if authorization != "" {
+		request.Header.Set(handlers.HEADER_AUTHORIZATION, "Bearer "+authorization)
+	}
+	recorder := httptest.NewRecorder()
+	ts.router.ServeHTTP(recorder, request)
+	return recorder
+}
+func (ts *testServer) doJSON(method, path, authorization string, body interface{}) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	//* Sin cuerpo enviamos una petición vacía, no 'null'.
+	var encodedBody []byte
+	if body != nil {
+		var err error
+		if encodedBody, err = json.Marshal(body); err != nil {
+			ts.t.Fatal(err)
+		}
+	}
+	return ts.serve(httptest.NewRequest(method, path, bytes.NewReader(encodedBody)), authorization)
+}
+func (ts *testServer) doForm(path, authorization string, form url.Values) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return ts.serve(request, authorization)
+}
+
+func decodeResponse(t *testing.T, recorder *httptest.ResponseRecorder, wantStatus int, response interface{}) {
+	t.Helper()
+	if recorder.Code != wantStatus {
+		t.Fatalf("status = %d (%s), want %d", recorder.Code, strings.TrimSpace(recorder.Body.String()), wantStatus)
+	}
+	if response == nil {
+		return
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(response); err != nil {
+		t.Fatal(err)
+	}
+}
+func expectStatus(t *testing.T, recorder *httptest.ResponseRecorder, wantStatus int) {
+	t.Helper()
+	decodeResponse(t, recorder, wantStatus, nil)
+}
+func expectOAuthError(t *testing.T, recorder *httptest.ResponseRecorder, wantError string) {
+	t.Helper()
+	var response handlers.OAuthErrorResponse
+	decodeResponse(t, recorder, http.StatusBadRequest, &response)
+	if response.Error != wantError {
+		t.Fatalf("error = %s (%s), want %s", response.Error, response.ErrorDescription, wantError)
+	}
+}
+
+func (ts *testServer) insertUser(email string) *models.User {
+	ts.t.Helper()
+	//* El coste mínimo basta en pruebas y las hace mucho más rápidas.
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(TEST_PASSWORD), bcrypt.MinCost)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	currentTime := time.Now()
+	user := &models.User{
+		Id:        ksuid.New().String(),
+		Email:     email,
+		Password:  string(hashedPassword),
+		CreatedAt: currentTime,
+		UpdatedAt: currentTime,
+	}
+	user.CreatedBy, user.UpdatedBy = user.Id, user.Id
+	if err := databases.InsertUser(context.Background(), user); err != nil {
+		ts.t.Fatal(err)
+	}
+	return user
+}
+func (ts *testServer) logIn(email string) *handlers.LogInResponse {
+	ts.t.Helper()
+	var response handlers.LogInResponse
+	decodeResponse(ts.t, ts.doJSON(http.MethodPost, "/login", "", handlers.LogInRequest{Email: email, Password: TEST_PASSWORD}), http.StatusOK, &response)
+	return &response
+}
+func (ts *testServer) claims(token string) *handlers.UserClaim {
+	ts.t.Helper()
+	claims := &handlers.UserClaim{}
+	if _, err := jwt.ParseWithClaims(token, claims, ts.server.KeyRing.Keyfunc); err != nil {
+		ts.t.Fatal(err)
+	}
+	return claims
+}
+func (ts *testServer) createPublicClient(authorization string, scopes ...string) *models.OAuthClient {
+	ts.t.Helper()
+	var response handlers.CreateOAuthClientResponse
+	decodeResponse(ts.t, ts.doJSON(http.MethodPost, "/oauth/clients", authorization, handlers.CreateOAuthClientRequest{
+		Name:         "test client",
+		RedirectURIs: []string{TEST_REDIRECT_URI},
+		Scopes:       scopes,
+	}), http.StatusCreated, &response)
+	return response.Client
+}
@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aerodinamicat/thisisme02/databases"
+	"github.com/aerodinamicat/thisisme02/models"
+	"github.com/aerodinamicat/thisisme02/principals"
+	"github.com/aerodinamicat/thisisme02/servers"
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	INTROSPECT_SCOPE = "introspect"
+
+	TOKEN_TYPE_HINT_ACCESS_TOKEN  = "access_token"
+	TOKEN_TYPE_HINT_REFRESH_TOKEN = "refresh_token"
+)
+
+type IntrospectionResponse struct {
+	Active      bool   `json:"active"`
+	Revoked     bool   `json:"revoked,omitempty"`
+	TokenType   string `json:"token_type,omitempty"`
+	Scope       string `json:"scope,omitempty"`
+	ClientId    string `json:"client_id,omitempty"`
+	Subject     string `json:"sub,omitempty"`
+	SubjectType string `json:"sub_type,omitempty"`
+	ExpiresAt   int64  `json:"exp,omitempty"`
+	IssuedAt    int64  `json:"iat,omitempty"`
+	TokenId     string `json:"jti,omitempty"`
+}
+
+func parseSignedUserClaim(server *servers.HttpServer, token string) *UserClaim {
+	//* Sólo comprobamos la firma y la caducidad: devuelve nulo si no es uno de nuestros 'token' de acceso.
+	parsedToken, err := jwt.ParseWithClaims(token, &UserClaim{}, server.KeyRing.Keyfunc)
+	if err != nil {
+		return nil
+	}
+	claims, ok := parsedToken.Claims.(*UserClaim)
+	if !ok || !parsedToken.Valid || claims.Audience == MFA_CHALLENGE_AUDIENCE {
+		return nil
+	}
+	return claims
+}
+func introspectAccessToken(ctx context.Context, server *servers.HttpServer, token string) (*IntrospectionResponse, error) {
+	//* Si no es un 'token' de acceso nuestro y vigente, devolvemos nulo.
+	if parseSignedUserClaim(server, token) == nil {
+		return nil, nil
+	}
+
+	//* 'ParseUserClaim' aplica además las revocaciones individuales y las de '/logout/all'.
+	claims, err := ParseUserClaim(ctx, server, token)
+	if err == databases.ErrTokenRevoked {
+		return &IntrospectionResponse{Revoked: true}, nil
+	}
+	if err == ErrInvalidToken {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	response := &IntrospectionResponse{
+		Active:      true,
+		TokenType:   TOKEN_TYPE_HINT_ACCESS_TOKEN,
+		Scope:       strings.Join(claims.Scopes, " "),
+		ClientId:    claims.ClientId,
+		Subject:     claims.UserId,
+		SubjectType: principals.SUBJECT_TYPE_USER,
+		ExpiresAt:   claims.ExpiresAt,
+		IssuedAt:    claims.IssuedAt,
+		TokenId:     claims.Id,
+	}
+	if claims.SubjectType == principals.SUBJECT_TYPE_SERVICE {
+		response.Subject = claims.Subject
+		response.SubjectType = principals.SUBJECT_TYPE_SERVICE
+	}
+
+	return response, nil
+}
+func introspectRefreshToken(ctx context.Context, token string) (*IntrospectionResponse, error) {
+	//* Solicitamos a DB el 'token' a partir de su 'hash'. Si no existe, devolvemos nulo.
+	refreshToken, err := databases.GetRefreshTokenByHash(ctx, hashOpaqueToken(token))
+	if err != nil || refreshToken == nil {
+		return nil, err
+	}
+
+	//* Un 'token' revocado, ya rotado o caducado no está activo.
+	if !refreshToken.RevokedAt.IsZero() {
+		return &IntrospectionResponse{Revoked: true}, nil
+	}
+	if !refreshToken.UsedAt.IsZero() || time.Now().After(refreshToken.ExpiresAt) {
+		return &IntrospectionResponse{}, nil
+	}
+
+	return &IntrospectionResponse{
+		Active:      true,
+		TokenType:   TOKEN_TYPE_HINT_REFRESH_TOKEN,
+		Scope:       strings.Join(refreshToken.Scopes, " "),
+		ClientId:    refreshToken.ClientId,
+		Subject:     refreshToken.UserId,
+		SubjectType: principals.SUBJECT_TYPE_USER,
+		ExpiresAt:   refreshToken.ExpiresAt.Unix(),
+		IssuedAt:    refreshToken.CreatedAt.Unix(),
+		TokenId:     refreshToken.Id,
+	}, nil
+}
+
+func IntrospectHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Esta función requiere una cuenta de servicio con el ámbito 'introspect'.
+		//* Obtenemos la identidad que 'CheckAuthMiddleware' dejó en el contexto de la petición.
+		principal, ok := principals.FromContext(request.Context())
+		if !ok || !principal.IsService() {
+			http.Error(writer, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		//* Según RFC 7662, la petición llega codificada como formulario.
+		if err := request.ParseForm(); err != nil {
+			writeOAuthError(writer, http.StatusBadRequest, OAUTH_ERROR_INVALID_REQUEST, err.Error())
+			return
+		}
+		token := request.PostForm.Get("token")
+		if token == "" {
+			writeOAuthError(writer, http.StatusBadRequest, OAUTH_ERROR_INVALID_REQUEST, "Missing token")
+			return
+		}
+
+		//* Probamos primero el tipo que sugiere el cliente y, si no coincide, el otro.
+		introspectors := []func() (*IntrospectionResponse, error){
+			func() (*IntrospectionResponse, error) { return introspectAccessToken(request.Context(), server, token) },
+			func() (*IntrospectionResponse, error) { return introspectRefreshToken(request.Context(), token) },
+		}
+		if request.PostForm.Get("token_type_hint") == TOKEN_TYPE_HINT_REFRESH_TOKEN {
+			introspectors[0], introspectors[1] = introspectors[1], introspectors[0]
+		}
+
+		//* Cualquier 'token' desconocido se responde simplemente como inactivo.
+		notEncodedResponse := &IntrospectionResponse{}
+		for _, introspect := range introspectors {
+			response, err := introspect()
+			if err != nil {
+				writeOAuthError(writer, http.StatusInternalServerError, OAUTH_ERROR_SERVER_ERROR, err.Error())
+				return
+			}
+			if response != nil {
+				notEncodedResponse = response
+				break
+			}
+		}
+
+		//* Enviamos la respuesta.
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
+func RevokeHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Según RFC 7009, la petición llega codificada como formulario.
+		if err := request.ParseForm(); err != nil {
+			writeOAuthError(writer, http.StatusBadRequest, OAUTH_ERROR_INVALID_REQUEST, err.Error())
+			return
+		}
+
+		//* El cliente se autentica igual que en '/token' y sólo puede revocar sus propios 'token'.
+		client, err := authenticateOAuthClient(request)
+		if err != nil {
+			writeOAuthError(writer, http.StatusInternalServerError, OAUTH_ERROR_SERVER_ERROR, err.Error())
+			return
+		}
+		if client == nil {
+			writer.Header().Set("WWW-Authenticate", `Basic realm="revoke"`)
+			writeOAuthError(writer, http.StatusUnauthorized, OAUTH_ERROR_INVALID_CLIENT, "Client authentication failed")
+			return
+		}
+		token := request.PostForm.Get("token")
+		if token == "" {
+			writeOAuthError(writer, http.StatusBadRequest, OAUTH_ERROR_INVALID_REQUEST, "Missing token")
+			return
+		}
+
+		//* Guardamos el momento en el que se produjo el registro.
+		currentTime := time.Now()
+
+		//* Si es un 'token' de acceso vigente, lo añadimos a la lista de revocados.
+		if claims := parseSignedUserClaim(server, token); claims != nil {
+			if claims.ClientId != client.Id {
+				writeOAuthError(writer, http.StatusBadRequest, OAUTH_ERROR_UNAUTHORIZED_CLIENT, "Token was not issued to this client")
+				return
+			}
+			revokedToken := &models.RevokedToken{
+				TokenId:   claims.Id,
+				UserId:    claims.UserId,
+				ClientId:  claims.ClientId,
+				ExpiresAt: time.Unix(claims.ExpiresAt, 0),
+				RevokedAt: currentTime,
+			}
+			if err := databases.InsertRevokedToken(request.Context(), revokedToken); err != nil {
+				writeOAuthError(writer, http.StatusInternalServerError, OAUTH_ERROR_SERVER_ERROR, err.Error())
+				return
+			}
+			writer.WriteHeader(http.StatusOK)
+			return
+		}
+
+		//* Si es un 'token' de refresco, revocamos toda su familia.
+		refreshToken, err := databases.GetRefreshTokenByHash(request.Context(), hashOpaqueToken(token))
+		if err != nil {
+			writeOAuthError(writer, http.StatusInternalServerError, OAUTH_ERROR_SERVER_ERROR, err.Error())
+			return
+		}
+		if refreshToken != nil {
+			if refreshToken.ClientId != client.Id {
+				writeOAuthError(writer, http.StatusBadRequest, OAUTH_ERROR_UNAUTHORIZED_CLIENT, "Token was not issued to this client")
+				return
+			}
+			if err := databases.RevokeRefreshTokenFamily(request.Context(), refreshToken.FamilyId, currentTime); err != nil {
+				writeOAuthError(writer, http.StatusInternalServerError, OAUTH_ERROR_SERVER_ERROR, err.Error())
+				return
+			}
+		}
+
+		//* Los 'token' desconocidos, caducados o ya revocados también se responden con éxito.
+		writer.WriteHeader(http.StatusOK)
+	}
+}
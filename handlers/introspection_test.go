@@ -0,0 +1,67 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/aerodinamicat/thisisme02/handlers"
+	"github.com/aerodinamicat/thisisme02/principals"
+	"github.com/golang-jwt/jwt"
+	"github.com/segmentio/ksuid"
+)
+
+func (ts *testServer) serviceToken(scopes ...string) string {
+	ts.t.Helper()
+	clientId := ksuid.New().String()
+	currentTime := time.Now()
+	token, err := ts.server.KeyRing.Sign(handlers.UserClaim{
+		Scopes:      scopes,
+		ClientId:    clientId,
+		SubjectType: principals.SUBJECT_TYPE_SERVICE,
+		AuthMethod:  principals.AUTH_METHOD_CLIENT,
+		StandardClaims: jwt.StandardClaims{
+			Id:        ksuid.New().String(),
+			Subject:   clientId,
+			IssuedAt:  currentTime.Unix(),
+			ExpiresAt: currentTime.Add(time.Hour).Unix(),
+		},
+	})
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	return token
+}
+func (ts *testServer) introspect(service, token string) *handlers.IntrospectionResponse {
+	ts.t.Helper()
+	var response handlers.IntrospectionResponse
+	decodeResponse(ts.t, ts.doForm("/introspect", service, url.Values{"token": {token}}), http.StatusOK, &response)
+	return &response
+}
+
+func TestIntrospectRevokedTokens(t *testing.T) {
+	ts := newTestServer(t)
+	user := ts.insertUser("introspect@example.com")
+	logIn := ts.logIn("introspect@example.com")
+	service := ts.serviceToken(handlers.INTROSPECT_SCOPE)
+
+	for _, token := range []string{logIn.Authorization, logIn.RefreshToken} {
+		if response := ts.introspect(service, token); !response.Active || response.Subject != user.Id {
+			t.Fatalf("introspection before log out = %+v, want active for %s", response, user.Id)
+		}
+	}
+
+	//* Al cerrar la sesión, ambos 'token' dejan de estar activos y se indican como revocados.
+	expectStatus(t, ts.doJSON(http.MethodPost, "/logout", logIn.Authorization, handlers.LogOutRequest{RefreshToken: logIn.RefreshToken}), http.StatusOK)
+	for _, token := range []string{logIn.Authorization, logIn.RefreshToken} {
+		if response := ts.introspect(service, token); response.Active || !response.Revoked {
+			t.Fatalf("introspection after log out = %+v, want revoked", response)
+		}
+	}
+
+	//* Un 'token' desconocido simplemente está inactivo.
+	if response := ts.introspect(service, "unknown"); response.Active || response.Revoked {
+		t.Fatalf("introspection of unknown token = %+v, want inactive", response)
+	}
+}
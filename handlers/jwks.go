@@ -0,0 +1,17 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/aerodinamicat/thisisme02/servers"
+)
+
+func JWKSHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Publicamos las claves públicas con las que validar nuestros 'token'.
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Header().Set("Cache-Control", "public, max-age=300")
+		json.NewEncoder(writer).Encode(server.KeyRing.JWKS())
+	}
+}
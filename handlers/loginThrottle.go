@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aerodinamicat/thisisme02/databases"
+	"github.com/aerodinamicat/thisisme02/models"
+	"github.com/aerodinamicat/thisisme02/servers"
+)
+
+const (
+	LOGIN_THROTTLE_KEY_ACCOUNT = "account:"
+	LOGIN_THROTTLE_KEY_ADDRESS = "address:"
+
+	//* Los fallos más antiguos que esta ventana dejan de contar.
+	LOGIN_FAILURES_WINDOW = 15 * time.Minute
+	//* A partir de este número de fallos, cada nuevo intento espera el doble que el anterior.
+	LOGIN_DELAY_THRESHOLD = 3
+	LOGIN_MAX_DELAY       = 30 * time.Second
+	//* Al alcanzar estos fallos, la cuenta o la dirección quedan bloqueadas temporalmente.
+	ACCOUNT_LOCKOUT_THRESHOLD = 10
+	ADDRESS_LOCKOUT_THRESHOLD = 50
+	LOGIN_LOCKOUT_DURATION    = 15 * time.Minute
+
+	LOGIN_THROTTLE_SYSTEM_ACTOR = "system"
+)
+
+type UnlockUserResponse struct {
+	Result bool `json:"result"`
+}
+
+func accountThrottleKey(email string) string {
+	return LOGIN_THROTTLE_KEY_ACCOUNT + strings.ToLower(strings.TrimSpace(email))
+}
+func addressThrottleKey(server *servers.HttpServer, request *http.Request) string {
+	//* Vacía si no se conoce la dirección del cliente: entonces sólo se limita la cuenta.
+	address := clientAddress(server, request)
+	if address == nil {
+		return ""
+	}
+	return LOGIN_THROTTLE_KEY_ADDRESS + address.String()
+}
+func clientAddress(server *servers.HttpServer, request *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		host = request.RemoteAddr
+	}
+	address := net.ParseIP(host)
+	if address == nil || !server.Config.IsTrustedProxy(address) {
+		//* Sin 'proxy' de confianza sólo vale la dirección de la conexión: las cabeceras las controla el cliente.
+		return address
+	}
+
+	//* Recorremos 'X-Forwarded-For' desde el final: cada 'proxy' de confianza añade a quien le llamó.
+	//* La primera dirección que no es de un 'proxy' de confianza es la del cliente.
+	forwardedFor := strings.Split(strings.Join(request.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwardedFor) - 1; i >= 0; i-- {
+		forwardedAddress := net.ParseIP(strings.TrimSpace(forwardedFor[i]))
+		if forwardedAddress == nil {
+			return nil
+		}
+		if !server.Config.IsTrustedProxy(forwardedAddress) {
+			return forwardedAddress
+		}
+	}
+	//* El 'proxy' no indicó el cliente: compartir su dirección bloquearía a todos sus clientes a la vez.
+	return nil
+}
+func loginDelay(failures int) time.Duration {
+	if failures < LOGIN_DELAY_THRESHOLD {
+		return 0
+	}
+	delay := time.Duration(math.Pow(2, float64(failures-LOGIN_DELAY_THRESHOLD))) * time.Second
+	if delay > LOGIN_MAX_DELAY {
+		return LOGIN_MAX_DELAY
+	}
+	return delay
+}
+
+func enforceLoginThrottle(writer http.ResponseWriter, request *http.Request, accountKey, addressKey string) bool {
+	//* Comprobamos la cuenta y la dirección. Devuelve falso, con la respuesta ya enviada, si no se permite el intento.
+	currentTime := time.Now()
+	for _, key := range []string{accountKey, addressKey} {
+		if key == "" {
+			continue
+		}
+		loginThrottle, err := databases.GetLoginThrottle(request.Context(), key)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return false
+		}
+		if loginThrottle == nil {
+			continue
+		}
+
+		//* Un bloqueo de la cuenta se distingue del resto para que el cliente pueda explicarlo.
+		if currentTime.Before(loginThrottle.LockedUntil) {
+			writer.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(loginThrottle.LockedUntil.Sub(currentTime).Seconds()))))
+			if key == accountKey {
+				http.Error(writer, "Account locked", http.StatusLocked)
+			} else {
+				http.Error(writer, "Too many attempts", http.StatusTooManyRequests)
+			}
+			return false
+		}
+
+		//* Si aún no ha pasado la espera correspondiente a los fallos recientes, rechazamos el intento.
+		if loginThrottle.LastFailedAt.After(currentTime.Add(-LOGIN_FAILURES_WINDOW)) {
+			retryAt := loginThrottle.LastFailedAt.Add(loginDelay(loginThrottle.Failures))
+			if currentTime.Before(retryAt) {
+				writer.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAt.Sub(currentTime).Seconds()))))
+				http.Error(writer, "Too many attempts", http.StatusTooManyRequests)
+				return false
+			}
+		}
+	}
+	return true
+}
+func registerLoginFailure(ctx context.Context, accountKey, addressKey string, user *models.User) error {
+	//* Contamos el fallo en la cuenta y en la dirección, y las bloqueamos si llegan al límite, todo o nada.
+	currentTime := time.Now()
+	thresholds := map[string]int{
+		accountKey: ACCOUNT_LOCKOUT_THRESHOLD,
+		addressKey: ADDRESS_LOCKOUT_THRESHOLD,
+	}
+	return databases.RunInTransaction(ctx, func(ctx context.Context) error {
+		for key, threshold := range thresholds {
+			if key == "" {
+				continue
+			}
+			loginThrottle, err := databases.RegisterLoginFailure(ctx, key, currentTime, currentTime.Add(-LOGIN_FAILURES_WINDOW))
+			if err != nil {
+				return err
+			}
+			if loginThrottle.Failures < threshold {
+				continue
+			}
+			lockedUntil := currentTime.Add(LOGIN_LOCKOUT_DURATION)
+			if err := databases.LockLoginThrottle(ctx, key, lockedUntil); err != nil {
+				return err
+			}
+
+			//* Si la cuenta existe, dejamos constancia del bloqueo en su historial.
+			if key == accountKey && user != nil && user.Id != "" {
+				propertyChange := &models.PropertyChange{
+					UserId:    user.Id,
+					Name:      "lockout",
+					From:      "",
+					To:        lockedUntil.UTC().Format(time.RFC3339),
+					CreatedAt: currentTime,
+					CreatedBy: LOGIN_THROTTLE_SYSTEM_ACTOR,
+				}
+				if err := databases.InsertPropertyChangeLog(ctx, propertyChange); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func UnlockUserHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Esta función requiere el permiso 'users:manage', que comprueba 'CheckAuthMiddleware'.
+		principal, user, ok := getManagedUser(writer, request)
+		if !ok {
+			return
+		}
+
+		//* Solicitamos a DB el registro de fallos de la cuenta.
+		accountKey := accountThrottleKey(user.Email)
+		loginThrottle, err := databases.GetLoginThrottle(request.Context(), accountKey)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Borramos los fallos y el bloqueo, si lo hay.
+		err = databases.RunInTransaction(request.Context(), func(ctx context.Context) error {
+			if err := databases.DeleteLoginThrottle(ctx, accountKey); err != nil {
+				return err
+			}
+
+			//* Si estaba bloqueada, dejamos constancia del desbloqueo, atribuyéndolo al administrador.
+			currentTime := time.Now()
+			if loginThrottle == nil || !currentTime.Before(loginThrottle.LockedUntil) {
+				return nil
+			}
+			propertyChange := &models.PropertyChange{
+				UserId:    user.Id,
+				Name:      "lockout",
+				From:      loginThrottle.LockedUntil.UTC().Format(time.RFC3339),
+				To:        "",
+				CreatedAt: currentTime,
+				CreatedBy: principal.UserId,
+			}
+			return databases.InsertPropertyChangeLog(ctx, propertyChange)
+		})
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Preparamos la respuesta y la enviamos.
+		notEncodedResponse := UnlockUserResponse{
+			Result: true,
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
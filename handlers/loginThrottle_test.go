@@ -0,0 +1,60 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aerodinamicat/thisisme02/databases"
+	"github.com/aerodinamicat/thisisme02/handlers"
+)
+
+func seedLoginFailures(t *testing.T, key string, failures int) {
+	t.Helper()
+	//* Fallos de hace un minuto: cuentan para el bloqueo, pero su espera ya ha pasado.
+	failedAt := time.Now().Add(-time.Minute)
+	for i := 0; i < failures; i++ {
+		if _, err := databases.RegisterLoginFailure(context.Background(), key, failedAt, failedAt.Add(-handlers.LOGIN_FAILURES_WINDOW)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+func logInRequest(email, password string) handlers.LogInRequest {
+	return handlers.LogInRequest{Email: email, Password: password}
+}
+
+func TestLogInDelay(t *testing.T) {
+	ts := newTestServer(t)
+	ts.insertUser("delay@example.com")
+
+	//* Hasta el umbral, los fallos no imponen espera.
+	for i := 0; i < handlers.LOGIN_DELAY_THRESHOLD; i++ {
+		expectStatus(t, ts.doJSON(http.MethodPost, "/login", "", logInRequest("delay@example.com", "wrong")), http.StatusUnauthorized)
+	}
+
+	//* A partir de él, ni siquiera la 'password' correcta se comprueba hasta que pase la espera.
+	recorder := ts.doJSON(http.MethodPost, "/login", "", logInRequest("delay@example.com", TEST_PASSWORD))
+	expectStatus(t, recorder, http.StatusTooManyRequests)
+	if recorder.Header().Get("Retry-After") == "" {
+		t.Error("missing Retry-After header")
+	}
+}
+func TestAccountLockout(t *testing.T) {
+	ts := newTestServer(t)
+	ts.insertUser("lockout@example.com")
+	seedLoginFailures(t, handlers.LOGIN_THROTTLE_KEY_ACCOUNT+"lockout@example.com", handlers.ACCOUNT_LOCKOUT_THRESHOLD-1)
+
+	//* El fallo que alcanza el umbral bloquea la cuenta, también para la 'password' correcta.
+	expectStatus(t, ts.doJSON(http.MethodPost, "/login", "", logInRequest("lockout@example.com", "wrong")), http.StatusUnauthorized)
+	expectStatus(t, ts.doJSON(http.MethodPost, "/login", "", logInRequest("lockout@example.com", TEST_PASSWORD)), http.StatusLocked)
+}
+func TestAddressLockout(t *testing.T) {
+	ts := newTestServer(t)
+	ts.insertUser("address@example.com")
+	seedLoginFailures(t, handlers.LOGIN_THROTTLE_KEY_ADDRESS+TEST_CLIENT_ADDRESS, handlers.ADDRESS_LOCKOUT_THRESHOLD-1)
+
+	//* Un fallo más contra cualquier cuenta bloquea la dirección, y con ella a todas las cuentas.
+	expectStatus(t, ts.doJSON(http.MethodPost, "/login", "", logInRequest("unknown@example.com", "wrong")), http.StatusUnauthorized)
+	expectStatus(t, ts.doJSON(http.MethodPost, "/login", "", logInRequest("address@example.com", TEST_PASSWORD)), http.StatusTooManyRequests)
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/aerodinamicat/thisisme02/databases"
+	"github.com/aerodinamicat/thisisme02/models"
+	"github.com/aerodinamicat/thisisme02/principals"
+	"github.com/aerodinamicat/thisisme02/servers"
+)
+
+type LogOutRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+type LogOutResponse struct {
+	Result bool `json:"result"`
+}
+
+func LogOutHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Esta función requiere autenticación de usuario.
+		//* Obtenemos la identidad que 'CheckAuthMiddleware' dejó en el contexto de la petición.
+		principal, ok := principals.FromContext(request.Context())
+		if !ok {
+			http.Error(writer, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		//* Preparamos la petición y la recibimos. El cuerpo es opcional.
+		var decodedRequest = new(LogOutRequest)
+		if request.ContentLength != 0 {
+			if err := json.NewDecoder(request.Body).Decode(&decodedRequest); err != nil {
+				http.Error(writer, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		//* Guardamos el momento en el que se produjo el registro.
+		currentTime := time.Now()
+
+		//* Revocamos ambos 'token' en una única transacción.
+		if err := databases.RunInTransaction(request.Context(), func(ctx context.Context) error {
+			//* Revocamos el 'token' de acceso con el que se hizo la petición.
+			revokedToken := &models.RevokedToken{
+				TokenId:   principal.TokenId,
+				UserId:    principal.UserId,
+				ExpiresAt: principal.ExpiresAt,
+				RevokedAt: currentTime,
+			}
+			if err := databases.InsertRevokedToken(ctx, revokedToken); err != nil {
+				return err
+			}
+
+			//* Si nos facilitan el 'token' de refresco, revocamos también su familia.
+			if decodedRequest.RefreshToken == "" {
+				return nil
+			}
+			refreshToken, err := databases.GetRefreshTokenByHash(ctx, hashOpaqueToken(decodedRequest.RefreshToken))
+			if err != nil {
+				return err
+			}
+			if refreshToken != nil && refreshToken.UserId == principal.UserId {
+				return databases.RevokeRefreshTokenFamily(ctx, refreshToken.FamilyId, currentTime)
+			}
+			return nil
+		}); err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Preparamos la respuesta y la enviamos.
+		notEncodedResponse := LogOutResponse{
+			Result: true,
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
+func LogOutAllHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Esta función requiere autenticación de usuario.
+		//* Obtenemos la identidad que 'CheckAuthMiddleware' dejó en el contexto de la petición.
+		principal, ok := principals.FromContext(request.Context())
+		if !ok {
+			http.Error(writer, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		//* Guardamos el momento en el que se produjo el registro.
+		currentTime := time.Now()
+
+		//* Todo 'token' de acceso emitido hasta ahora deja de ser válido, y también los de refresco.
+		if err := databases.RunInTransaction(request.Context(), func(ctx context.Context) error {
+			return revokeUserSessions(ctx, principal.UserId, currentTime)
+		}); err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Preparamos la respuesta y la enviamos.
+		notEncodedResponse := LogOutResponse{
+			Result: true,
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
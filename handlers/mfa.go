@@ -0,0 +1,467 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aerodinamicat/thisisme02/databases"
+	"github.com/aerodinamicat/thisisme02/models"
+	"github.com/aerodinamicat/thisisme02/principals"
+	"github.com/aerodinamicat/thisisme02/servers"
+	"github.com/aerodinamicat/thisisme02/totp"
+	"github.com/golang-jwt/jwt"
+	"github.com/segmentio/ksuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	MFA_ISSUER                = "thisisme"
+	MFA_CHALLENGE_AUDIENCE    = "mfa_challenge"
+	MFA_CHALLENGE_TOKEN_TYPE  = "mfa-challenge+jwt"
+	MFA_CHALLENGE_EXPIRE_TIME = 5 * time.Minute
+	RECOVERY_CODES_COUNT      = 10
+	RECOVERY_CODE_SIZE        = 10
+	RECOVERY_CODE_ALPHABET    = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+type MfaChallengeClaim struct {
+	UserId string
+	jwt.StandardClaims
+}
+
+type MfaChallengeResponse struct {
+	MfaRequired bool   `json:"mfaRequired"`
+	MfaToken    string `json:"mfaToken"`
+}
+
+type MfaEnrollResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type MfaConfirmRequest struct {
+	Code string `json:"code"`
+}
+type MfaConfirmResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+type MfaDisableRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+type MfaDisableResponse struct {
+	Result bool `json:"result"`
+}
+
+type LogInMfaRequest struct {
+	MfaToken     string `json:"mfaToken"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+func newMfaChallengeToken(server *servers.HttpServer, userId string) (string, error) {
+	//* Se firma con el anillo de claves, como los 'token' de acceso, pero con su propio 'typ' y audiencia.
+	currentTime := time.Now()
+	return server.KeyRing.SignWithType(MfaChallengeClaim{
+		UserId: userId,
+		StandardClaims: jwt.StandardClaims{
+			Audience:  MFA_CHALLENGE_AUDIENCE,
+			IssuedAt:  currentTime.Unix(),
+			ExpiresAt: currentTime.Add(MFA_CHALLENGE_EXPIRE_TIME).Unix(),
+		},
+	}, MFA_CHALLENGE_TOKEN_TYPE)
+}
+func parseMfaChallengeToken(server *servers.HttpServer, mfaToken string) (*MfaChallengeClaim, error) {
+	token, err := jwt.ParseWithClaims(mfaToken, &MfaChallengeClaim{}, server.KeyRing.Keyfunc)
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(*MfaChallengeClaim)
+	tokenType, _ := token.Header["typ"].(string)
+	if !ok || !token.Valid || tokenType != MFA_CHALLENGE_TOKEN_TYPE || !claims.VerifyAudience(MFA_CHALLENGE_AUDIENCE, true) {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+func newRecoveryCode() (string, error) {
+	//* Tomamos bytes aleatorios y descartamos los que no caben un número exacto de veces en el alfabeto,
+	//* para que todos los caracteres tengan la misma probabilidad.
+	limit := 256 - 256%len(RECOVERY_CODE_ALPHABET)
+	code := make([]byte, 0, RECOVERY_CODE_SIZE)
+	randomBytes := make([]byte, RECOVERY_CODE_SIZE)
+	for len(code) < RECOVERY_CODE_SIZE {
+		if _, err := rand.Read(randomBytes); err != nil {
+			return "", err
+		}
+		for _, randomByte := range randomBytes {
+			if int(randomByte) >= limit || len(code) == RECOVERY_CODE_SIZE {
+				continue
+			}
+			code = append(code, RECOVERY_CODE_ALPHABET[int(randomByte)%len(RECOVERY_CODE_ALPHABET)])
+		}
+	}
+
+	return string(code), nil
+}
+func normalizeRecoveryCode(code string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
+
+func MfaEnrollHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Esta función requiere autenticación de usuario.
+		//* Obtenemos la identidad que 'CheckAuthMiddleware' dejó en el contexto de la petición.
+		principal, ok := principals.FromContext(request.Context())
+		if !ok {
+			http.Error(writer, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		//* Solicitamos un 'user' a DB.
+		user, err := databases.GetUserById(request.Context(), principal.UserId)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Si ya tiene MFA activado, no permitimos sustituirlo sin desactivarlo antes.
+		userMfa, err := databases.GetUserMfaByUserId(request.Context(), user.Id)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if userMfa != nil && !userMfa.EnabledAt.IsZero() {
+			http.Error(writer, "MFA already enabled", http.StatusConflict)
+			return
+		}
+
+		//* Generamos un nuevo secreto y lo guardamos pendiente de confirmación.
+		secret, err := totp.GenerateSecret()
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		userMfa = &models.UserMfa{
+			UserId:    user.Id,
+			Secret:    secret,
+			CreatedAt: time.Now(),
+		}
+		if err := databases.UpsertUserMfa(request.Context(), userMfa); err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Preparamos la respuesta y la enviamos.
+		notEncodedResponse := MfaEnrollResponse{
+			Secret: secret,
+			URI:    totp.BuildURI(MFA_ISSUER, user.Email, secret),
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
+func MfaConfirmHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Esta función requiere autenticación de usuario.
+		//* Obtenemos la identidad que 'CheckAuthMiddleware' dejó en el contexto de la petición.
+		principal, ok := principals.FromContext(request.Context())
+		if !ok {
+			http.Error(writer, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		//* Preparamos la petición y la recibimos.
+		var decodedRequest = new(MfaConfirmRequest)
+		if err := json.NewDecoder(request.Body).Decode(&decodedRequest); err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		//* Solicitamos el alta pendiente a DB.
+		userMfa, err := databases.GetUserMfaByUserId(request.Context(), principal.UserId)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if userMfa == nil || !userMfa.EnabledAt.IsZero() {
+			http.Error(writer, "No pending MFA enrollment", http.StatusConflict)
+			return
+		}
+
+		//* Guardamos el momento en el que se produjo el registro.
+		currentTime := time.Now()
+
+		//* Comprobamos el primer código generado por la aplicación del 'user'.
+		step, ok := totp.Validate(userMfa.Secret, decodedRequest.Code, currentTime)
+		if !ok {
+			http.Error(writer, "Invalid code", http.StatusUnauthorized)
+			return
+		}
+
+		//* Generamos los códigos de recuperación. Sólo se guarda su 'hash'.
+		recoveryCodes := make([]string, 0, RECOVERY_CODES_COUNT)
+		for i := 0; i < RECOVERY_CODES_COUNT; i++ {
+			code, err := newRecoveryCode()
+			if err != nil {
+				http.Error(writer, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			recoveryCodes = append(recoveryCodes, code)
+		}
+
+		//* Activamos MFA, sustituimos los códigos y dejamos constancia en una única transacción.
+		if err := databases.RunInTransaction(request.Context(), func(ctx context.Context) error {
+			userMfa.LastUsedStep = step
+			userMfa.EnabledAt = currentTime
+			if err := databases.UpdateUserMfa(ctx, userMfa); err != nil {
+				return err
+			}
+
+			if err := databases.DeleteRecoveryCodesByUserId(ctx, principal.UserId); err != nil {
+				return err
+			}
+			for _, code := range recoveryCodes {
+				recoveryCode := &models.RecoveryCode{
+					Id:        ksuid.New().String(),
+					UserId:    principal.UserId,
+					CodeHash:  hashOpaqueToken(code),
+					CreatedAt: currentTime,
+				}
+				if err := databases.InsertRecoveryCode(ctx, recoveryCode); err != nil {
+					return err
+				}
+			}
+
+			//* Instanciamos un 'propertyChange' y lo guardamos en DB.
+			propertyChange := &models.PropertyChange{
+				UserId:    principal.UserId,
+				Name:      "mfa",
+				From:      "disabled",
+				To:        "enabled",
+				CreatedAt: currentTime,
+				CreatedBy: principal.UserId,
+			}
+			return databases.InsertPropertyChangeLog(ctx, propertyChange)
+		}); err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Preparamos la respuesta y la enviamos.
+		notEncodedResponse := MfaConfirmResponse{
+			RecoveryCodes: recoveryCodes,
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
+func MfaDisableHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Esta función requiere autenticación de usuario.
+		//* Obtenemos la identidad que 'CheckAuthMiddleware' dejó en el contexto de la petición.
+		principal, ok := principals.FromContext(request.Context())
+		if !ok {
+			http.Error(writer, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		//* Preparamos la petición y la recibimos.
+		var decodedRequest = new(MfaDisableRequest)
+		if err := json.NewDecoder(request.Body).Decode(&decodedRequest); err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		//* Solicitamos un 'user' y su MFA a DB.
+		user, err := databases.GetUserById(request.Context(), principal.UserId)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		userMfa, err := databases.GetUserMfaByUserId(request.Context(), principal.UserId)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if userMfa == nil || userMfa.EnabledAt.IsZero() {
+			http.Error(writer, "MFA not enabled", http.StatusConflict)
+			return
+		}
+
+		//* Para desactivarlo exigimos tanto la 'password' como un código válido.
+		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(decodedRequest.Password)); err != nil {
+			http.Error(writer, "Invalid credentials", http.StatusUnauthorized)
+			return
+		}
+		step, ok := totp.Validate(userMfa.Secret, decodedRequest.Code, time.Now())
+		if !ok {
+			http.Error(writer, "Invalid code", http.StatusUnauthorized)
+			return
+		}
+
+		//* Borramos el secreto y los códigos de recuperación, y dejamos constancia, en una única transacción.
+		if err := databases.RunInTransaction(request.Context(), func(ctx context.Context) error {
+			//* Consumimos el código igual que en '/login/mfa', para que no pueda repetirse.
+			userMfa.LastUsedStep = step
+			if err := databases.UpdateUserMfa(ctx, userMfa); err != nil {
+				return err
+			}
+
+			if err := databases.DeleteUserMfa(ctx, user.Id); err != nil {
+				return err
+			}
+			if err := databases.DeleteRecoveryCodesByUserId(ctx, user.Id); err != nil {
+				return err
+			}
+
+			//* Instanciamos un 'propertyChange' y lo guardamos en DB.
+			propertyChange := &models.PropertyChange{
+				UserId:    user.Id,
+				Name:      "mfa",
+				From:      "enabled",
+				To:        "disabled",
+				CreatedAt: time.Now(),
+				CreatedBy: user.Id,
+			}
+			return databases.InsertPropertyChangeLog(ctx, propertyChange)
+		}); err != nil {
+			if err == databases.ErrTokenAlreadyUsed {
+				http.Error(writer, "Invalid code", http.StatusUnauthorized)
+				return
+			}
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Preparamos la respuesta y la enviamos.
+		notEncodedResponse := MfaDisableResponse{
+			Result: true,
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
+func LogInMfaHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Preparamos la petición y la recibimos.
+		var decodedRequest = new(LogInMfaRequest)
+		if err := json.NewDecoder(request.Body).Decode(&decodedRequest); err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		//* Comprobamos el 'token' de desafío emitido por '/login'.
+		claims, err := parseMfaChallengeToken(server, decodedRequest.MfaToken)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		//* Solicitamos el 'user' del desafío a DB.
+		user, err := databases.GetUserById(request.Context(), claims.UserId)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if user == nil || user.Id == "" {
+			http.Error(writer, "Invalid credentials", http.StatusUnauthorized)
+			return
+		}
+
+		//* Los códigos también se pueden adivinar: aplicamos los mismos límites que en '/login'.
+		accountKey := accountThrottleKey(user.Email)
+		addressKey := addressThrottleKey(server, request)
+		if !enforceLoginThrottle(writer, request, accountKey, addressKey) {
+			return
+		}
+
+		//* Solicitamos el MFA del 'user' a DB.
+		userMfa, err := databases.GetUserMfaByUserId(request.Context(), claims.UserId)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if userMfa == nil || userMfa.EnabledAt.IsZero() {
+			http.Error(writer, "Invalid credentials", http.StatusUnauthorized)
+			return
+		}
+
+		//* Guardamos el momento en el que se produjo el registro.
+		currentTime := time.Now()
+
+		if decodedRequest.RecoveryCode != "" {
+			//* Si nos facilitan un código de recuperación, lo consumimos.
+			recoveryCode, err := databases.GetRecoveryCodeByUserIdAndHash(request.Context(), claims.UserId, hashOpaqueToken(normalizeRecoveryCode(decodedRequest.RecoveryCode)))
+			if err != nil {
+				http.Error(writer, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if recoveryCode == nil || !recoveryCode.UsedAt.IsZero() {
+				if err := registerLoginFailure(request.Context(), accountKey, addressKey, user); err != nil {
+					http.Error(writer, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				http.Error(writer, "Invalid credentials", http.StatusUnauthorized)
+				return
+			}
+			recoveryCode.UsedAt = currentTime
+			if err := databases.UpdateRecoveryCode(request.Context(), recoveryCode); err != nil {
+				if err == databases.ErrTokenAlreadyUsed {
+					http.Error(writer, "Invalid credentials", http.StatusUnauthorized)
+					return
+				}
+				http.Error(writer, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		} else {
+			//* En otro caso, comprobamos el código TOTP y que no se haya usado ya.
+			step, ok := totp.Validate(userMfa.Secret, decodedRequest.Code, currentTime)
+			if !ok {
+				if err := registerLoginFailure(request.Context(), accountKey, addressKey, user); err != nil {
+					http.Error(writer, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				http.Error(writer, "Invalid credentials", http.StatusUnauthorized)
+				return
+			}
+			userMfa.LastUsedStep = step
+			if err := databases.UpdateUserMfa(request.Context(), userMfa); err != nil {
+				if err == databases.ErrTokenAlreadyUsed {
+					http.Error(writer, "Invalid credentials", http.StatusUnauthorized)
+					return
+				}
+				http.Error(writer, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		//* Superado el segundo factor, comprobamos el estado de la cuenta, que pudo bloquearse entre '/login' y este paso.
+		if !checkUserCanLogIn(writer, server, user) {
+			return
+		}
+
+		//* Con el 'user' ya autenticado, olvidamos los fallos previos de la cuenta.
+		if err := databases.DeleteLoginThrottle(request.Context(), accountKey); err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Generamos los 'token' como en '/login'.
+		notEncodedResponse, err := issueTokens(request.Context(), server, claims.UserId, "", principals.AUTH_METHOD_MFA, time.Now())
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Enviamos la respuesta.
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Header().Set(HEADER_AUTHORIZATION, notEncodedResponse.Authorization)
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
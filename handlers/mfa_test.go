@@ -0,0 +1,67 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aerodinamicat/thisisme02/handlers"
+	"github.com/aerodinamicat/thisisme02/totp"
+)
+
+func (ts *testServer) mfaToken(email string) string {
+	ts.t.Helper()
+	var response handlers.MfaChallengeResponse
+	decodeResponse(ts.t, ts.doJSON(http.MethodPost, "/login", "", handlers.LogInRequest{Email: email, Password: TEST_PASSWORD}), http.StatusOK, &response)
+	if !response.MfaRequired {
+		ts.t.Fatal("log in did not require MFA")
+	}
+	return response.MfaToken
+}
+func generateCode(t *testing.T, secret string, step int64) string {
+	t.Helper()
+	code, err := totp.GenerateCode(secret, step)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestMfaLogIn(t *testing.T) {
+	ts := newTestServer(t)
+	ts.insertUser("mfa@example.com")
+	authorization := ts.logIn("mfa@example.com").Authorization
+
+	//* Activamos MFA confirmando el código del paso actual.
+	var enroll handlers.MfaEnrollResponse
+	decodeResponse(t, ts.doJSON(http.MethodPost, "/user/mfa/enroll", authorization, nil), http.StatusOK, &enroll)
+	step := totp.Step(time.Now())
+	confirmCode := generateCode(t, enroll.Secret, step)
+	var confirm handlers.MfaConfirmResponse
+	decodeResponse(t, ts.doJSON(http.MethodPost, "/user/mfa/confirm", authorization, handlers.MfaConfirmRequest{Code: confirmCode}), http.StatusOK, &confirm)
+	if len(confirm.RecoveryCodes) < 2 {
+		t.Fatalf("got %d recovery codes, want at least 2", len(confirm.RecoveryCodes))
+	}
+
+	t.Run("totp replay", func(t *testing.T) {
+		//* El código usado al confirmar ya no vale para iniciar sesión.
+		expectStatus(t, ts.doJSON(http.MethodPost, "/login/mfa", "", handlers.LogInMfaRequest{MfaToken: ts.mfaToken("mfa@example.com"), Code: confirmCode}), http.StatusUnauthorized)
+
+		//* El del paso siguiente, dentro del desfase admitido, sí; pero sólo una vez.
+		nextCode := generateCode(t, enroll.Secret, step+1)
+		var logIn handlers.LogInResponse
+		decodeResponse(t, ts.doJSON(http.MethodPost, "/login/mfa", "", handlers.LogInMfaRequest{MfaToken: ts.mfaToken("mfa@example.com"), Code: nextCode}), http.StatusOK, &logIn)
+		if logIn.Authorization == "" {
+			t.Fatal("no access token issued")
+		}
+		expectStatus(t, ts.doJSON(http.MethodPost, "/login/mfa", "", handlers.LogInMfaRequest{MfaToken: ts.mfaToken("mfa@example.com"), Code: nextCode}), http.StatusUnauthorized)
+	})
+
+	t.Run("recovery codes", func(t *testing.T) {
+		//* Cada código de recuperación vale una sola vez, y usar uno no consume los demás.
+		recoveryCode := confirm.RecoveryCodes[0]
+		expectStatus(t, ts.doJSON(http.MethodPost, "/login/mfa", "", handlers.LogInMfaRequest{MfaToken: ts.mfaToken("mfa@example.com"), RecoveryCode: recoveryCode}), http.StatusOK)
+		expectStatus(t, ts.doJSON(http.MethodPost, "/login/mfa", "", handlers.LogInMfaRequest{MfaToken: ts.mfaToken("mfa@example.com"), RecoveryCode: recoveryCode}), http.StatusUnauthorized)
+		expectStatus(t, ts.doJSON(http.MethodPost, "/login/mfa", "", handlers.LogInMfaRequest{MfaToken: ts.mfaToken("mfa@example.com"), RecoveryCode: confirm.RecoveryCodes[1]}), http.StatusOK)
+	})
+}
@@ -0,0 +1,586 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aerodinamicat/thisisme02/databases"
+	"github.com/aerodinamicat/thisisme02/models"
+	"github.com/aerodinamicat/thisisme02/principals"
+	"github.com/aerodinamicat/thisisme02/servers"
+	"github.com/segmentio/ksuid"
+)
+
+const (
+	OAUTH_AUTHORIZATION_CODE_EXPIRE_TIME = 5 * time.Minute
+	OAUTH_CODE_CHALLENGE_METHOD_S256     = "S256"
+
+	OAUTH_RESPONSE_TYPE_CODE = "code"
+
+	OAUTH_GRANT_TYPE_AUTHORIZATION_CODE = "authorization_code"
+	OAUTH_GRANT_TYPE_REFRESH_TOKEN      = "refresh_token"
+	OAUTH_GRANT_TYPE_CLIENT_CREDENTIALS = "client_credentials"
+
+	OAUTH_ERROR_INVALID_REQUEST           = "invalid_request"
+	OAUTH_ERROR_INVALID_CLIENT            = "invalid_client"
+	OAUTH_ERROR_INVALID_GRANT             = "invalid_grant"
+	OAUTH_ERROR_INVALID_SCOPE             = "invalid_scope"
+	OAUTH_ERROR_ACCESS_DENIED             = "access_denied"
+	OAUTH_ERROR_UNSUPPORTED_RESPONSE_TYPE = "unsupported_response_type"
+	OAUTH_ERROR_UNSUPPORTED_GRANT_TYPE    = "unsupported_grant_type"
+	OAUTH_ERROR_UNAUTHORIZED_CLIENT       = "unauthorized_client"
+	OAUTH_ERROR_SERVER_ERROR              = "server_error"
+)
+
+type AuthorizeRequest struct {
+	ResponseType        string `json:"response_type"`
+	ClientId            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	Nonce               string `json:"nonce"`
+	Approve             bool   `json:"approve"`
+}
+type AuthorizeResponse struct {
+	ConsentRequired bool                `json:"consentRequired"`
+	Client          *models.OAuthClient `json:"client,omitempty"`
+	Scopes          []string            `json:"scopes,omitempty"`
+	RedirectTo      string              `json:"redirectTo,omitempty"`
+}
+
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IdToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+type OAuthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+func writeOAuthError(writer http.ResponseWriter, statusCode int, code, description string) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Header().Set("Cache-Control", "no-store")
+	writer.WriteHeader(statusCode)
+	json.NewEncoder(writer).Encode(OAuthErrorResponse{
+		Error:            code,
+		ErrorDescription: description,
+	})
+}
+func writeOAuthTokenResponse(writer http.ResponseWriter, response *OAuthTokenResponse) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Header().Set("Cache-Control", "no-store")
+	writer.Header().Set("Pragma", "no-cache")
+	json.NewEncoder(writer).Encode(response)
+}
+
+func containsAll(granted, requested []string) bool {
+	for _, requestedScope := range requested {
+		found := false
+		for _, grantedScope := range granted {
+			if grantedScope == requestedScope {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+func buildRedirectURI(redirectURI string, params url.Values) (string, error) {
+	//* Añadimos los parámetros a la URI registrada, conservando los que ya tuviera.
+	parsedURI, err := url.Parse(redirectURI)
+	if err != nil {
+		return "", err
+	}
+	query := parsedURI.Query()
+	for name, values := range params {
+		for _, value := range values {
+			query.Add(name, value)
+		}
+	}
+	parsedURI.RawQuery = query.Encode()
+
+	return parsedURI.String(), nil
+}
+func authorizeErrorRedirect(redirectURI, state, code, description string) (string, error) {
+	params := url.Values{}
+	params.Set("error", code)
+	params.Set("error_description", description)
+	if state != "" {
+		params.Set("state", state)
+	}
+	return buildRedirectURI(redirectURI, params)
+}
+func verifyCodeChallenge(codeVerifier, codeChallenge string) bool {
+	//* RFC 7636: el verificador tiene entre 43 y 128 caracteres y su SHA-256 en 'base64url' es el desafío.
+	if len(codeVerifier) < 43 || len(codeVerifier) > 128 {
+		return false
+	}
+	hash := sha256.Sum256([]byte(codeVerifier))
+	computedChallenge := base64.RawURLEncoding.EncodeToString(hash[:])
+
+	return subtle.ConstantTimeCompare([]byte(computedChallenge), []byte(codeChallenge)) == 1
+}
+func newOAuthAccessToken(server *servers.HttpServer, userId, clientId string, scopes []string, authTime time.Time) (string, error) {
+	claims := newUserClaim(userId, principals.AUTH_METHOD_OAUTH, authTime)
+	claims.ClientId = clientId
+	claims.Scopes = scopes
+	return server.KeyRing.Sign(claims)
+}
+func newServiceAccessToken(server *servers.HttpServer, clientId string, scopes []string) (string, error) {
+	//* El sujeto es el propio cliente: no hay 'user' detrás de una cuenta de servicio.
+	claims := newUserClaim("", principals.AUTH_METHOD_CLIENT, time.Time{})
+	claims.Subject = clientId
+	claims.SubjectType = principals.SUBJECT_TYPE_SERVICE
+	claims.ClientId = clientId
+	claims.Scopes = scopes
+	return server.KeyRing.Sign(claims)
+}
+func authenticateOAuthClient(request *http.Request) (*models.OAuthClient, error) {
+	//* Los clientes confidenciales se autentican con 'client_secret_basic' o 'client_secret_post'.
+	//* Los públicos sólo se identifican con 'client_id'.
+	clientId, clientSecret, hasBasicAuth := request.BasicAuth()
+	if hasBasicAuth {
+		var err error
+		if clientId, err = url.QueryUnescape(clientId); err != nil {
+			return nil, nil
+		}
+		if clientSecret, err = url.QueryUnescape(clientSecret); err != nil {
+			return nil, nil
+		}
+	} else {
+		clientId = request.PostForm.Get("client_id")
+		clientSecret = request.PostForm.Get("client_secret")
+	}
+
+	//* Solicitamos el cliente a DB.
+	client, err := databases.GetOAuthClientById(request.Context(), clientId)
+	if err != nil || client == nil {
+		return nil, err
+	}
+	if !client.Confidential {
+		if clientSecret != "" {
+			return nil, nil
+		}
+		return client, nil
+	}
+	if clientSecret == "" || subtle.ConstantTimeCompare([]byte(hashOpaqueToken(clientSecret)), []byte(client.SecretHash)) != 1 {
+		return nil, nil
+	}
+
+	return client, nil
+}
+func issueOAuthTokens(ctx context.Context, server *servers.HttpServer, userId, familyId, clientId string, scopes []string, authTime time.Time, nonce string) (*OAuthTokenResponse, error) {
+	//* Generamos el 'token' de acceso, compatible con 'UserClaim' pero ligado al cliente y sus ámbitos.
+	accessToken, err := newOAuthAccessToken(server, userId, clientId, scopes, authTime)
+	if err != nil {
+		return nil, err
+	}
+
+	//* Generamos el 'token' de refresco, también ligado al cliente.
+	refreshToken, err := newRefreshToken(ctx, userId, familyId, clientId, scopes, authTime, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	response := &OAuthTokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(ACCESS_TOKEN_EXPIRE_TIME.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        strings.Join(scopes, " "),
+	}
+
+	//* Si se pidió 'openid', añadimos el 'token' de identidad OIDC.
+	if containsAll(scopes, []string{OIDC_SCOPE_OPENID}) {
+		if response.IdToken, err = newIdToken(ctx, server, userId, clientId, scopes, authTime, nonce); err != nil {
+			return nil, err
+		}
+	}
+
+	return response, nil
+}
+
+func AuthorizeHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Esta función requiere autenticación de usuario.
+		//* Obtenemos la identidad que 'CheckAuthMiddleware' dejó en el contexto de la petición.
+		principal, ok := principals.FromContext(request.Context())
+		if !ok {
+			http.Error(writer, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		//* Un cliente OAuth no puede autorizar a otro en nombre del 'user'.
+		if principal.ClientId != "" {
+			http.Error(writer, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		//* Preparamos la petición y la recibimos: por 'query' al consultar, por cuerpo al decidir.
+		var decodedRequest = new(AuthorizeRequest)
+		if request.Method == http.MethodPost {
+			if err := json.NewDecoder(request.Body).Decode(&decodedRequest); err != nil {
+				http.Error(writer, err.Error(), http.StatusBadRequest)
+				return
+			}
+		} else {
+			query := request.URL.Query()
+			decodedRequest.ResponseType = query.Get("response_type")
+			decodedRequest.ClientId = query.Get("client_id")
+			decodedRequest.RedirectURI = query.Get("redirect_uri")
+			decodedRequest.Scope = query.Get("scope")
+			decodedRequest.State = query.Get("state")
+			decodedRequest.CodeChallenge = query.Get("code_challenge")
+			decodedRequest.CodeChallengeMethod = query.Get("code_challenge_method")
+			decodedRequest.Nonce = query.Get("nonce")
+		}
+
+		//* Solicitamos el cliente a DB.
+		client, err := databases.GetOAuthClientById(request.Context(), decodedRequest.ClientId)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		//* Si el cliente o la URI de redirección no son válidos, no redirigimos: respondemos el error directamente.
+		if client == nil {
+			http.Error(writer, "Invalid client", http.StatusBadRequest)
+			return
+		}
+		if !containsAll(client.RedirectURIs, []string{decodedRequest.RedirectURI}) {
+			http.Error(writer, "Invalid redirect URI", http.StatusBadRequest)
+			return
+		}
+
+		//* A partir de aquí los errores se devuelven al cliente a través de su URI de redirección.
+		redirectWithError := func(code, description string) {
+			redirectTo, err := authorizeErrorRedirect(decodedRequest.RedirectURI, decodedRequest.State, code, description)
+			if err != nil {
+				http.Error(writer, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			writer.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(writer).Encode(AuthorizeResponse{RedirectTo: redirectTo})
+		}
+		if decodedRequest.ResponseType != OAUTH_RESPONSE_TYPE_CODE {
+			redirectWithError(OAUTH_ERROR_UNSUPPORTED_RESPONSE_TYPE, "Only the authorization code flow is supported")
+			return
+		}
+		//* PKCE es obligatorio y sólo admitimos 'S256'.
+		if decodedRequest.CodeChallenge == "" || decodedRequest.CodeChallengeMethod != OAUTH_CODE_CHALLENGE_METHOD_S256 {
+			redirectWithError(OAUTH_ERROR_INVALID_REQUEST, "PKCE with S256 is required")
+			return
+		}
+		if len(decodedRequest.CodeChallenge) < 43 || len(decodedRequest.CodeChallenge) > 128 {
+			redirectWithError(OAUTH_ERROR_INVALID_REQUEST, "Invalid code challenge")
+			return
+		}
+
+		//* Si no se piden ámbitos concretos, se conceden todos los registrados para el cliente.
+		scopes := strings.Fields(decodedRequest.Scope)
+		if len(scopes) == 0 {
+			scopes = client.Scopes
+		}
+		if !containsAll(client.Scopes, scopes) {
+			redirectWithError(OAUTH_ERROR_INVALID_SCOPE, "Requested scope is not allowed for this client")
+			return
+		}
+
+		//* Guardamos el momento en el que se produjo el registro.
+		currentTime := time.Now()
+
+		//* Comprobamos si el 'user' ya consintió estos ámbitos para el cliente.
+		consent, err := databases.GetOAuthConsent(request.Context(), principal.UserId, client.Id)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		consentGranted := consent != nil && containsAll(consent.Scopes, scopes)
+
+		if request.Method == http.MethodPost {
+			//* Si el 'user' rechaza, se lo comunicamos al cliente.
+			if !decodedRequest.Approve {
+				redirectWithError(OAUTH_ERROR_ACCESS_DENIED, "The user denied the request")
+				return
+			}
+
+			//* Registramos el consentimiento, ampliando el que ya hubiera.
+			if !consentGranted {
+				if consent == nil {
+					consent = &models.OAuthConsent{
+						UserId:    principal.UserId,
+						ClientId:  client.Id,
+						CreatedAt: currentTime,
+					}
+				}
+				for _, scope := range scopes {
+					if !containsAll(consent.Scopes, []string{scope}) {
+						consent.Scopes = append(consent.Scopes, scope)
+					}
+				}
+				consent.UpdatedAt = currentTime
+				if err := databases.UpsertOAuthConsent(request.Context(), consent); err != nil {
+					http.Error(writer, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				consentGranted = true
+			}
+		}
+
+		//* Si falta el consentimiento, devolvemos lo necesario para pedírselo al 'user'.
+		if !consentGranted {
+			notEncodedResponse := AuthorizeResponse{
+				ConsentRequired: true,
+				Client:          client,
+				Scopes:          scopes,
+			}
+			writer.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(writer).Encode(notEncodedResponse)
+			return
+		}
+
+		//* Generamos el código de autorización: opaco, de un solo uso y de vida corta.
+		id, err := ksuid.NewRandom()
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		code, codeHash, err := newOpaqueToken()
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		authorizationCode := &models.OAuthAuthorizationCode{
+			Id:                  id.String(),
+			CodeHash:            codeHash,
+			ClientId:            client.Id,
+			UserId:              principal.UserId,
+			RedirectURI:         decodedRequest.RedirectURI,
+			Scopes:              scopes,
+			CodeChallenge:       decodedRequest.CodeChallenge,
+			CodeChallengeMethod: decodedRequest.CodeChallengeMethod,
+			Nonce:               decodedRequest.Nonce,
+			AuthTime:            principal.AuthTime,
+			ExpiresAt:           currentTime.Add(OAUTH_AUTHORIZATION_CODE_EXPIRE_TIME),
+			CreatedAt:           currentTime,
+		}
+		if err := databases.InsertOAuthAuthorizationCode(request.Context(), authorizationCode); err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Preparamos la redirección con el código y la enviamos.
+		params := url.Values{}
+		params.Set("code", code)
+		if decodedRequest.State != "" {
+			params.Set("state", decodedRequest.State)
+		}
+		redirectTo, err := buildRedirectURI(decodedRequest.RedirectURI, params)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		notEncodedResponse := AuthorizeResponse{
+			RedirectTo: redirectTo,
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
+
+func OAuthTokenHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Según OAuth 2.0, la petición llega codificada como formulario.
+		if err := request.ParseForm(); err != nil {
+			writeOAuthError(writer, http.StatusBadRequest, OAUTH_ERROR_INVALID_REQUEST, err.Error())
+			return
+		}
+
+		//* Identificamos al cliente y, si es confidencial, comprobamos su secreto.
+		client, err := authenticateOAuthClient(request)
+		if err != nil {
+			writeOAuthError(writer, http.StatusInternalServerError, OAUTH_ERROR_SERVER_ERROR, err.Error())
+			return
+		}
+		if client == nil {
+			writer.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+			writeOAuthError(writer, http.StatusUnauthorized, OAUTH_ERROR_INVALID_CLIENT, "Client authentication failed")
+			return
+		}
+
+		switch request.PostForm.Get("grant_type") {
+		case OAUTH_GRANT_TYPE_AUTHORIZATION_CODE:
+			exchangeAuthorizationCode(writer, request, server, client)
+		case OAUTH_GRANT_TYPE_REFRESH_TOKEN:
+			exchangeRefreshToken(writer, request, server, client)
+		case OAUTH_GRANT_TYPE_CLIENT_CREDENTIALS:
+			exchangeClientCredentials(writer, request, server, client)
+		case OAUTH_GRANT_TYPE_DEVICE_CODE:
+			exchangeDeviceCode(writer, request, server, client)
+		default:
+			writeOAuthError(writer, http.StatusBadRequest, OAUTH_ERROR_UNSUPPORTED_GRANT_TYPE, "Unsupported grant type")
+		}
+	}
+}
+func exchangeAuthorizationCode(writer http.ResponseWriter, request *http.Request, server *servers.HttpServer, client *models.OAuthClient) {
+	//* Guardamos el momento en el que se produjo el registro.
+	currentTime := time.Now()
+
+	//* Solicitamos a DB el código a partir de su 'hash'.
+	authorizationCode, err := databases.GetOAuthAuthorizationCodeByHash(request.Context(), hashOpaqueToken(request.PostForm.Get("code")))
+	if err != nil {
+		writeOAuthError(writer, http.StatusInternalServerError, OAUTH_ERROR_SERVER_ERROR, err.Error())
+		return
+	}
+	if authorizationCode == nil || authorizationCode.ClientId != client.Id {
+		writeOAuthError(writer, http.StatusBadRequest, OAUTH_ERROR_INVALID_GRANT, "Invalid authorization code")
+		return
+	}
+	//* Si el código ya se canjeó, alguien lo está reutilizando: revocamos los 'token' emitidos con él.
+	if !authorizationCode.UsedAt.IsZero() {
+		if authorizationCode.FamilyId != "" {
+			if err := databases.RevokeRefreshTokenFamily(request.Context(), authorizationCode.FamilyId, currentTime); err != nil {
+				writeOAuthError(writer, http.StatusInternalServerError, OAUTH_ERROR_SERVER_ERROR, err.Error())
+				return
+			}
+		}
+		writeOAuthError(writer, http.StatusBadRequest, OAUTH_ERROR_INVALID_GRANT, "Authorization code already used")
+		return
+	}
+	if currentTime.After(authorizationCode.ExpiresAt) {
+		writeOAuthError(writer, http.StatusBadRequest, OAUTH_ERROR_INVALID_GRANT, "Authorization code expired")
+		return
+	}
+	//* La URI de redirección debe coincidir con la usada en '/authorize' y el verificador con el desafío PKCE.
+	if authorizationCode.RedirectURI != request.PostForm.Get("redirect_uri") {
+		writeOAuthError(writer, http.StatusBadRequest, OAUTH_ERROR_INVALID_GRANT, "Redirect URI mismatch")
+		return
+	}
+	if !verifyCodeChallenge(request.PostForm.Get("code_verifier"), authorizationCode.CodeChallenge) {
+		writeOAuthError(writer, http.StatusBadRequest, OAUTH_ERROR_INVALID_GRANT, "Invalid code verifier")
+		return
+	}
+
+	//* Marcamos el código como usado, reservando la familia de los 'token' que vamos a emitir, y los emitimos.
+	var notEncodedResponse *OAuthTokenResponse
+	err = databases.RunInTransaction(request.Context(), func(ctx context.Context) error {
+		authorizationCode.UsedAt = currentTime
+		authorizationCode.FamilyId = ksuid.New().String()
+		if err := databases.UpdateOAuthAuthorizationCode(ctx, authorizationCode); err != nil {
+			return err
+		}
+		notEncodedResponse, err = issueOAuthTokens(ctx, server, authorizationCode.UserId, authorizationCode.FamilyId, client.Id, authorizationCode.Scopes, authorizationCode.AuthTime, authorizationCode.Nonce)
+		return err
+	})
+	if err == databases.ErrTokenAlreadyUsed {
+		writeOAuthError(writer, http.StatusBadRequest, OAUTH_ERROR_INVALID_GRANT, "Authorization code already used")
+		return
+	}
+	if err != nil {
+		writeOAuthError(writer, http.StatusInternalServerError, OAUTH_ERROR_SERVER_ERROR, err.Error())
+		return
+	}
+
+	//* Enviamos la respuesta.
+	writeOAuthTokenResponse(writer, notEncodedResponse)
+}
+func exchangeRefreshToken(writer http.ResponseWriter, request *http.Request, server *servers.HttpServer, client *models.OAuthClient) {
+	//* Guardamos el momento en el que se produjo el registro.
+	currentTime := time.Now()
+
+	//* Solicitamos a DB el 'token' a partir de su 'hash'. Debe pertenecer al cliente que lo presenta.
+	refreshToken, err := databases.GetRefreshTokenByHash(request.Context(), hashOpaqueToken(request.PostForm.Get("refresh_token")))
+	if err != nil {
+		writeOAuthError(writer, http.StatusInternalServerError, OAUTH_ERROR_SERVER_ERROR, err.Error())
+		return
+	}
+	if refreshToken != nil && refreshToken.ClientId != client.Id {
+		writeOAuthError(writer, http.StatusBadRequest, OAUTH_ERROR_INVALID_GRANT, "Invalid or expired token")
+		return
+	}
+
+	//* Sólo se pueden reducir los ámbitos concedidos originalmente, nunca ampliarlos.
+	scopes := strings.Fields(request.PostForm.Get("scope"))
+	if refreshToken != nil {
+		if len(scopes) == 0 {
+			scopes = refreshToken.Scopes
+		}
+		if !containsAll(refreshToken.Scopes, scopes) {
+			writeOAuthError(writer, http.StatusBadRequest, OAUTH_ERROR_INVALID_SCOPE, "Requested scope exceeds the original grant")
+			return
+		}
+	}
+
+	//* Lo marcamos como usado para que no pueda volver a canjearse y emitimos un nuevo par de 'token' dentro de la misma familia.
+	var notEncodedResponse *OAuthTokenResponse
+	err = databases.RunInTransaction(request.Context(), func(ctx context.Context) error {
+		if err := consumeRefreshToken(ctx, refreshToken, currentTime); err != nil {
+			return err
+		}
+		notEncodedResponse, err = issueOAuthTokens(ctx, server, refreshToken.UserId, refreshToken.FamilyId, client.Id, scopes, refreshToken.AuthTime, "")
+		return err
+	})
+	//* Si se está reutilizando, revocamos toda la familia una vez deshecha la transacción.
+	if err == ErrRefreshTokenReuse {
+		err = revokeRefreshTokenFamily(request.Context(), refreshToken.FamilyId, currentTime)
+	}
+	if err != nil {
+		switch err {
+		case ErrInvalidToken:
+			writeOAuthError(writer, http.StatusBadRequest, OAUTH_ERROR_INVALID_GRANT, "Invalid or expired token")
+		case ErrRefreshTokenReuse:
+			writeOAuthError(writer, http.StatusBadRequest, OAUTH_ERROR_INVALID_GRANT, "Refresh token reuse detected")
+		default:
+			writeOAuthError(writer, http.StatusInternalServerError, OAUTH_ERROR_SERVER_ERROR, err.Error())
+		}
+		return
+	}
+
+	//* Enviamos la respuesta.
+	writeOAuthTokenResponse(writer, notEncodedResponse)
+}
+func exchangeClientCredentials(writer http.ResponseWriter, request *http.Request, server *servers.HttpServer, client *models.OAuthClient) {
+	//* Sólo los clientes confidenciales pueden actuar como cuenta de servicio.
+	if !client.Confidential {
+		writeOAuthError(writer, http.StatusBadRequest, OAUTH_ERROR_UNAUTHORIZED_CLIENT, "Public clients cannot use the client credentials grant")
+		return
+	}
+
+	//* Si no se piden ámbitos concretos, se conceden todos los registrados para el cliente.
+	scopes := strings.Fields(request.PostForm.Get("scope"))
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	//* 'openid' no tiene sentido sin un 'user' detrás.
+	if !containsAll(client.Scopes, scopes) || containsAll(scopes, []string{OIDC_SCOPE_OPENID}) {
+		writeOAuthError(writer, http.StatusBadRequest, OAUTH_ERROR_INVALID_SCOPE, "Requested scope is not allowed for this client")
+		return
+	}
+
+	//* Emitimos sólo el 'token' de acceso: el cliente puede pedir otro con sus credenciales cuando caduque.
+	accessToken, err := newServiceAccessToken(server, client.Id, scopes)
+	if err != nil {
+		writeOAuthError(writer, http.StatusInternalServerError, OAUTH_ERROR_SERVER_ERROR, err.Error())
+		return
+	}
+	writeOAuthTokenResponse(writer, &OAuthTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(ACCESS_TOKEN_EXPIRE_TIME.Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	})
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aerodinamicat/thisisme02/databases"
+	"github.com/aerodinamicat/thisisme02/models"
+	"github.com/aerodinamicat/thisisme02/principals"
+	"github.com/aerodinamicat/thisisme02/servers"
+	"github.com/segmentio/ksuid"
+)
+
+const (
+	//* Ámbitos de recurso: cada ruta que admite credenciales delegadas declara el que necesita.
+	SCOPE_PROFILE_READ   = "profile:read"
+	SCOPE_API_KEYS_READ  = "apikeys:read"
+	SCOPE_API_KEYS_WRITE = "apikeys:write"
+	SCOPE_CLIENTS_READ   = "clients:read"
+)
+
+var (
+	//* Ámbitos que cualquier 'user' puede conceder a sus clientes y a sus claves personales.
+	GRANTABLE_SCOPES = []string{OIDC_SCOPE_OPENID, OIDC_SCOPE_EMAIL, SCOPE_PROFILE_READ, SCOPE_API_KEYS_READ, SCOPE_API_KEYS_WRITE, SCOPE_CLIENTS_READ}
+	//* Ámbitos que dan acceso a datos de otros 'user': sólo con el permiso 'clients:manage'.
+	PRIVILEGED_SCOPES = []string{INTROSPECT_SCOPE}
+)
+
+type CreateOAuthClientRequest struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirectUris"`
+	Scopes       []string `json:"scopes"`
+	Confidential bool     `json:"confidential"`
+}
+type CreateOAuthClientResponse struct {
+	Client       *models.OAuthClient `json:"client"`
+	ClientSecret string              `json:"clientSecret,omitempty"`
+}
+
+type OAuthClientsListResponse struct {
+	Clients []*models.OAuthClient `json:"clients"`
+}
+
+func isValidRedirectURI(redirectURI string) bool {
+	//* Sólo admitimos URIs absolutas y sin fragmento, tal y como exige OAuth 2.0.
+	parsedURI, err := url.Parse(redirectURI)
+	if err != nil {
+		return false
+	}
+	return parsedURI.IsAbs() && parsedURI.Host != "" && parsedURI.Fragment == ""
+}
+func isPrivilegedScope(scope string) bool {
+	return containsAll(PRIVILEGED_SCOPES, []string{scope})
+}
+
+func CreateOAuthClientHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Esta función requiere autenticación de usuario.
+		//* Obtenemos la identidad que 'CheckAuthMiddleware' dejó en el contexto de la petición.
+		principal, ok := principals.FromContext(request.Context())
+		if !ok {
+			http.Error(writer, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		//* Preparamos la petición y la recibimos.
+		var decodedRequest = new(CreateOAuthClientRequest)
+		if err := json.NewDecoder(request.Body).Decode(&decodedRequest); err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		//* Comprobamos que el cliente tenga nombre y, si es público, al menos una URI de redirección válida.
+		//* Los confidenciales pueden no tenerla cuando sólo se usan como cuenta de servicio.
+		if strings.TrimSpace(decodedRequest.Name) == "" {
+			http.Error(writer, "Name is required", http.StatusBadRequest)
+			return
+		}
+		if !decodedRequest.Confidential && len(decodedRequest.RedirectURIs) == 0 {
+			http.Error(writer, "Redirect URIs are required for public clients", http.StatusBadRequest)
+			return
+		}
+		for _, redirectURI := range decodedRequest.RedirectURIs {
+			if !isValidRedirectURI(redirectURI) {
+				http.Error(writer, "Invalid redirect URI", http.StatusBadRequest)
+				return
+			}
+		}
+		//* Sólo admitimos los ámbitos que conocemos. Los privilegiados y los clientes confidenciales,
+		//* que pueden obtener 'token' de servicio sin ningún 'user', requieren el permiso 'clients:manage'.
+		if !containsAll(append(append([]string{}, GRANTABLE_SCOPES...), PRIVILEGED_SCOPES...), decodedRequest.Scopes) {
+			http.Error(writer, "Invalid scope", http.StatusBadRequest)
+			return
+		}
+		requiresPermission := decodedRequest.Confidential
+		for _, scope := range decodedRequest.Scopes {
+			requiresPermission = requiresPermission || isPrivilegedScope(scope)
+		}
+		if requiresPermission && !principals.HasPermission(request.Context(), principals.PERMISSION_CLIENTS_MANAGE) {
+			http.Error(writer, "Insufficient permissions", http.StatusForbidden)
+			return
+		}
+
+		//* Generamos un nuevo 'id' aleatorio, que hará de 'client_id'.
+		id, err := ksuid.NewRandom()
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Instanciamos el cliente.
+		client := &models.OAuthClient{
+			Id:           id.String(),
+			Name:         decodedRequest.Name,
+			RedirectURIs: decodedRequest.RedirectURIs,
+			Scopes:       decodedRequest.Scopes,
+			Confidential: decodedRequest.Confidential,
+			CreatedAt:    time.Now(),
+			CreatedBy:    principal.UserId,
+		}
+
+		//* Si es confidencial, generamos su secreto. Sólo se entrega ahora: en DB guardamos su 'hash'.
+		var clientSecret string
+		if client.Confidential {
+			if clientSecret, client.SecretHash, err = newOpaqueToken(); err != nil {
+				http.Error(writer, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		//* Guardamos el cliente en DB.
+		if err := databases.InsertOAuthClient(request.Context(), client); err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Preparamos la respuesta y la enviamos.
+		notEncodedResponse := CreateOAuthClientResponse{
+			Client:       client,
+			ClientSecret: clientSecret,
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(http.StatusCreated)
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
+func ListOAuthClientsHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Esta función requiere autenticación de usuario.
+		//* Obtenemos la identidad que 'CheckAuthMiddleware' dejó en el contexto de la petición.
+		principal, ok := principals.FromContext(request.Context())
+		if !ok {
+			http.Error(writer, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		//* Solicitamos a DB los clientes registrados por el 'user'.
+		clients, err := databases.ListOAuthClientsByCreator(request.Context(), principal.UserId)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Preparamos la respuesta y la enviamos.
+		notEncodedResponse := OAuthClientsListResponse{
+			Clients: clients,
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
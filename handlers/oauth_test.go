@@ -0,0 +1,78 @@
+package handlers_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/aerodinamicat/thisisme02/handlers"
+	"github.com/aerodinamicat/thisisme02/models"
+)
+
+func codeChallenge(codeVerifier string) string {
+	hash := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+func (ts *testServer) authorize(authorization string, client *models.OAuthClient, codeVerifier string) string {
+	ts.t.Helper()
+	var response handlers.AuthorizeResponse
+	decodeResponse(ts.t, ts.doJSON(http.MethodPost, "/authorize", authorization, handlers.AuthorizeRequest{
+		ResponseType:        "code",
+		ClientId:            client.Id,
+		RedirectURI:         TEST_REDIRECT_URI,
+		Scope:               strings.Join(client.Scopes, " "),
+		State:               "state",
+		CodeChallenge:       codeChallenge(codeVerifier),
+		CodeChallengeMethod: "S256",
+		Approve:             true,
+	}), http.StatusOK, &response)
+
+	redirectTo, err := url.Parse(response.RedirectTo)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	code := redirectTo.Query().Get("code")
+	if code == "" {
+		ts.t.Fatalf("no code in redirect %s", response.RedirectTo)
+	}
+	return code
+}
+func exchangeCodeForm(client *models.OAuthClient, code, codeVerifier string) url.Values {
+	return url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {client.Id},
+		"code":          {code},
+		"redirect_uri":  {TEST_REDIRECT_URI},
+		"code_verifier": {codeVerifier},
+	}
+}
+
+func TestAuthorizationCodePkce(t *testing.T) {
+	ts := newTestServer(t)
+	ts.insertUser("pkce@example.com")
+	authorization := ts.logIn("pkce@example.com").Authorization
+	client := ts.createPublicClient(authorization, handlers.OIDC_SCOPE_OPENID, handlers.OIDC_SCOPE_EMAIL)
+
+	codeVerifier := strings.Repeat("v", 43)
+	code := ts.authorize(authorization, client, codeVerifier)
+
+	//* Con otro verificador el código no se canjea, pero tampoco se consume.
+	expectOAuthError(t, ts.doForm("/token", "", exchangeCodeForm(client, code, strings.Repeat("w", 43))), "invalid_grant")
+
+	var tokens handlers.OAuthTokenResponse
+	decodeResponse(t, ts.doForm("/token", "", exchangeCodeForm(client, code, codeVerifier)), http.StatusOK, &tokens)
+	if tokens.AccessToken == "" || tokens.RefreshToken == "" || tokens.IdToken == "" {
+		t.Fatalf("incomplete token response: %+v", tokens)
+	}
+
+	//* Reutilizar el código se rechaza y revoca los 'token' emitidos con él.
+	expectOAuthError(t, ts.doForm("/token", "", exchangeCodeForm(client, code, codeVerifier)), "invalid_grant")
+	expectOAuthError(t, ts.doForm("/token", "", url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {client.Id},
+		"refresh_token": {tokens.RefreshToken},
+	}), "invalid_grant")
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/aerodinamicat/thisisme02/databases"
+	"github.com/aerodinamicat/thisisme02/principals"
+	"github.com/aerodinamicat/thisisme02/servers"
+	"github.com/golang-jwt/jwt"
+	"github.com/segmentio/ksuid"
+)
+
+const (
+	OIDC_SCOPE_OPENID = "openid"
+	OIDC_SCOPE_EMAIL  = "email"
+
+	ID_TOKEN_EXPIRE_TIME = 1 * time.Hour
+)
+
+type IdTokenClaim struct {
+	AuthTime      int64  `json:"auth_time,omitempty"`
+	Nonce         string `json:"nonce,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+	jwt.StandardClaims
+}
+
+type OpenIdConfigurationResponse struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JwksURI                           string   `json:"jwks_uri"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IdTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+type UserInfoResponse struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+}
+
+func newIdToken(ctx context.Context, server *servers.HttpServer, userId, clientId string, scopes []string, authTime time.Time, nonce string) (string, error) {
+	currentTime := time.Now()
+	claims := IdTokenClaim{
+		Nonce: nonce,
+		StandardClaims: jwt.StandardClaims{
+			Id:        ksuid.New().String(),
+			Issuer:    server.Config.Issuer,
+			Subject:   userId,
+			Audience:  clientId,
+			IssuedAt:  currentTime.Unix(),
+			ExpiresAt: currentTime.Add(ID_TOKEN_EXPIRE_TIME).Unix(),
+		},
+	}
+	if !authTime.IsZero() {
+		claims.AuthTime = authTime.Unix()
+	}
+
+	//* Los datos de contacto sólo se incluyen si el cliente obtuvo el ámbito 'email'.
+	if containsAll(scopes, []string{OIDC_SCOPE_EMAIL}) {
+		user, err := databases.GetUserById(ctx, userId)
+		if err != nil {
+			return "", err
+		}
+		emailVerified := !user.EmailVerifiedAt.IsZero()
+		claims.Email = user.Email
+		claims.EmailVerified = &emailVerified
+	}
+
+	return server.KeyRing.Sign(claims)
+}
+
+func OpenIdConfigurationHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Publicamos los metadatos del proveedor para que los clientes se configuren solos.
+		issuer := server.Config.Issuer
+		notEncodedResponse := OpenIdConfigurationResponse{
+			Issuer:                            issuer,
+			AuthorizationEndpoint:             issuer + "/authorize",
+			TokenEndpoint:                     issuer + "/token",
+			UserInfoEndpoint:                  issuer + "/userinfo",
+			JwksURI:                           issuer + "/.well-known/jwks.json",
+			IntrospectionEndpoint:             issuer + "/introspect",
+			RevocationEndpoint:                issuer + "/revoke",
+			DeviceAuthorizationEndpoint:       issuer + "/device/code",
+			ScopesSupported:                   GRANTABLE_SCOPES,
+			ResponseTypesSupported:            []string{OAUTH_RESPONSE_TYPE_CODE},
+			GrantTypesSupported:               []string{OAUTH_GRANT_TYPE_AUTHORIZATION_CODE, OAUTH_GRANT_TYPE_REFRESH_TOKEN, OAUTH_GRANT_TYPE_CLIENT_CREDENTIALS, OAUTH_GRANT_TYPE_DEVICE_CODE},
+			SubjectTypesSupported:             []string{"public"},
+			IdTokenSigningAlgValuesSupported:  []string{server.KeyRing.Algorithm},
+			TokenEndpointAuthMethodsSupported: []string{"none", "client_secret_basic", "client_secret_post"},
+			CodeChallengeMethodsSupported:     []string{OAUTH_CODE_CHALLENGE_METHOD_S256},
+			ClaimsSupported:                   []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "email", "email_verified"},
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Header().Set("Cache-Control", "public, max-age=300")
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
+func UserInfoHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Esta función requiere un 'token' de acceso con el ámbito 'openid'.
+		//* Obtenemos la identidad que 'CheckAuthMiddleware' dejó en el contexto de la petición.
+		principal, ok := principals.FromContext(request.Context())
+		if !ok {
+			http.Error(writer, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		//* Solicitamos un 'user' a DB.
+		user, err := databases.GetUserById(request.Context(), principal.UserId)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if user == nil || user.Id == "" {
+			http.Error(writer, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		//* Preparamos la respuesta con los datos que permiten los ámbitos concedidos y la enviamos.
+		notEncodedResponse := UserInfoResponse{
+			Subject: user.Id,
+		}
+		if principals.HasScope(request.Context(), OIDC_SCOPE_EMAIL) {
+			emailVerified := !user.EmailVerifiedAt.IsZero()
+			notEncodedResponse.Email = user.Email
+			notEncodedResponse.EmailVerified = &emailVerified
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
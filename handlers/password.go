@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aerodinamicat/thisisme02/databases"
+	"github.com/aerodinamicat/thisisme02/models"
+	"github.com/aerodinamicat/thisisme02/notifications"
+	"github.com/aerodinamicat/thisisme02/servers"
+	"github.com/segmentio/ksuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	OPAQUE_TOKEN_SIZE          = 32
+	PASSWORD_RESET_EXPIRE_TIME = 1 * time.Hour
+)
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+type ForgotPasswordResponse struct {
+	Result bool `json:"result"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"newPassword"`
+}
+type ResetPasswordResponse struct {
+	Result bool `json:"result"`
+}
+
+func newOpaqueToken() (string, string, error) {
+	//* Generamos un 'token' opaco aleatorio y su 'hash'. Al cliente sólo se le entrega el 'token'
+	//* y en DB sólo se guarda el 'hash', de modo que una fuga de la DB no permite usarlos.
+	randomBytes := make([]byte, OPAQUE_TOKEN_SIZE)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(randomBytes)
+
+	return token, hashOpaqueToken(token), nil
+}
+func hashOpaqueToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+func ForgotPasswordHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Preparamos la petición y la recibimos.
+		var decodedRequest = new(ForgotPasswordRequest)
+		if err := json.NewDecoder(request.Body).Decode(&decodedRequest); err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		//* Preparamos la respuesta. Siempre es la misma, exista o no el 'user',
+		//* para no desvelar qué 'email' están registrados.
+		notEncodedResponse := ForgotPasswordResponse{
+			Result: true,
+		}
+
+		//* Solicitamos a DB un 'user' con el 'email' facilitado.
+		user, err := databases.GetUserByEmail(request.Context(), decodedRequest.Email)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if user == nil || user.Id == "" {
+			writer.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(writer).Encode(notEncodedResponse)
+			return
+		}
+
+		//* Generamos un nuevo 'id' aleatorio y el 'token' de restablecimiento.
+		id, err := ksuid.NewRandom()
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		token, tokenHash, err := newOpaqueToken()
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Guardamos el momento en el que se produjo el registro.
+		currentTime := time.Now()
+
+		//* Instanciamos un 'passwordResetToken' y lo guardamos en DB.
+		passwordResetToken := &models.PasswordResetToken{
+			Id:        id.String(),
+			UserId:    user.Id,
+			TokenHash: tokenHash,
+			ExpiresAt: currentTime.Add(PASSWORD_RESET_EXPIRE_TIME),
+			CreatedAt: currentTime,
+		}
+		if err := databases.InsertPasswordResetToken(request.Context(), passwordResetToken); err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Enviamos el 'token' al 'email' del 'user'.
+		body := fmt.Sprintf("Use this token to reset your password before %s: %s", passwordResetToken.ExpiresAt.Format(time.RFC3339), token)
+		if err := notifications.Send(request.Context(), user.Email, "Password reset", body); err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Enviamos la respuesta.
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
+func ResetPasswordHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Preparamos la petición y la recibimos.
+		var decodedRequest = new(ResetPasswordRequest)
+		if err := json.NewDecoder(request.Body).Decode(&decodedRequest); err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		//* Guardamos el momento en el que se produjo el registro.
+		currentTime := time.Now()
+
+		//* Solicitamos a DB el 'token' a partir de su 'hash'.
+		passwordResetToken, err := databases.GetPasswordResetTokenByHash(request.Context(), hashOpaqueToken(decodedRequest.Token))
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		//* Si no existe, ya se usó o ha caducado, respondemos 'No autorizado'.
+		if passwordResetToken == nil || !passwordResetToken.UsedAt.IsZero() || currentTime.After(passwordResetToken.ExpiresAt) {
+			http.Error(writer, "Invalid or expired token", http.StatusUnauthorized)
+			return
+		}
+
+		//* Solicitamos el 'user' al que pertenece el 'token'.
+		user, err := databases.GetUserById(request.Context(), passwordResetToken.UserId)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		//* La cuenta puede haberse eliminado después de pedir el 'token'.
+		if user == nil {
+			http.Error(writer, "Invalid or expired token", http.StatusUnauthorized)
+			return
+		}
+
+		//* Ciframos la nueva 'password'.
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(decodedRequest.NewPassword), HASH_COST)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Instanciamos un 'propertyChange'.
+		propertyChange := &models.PropertyChange{
+			UserId:    user.Id,
+			Name:      "password",
+			From:      user.Password,
+			To:        string(hashedPassword),
+			CreatedAt: currentTime,
+			CreatedBy: user.Id,
+		}
+
+		//* Realizamos el cambio en 'user'.
+		user.Password = string(hashedPassword)
+		user.UpdatedAt = currentTime
+		user.UpdatedBy = user.Id
+
+		//* Consumimos el 'token' y guardamos el cambio en una única transacción.
+		if err := databases.RunInTransaction(request.Context(), func(ctx context.Context) error {
+			//* Marcamos el 'token' como usado antes de nada, para que no pueda reutilizarse.
+			passwordResetToken.UsedAt = currentTime
+			if err := databases.UpdatePasswordResetToken(ctx, passwordResetToken); err != nil {
+				return err
+			}
+			//* Los demás 'token' pendientes del 'user' tampoco deben servir para volver a cambiarla.
+			if err := databases.UsePasswordResetTokensByUserId(ctx, user.Id, currentTime); err != nil {
+				return err
+			}
+
+			//* Guardamos 'user' en DB.
+			if err := databases.UpdateUser(ctx, user); err != nil {
+				return err
+			}
+
+			//* Guardamos 'propertyChange' en DB.
+			if err := databases.InsertPropertyChangeLog(ctx, propertyChange); err != nil {
+				return err
+			}
+
+			//* Cerramos todas sus sesiones: los 'token' robados antes del cambio dejan de valer.
+			return revokeUserSessions(ctx, user.Id, currentTime)
+		}); err != nil {
+			if err == databases.ErrTokenAlreadyUsed {
+				http.Error(writer, "Invalid or expired token", http.StatusUnauthorized)
+				return
+			}
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Preparamos la respuesta y la enviamos.
+		notEncodedResponse := ResetPasswordResponse{
+			Result: true,
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
@@ -0,0 +1,32 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/aerodinamicat/thisisme02/handlers"
+)
+
+func TestResetPasswordTokenSingleUse(t *testing.T) {
+	ts := newTestServer(t)
+	ts.insertUser("reset@example.com")
+
+	//* Pedimos dos 'token' antes de usar ninguno.
+	expectStatus(t, ts.doJSON(http.MethodPost, "/password/forgot", "", handlers.ForgotPasswordRequest{Email: "reset@example.com"}), http.StatusOK)
+	firstToken := ts.sender.lastToken(t, "reset@example.com")
+	expectStatus(t, ts.doJSON(http.MethodPost, "/password/forgot", "", handlers.ForgotPasswordRequest{Email: "reset@example.com"}), http.StatusOK)
+	secondToken := ts.sender.lastToken(t, "reset@example.com")
+	if firstToken == secondToken {
+		t.Fatal("both reset requests sent the same token")
+	}
+
+	expectStatus(t, ts.doJSON(http.MethodPost, "/password/reset", "", handlers.ResetPasswordRequest{Token: firstToken, NewPassword: "a brand new password"}), http.StatusOK)
+
+	//* Ni el 'token' usado ni el otro pendiente sirven para volver a cambiarla.
+	expectStatus(t, ts.doJSON(http.MethodPost, "/password/reset", "", handlers.ResetPasswordRequest{Token: firstToken, NewPassword: "stolen"}), http.StatusUnauthorized)
+	expectStatus(t, ts.doJSON(http.MethodPost, "/password/reset", "", handlers.ResetPasswordRequest{Token: secondToken, NewPassword: "stolen"}), http.StatusUnauthorized)
+
+	//* La 'password' nueva es la que vale.
+	expectStatus(t, ts.doJSON(http.MethodPost, "/login", "", handlers.LogInRequest{Email: "reset@example.com", Password: TEST_PASSWORD}), http.StatusUnauthorized)
+	expectStatus(t, ts.doJSON(http.MethodPost, "/login", "", handlers.LogInRequest{Email: "reset@example.com", Password: "a brand new password"}), http.StatusOK)
+}
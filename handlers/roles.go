@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aerodinamicat/thisisme02/databases"
+	"github.com/aerodinamicat/thisisme02/models"
+	"github.com/aerodinamicat/thisisme02/principals"
+	"github.com/aerodinamicat/thisisme02/servers"
+	"github.com/gorilla/mux"
+	"github.com/segmentio/ksuid"
+)
+
+type PermissionsListResponse struct {
+	Permissions []*models.Permission `json:"permissions"`
+}
+
+type CreateRoleRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+type CreateRoleResponse struct {
+	Role *models.Role `json:"role"`
+}
+
+type RolesListResponse struct {
+	Roles []*models.Role `json:"roles"`
+}
+
+type AssignUserRoleRequest struct {
+	RoleId string `json:"roleId"`
+}
+type AssignUserRoleResponse struct {
+	Result bool `json:"result"`
+}
+
+type RevokeUserRoleResponse struct {
+	Result bool `json:"result"`
+}
+
+func ListPermissionsHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Esta función requiere el permiso 'roles:manage', que comprueba 'CheckAuthMiddleware'.
+		//* Solicitamos a DB los permisos existentes.
+		permissions, err := databases.ListPermissions(request.Context())
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Preparamos la respuesta y la enviamos.
+		notEncodedResponse := PermissionsListResponse{
+			Permissions: permissions,
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
+func ListRolesHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Esta función requiere el permiso 'roles:manage', que comprueba 'CheckAuthMiddleware'.
+		//* Solicitamos a DB los roles con sus permisos.
+		roles, err := databases.ListRoles(request.Context())
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Preparamos la respuesta y la enviamos.
+		notEncodedResponse := RolesListResponse{
+			Roles: roles,
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
+func CreateRoleHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Esta función requiere el permiso 'roles:manage', que comprueba 'CheckAuthMiddleware'.
+		//* Obtenemos la identidad que 'CheckAuthMiddleware' dejó en el contexto de la petición.
+		principal, ok := principals.FromContext(request.Context())
+		if !ok {
+			http.Error(writer, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		//* Preparamos la petición y la recibimos.
+		var decodedRequest = new(CreateRoleRequest)
+		if err := json.NewDecoder(request.Body).Decode(&decodedRequest); err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if strings.TrimSpace(decodedRequest.Name) == "" {
+			http.Error(writer, "Name is required", http.StatusBadRequest)
+			return
+		}
+
+		//* Comprobamos que todos los permisos existan.
+		permissions, err := databases.ListPermissions(request.Context())
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		permissionNames := make([]string, 0, len(permissions))
+		for _, permission := range permissions {
+			permissionNames = append(permissionNames, permission.Name)
+		}
+		if !containsAll(permissionNames, decodedRequest.Permissions) {
+			http.Error(writer, "Unknown permission", http.StatusBadRequest)
+			return
+		}
+
+		//* Generamos un nuevo 'id' aleatorio.
+		id, err := ksuid.NewRandom()
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Instanciamos el rol y lo guardamos en DB.
+		role := &models.Role{
+			Id:          id.String(),
+			Name:        decodedRequest.Name,
+			Description: decodedRequest.Description,
+			Permissions: decodedRequest.Permissions,
+			CreatedAt:   time.Now(),
+			CreatedBy:   principal.UserId,
+		}
+		if err := databases.InsertRole(request.Context(), role); err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Preparamos la respuesta y la enviamos.
+		notEncodedResponse := CreateRoleResponse{
+			Role: role,
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(http.StatusCreated)
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
+
+func ListUserRolesHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Esta función requiere el permiso 'roles:manage', que comprueba 'CheckAuthMiddleware'.
+		//* Solicitamos a DB los roles del 'user' indicado en la ruta.
+		roles, err := databases.ListRolesByUserId(request.Context(), mux.Vars(request)["id"])
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Preparamos la respuesta y la enviamos.
+		notEncodedResponse := RolesListResponse{
+			Roles: roles,
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
+func AssignUserRoleHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Esta función requiere el permiso 'roles:manage', que comprueba 'CheckAuthMiddleware'.
+		//* Obtenemos la identidad que 'CheckAuthMiddleware' dejó en el contexto de la petición.
+		principal, ok := principals.FromContext(request.Context())
+		if !ok {
+			http.Error(writer, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		//* Preparamos la petición y la recibimos.
+		var decodedRequest = new(AssignUserRoleRequest)
+		if err := json.NewDecoder(request.Body).Decode(&decodedRequest); err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		//* Solicitamos a DB el 'user' indicado en la ruta y el rol.
+		user, err := databases.GetUserById(request.Context(), mux.Vars(request)["id"])
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if user == nil || user.Id == "" {
+			http.Error(writer, "User not found", http.StatusNotFound)
+			return
+		}
+		role, err := databases.GetRoleById(request.Context(), decodedRequest.RoleId)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if role == nil {
+			http.Error(writer, "Role not found", http.StatusNotFound)
+			return
+		}
+
+		//* Guardamos el momento en el que se produjo el registro.
+		currentTime := time.Now()
+
+		//* Asignamos el rol. Si ya lo tenía, no hay nada que registrar.
+		userRole := &models.UserRole{
+			UserId:    user.Id,
+			RoleId:    role.Id,
+			CreatedAt: currentTime,
+			CreatedBy: principal.UserId,
+		}
+		err = databases.RunInTransaction(request.Context(), func(ctx context.Context) error {
+			assigned, err := databases.InsertUserRole(ctx, userRole)
+			if err != nil || !assigned {
+				return err
+			}
+
+			//* Instanciamos un 'propertyChange' que deja constancia de la asignación y lo guardamos en DB.
+			propertyChange := &models.PropertyChange{
+				UserId:    user.Id,
+				Name:      "role",
+				From:      "",
+				To:        role.Name,
+				CreatedAt: currentTime,
+				CreatedBy: principal.UserId,
+			}
+			return databases.InsertPropertyChangeLog(ctx, propertyChange)
+		})
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Preparamos la respuesta y la enviamos.
+		notEncodedResponse := AssignUserRoleResponse{
+			Result: true,
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
+func RevokeUserRoleHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Esta función requiere el permiso 'roles:manage', que comprueba 'CheckAuthMiddleware'.
+		//* Obtenemos la identidad que 'CheckAuthMiddleware' dejó en el contexto de la petición.
+		principal, ok := principals.FromContext(request.Context())
+		if !ok {
+			http.Error(writer, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		//* Solicitamos a DB el rol indicado en la ruta.
+		userId := mux.Vars(request)["id"]
+		role, err := databases.GetRoleById(request.Context(), mux.Vars(request)["roleId"])
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if role == nil {
+			http.Error(writer, "Role not found", http.StatusNotFound)
+			return
+		}
+
+		//* Guardamos el momento en el que se produjo el registro.
+		currentTime := time.Now()
+
+		//* Retiramos el rol.
+		var revoked bool
+		err = databases.RunInTransaction(request.Context(), func(ctx context.Context) error {
+			revoked, err = databases.DeleteUserRole(ctx, userId, role.Id)
+			if err != nil || !revoked {
+				return err
+			}
+
+			//* Instanciamos un 'propertyChange' que deja constancia de la retirada y lo guardamos en DB.
+			propertyChange := &models.PropertyChange{
+				UserId:    userId,
+				Name:      "role",
+				From:      role.Name,
+				To:        "",
+				CreatedAt: currentTime,
+				CreatedBy: principal.UserId,
+			}
+			if err := databases.InsertPropertyChangeLog(ctx, propertyChange); err != nil {
+				return err
+			}
+
+			//* Los 'token' ya emitidos llevan los permisos del rol: cerramos todas sus sesiones.
+			return revokeUserSessions(ctx, userId, currentTime)
+		})
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !revoked {
+			http.Error(writer, "Role not assigned", http.StatusNotFound)
+			return
+		}
+
+		//* Preparamos la respuesta y la enviamos.
+		notEncodedResponse := RevokeUserRoleResponse{
+			Result: true,
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
@@ -0,0 +1,58 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aerodinamicat/thisisme02/databases"
+	"github.com/aerodinamicat/thisisme02/handlers"
+	"github.com/aerodinamicat/thisisme02/models"
+	"github.com/aerodinamicat/thisisme02/principals"
+)
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRolePermissionClaims(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+
+	//* Al primer administrador se le asigna directamente en DB el rol que siembran las migraciones.
+	admin := ts.insertUser("admin@example.com")
+	if _, err := databases.InsertUserRole(ctx, &models.UserRole{UserId: admin.Id, RoleId: "admin", CreatedAt: time.Now(), CreatedBy: admin.Id}); err != nil {
+		t.Fatal(err)
+	}
+	adminAuthorization := ts.logIn("admin@example.com").Authorization
+
+	//* Creamos un rol y se lo asignamos a un 'user'.
+	user := ts.insertUser("support@example.com")
+	var createRole handlers.CreateRoleResponse
+	decodeResponse(t, ts.doJSON(http.MethodPost, "/roles", adminAuthorization, handlers.CreateRoleRequest{Name: "support", Permissions: []string{principals.PERMISSION_USERS_MANAGE}}), http.StatusCreated, &createRole)
+	expectStatus(t, ts.doJSON(http.MethodPost, "/users/"+user.Id+"/roles", adminAuthorization, handlers.AssignUserRoleRequest{RoleId: createRole.Role.Id}), http.StatusOK)
+
+	//* Su siguiente sesión lleva el rol y sus permisos, y con ellos accede a las rutas protegidas.
+	authorization := ts.logIn("support@example.com").Authorization
+	claims := ts.claims(authorization)
+	if !contains(claims.Roles, "support") || !contains(claims.Permissions, principals.PERMISSION_USERS_MANAGE) {
+		t.Fatalf("claims roles = %v, permissions = %v, want support and %s", claims.Roles, claims.Permissions, principals.PERMISSION_USERS_MANAGE)
+	}
+	expectStatus(t, ts.doJSON(http.MethodGet, "/users", authorization, handlers.UsersListRequest{}), http.StatusOK)
+
+	//* Al retirarle el rol, el 'token' que lo llevaba deja de valer y la nueva sesión ya no tiene el permiso.
+	expectStatus(t, ts.doJSON(http.MethodDelete, "/users/"+user.Id+"/roles/"+createRole.Role.Id, adminAuthorization, nil), http.StatusOK)
+	expectStatus(t, ts.doJSON(http.MethodGet, "/users", authorization, handlers.UsersListRequest{}), http.StatusUnauthorized)
+
+	authorization = ts.logIn("support@example.com").Authorization
+	if claims := ts.claims(authorization); len(claims.Roles) != 0 || len(claims.Permissions) != 0 {
+		t.Fatalf("claims roles = %v, permissions = %v, want none", claims.Roles, claims.Permissions)
+	}
+	expectStatus(t, ts.doJSON(http.MethodGet, "/users", authorization, handlers.UsersListRequest{}), http.StatusForbidden)
+}
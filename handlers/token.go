@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/aerodinamicat/thisisme02/databases"
+	"github.com/aerodinamicat/thisisme02/models"
+	"github.com/aerodinamicat/thisisme02/principals"
+	"github.com/aerodinamicat/thisisme02/servers"
+	"github.com/segmentio/ksuid"
+)
+
+const (
+	REFRESH_TOKEN_EXPIRE_TIME = 30 * time.Hour * 24
+)
+
+var (
+	ErrRefreshTokenReuse = errors.New("refresh token reuse detected")
+)
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+func newAccessToken(ctx context.Context, server *servers.HttpServer, userId, authMethod string, authTime time.Time) (string, error) {
+	claims := newUserClaim(userId, authMethod, authTime)
+
+	//* Las sesiones propias del 'user' llevan sus roles y permisos; las delegadas en clientes OAuth no.
+	roles, err := databases.ListRolesByUserId(ctx, userId)
+	if err != nil {
+		return "", err
+	}
+	for _, role := range roles {
+		claims.Roles = append(claims.Roles, role.Name)
+		for _, permission := range role.Permissions {
+			if !containsAll(claims.Permissions, []string{permission}) {
+				claims.Permissions = append(claims.Permissions, permission)
+			}
+		}
+	}
+
+	return server.KeyRing.Sign(claims)
+}
+func newRefreshToken(ctx context.Context, userId, familyId, clientId string, scopes []string, authTime, currentTime time.Time) (string, error) {
+	//* Generamos un nuevo 'id' aleatorio y el 'token' opaco.
+	id, err := ksuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+	token, tokenHash, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	//* Si no forma parte de una familia previa, el 'token' inicia una nueva con su propio 'id'.
+	if familyId == "" {
+		familyId = id.String()
+	}
+
+	//* Instanciamos un 'refreshToken' y lo guardamos en DB.
+	refreshToken := &models.RefreshToken{
+		Id:        id.String(),
+		UserId:    userId,
+		FamilyId:  familyId,
+		ClientId:  clientId,
+		Scopes:    scopes,
+		TokenHash: tokenHash,
+		AuthTime:  authTime,
+		ExpiresAt: currentTime.Add(REFRESH_TOKEN_EXPIRE_TIME),
+		CreatedAt: currentTime,
+	}
+	if err := databases.InsertRefreshToken(ctx, refreshToken); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+func issueTokens(ctx context.Context, server *servers.HttpServer, userId, familyId, authMethod string, authTime time.Time) (*LogInResponse, error) {
+	//* Generamos el 'token' de acceso, de vida corta.
+	//* 'authTime' es el momento en que el 'user' se autenticó y se conserva a lo largo de la familia.
+	authorizationToken, err := newAccessToken(ctx, server, userId, authMethod, authTime)
+	if err != nil {
+		return nil, err
+	}
+
+	//* Generamos el 'token' de refresco, opaco y de vida larga.
+	refreshToken, err := newRefreshToken(ctx, userId, familyId, "", nil, authTime, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return &LogInResponse{
+		Authorization: authorizationToken,
+		RefreshToken:  refreshToken,
+	}, nil
+}
+
+func consumeRefreshToken(ctx context.Context, refreshToken *models.RefreshToken, currentTime time.Time) error {
+	//* Si no existe, está revocado o ha caducado, no es válido.
+	if refreshToken == nil || !refreshToken.RevokedAt.IsZero() || currentTime.After(refreshToken.ExpiresAt) {
+		return ErrInvalidToken
+	}
+
+	//* Si ya se usó, alguien está reutilizando un 'token' rotado. Lo mismo ocurre si otra petición lo consume a la vez que ésta.
+	//* Quien reciba 'ErrRefreshTokenReuse' debe revocar la familia fuera de la transacción, o la revocación se desharía con ella.
+	if !refreshToken.UsedAt.IsZero() {
+		return ErrRefreshTokenReuse
+	}
+	refreshToken.UsedAt = currentTime
+	if err := databases.UpdateRefreshToken(ctx, refreshToken); err != nil {
+		if err == databases.ErrTokenAlreadyUsed {
+			return ErrRefreshTokenReuse
+		}
+		return err
+	}
+
+	return nil
+}
+func revokeRefreshTokenFamily(ctx context.Context, familyId string, currentTime time.Time) error {
+	if err := databases.RevokeRefreshTokenFamily(ctx, familyId, currentTime); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReuse
+}
+
+func RefreshTokenHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Preparamos la petición y la recibimos.
+		var decodedRequest = new(RefreshTokenRequest)
+		if err := json.NewDecoder(request.Body).Decode(&decodedRequest); err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		//* Guardamos el momento en el que se produjo el registro.
+		currentTime := time.Now()
+
+		//* Solicitamos a DB el 'token' a partir de su 'hash'.
+		refreshToken, err := databases.GetRefreshTokenByHash(request.Context(), hashOpaqueToken(decodedRequest.RefreshToken))
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		//* Los 'token' emitidos a clientes OAuth sólo se refrescan en '/token'.
+		if refreshToken != nil && refreshToken.ClientId != "" {
+			http.Error(writer, "Invalid or expired token", http.StatusUnauthorized)
+			return
+		}
+
+		//* Lo marcamos como usado para que no pueda volver a canjearse y emitimos un nuevo par de 'token' dentro de la misma familia.
+		var notEncodedResponse *LogInResponse
+		err = databases.RunInTransaction(request.Context(), func(ctx context.Context) error {
+			if err := consumeRefreshToken(ctx, refreshToken, currentTime); err != nil {
+				return err
+			}
+			notEncodedResponse, err = issueTokens(ctx, server, refreshToken.UserId, refreshToken.FamilyId, principals.AUTH_METHOD_REFRESH, refreshToken.AuthTime)
+			return err
+		})
+		//* Si se está reutilizando, revocamos toda la familia una vez deshecha la transacción.
+		if err == ErrRefreshTokenReuse {
+			err = revokeRefreshTokenFamily(request.Context(), refreshToken.FamilyId, currentTime)
+		}
+		if err != nil {
+			switch err {
+			case ErrInvalidToken:
+				http.Error(writer, "Invalid or expired token", http.StatusUnauthorized)
+			case ErrRefreshTokenReuse:
+				http.Error(writer, "Refresh token reuse detected", http.StatusUnauthorized)
+			default:
+				http.Error(writer, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		//* Enviamos la respuesta.
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Header().Set(HEADER_AUTHORIZATION, notEncodedResponse.Authorization)
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
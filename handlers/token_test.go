@@ -0,0 +1,29 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/aerodinamicat/thisisme02/handlers"
+)
+
+func TestRefreshTokenReuse(t *testing.T) {
+	ts := newTestServer(t)
+	ts.insertUser("refresh@example.com")
+	logIn := ts.logIn("refresh@example.com")
+
+	//* La primera rotación es válida y entrega un nuevo 'token' de la misma familia.
+	var rotated handlers.LogInResponse
+	decodeResponse(t, ts.doJSON(http.MethodPost, "/token/refresh", "", handlers.RefreshTokenRequest{RefreshToken: logIn.RefreshToken}), http.StatusOK, &rotated)
+	if rotated.RefreshToken == "" || rotated.RefreshToken == logIn.RefreshToken {
+		t.Fatalf("refresh token was not rotated")
+	}
+
+	//* Volver a presentar el 'token' ya rotado es una reutilización: se rechaza y se revoca la familia,
+	//* de modo que tampoco sirve el que se acaba de emitir.
+	expectStatus(t, ts.doJSON(http.MethodPost, "/token/refresh", "", handlers.RefreshTokenRequest{RefreshToken: logIn.RefreshToken}), http.StatusUnauthorized)
+	expectStatus(t, ts.doJSON(http.MethodPost, "/token/refresh", "", handlers.RefreshTokenRequest{RefreshToken: rotated.RefreshToken}), http.StatusUnauthorized)
+
+	//* Un nuevo inicio de sesión abre una familia distinta, que no se ve afectada.
+	expectStatus(t, ts.doJSON(http.MethodPost, "/token/refresh", "", handlers.RefreshTokenRequest{RefreshToken: ts.logIn("refresh@example.com").RefreshToken}), http.StatusOK)
+}
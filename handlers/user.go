@@ -1,13 +1,15 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
-	"strings"
+	"net/mail"
 	"time"
 
 	"github.com/aerodinamicat/thisisme02/databases"
 	"github.com/aerodinamicat/thisisme02/models"
+	"github.com/aerodinamicat/thisisme02/principals"
 	"github.com/aerodinamicat/thisisme02/servers"
 	"github.com/golang-jwt/jwt"
 	"github.com/segmentio/ksuid"
@@ -15,13 +17,23 @@ import (
 )
 
 const (
-	HASH_COST            = 8
-	EXPIRE_TIME          = 1 * time.Hour * 24
-	HEADER_AUTHORIZATION = "Authorization"
+	HASH_COST                = 8
+	ACCESS_TOKEN_EXPIRE_TIME = 15 * time.Minute
+	HEADER_AUTHORIZATION     = "Authorization"
 )
 
 type UserClaim struct {
-	UserId string
+	UserId     string
+	Scopes     []string `json:"scopes,omitempty"`
+	AuthMethod string   `json:"amr,omitempty"`
+	ClientId   string   `json:"client_id,omitempty"`
+	AuthTime   int64    `json:"auth_time,omitempty"`
+	//* 'service' en los 'token' emitidos a cuentas de servicio; vacío en los de 'user'.
+	SubjectType string   `json:"sub_type,omitempty"`
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	//* 'iat' en microsegundos: con segundos no se distingue un 'token' emitido justo antes de una revocación.
+	IssuedAtMicro int64 `json:"iat_us,omitempty"`
 	jwt.StandardClaims
 }
 
@@ -39,13 +51,15 @@ type LogInRequest struct {
 }
 type LogInResponse struct {
 	Authorization string `json:"authorization"`
+	RefreshToken  string `json:"refreshToken"`
 }
 
 type ChangeEmailRequest struct {
 	NewEmail string `json:"newEmail"`
 }
 type ChangeEmailResponse struct {
-	Result bool `json:"result"`
+	Result  bool `json:"result"`
+	Pending bool `json:"pending"`
 }
 
 type ChangePasswordRequest struct {
@@ -65,13 +79,29 @@ type PropertyChangesListResponse struct {
 	PropertyChanges []*models.PropertyChange `json:"propertyName"`
 }
 
-func newUserClaim(userId string) UserClaim {
-	return UserClaim{
-		UserId: userId,
+func newUserClaim(userId, authMethod string, authTime time.Time) UserClaim {
+	currentTime := time.Now()
+	claims := UserClaim{
+		UserId:        userId,
+		AuthMethod:    authMethod,
+		IssuedAtMicro: currentTime.UnixMicro(),
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(EXPIRE_TIME).Unix(),
+			Id:        ksuid.New().String(),
+			IssuedAt:  currentTime.Unix(),
+			ExpiresAt: currentTime.Add(ACCESS_TOKEN_EXPIRE_TIME).Unix(),
 		},
 	}
+	//* Los 'token' de refresco anteriores a 'auth_time' no lo conocen: en ese caso se omite.
+	if !authTime.IsZero() {
+		claims.AuthTime = authTime.Unix()
+	}
+	return claims
+}
+
+func isValidEmail(email string) bool {
+	//* Una única dirección, sin nombre visible: 'mail.ParseAddress' también acepta "Nombre <email>".
+	address, err := mail.ParseAddress(email)
+	return err == nil && address.Address == email
 }
 
 func SignUpHandler(server *servers.HttpServer) http.HandlerFunc {
@@ -82,6 +112,10 @@ func SignUpHandler(server *servers.HttpServer) http.HandlerFunc {
 			http.Error(writer, err.Error(), http.StatusBadRequest)
 			return
 		}
+		if !isValidEmail(decodedRequest.Email) {
+			http.Error(writer, "Invalid email", http.StatusBadRequest)
+			return
+		}
 
 		//* Generamos un nuevo 'id' aleatorio.
 		id, err := ksuid.NewRandom()
@@ -111,39 +145,60 @@ func SignUpHandler(server *servers.HttpServer) http.HandlerFunc {
 			UpdatedBy: id.String(),
 		}
 
-		//* Guardamos el 'user' en la DB.
-		if err := databases.InsertUser(request.Context(), &user); err != nil {
-			http.Error(writer, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		//* Instanciamos los cambios de propiedades pertinentes:
-		//* Para 'email'.
-		propertyChange := &models.PropertyChange{
-			UserId:    user.Id,
-			Name:      "email",
-			From:      "",
-			To:        user.Email,
-			CreatedAt: currentTime,
-			CreatedBy: user.Id,
-		}
-		//* Lo guardamos en ls DB.
-		if err := databases.InsertPropertyChangeLog(request.Context(), propertyChange); err != nil {
-			http.Error(writer, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		//* Para 'password'.
-		propertyChange = &models.PropertyChange{
-			UserId:    user.Id,
-			Name:      "password",
-			From:      "",
-			To:        user.Password,
-			CreatedAt: currentTime,
-			CreatedBy: user.Id,
-		}
-		//* Lo guardamos.
-		if err := databases.InsertPropertyChangeLog(request.Context(), propertyChange); err != nil {
+		//* Guardamos el 'user', su historial inicial y el 'token' de verificación en una única transacción.
+		//* Si el envío falla, no queda ningún 'user' y se puede repetir el registro con el mismo 'email'.
+		if err := databases.RunInTransaction(request.Context(), func(ctx context.Context) error {
+			//* Comprobamos que el 'email' no pertenezca ya a otro 'user', aunque esté eliminado.
+			emailInUse, err := databases.IsEmailInUse(ctx, user.Email)
+			if err != nil {
+				return err
+			}
+			if emailInUse {
+				return ErrEmailInUse
+			}
+
+			//* Guardamos el 'user' en la DB.
+			if err := databases.InsertUser(ctx, &user); err != nil {
+				return err
+			}
+
+			//* Instanciamos los cambios de propiedades pertinentes:
+			//* Para 'email'.
+			propertyChange := &models.PropertyChange{
+				UserId:    user.Id,
+				Name:      "email",
+				From:      "",
+				To:        user.Email,
+				CreatedAt: currentTime,
+				CreatedBy: user.Id,
+			}
+			//* Lo guardamos en ls DB.
+			if err := databases.InsertPropertyChangeLog(ctx, propertyChange); err != nil {
+				return err
+			}
+
+			//* Para 'password'.
+			propertyChange = &models.PropertyChange{
+				UserId:    user.Id,
+				Name:      "password",
+				From:      "",
+				To:        user.Password,
+				CreatedAt: currentTime,
+				CreatedBy: user.Id,
+			}
+			//* Lo guardamos.
+			if err := databases.InsertPropertyChangeLog(ctx, propertyChange); err != nil {
+				return err
+			}
+
+			//* Enviamos el 'token' de verificación al 'email' facilitado.
+			return sendEmailVerificationToken(ctx, user.Id, user.Email)
+		}); err != nil {
+			//* Otro registro simultáneo pudo ocupar el 'email' después de la comprobación.
+			if err == ErrEmailInUse || err == databases.ErrDuplicateKey {
+				http.Error(writer, "Email already in use", http.StatusConflict)
+				return
+			}
 			http.Error(writer, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -156,6 +211,19 @@ func SignUpHandler(server *servers.HttpServer) http.HandlerFunc {
 		json.NewEncoder(writer).Encode(notEncodedResponse)
 	}
 }
+func checkUserCanLogIn(writer http.ResponseWriter, server *servers.HttpServer, user *models.User) bool {
+	//* Devuelve falso, con la respuesta ya enviada, si la cuenta no puede iniciar sesión.
+	//* Sólo debe llamarse con el 'user' completamente autenticado: las respuestas desvelan el estado de la cuenta.
+	if isUserDisabled(user) {
+		http.Error(writer, "Account disabled", http.StatusForbidden)
+		return false
+	}
+	if isEmailVerificationPending(server, user) {
+		http.Error(writer, "Email not verified", http.StatusForbidden)
+		return false
+	}
+	return true
+}
 func LogInHandler(server *servers.HttpServer) http.HandlerFunc {
 	return func(writer http.ResponseWriter, request *http.Request) {
 		//* Preparamos la petición y la recibimos.
@@ -165,6 +233,13 @@ func LogInHandler(server *servers.HttpServer) http.HandlerFunc {
 			return
 		}
 
+		//* Antes de comprobar nada, aplicamos los límites de intentos de la cuenta y de la dirección.
+		accountKey := accountThrottleKey(decodedRequest.Email)
+		addressKey := addressThrottleKey(server, request)
+		if !enforceLoginThrottle(writer, request, accountKey, addressKey) {
+			return
+		}
+
 		//* Solicitamos a DB un 'user' con los mismos datos que los facilitados.
 		user, err := databases.GetUserByEmail(request.Context(), decodedRequest.Email)
 		if err != nil {
@@ -173,57 +248,78 @@ func LogInHandler(server *servers.HttpServer) http.HandlerFunc {
 		}
 
 		//* Si 'user' devuelto es nulo, es decir no existe en DB, respondemos 'No autorizado'.
-		if user == nil {
-			http.Error(writer, "Invalid credentials", http.StatusUnauthorized)
-			return
-		}
 		//* Si 'user' existe, comparamos su 'password' con la facilitada en la petición.
 		//* Si 'error' devuelto no es nulo, es decir las 'password' no coinciden, respondemos 'No autorizado'.
-		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(decodedRequest.Password)); err != nil {
+		//* En ambos casos contamos el fallo.
+		if user == nil || bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(decodedRequest.Password)) != nil {
+			if err := registerLoginFailure(request.Context(), accountKey, addressKey, user); err != nil {
+				http.Error(writer, err.Error(), http.StatusInternalServerError)
+				return
+			}
 			http.Error(writer, "Invalid credentials", http.StatusUnauthorized)
 			return
 		}
 
-		//* Si las 'password' coinciden, generamos un token de autorización.
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, newUserClaim(user.Id))
-		authorizationToken, err := token.SignedString([]byte(server.Config.Secret))
+		//* Si el 'user' tiene MFA activado, en lugar de los 'token' devolvemos un desafío
+		//* que deberá completarse en '/login/mfa'. La 'password' sola no basta para autenticarlo:
+		//* ni olvidamos sus fallos previos ni desvelamos el estado de la cuenta hasta superar el segundo factor.
+		userMfa, err := databases.GetUserMfaByUserId(request.Context(), user.Id)
 		if err != nil {
 			http.Error(writer, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		if userMfa != nil && !userMfa.EnabledAt.IsZero() {
+			mfaToken, err := newMfaChallengeToken(server, user.Id)
+			if err != nil {
+				http.Error(writer, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			notEncodedResponse := &MfaChallengeResponse{
+				MfaRequired: true,
+				MfaToken:    mfaToken,
+			}
+			writer.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(writer).Encode(notEncodedResponse)
+			return
+		}
 
-		//* Preparamos la respuesta y la enviamos.
-		notEncodedResponse := &LogInResponse{
-			Authorization: authorizationToken,
+		//* Una cuenta bloqueada o eliminada por un administrador, o sin verificar si la política lo exige,
+		//* no puede iniciar sesión.
+		if !checkUserCanLogIn(writer, server, user) {
+			return
+		}
+
+		//* Con el 'user' ya autenticado, olvidamos los fallos previos de la cuenta.
+		if err := databases.DeleteLoginThrottle(request.Context(), accountKey); err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Si las 'password' coinciden, generamos un token de autorización y otro de refresco.
+		notEncodedResponse, err := issueTokens(request.Context(), server, user.Id, "", principals.AUTH_METHOD_PASSWORD, time.Now())
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
 		}
+
+		//* Enviamos la respuesta.
 		writer.Header().Set("Content-Type", "application/json")
-		writer.Header().Set(HEADER_AUTHORIZATION, authorizationToken)
+		writer.Header().Set(HEADER_AUTHORIZATION, notEncodedResponse.Authorization)
 		json.NewEncoder(writer).Encode(notEncodedResponse)
 	}
 }
 func ChangeEmailHandler(server *servers.HttpServer) http.HandlerFunc {
 	return func(writer http.ResponseWriter, request *http.Request) {
 		//* Esta función requiere autenticación de usuario.
-		//* Obtenemos el 'token' de las 'headers' de la petición. Se ubican en 'Authorization'.
-		authorizationToken := strings.TrimSpace(request.Header.Get(HEADER_AUTHORIZATION))
-		token, err := jwt.ParseWithClaims(authorizationToken, &UserClaim{}, func(token *jwt.Token) (interface{}, error) {
-			return []byte(server.Config.Secret), nil
-		})
-		//* Si no podemos decodificarla, devolvemos 'No autorizado'.
-		if err != nil {
-			http.Error(writer, err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		//* En caso afirmativo, obtenemos un 'id' de 'user' en ella.
-		claims, ok := token.Claims.(*UserClaim)
-		if !ok || !token.Valid {
-			http.Error(writer, err.Error(), http.StatusInternalServerError)
+		//* Obtenemos la identidad que 'CheckAuthMiddleware' dejó en el contexto de la petición.
+		principal, ok := principals.FromContext(request.Context())
+		if !ok {
+			http.Error(writer, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
 		//* Solicitamos un 'user' a DB.
-		user, err := databases.GetUserById(request.Context(), claims.UserId)
+		user, err := databases.GetUserById(request.Context(), principal.UserId)
 		if err != nil {
 			http.Error(writer, err.Error(), http.StatusInternalServerError)
 			return
@@ -235,39 +331,54 @@ func ChangeEmailHandler(server *servers.HttpServer) http.HandlerFunc {
 			http.Error(writer, err.Error(), http.StatusBadRequest)
 			return
 		}
+		if !isValidEmail(decodedRequest.NewEmail) {
+			http.Error(writer, "Invalid email", http.StatusBadRequest)
+			return
+		}
+
+		//* Comprobamos que el nuevo 'email' no pertenezca ya a otro 'user', aunque esté eliminado.
+		emailInUse, err := databases.IsEmailInUse(request.Context(), decodedRequest.NewEmail)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if emailInUse {
+			http.Error(writer, "Email already in use", http.StatusConflict)
+			return
+		}
 
 		//* Guardamos el momento en el que se produjo el registro.
 		currentTime := time.Now()
 
-		//* Instanciamos un 'propertyChange'.
+		//* El cambio queda pendiente hasta que se confirme desde el nuevo 'email'.
+		//* Instanciamos un 'propertyChange' que deja constancia de la solicitud.
 		propertyChange := &models.PropertyChange{
 			UserId:    user.Id,
-			Name:      "email",
+			Name:      "pendingEmail",
 			From:      user.Email,
 			To:        decodedRequest.NewEmail,
 			CreatedAt: currentTime,
 			CreatedBy: user.Id,
 		}
 
-		//* Realizamos el cambio en 'user'.
-		user.Email = decodedRequest.NewEmail
-		user.UpdatedAt = currentTime
-
-		//* Guardamos 'user' en DB.
-		if err := databases.UpdateUser(request.Context(), user); err != nil {
-			http.Error(writer, err.Error(), http.StatusInternalServerError)
-			return
-		}
+		//* Guardamos 'propertyChange' y el 'token' en una única transacción. Si el envío falla, no queda ninguno.
+		if err := databases.RunInTransaction(request.Context(), func(ctx context.Context) error {
+			if err := databases.InsertPropertyChangeLog(ctx, propertyChange); err != nil {
+				return err
+			}
 
-		//* Guardamos 'propertyChange' en DB.
-		if err := databases.InsertPropertyChangeLog(request.Context(), propertyChange); err != nil {
+			//* Enviamos el 'token' de confirmación al nuevo 'email'.
+			return sendEmailToken(ctx, user.Id, decodedRequest.NewEmail, EMAIL_TOKEN_PURPOSE_CHANGE, EMAIL_CHANGE_EXPIRE_TIME,
+				"Confirm your new email address", "Use this token to confirm your new email address")
+		}); err != nil {
 			http.Error(writer, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
 		//* Preparamos la respuesta y la enviamos.
 		notEncodedResponse := ChangeEmailResponse{
-			Result: true,
+			Result:  true,
+			Pending: true,
 		}
 		writer.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(writer).Encode(notEncodedResponse)
@@ -276,26 +387,15 @@ func ChangeEmailHandler(server *servers.HttpServer) http.HandlerFunc {
 func ChangePasswordHandler(server *servers.HttpServer) http.HandlerFunc {
 	return func(writer http.ResponseWriter, request *http.Request) {
 		//* Esta función requiere autenticación de usuario.
-		//* Obtenemos el 'token' de las 'headers' de la petición. Se ubican en 'Authorization'.
-		authorizationToken := strings.TrimSpace(request.Header.Get(HEADER_AUTHORIZATION))
-		token, err := jwt.ParseWithClaims(authorizationToken, &UserClaim{}, func(token *jwt.Token) (interface{}, error) {
-			return []byte(server.Config.Secret), nil
-		})
-		//* Si no podemos decodificarla, devolvemos 'No autorizado'.
-		if err != nil {
-			http.Error(writer, err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		//* En caso afirmativo, obtenemos un 'id' de 'user' en ella.
-		claims, ok := token.Claims.(*UserClaim)
-		if !ok || !token.Valid {
-			http.Error(writer, err.Error(), http.StatusInternalServerError)
+		//* Obtenemos la identidad que 'CheckAuthMiddleware' dejó en el contexto de la petición.
+		principal, ok := principals.FromContext(request.Context())
+		if !ok {
+			http.Error(writer, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
 		//* Solicitamos un 'user' a DB.
-		user, err := databases.GetUserById(request.Context(), claims.UserId)
+		user, err := databases.GetUserById(request.Context(), principal.UserId)
 		if err != nil {
 			http.Error(writer, err.Error(), http.StatusInternalServerError)
 			return
@@ -337,15 +437,24 @@ func ChangePasswordHandler(server *servers.HttpServer) http.HandlerFunc {
 		//* Realizamos el cambio en 'user'.
 		user.Password = string(hashedPassword)
 		user.UpdatedAt = currentTime
-
-		//* Guardamos 'user' en DB.
-		if err := databases.UpdateUser(request.Context(), user); err != nil {
-			http.Error(writer, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		//* Guardamos 'propertyChange' en DB.
-		if err := databases.InsertPropertyChangeLog(request.Context(), propertyChange); err != nil {
+		user.UpdatedBy = user.Id
+
+		//* Guardamos 'user' y 'propertyChange' en DB en una única transacción.
+		if err := databases.RunInTransaction(request.Context(), func(ctx context.Context) error {
+			if err := databases.UpdateUser(ctx, user); err != nil {
+				return err
+			}
+			if err := databases.InsertPropertyChangeLog(ctx, propertyChange); err != nil {
+				return err
+			}
+			//* Los enlaces de restablecimiento pendientes dejan de servir.
+			if err := databases.UsePasswordResetTokensByUserId(ctx, user.Id, currentTime); err != nil {
+				return err
+			}
+
+			//* Cerramos todas sus sesiones, también la actual: los 'token' robados antes del cambio dejan de valer.
+			return revokeUserSessions(ctx, user.Id, currentTime)
+		}); err != nil {
 			http.Error(writer, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -361,21 +470,10 @@ func ChangePasswordHandler(server *servers.HttpServer) http.HandlerFunc {
 func GetPropertyChangesHandler(server *servers.HttpServer) http.HandlerFunc {
 	return func(writer http.ResponseWriter, request *http.Request) {
 		//* Esta función requiere autenticación de usuario.
-		//* Obtenemos el 'token' de las 'headers' de la petición. Se ubican en 'Authorization'.
-		authorizationToken := strings.TrimSpace(request.Header.Get(HEADER_AUTHORIZATION))
-		token, err := jwt.ParseWithClaims(authorizationToken, &UserClaim{}, func(token *jwt.Token) (interface{}, error) {
-			return []byte(server.Config.Secret), nil
-		})
-		//* Si no podemos decodificarla, devolvemos 'No autorizado'.
-		if err != nil {
-			http.Error(writer, err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		//* En caso afirmativo, obtenemos un 'id' de 'user' en ella.
-		claims, ok := token.Claims.(*UserClaim)
-		if !ok || !token.Valid {
-			http.Error(writer, err.Error(), http.StatusInternalServerError)
+		//* Obtenemos la identidad que 'CheckAuthMiddleware' dejó en el contexto de la petición.
+		principal, ok := principals.FromContext(request.Context())
+		if !ok {
+			http.Error(writer, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
@@ -387,7 +485,7 @@ func GetPropertyChangesHandler(server *servers.HttpServer) http.HandlerFunc {
 		}
 
 		//* Solicitamos un listado 'propertyChange'  a DB.
-		propertyChanges, pageInfo, err := databases.ListPropertyChangesByUserIdAndName(request.Context(), claims.UserId, decodedRequest.Name, &decodedRequest.PageInfo)
+		propertyChanges, pageInfo, err := databases.ListPropertyChangesByUserIdAndName(request.Context(), principal.UserId, decodedRequest.Name, &decodedRequest.PageInfo)
 		if err != nil {
 			http.Error(writer, err.Error(), http.StatusInternalServerError)
 			return
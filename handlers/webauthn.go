@@ -0,0 +1,351 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/aerodinamicat/thisisme02/databases"
+	"github.com/aerodinamicat/thisisme02/models"
+	"github.com/aerodinamicat/thisisme02/principals"
+	"github.com/aerodinamicat/thisisme02/servers"
+	"github.com/aerodinamicat/thisisme02/webauthn"
+	"github.com/segmentio/ksuid"
+)
+
+const (
+	WEBAUTHN_CHALLENGE_EXPIRE_TIME = 5 * time.Minute
+)
+
+type WebAuthnRegisterBeginResponse struct {
+	SessionId string                    `json:"sessionId"`
+	PublicKey *webauthn.CreationOptions `json:"publicKey"`
+}
+
+type WebAuthnRegisterFinishRequest struct {
+	SessionId  string `json:"sessionId"`
+	Name       string `json:"name"`
+	Credential struct {
+		Response webauthn.AttestationResponse `json:"response"`
+	} `json:"credential"`
+}
+type WebAuthnRegisterFinishResponse struct {
+	Result bool `json:"result"`
+}
+
+type WebAuthnLogInBeginRequest struct {
+	Email string `json:"email"`
+}
+type WebAuthnLogInBeginResponse struct {
+	SessionId string                   `json:"sessionId"`
+	PublicKey *webauthn.RequestOptions `json:"publicKey"`
+}
+
+type WebAuthnLogInFinishRequest struct {
+	SessionId  string `json:"sessionId"`
+	Credential struct {
+		RawId    webauthn.URLEncodedBytes   `json:"rawId"`
+		Response webauthn.AssertionResponse `json:"response"`
+	} `json:"credential"`
+}
+
+func newRelyingParty(server *servers.HttpServer) *webauthn.RelyingParty {
+	return &webauthn.RelyingParty{
+		ID:     server.Config.RelyingPartyId,
+		Name:   server.Config.RelyingPartyName,
+		Origin: server.Config.RelyingPartyOrigin,
+	}
+}
+func newWebAuthnChallenge(request *http.Request, userId, ceremony string) (*models.WebAuthnChallenge, error) {
+	//* Generamos el desafío y lo guardamos en DB para poder consumirlo una sola vez.
+	challengeBytes, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, err
+	}
+	currentTime := time.Now()
+	challenge := &models.WebAuthnChallenge{
+		Id:        ksuid.New().String(),
+		UserId:    userId,
+		Ceremony:  ceremony,
+		Challenge: challengeBytes,
+		ExpiresAt: currentTime.Add(WEBAUTHN_CHALLENGE_EXPIRE_TIME),
+		CreatedAt: currentTime,
+	}
+	if err := databases.InsertWebAuthnChallenge(request.Context(), challenge); err != nil {
+		return nil, err
+	}
+
+	return challenge, nil
+}
+func consumeWebAuthnChallenge(request *http.Request, sessionId, ceremony string) (*models.WebAuthnChallenge, error) {
+	//* Solicitamos el desafío a DB y comprobamos que corresponda a esta ceremonia y siga vigente.
+	challenge, err := databases.GetWebAuthnChallengeById(request.Context(), sessionId)
+	if err != nil {
+		return nil, err
+	}
+	currentTime := time.Now()
+	if challenge == nil || challenge.Ceremony != ceremony || !challenge.UsedAt.IsZero() || currentTime.After(challenge.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+
+	//* Lo marcamos como usado antes de verificar nada, para que no pueda reutilizarse.
+	challenge.UsedAt = currentTime
+	if err := databases.UpdateWebAuthnChallenge(request.Context(), challenge); err != nil {
+		if err == databases.ErrTokenAlreadyUsed {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	return challenge, nil
+}
+func webAuthnCredentialIds(credentials []*models.WebAuthnCredential) [][]byte {
+	credentialIds := make([][]byte, 0, len(credentials))
+	for _, credential := range credentials {
+		credentialId, err := base64.RawURLEncoding.DecodeString(credential.Id)
+		if err != nil {
+			continue
+		}
+		credentialIds = append(credentialIds, credentialId)
+	}
+
+	return credentialIds
+}
+
+func WebAuthnRegisterBeginHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Esta función requiere autenticación de usuario.
+		//* Obtenemos la identidad que 'CheckAuthMiddleware' dejó en el contexto de la petición.
+		principal, ok := principals.FromContext(request.Context())
+		if !ok {
+			http.Error(writer, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		//* Solicitamos un 'user' y sus credenciales a DB.
+		user, err := databases.GetUserById(request.Context(), principal.UserId)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		credentials, err := databases.ListWebAuthnCredentialsByUserId(request.Context(), user.Id)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Generamos el desafío de alta.
+		challenge, err := newWebAuthnChallenge(request, user.Id, webauthn.CEREMONY_CREATE)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Preparamos la respuesta y la enviamos. Excluimos las credenciales ya registradas.
+		notEncodedResponse := WebAuthnRegisterBeginResponse{
+			SessionId: challenge.Id,
+			PublicKey: newRelyingParty(server).CreationOptions(challenge.Challenge, []byte(user.Id), user.Email, webAuthnCredentialIds(credentials)),
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
+func WebAuthnRegisterFinishHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Esta función requiere autenticación de usuario.
+		//* Obtenemos la identidad que 'CheckAuthMiddleware' dejó en el contexto de la petición.
+		principal, ok := principals.FromContext(request.Context())
+		if !ok {
+			http.Error(writer, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		//* Preparamos la petición y la recibimos.
+		var decodedRequest = new(WebAuthnRegisterFinishRequest)
+		if err := json.NewDecoder(request.Body).Decode(&decodedRequest); err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		//* Consumimos el desafío, que debe pertenecer al mismo 'user'.
+		challenge, err := consumeWebAuthnChallenge(request, decodedRequest.SessionId, webauthn.CEREMONY_CREATE)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if challenge.UserId != principal.UserId {
+			http.Error(writer, ErrInvalidToken.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		//* Verificamos la respuesta del autenticador.
+		registeredCredential, err := newRelyingParty(server).VerifyRegistration(challenge.Challenge, &decodedRequest.Credential.Response)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		//* Guardamos el momento en el que se produjo el registro.
+		currentTime := time.Now()
+
+		//* Instanciamos la credencial y la guardamos en DB.
+		credential := &models.WebAuthnCredential{
+			Id:        base64.RawURLEncoding.EncodeToString(registeredCredential.Id),
+			UserId:    principal.UserId,
+			Name:      decodedRequest.Name,
+			PublicKey: registeredCredential.PublicKey,
+			SignCount: registeredCredential.SignCount,
+			CreatedAt: currentTime,
+		}
+		//* Instanciamos un 'propertyChange'.
+		propertyChange := &models.PropertyChange{
+			UserId:    principal.UserId,
+			Name:      "passkey",
+			From:      "",
+			To:        credential.Id,
+			CreatedAt: currentTime,
+			CreatedBy: principal.UserId,
+		}
+
+		//* Guardamos la credencial y 'propertyChange' en DB en una única transacción.
+		if err := databases.RunInTransaction(request.Context(), func(ctx context.Context) error {
+			if err := databases.InsertWebAuthnCredential(ctx, credential); err != nil {
+				return err
+			}
+			return databases.InsertPropertyChangeLog(ctx, propertyChange)
+		}); err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Preparamos la respuesta y la enviamos.
+		notEncodedResponse := WebAuthnRegisterFinishResponse{
+			Result: true,
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
+func WebAuthnLogInBeginHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Preparamos la petición y la recibimos.
+		var decodedRequest = new(WebAuthnLogInBeginRequest)
+		if err := json.NewDecoder(request.Body).Decode(&decodedRequest); err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		//* Si nos facilitan un 'email', limitamos las credenciales aceptadas a las de ese 'user'.
+		//* Si no, el navegador ofrecerá cualquier 'passkey' guardada para este sitio.
+		var allowCredentialIds [][]byte
+		if decodedRequest.Email != "" {
+			user, err := databases.GetUserByEmail(request.Context(), decodedRequest.Email)
+			if err != nil {
+				http.Error(writer, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if user != nil && user.Id != "" {
+				credentials, err := databases.ListWebAuthnCredentialsByUserId(request.Context(), user.Id)
+				if err != nil {
+					http.Error(writer, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				allowCredentialIds = webAuthnCredentialIds(credentials)
+			}
+		}
+
+		//* Generamos el desafío de inicio de sesión.
+		challenge, err := newWebAuthnChallenge(request, "", webauthn.CEREMONY_GET)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Preparamos la respuesta y la enviamos.
+		notEncodedResponse := WebAuthnLogInBeginResponse{
+			SessionId: challenge.Id,
+			PublicKey: newRelyingParty(server).RequestOptions(challenge.Challenge, allowCredentialIds),
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
+func WebAuthnLogInFinishHandler(server *servers.HttpServer) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		//* Preparamos la petición y la recibimos.
+		var decodedRequest = new(WebAuthnLogInFinishRequest)
+		if err := json.NewDecoder(request.Body).Decode(&decodedRequest); err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		//* Consumimos el desafío.
+		challenge, err := consumeWebAuthnChallenge(request, decodedRequest.SessionId, webauthn.CEREMONY_GET)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		//* Solicitamos la credencial utilizada a DB.
+		credential, err := databases.GetWebAuthnCredentialById(request.Context(), base64.RawURLEncoding.EncodeToString(decodedRequest.Credential.RawId))
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		//* Si el autenticador devuelve el 'user handle', debe coincidir con el dueño de la credencial.
+		userHandle := decodedRequest.Credential.Response.UserHandle
+		if credential == nil || (len(userHandle) > 0 && string(userHandle) != credential.UserId) {
+			http.Error(writer, "Invalid credentials", http.StatusUnauthorized)
+			return
+		}
+
+		//* Verificamos la firma y el contador de la credencial.
+		signCount, err := newRelyingParty(server).VerifyAssertion(challenge.Challenge, credential.PublicKey, credential.SignCount, &decodedRequest.Credential.Response)
+		if err != nil {
+			http.Error(writer, "Invalid credentials", http.StatusUnauthorized)
+			return
+		}
+
+		//* Una cuenta bloqueada o eliminada por un administrador no puede iniciar sesión.
+		user, err := databases.GetUserById(request.Context(), credential.UserId)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if user == nil || user.Id == "" {
+			http.Error(writer, "Invalid credentials", http.StatusUnauthorized)
+			return
+		}
+		if !checkUserCanLogIn(writer, server, user) {
+			return
+		}
+
+		//* Actualizamos el contador y el último uso de la credencial.
+		credential.SignCount = signCount
+		credential.LastUsedAt = time.Now()
+		if err := databases.UpdateWebAuthnCredential(request.Context(), credential); err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Con el 'user' ya autenticado, olvidamos los fallos previos de la cuenta.
+		if err := databases.DeleteLoginThrottle(request.Context(), accountThrottleKey(user.Email)); err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Generamos los 'token' como en '/login'.
+		notEncodedResponse, err := issueTokens(request.Context(), server, credential.UserId, "", principals.AUTH_METHOD_WEBAUTHN, time.Now())
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//* Enviamos la respuesta.
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Header().Set(HEADER_AUTHORIZATION, notEncodedResponse.Authorization)
+		json.NewEncoder(writer).Encode(notEncodedResponse)
+	}
+}
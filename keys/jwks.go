@@ -0,0 +1,134 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+
+	"github.com/golang-jwt/jwt"
+)
+
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyId     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	Y     string `json:"y,omitempty"`
+	N     string `json:"n,omitempty"`
+	E     string `json:"e,omitempty"`
+}
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+func (kr *KeyRing) JWKS() *JSONWebKeySet {
+	kr.mutex.RLock()
+	defer kr.mutex.RUnlock()
+
+	//* Publicamos todas las claves que siguen validando, incluidas las retiradas en solapamiento.
+	jwks := &JSONWebKeySet{
+		Keys: make([]JSONWebKey, 0, len(kr.keys)),
+	}
+	for _, key := range kr.keys {
+		jwk := JSONWebKey{
+			KeyId:     key.model.Id,
+			Use:       "sig",
+			Algorithm: key.model.Algorithm,
+		}
+		switch publicKey := key.privateKey.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = encode(publicKey.N.Bytes())
+			jwk.E = encode(big.NewInt(int64(publicKey.E)).Bytes())
+		case *ecdsa.PublicKey:
+			jwk.KeyType = "EC"
+			jwk.Curve = publicKey.Curve.Params().Name
+			jwk.X = encode(publicKey.X.FillBytes(make([]byte, 32)))
+			jwk.Y = encode(publicKey.Y.FillBytes(make([]byte, 32)))
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = encode(publicKey)
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	return jwks
+}
+func (jwk *JSONWebKey) PublicKey() (crypto.PublicKey, error) {
+	//* Reconstruimos la clave pública a partir de su representación JWK.
+	switch jwk.KeyType {
+	case "RSA":
+		n, err := decode(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		if jwk.Curve != elliptic.P256().Params().Name {
+			return nil, ErrUnsupportedAlgorithm
+		}
+		x, err := decode(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	case "OKP":
+		x, err := decode(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if jwk.Curve != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, ErrUnsupportedAlgorithm
+		}
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, ErrUnsupportedAlgorithm
+}
+
+func (jwks *JSONWebKeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	//* Permite a un validador externo comprobar nuestros 'token' sólo con el JWKS publicado.
+	keyId, _ := token.Header["kid"].(string)
+	for i := range jwks.Keys {
+		jwk := &jwks.Keys[i]
+		if jwk.KeyId != keyId {
+			continue
+		}
+		if token.Method.Alg() != jwk.Algorithm {
+			return nil, ErrUnsupportedAlgorithm
+		}
+		return jwk.PublicKey()
+	}
+
+	return nil, ErrUnknownKey
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+func decode(data string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(data)
+}
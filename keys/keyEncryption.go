@@ -0,0 +1,70 @@
+package keys
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+)
+
+const (
+	//* Las claves cifradas empiezan por esta marca. Las antiguas, sin cifrar, son DER y empiezan por 0x30.
+	ENCRYPTED_KEY_PREFIX = "aes256gcm:"
+	ENCRYPTION_KEY_SIZE  = 32
+)
+
+var (
+	ErrInvalidEncryptionKey = errors.New("the signing keys encryption key must be 32 bytes long")
+	ErrMissingEncryptionKey = errors.New("signing key is encrypted but no encryption key is configured")
+)
+
+func newKeyCipher(encryptionKey []byte) (cipher.AEAD, error) {
+	if len(encryptionKey) != ENCRYPTION_KEY_SIZE {
+		return nil, ErrInvalidEncryptionKey
+	}
+	block, err := aes.NewCipher(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (kr *KeyRing) sealPrivateKey(keyId string, privateKey []byte) ([]byte, error) {
+	//* Sin clave de cifrado se guarda tal cual: cualquiera con acceso a la DB podría firmar 'token'.
+	if kr.EncryptionKey == nil {
+		return privateKey, nil
+	}
+	keyCipher, err := newKeyCipher(kr.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, keyCipher.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	//* El 'id' de la clave autentica el cifrado: no puede copiarse el contenido de una fila a otra.
+	sealedKey := append([]byte(ENCRYPTED_KEY_PREFIX), nonce...)
+	return keyCipher.Seal(sealedKey, nonce, privateKey, []byte(keyId)), nil
+}
+func (kr *KeyRing) openPrivateKey(keyId string, storedKey []byte) ([]byte, error) {
+	//* Las claves guardadas antes de configurar el cifrado se siguen leyendo hasta que se retiran.
+	if !bytes.HasPrefix(storedKey, []byte(ENCRYPTED_KEY_PREFIX)) {
+		return storedKey, nil
+	}
+	if kr.EncryptionKey == nil {
+		return nil, ErrMissingEncryptionKey
+	}
+	keyCipher, err := newKeyCipher(kr.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	sealedKey := storedKey[len(ENCRYPTED_KEY_PREFIX):]
+	if len(sealedKey) < keyCipher.NonceSize() {
+		return nil, ErrUnknownKey
+	}
+	nonce, ciphertext := sealedKey[:keyCipher.NonceSize()], sealedKey[keyCipher.NonceSize():]
+	return keyCipher.Open(nil, nonce, ciphertext, []byte(keyId))
+}
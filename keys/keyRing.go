@@ -0,0 +1,293 @@
+package keys
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aerodinamicat/thisisme02/databases"
+	"github.com/aerodinamicat/thisisme02/models"
+	"github.com/golang-jwt/jwt"
+	"github.com/segmentio/ksuid"
+)
+
+const (
+	ALGORITHM_RS256 = "RS256"
+	ALGORITHM_ES256 = "ES256"
+	ALGORITHM_EDDSA = "EdDSA"
+
+	DEFAULT_ALGORITHM         = ALGORITHM_ES256
+	DEFAULT_ROTATION_INTERVAL = 30 * time.Hour * 24
+	DEFAULT_ROTATION_OVERLAP  = 1 * time.Hour * 24
+	RSA_KEY_SIZE              = 2048
+	RELOAD_INTERVAL           = 5 * time.Minute
+)
+
+var (
+	ErrUnknownKey           = errors.New("unknown signing key")
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+	ErrNoSigningKey         = errors.New("no signing key available")
+)
+
+type signingKey struct {
+	model      *models.SigningKey
+	method     jwt.SigningMethod
+	privateKey crypto.Signer
+}
+
+type KeyRing struct {
+	mutex sync.RWMutex
+	keys  []*signingKey
+
+	Algorithm        string
+	RotationInterval time.Duration
+	RotationOverlap  time.Duration
+	//* Clave AES-256 con la que se cifran las claves privadas en DB. Sin ella se guardan sin cifrar.
+	EncryptionKey []byte
+}
+
+func NewKeyRing(algorithm string, rotationInterval, rotationOverlap time.Duration) *KeyRing {
+	if algorithm == "" {
+		algorithm = DEFAULT_ALGORITHM
+	}
+	if rotationInterval == 0 {
+		rotationInterval = DEFAULT_ROTATION_INTERVAL
+	}
+	if rotationOverlap == 0 {
+		rotationOverlap = DEFAULT_ROTATION_OVERLAP
+	}
+
+	return &KeyRing{
+		Algorithm:        algorithm,
+		RotationInterval: rotationInterval,
+		RotationOverlap:  rotationOverlap,
+	}
+}
+
+func (kr *KeyRing) Load(ctx context.Context) error {
+	if err := kr.reload(ctx); err != nil {
+		return err
+	}
+
+	//* Si no hay clave activa o ya le toca rotar, generamos una nueva.
+	active := kr.activeKey()
+	if active == nil || time.Since(active.model.CreatedAt) >= kr.RotationInterval || active.model.Algorithm != kr.Algorithm {
+		return kr.Rotate(ctx)
+	}
+
+	return nil
+}
+func (kr *KeyRing) Rotate(ctx context.Context) error {
+	//* Generamos la nueva clave y la guardamos en DB para que la compartan todas las réplicas.
+	newKey, err := generateSigningKey(kr.Algorithm, time.Now())
+	if err != nil {
+		return err
+	}
+	storedKey := *newKey.model
+	if storedKey.PrivateKey, err = kr.sealPrivateKey(storedKey.Id, storedKey.PrivateKey); err != nil {
+		return err
+	}
+	if err := databases.InsertSigningKey(ctx, &storedKey); err != nil {
+		return err
+	}
+
+	//* Recargamos desde DB, y no sólo desde memoria, para retirar también las claves
+	//* que otras réplicas hayan generado a la vez que esta.
+	if err := kr.reload(ctx); err != nil {
+		return err
+	}
+
+	log.Printf("Signing key rotated, new key id: %s\n", newKey.model.Id)
+	return nil
+}
+func (kr *KeyRing) reload(ctx context.Context) error {
+	//* Solicitamos a DB las claves en uso y las retiradas que siguen dentro del solapamiento.
+	signingKeyModels, err := databases.ListSigningKeys(ctx, time.Now().Add(-kr.RotationOverlap))
+	if err != nil {
+		return err
+	}
+
+	loadedKeys := make([]*signingKey, 0, len(signingKeyModels))
+	for _, signingKeyModel := range signingKeyModels {
+		if signingKeyModel.PrivateKey, err = kr.openPrivateKey(signingKeyModel.Id, signingKeyModel.PrivateKey); err != nil {
+			return err
+		}
+		loadedKey, err := parseSigningKey(signingKeyModel)
+		if err != nil {
+			return err
+		}
+		loadedKeys = append(loadedKeys, loadedKey)
+	}
+
+	kr.mutex.Lock()
+	kr.keys = loadedKeys
+	kr.mutex.Unlock()
+
+	return kr.retireInactiveKeys(ctx)
+}
+func (kr *KeyRing) retireInactiveKeys(ctx context.Context) error {
+	//* Si varias réplicas rotaron a la vez, hay más de una clave sin retirar. Todas convergen en la más
+	//* reciente: las demás dejan de firmar, pero siguen validando durante el solapamiento.
+	active := kr.activeKey()
+	currentTime := time.Now()
+
+	kr.mutex.Lock()
+	defer kr.mutex.Unlock()
+
+	for _, key := range kr.keys {
+		if key == active || !key.model.RetiredAt.IsZero() {
+			continue
+		}
+		key.model.RetiredAt = currentTime
+		if err := databases.UpdateSigningKey(ctx, key.model); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+func (kr *KeyRing) StartRotation(ctx context.Context) {
+	//* Recargamos periódicamente para ver las rotaciones hechas por otras réplicas y rotar si toca.
+	go func() {
+		ticker := time.NewTicker(RELOAD_INTERVAL)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := kr.Load(ctx); err != nil {
+					log.Printf("Signing keys reload failed: '%v'\n", err)
+				}
+			}
+		}
+	}()
+}
+
+func (kr *KeyRing) activeKey() *signingKey {
+	kr.mutex.RLock()
+	defer kr.mutex.RUnlock()
+
+	//* La clave activa es la más reciente sin retirar.
+	var active *signingKey
+	for _, key := range kr.keys {
+		if !key.model.RetiredAt.IsZero() {
+			continue
+		}
+		if active == nil || key.model.CreatedAt.After(active.model.CreatedAt) {
+			active = key
+		}
+	}
+	return active
+}
+
+func (kr *KeyRing) Sign(claims jwt.Claims) (string, error) {
+	return kr.SignWithType(claims, "")
+}
+func (kr *KeyRing) SignWithType(claims jwt.Claims, tokenType string) (string, error) {
+	active := kr.activeKey()
+	if active == nil {
+		return "", ErrNoSigningKey
+	}
+
+	//* Indicamos en la cabecera 'kid' con qué clave se firmó para que los validadores la localicen.
+	//* Los 'token' que no son de acceso declaran su propio 'typ' para que nadie los confunda.
+	token := jwt.NewWithClaims(active.method, claims)
+	token.Header["kid"] = active.model.Id
+	if tokenType != "" {
+		token.Header["typ"] = tokenType
+	}
+	return token.SignedString(active.privateKey)
+}
+func (kr *KeyRing) Keyfunc(token *jwt.Token) (interface{}, error) {
+	keyId, _ := token.Header["kid"].(string)
+
+	kr.mutex.RLock()
+	defer kr.mutex.RUnlock()
+
+	for _, key := range kr.keys {
+		if key.model.Id != keyId {
+			continue
+		}
+		//* El algoritmo debe ser el de la clave: nunca el que diga el 'token'.
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, ErrUnsupportedAlgorithm
+		}
+		return key.privateKey.Public(), nil
+	}
+
+	return nil, ErrUnknownKey
+}
+
+func generateSigningKey(algorithm string, currentTime time.Time) (*signingKey, error) {
+	var privateKey crypto.Signer
+	var err error
+	switch algorithm {
+	case ALGORITHM_RS256:
+		privateKey, err = rsa.GenerateKey(rand.Reader, RSA_KEY_SIZE)
+	case ALGORITHM_ES256:
+		privateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case ALGORITHM_EDDSA:
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	encodedPrivateKey, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseSigningKey(&models.SigningKey{
+		Id:         ksuid.New().String(),
+		Algorithm:  algorithm,
+		PrivateKey: encodedPrivateKey,
+		CreatedAt:  currentTime,
+	})
+}
+func parseSigningKey(signingKeyModel *models.SigningKey) (*signingKey, error) {
+	method := jwt.GetSigningMethod(signingKeyModel.Algorithm)
+	if method == nil {
+		return nil, ErrUnsupportedAlgorithm
+	}
+
+	parsedKey, err := x509.ParsePKCS8PrivateKey(signingKeyModel.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	//* Comprobamos que el tipo de clave corresponde al algoritmo declarado.
+	switch parsedKey.(type) {
+	case *rsa.PrivateKey:
+		if signingKeyModel.Algorithm != ALGORITHM_RS256 {
+			return nil, ErrUnsupportedAlgorithm
+		}
+	case *ecdsa.PrivateKey:
+		if signingKeyModel.Algorithm != ALGORITHM_ES256 {
+			return nil, ErrUnsupportedAlgorithm
+		}
+	case ed25519.PrivateKey:
+		if signingKeyModel.Algorithm != ALGORITHM_EDDSA {
+			return nil, ErrUnsupportedAlgorithm
+		}
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+
+	return &signingKey{
+		model:      signingKeyModel,
+		method:     method,
+		privateKey: parsedKey.(crypto.Signer),
+	}, nil
+}
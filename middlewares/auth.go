@@ -3,44 +3,160 @@ package middlewares
 import (
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/aerodinamicat/thisisme02/handlers"
+	"github.com/aerodinamicat/thisisme02/principals"
 	"github.com/aerodinamicat/thisisme02/servers"
-	"github.com/golang-jwt/jwt"
+	"github.com/gorilla/mux"
 )
 
-var (
-	NO_AUTH_NEEDED_PATHS = []string{
-		"/",
-		"signup",
-		"login",
+type RoutePolicy struct {
+	Public bool
+	//* Ámbitos que necesita cualquier identidad. Sin ámbitos declarados, aquí o en 'DelegatedScopes',
+	//* la ruta no admite credenciales delegadas.
+	Scopes []string
+	//* Ámbitos que necesitan sólo las credenciales delegadas: las sesiones del propio 'user' no los llevan.
+	DelegatedScopes []string
+	//* Las cuentas de servicio sólo acceden a las rutas que lo permiten expresamente.
+	AllowServices bool
+	Permissions   []string
+}
+
+type RoutePolicies struct {
+	policies map[*mux.Route]RoutePolicy
+}
+
+func NewRoutePolicies() *RoutePolicies {
+	return &RoutePolicies{
+		policies: make(map[*mux.Route]RoutePolicy),
 	}
-)
+}
 
-func shouldCheckAuthorization(route string) bool {
-	for _, path := range NO_AUTH_NEEDED_PATHS {
-		if strings.Contains(route, path) {
+func (rp *RoutePolicies) Set(route *mux.Route, policy RoutePolicy) *mux.Route {
+	rp.policies[route] = policy
+	return route
+}
+func (rp *RoutePolicies) Public(route *mux.Route) *mux.Route {
+	return rp.Set(route, RoutePolicy{Public: true})
+}
+func (rp *RoutePolicies) Authenticated(route *mux.Route) *mux.Route {
+	return rp.Set(route, RoutePolicy{})
+}
+func (rp *RoutePolicies) RequireScopes(route *mux.Route, scopes ...string) *mux.Route {
+	return rp.Set(route, RoutePolicy{Scopes: scopes})
+}
+func (rp *RoutePolicies) AllowDelegated(route *mux.Route, scopes ...string) *mux.Route {
+	return rp.Set(route, RoutePolicy{DelegatedScopes: scopes})
+}
+func (rp *RoutePolicies) RequirePermissions(route *mux.Route, permissions ...string) *mux.Route {
+	return rp.Set(route, RoutePolicy{Permissions: permissions})
+}
+func (rp *RoutePolicies) AllowServices(route *mux.Route, scopes ...string) *mux.Route {
+	return rp.Set(route, RoutePolicy{Scopes: scopes, AllowServices: true})
+}
+
+func (rp *RoutePolicies) Get(route *mux.Route) RoutePolicy {
+	//* Las rutas sin política declarada exigen autenticación: nunca quedan públicas por descuido.
+	if route == nil {
+		return RoutePolicy{}
+	}
+	return rp.policies[route]
+}
+
+func hasScopes(granted, required []string) bool {
+	for _, requiredScope := range required {
+		found := false
+		for _, grantedScope := range granted {
+			if grantedScope == requiredScope {
+				found = true
+				break
+			}
+		}
+		if !found {
 			return false
 		}
 	}
 	return true
 }
 
-func CheckAuthMiddleware(server *servers.HttpServer) func(h http.Handler) http.Handler {
+func CheckAuthMiddleware(server *servers.HttpServer, policies *RoutePolicies) func(h http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
-			if shouldCheckAuthorization(request.URL.Path) {
-				authTokenString := strings.TrimSpace(request.Header.Get("Authorization"))
-
-				_, err := jwt.ParseWithClaims(authTokenString, &handlers.UserClaim{}, func(token *jwt.Token) (interface{}, error) {
-					return []byte(server.Config.Secret), nil
-				})
-				if err != nil {
-					http.Error(writer, err.Error(), http.StatusUnauthorized)
-					return
-				}
-			}
-			next.ServeHTTP(writer, request)
+			//* Obtenemos la política declarada para la ruta al registrarla.
+			policy := policies.Get(mux.CurrentRoute(request))
+			if policy.Public {
+				next.ServeHTTP(writer, request)
+				return
+			}
+
+			//* Admitimos una clave personal con el esquema 'ApiKey' o un 'token' de acceso,
+			//* tal cual o con el esquema 'Bearer' que usan los clientes OAuth.
+			authorization := strings.TrimSpace(request.Header.Get(handlers.HEADER_AUTHORIZATION))
+			var principal *principals.Principal
+			var err error
+			if strings.HasPrefix(authorization, handlers.AUTHORIZATION_SCHEME_API_KEY+" ") {
+				apiKey := strings.TrimSpace(strings.TrimPrefix(authorization, handlers.AUTHORIZATION_SCHEME_API_KEY+" "))
+				principal, err = handlers.AuthenticateApiKey(request.Context(), apiKey)
+			} else {
+				authTokenString := strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer "))
+				principal, err = principalFromToken(request, server, authTokenString)
+			}
+			if err != nil {
+				http.Error(writer, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			if principal.IsService() && !policy.AllowServices {
+				http.Error(writer, "Service principals are not allowed", http.StatusForbidden)
+				return
+			}
+			//* Las credenciales delegadas sólo acceden a las rutas que declaran los ámbitos que necesitan.
+			if principal.IsDelegated() && len(policy.Scopes) == 0 && len(policy.DelegatedScopes) == 0 {
+				http.Error(writer, "Delegated credentials are not allowed", http.StatusForbidden)
+				return
+			}
+			if principal.IsDelegated() && !hasScopes(principal.Scopes, policy.DelegatedScopes) {
+				http.Error(writer, "Insufficient scope", http.StatusForbidden)
+				return
+			}
+			if !hasScopes(principal.Scopes, policy.Scopes) {
+				http.Error(writer, "Insufficient scope", http.StatusForbidden)
+				return
+			}
+			if !hasScopes(principal.Permissions, policy.Permissions) {
+				http.Error(writer, "Insufficient permissions", http.StatusForbidden)
+				return
+			}
+
+			//* Dejamos la identidad en el contexto para que los 'handlers' no vuelvan a autenticar la petición.
+			next.ServeHTTP(writer, request.WithContext(principals.NewContext(request.Context(), principal)))
 		})
 	}
 }
+
+func principalFromToken(request *http.Request, server *servers.HttpServer, authTokenString string) (*principals.Principal, error) {
+	claims, err := handlers.ParseUserClaim(request.Context(), server, authTokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	principal := &principals.Principal{
+		SubjectType: principals.SUBJECT_TYPE_USER,
+		UserId:      claims.UserId,
+		Scopes:      claims.Scopes,
+		Roles:       claims.Roles,
+		Permissions: claims.Permissions,
+		TokenId:     claims.Id,
+		AuthMethod:  claims.AuthMethod,
+		ClientId:    claims.ClientId,
+		ExpiresAt:   time.Unix(claims.ExpiresAt, 0),
+	}
+	if claims.SubjectType == principals.SUBJECT_TYPE_SERVICE {
+		principal.SubjectType = principals.SUBJECT_TYPE_SERVICE
+	}
+	if claims.AuthTime != 0 {
+		principal.AuthTime = time.Unix(claims.AuthTime, 0)
+	}
+
+	return principal, nil
+}
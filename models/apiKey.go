@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+type ApiKey struct {
+	Id         string   `json:"id"`
+	UserId     string   `json:"userId"`
+	Name       string   `json:"name"`
+	Prefix     string   `json:"prefix"`
+	SecretHash string   `json:"-"`
+	Scopes     []string `json:"scopes"`
+
+	ExpiresAt  time.Time `json:"expiresAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+	RevokedAt  time.Time `json:"revokedAt"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
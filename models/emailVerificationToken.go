@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+type EmailVerificationToken struct {
+	Id        string `json:"id"`
+	UserId    string `json:"userId"`
+	Email     string `json:"email"`
+	Purpose   string `json:"purpose"`
+	TokenHash string `json:"-"`
+
+	ExpiresAt time.Time `json:"expiresAt"`
+	UsedAt    time.Time `json:"usedAt"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+type LoginThrottle struct {
+	Key          string    `json:"key"`
+	Failures     int       `json:"failures"`
+	LastFailedAt time.Time `json:"lastFailedAt"`
+	LockedUntil  time.Time `json:"lockedUntil"`
+}
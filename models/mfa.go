@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+type UserMfa struct {
+	UserId       string `json:"userId"`
+	Secret       string `json:"-"`
+	LastUsedStep int64  `json:"-"`
+
+	EnabledAt time.Time `json:"enabledAt"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type RecoveryCode struct {
+	Id       string `json:"id"`
+	UserId   string `json:"userId"`
+	CodeHash string `json:"-"`
+
+	UsedAt    time.Time `json:"usedAt"`
+	CreatedAt time.Time `json:"createdAt"`
+}
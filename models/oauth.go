@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+type OAuthClient struct {
+	Id           string   `json:"id"`
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirectUris"`
+	Scopes       []string `json:"scopes"`
+	Confidential bool     `json:"confidential"`
+	SecretHash   string   `json:"-"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	CreatedBy string    `json:"createdBy"`
+}
+
+type OAuthAuthorizationCode struct {
+	Id                  string   `json:"id"`
+	CodeHash            string   `json:"-"`
+	ClientId            string   `json:"clientId"`
+	UserId              string   `json:"userId"`
+	RedirectURI         string   `json:"redirectUri"`
+	Scopes              []string `json:"scopes"`
+	CodeChallenge       string   `json:"-"`
+	CodeChallengeMethod string   `json:"-"`
+	Nonce               string   `json:"-"`
+	FamilyId            string   `json:"-"`
+
+	AuthTime  time.Time `json:"authTime"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	UsedAt    time.Time `json:"usedAt"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type OAuthConsent struct {
+	UserId   string   `json:"userId"`
+	ClientId string   `json:"clientId"`
+	Scopes   []string `json:"scopes"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type OAuthDeviceCode struct {
+	Id             string   `json:"id"`
+	DeviceCodeHash string   `json:"-"`
+	UserCodeHash   string   `json:"-"`
+	ClientId       string   `json:"clientId"`
+	Scopes         []string `json:"scopes"`
+	UserId         string   `json:"userId"`
+	FamilyId       string   `json:"-"`
+	Interval       int      `json:"interval"`
+
+	AuthTime     time.Time `json:"authTime"`
+	ApprovedAt   time.Time `json:"approvedAt"`
+	DeniedAt     time.Time `json:"deniedAt"`
+	LastPolledAt time.Time `json:"lastPolledAt"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+	UsedAt       time.Time `json:"usedAt"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
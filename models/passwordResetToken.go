@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+type PasswordResetToken struct {
+	Id        string `json:"id"`
+	UserId    string `json:"userId"`
+	TokenHash string `json:"-"`
+
+	ExpiresAt time.Time `json:"expiresAt"`
+	UsedAt    time.Time `json:"usedAt"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+type RefreshToken struct {
+	Id        string   `json:"id"`
+	UserId    string   `json:"userId"`
+	FamilyId  string   `json:"familyId"`
+	ClientId  string   `json:"clientId"`
+	Scopes    []string `json:"scopes"`
+	TokenHash string   `json:"-"`
+
+	AuthTime  time.Time `json:"authTime"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	UsedAt    time.Time `json:"usedAt"`
+	RevokedAt time.Time `json:"revokedAt"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
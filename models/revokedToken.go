@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+type RevokedToken struct {
+	TokenId  string `json:"tokenId"`
+	UserId   string `json:"userId"`
+	ClientId string `json:"clientId"`
+
+	ExpiresAt time.Time `json:"expiresAt"`
+	RevokedAt time.Time `json:"revokedAt"`
+}
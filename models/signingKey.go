@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+type SigningKey struct {
+	Id         string `json:"id"`
+	Algorithm  string `json:"algorithm"`
+	PrivateKey []byte `json:"-"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	RetiredAt time.Time `json:"retiredAt"`
+}
@@ -5,9 +5,11 @@ import (
 )
 
 type User struct {
-	Id       string `json:"id"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Id              string    `json:"id"`
+	Email           string    `json:"email"`
+	EmailVerifiedAt time.Time `json:"emailVerifiedAt"`
+	Password        string    `json:"password"`
+	DisabledAt      time.Time `json:"disabledAt"`
 
 	CreatedAt time.Time `json:"createdAt"`
 	CreatedBy string    `json:"createdBy"`
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+type WebAuthnCredential struct {
+	Id        string `json:"id"`
+	UserId    string `json:"userId"`
+	Name      string `json:"name"`
+	PublicKey []byte `json:"-"`
+	SignCount uint32 `json:"-"`
+
+	LastUsedAt time.Time `json:"lastUsedAt"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type WebAuthnChallenge struct {
+	Id        string `json:"id"`
+	UserId    string `json:"userId"`
+	Ceremony  string `json:"ceremony"`
+	Challenge []byte `json:"-"`
+
+	ExpiresAt time.Time `json:"expiresAt"`
+	UsedAt    time.Time `json:"usedAt"`
+	CreatedAt time.Time `json:"createdAt"`
+}
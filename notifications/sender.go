@@ -0,0 +1,42 @@
+package notifications
+
+import (
+	"context"
+	"log"
+)
+
+type Sender interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+var senderImplementation Sender = NewLogSender(false)
+
+func SetSender(sender Sender) {
+	senderImplementation = sender
+}
+
+func Send(ctx context.Context, to, subject, body string) error {
+	return senderImplementation.Send(ctx, to, subject, body)
+}
+
+type LogSender struct {
+	//* El cuerpo lleva 'token' de un solo uso: sólo se escribe en el 'log' si se pide expresamente, en desarrollo.
+	LogBodies bool
+}
+
+func NewLogSender(logBodies bool) *LogSender {
+	return &LogSender{
+		LogBodies: logBodies,
+	}
+}
+
+func (ls *LogSender) Send(ctx context.Context, to, subject, body string) error {
+	//* No enviamos nada: nos limitamos a escribir el mensaje en el 'log' del servicio.
+	//* Útil en desarrollo mientras no haya un proveedor de correo configurado.
+	if !ls.LogBodies {
+		log.Printf("Notification to '%s': [%s]\n", to, subject)
+		return nil
+	}
+	log.Printf("Notification to '%s': [%s] %s\n", to, subject, body)
+	return nil
+}
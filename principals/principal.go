@@ -0,0 +1,91 @@
+package principals
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	AUTH_METHOD_PASSWORD = "password"
+	AUTH_METHOD_MFA      = "mfa"
+	AUTH_METHOD_WEBAUTHN = "webauthn"
+	AUTH_METHOD_REFRESH  = "refresh"
+	AUTH_METHOD_OAUTH    = "oauth"
+	AUTH_METHOD_CLIENT   = "client_credentials"
+	AUTH_METHOD_API_KEY  = "api_key"
+
+	SUBJECT_TYPE_USER    = "user"
+	SUBJECT_TYPE_SERVICE = "service"
+
+	PERMISSION_CLIENTS_MANAGE = "clients:manage"
+	PERMISSION_ROLES_MANAGE   = "roles:manage"
+	PERMISSION_USERS_MANAGE   = "users:manage"
+)
+
+type Principal struct {
+	SubjectType string
+	UserId      string
+	Scopes      []string
+	Roles       []string
+	Permissions []string
+	TokenId     string
+	AuthMethod  string
+	ClientId    string
+	AuthTime    time.Time
+	ExpiresAt   time.Time
+}
+
+type contextKey struct{}
+
+func (p *Principal) IsService() bool {
+	return p.SubjectType == SUBJECT_TYPE_SERVICE
+}
+
+func (p *Principal) IsDelegated() bool {
+	//* Un 'token' emitido a un cliente OAuth o una clave personal actúan en nombre del 'user'
+	//* sólo dentro de sus ámbitos.
+	return p.ClientId != "" || p.AuthMethod == AUTH_METHOD_API_KEY
+}
+
+func NewContext(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, principal)
+}
+
+func FromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(contextKey{}).(*Principal)
+	return principal, ok && principal != nil
+}
+
+func UserId(ctx context.Context) string {
+	//* Los servicios no actúan en nombre de ningún 'user'.
+	if principal, ok := FromContext(ctx); ok && !principal.IsService() {
+		return principal.UserId
+	}
+	return ""
+}
+
+func HasScope(ctx context.Context, scope string) bool {
+	principal, ok := FromContext(ctx)
+	if !ok {
+		return false
+	}
+	for _, grantedScope := range principal.Scopes {
+		if grantedScope == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func HasPermission(ctx context.Context, permission string) bool {
+	principal, ok := FromContext(ctx)
+	if !ok {
+		return false
+	}
+	for _, grantedPermission := range principal.Permissions {
+		if grantedPermission == permission {
+			return true
+		}
+	}
+	return false
+}
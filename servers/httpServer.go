@@ -2,18 +2,69 @@ package servers
 
 import (
 	"context"
+	"encoding/base64"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"time"
 
 	"github.com/aerodinamicat/thisisme02/databases"
+	"github.com/aerodinamicat/thisisme02/keys"
+	"github.com/aerodinamicat/thisisme02/notifications"
 	"github.com/gorilla/mux"
 )
 
+const (
+	EMAIL_VERIFICATION_OPTIONAL = "optional"
+	EMAIL_VERIFICATION_REQUIRED = "required"
+
+	DEFAULT_ACCOUNT_DELETION_GRACE_PERIOD = 30 * time.Hour * 24
+	ACCOUNT_PURGE_INTERVAL                = 1 * time.Hour
+
+	DATABASE_DRIVER_POSTGRES = "postgres"
+	DATABASE_DRIVER_MEMORY   = "memory"
+	DATABASE_DRIVER_SQLITE   = "sqlite"
+)
+
+var (
+	DATABASE_DRIVERS = []string{DATABASE_DRIVER_POSTGRES, DATABASE_DRIVER_MEMORY, DATABASE_DRIVER_SQLITE}
+)
+
 type Config struct {
 	Port   string
-	Secret string
+	Issuer string
+
+	RelyingPartyId     string
+	RelyingPartyName   string
+	RelyingPartyOrigin string
+
+	EmailVerificationPolicy string
+
+	AccountDeletionGracePeriod time.Duration
+
+	JwtAlgorithm        string
+	JwtRotationInterval time.Duration
+	JwtRotationOverlap  time.Duration
+	//* Clave de 32 bytes, en 'base64', que cifra en DB las claves privadas de firma.
+	KeyEncryptionKey string
+
+	//* Si se activa, el esquema de la DB se lleva a la última versión al arrancar.
+	MigrateOnStart bool
+
+	//* Sólo para desarrollo: escribe en el 'log' el cuerpo de las notificaciones, con sus 'token'.
+	LogNotificationBodies bool
+
+	//* Direcciones o redes, en notación CIDR, de los 'proxy' inversos de confianza.
+	//* Sólo de ellos se acepta la dirección del cliente que indican en 'X-Forwarded-For'.
+	TrustedProxies []string
 }
 type DBConfig struct {
+	//* 'postgres' si no se indica. 'memory' no persiste nada: sólo para pruebas y desarrollo local.
+	//* 'sqlite' guarda todo en el fichero 'Path', sin necesidad de un servidor de DB.
+	Driver string
+	Path   string
+
 	Port     string
 	Password string
 	User     string
@@ -25,13 +76,70 @@ type HttpServer struct {
 	Config   *Config
 	DBConfig *DBConfig
 	Router   *mux.Router
+	KeyRing  *keys.KeyRing
+}
+
+func (cfg *Config) Validate() error {
+	//* Un valor desconocido no debe tratarse en silencio como 'optional': dejaría entrar cuentas sin verificar.
+	switch cfg.EmailVerificationPolicy {
+	case "", EMAIL_VERIFICATION_OPTIONAL, EMAIL_VERIFICATION_REQUIRED:
+	default:
+		return fmt.Errorf("unknown email verification policy '%s'", cfg.EmailVerificationPolicy)
+	}
+	if cfg.KeyEncryptionKey != "" {
+		if encryptionKey, err := base64.StdEncoding.DecodeString(cfg.KeyEncryptionKey); err != nil || len(encryptionKey) != keys.ENCRYPTION_KEY_SIZE {
+			return keys.ErrInvalidEncryptionKey
+		}
+	}
+	for _, trustedProxy := range cfg.TrustedProxies {
+		if _, err := parseNetwork(trustedProxy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+func (cfg *Config) IsTrustedProxy(ip net.IP) bool {
+	for _, trustedProxy := range cfg.TrustedProxies {
+		network, err := parseNetwork(trustedProxy)
+		if err == nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+func parseNetwork(value string) (*net.IPNet, error) {
+	//* Una dirección suelta equivale a una red que sólo la contiene a ella.
+	if ip := net.ParseIP(value); ip != nil {
+		bits := 8 * len(ip.To4())
+		if bits == 0 {
+			bits = 8 * net.IPv6len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, network, err := net.ParseCIDR(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted proxy '%s'", value)
+	}
+	return network, nil
 }
 
 func NewHttpServer(ctx context.Context, cfg *Config, dbCfg *DBConfig) *HttpServer {
+	//* Si no se indica el emisor OIDC, usamos el origen público del servicio.
+	if cfg.Issuer == "" {
+		cfg.Issuer = cfg.RelyingPartyOrigin
+	}
+	if cfg.AccountDeletionGracePeriod == 0 {
+		cfg.AccountDeletionGracePeriod = DEFAULT_ACCOUNT_DELETION_GRACE_PERIOD
+	}
+
 	server := &HttpServer{
 		Config:   cfg,
 		DBConfig: dbCfg,
 		Router:   mux.NewRouter(),
+		KeyRing:  keys.NewKeyRing(cfg.JwtAlgorithm, cfg.JwtRotationInterval, cfg.JwtRotationOverlap),
+	}
+	if cfg.KeyEncryptionKey != "" {
+		server.KeyRing.EncryptionKey, _ = base64.StdEncoding.DecodeString(cfg.KeyEncryptionKey)
 	}
 
 	return server
@@ -40,20 +148,100 @@ func NewHttpServer(ctx context.Context, cfg *Config, dbCfg *DBConfig) *HttpServe
 func (srv *HttpServer) Start(binder func(server *HttpServer, router *mux.Router)) {
 	binder(srv, srv.Router)
 
-	dbr, err := databases.NewPostgresImplementation(
-		srv.DBConfig.User,
-		srv.DBConfig.Password,
-		srv.DBConfig.Host,
-		srv.DBConfig.Port,
-		srv.DBConfig.Schema,
-	)
+	dbr, err := NewDatabaseRepository(srv.DBConfig)
 	if err != nil {
 		log.Fatalf("Database connection failed: '%v'", err)
 	}
 	databases.SetDatabaseRepository(dbr)
+	notifications.SetSender(notifications.NewLogSender(srv.Config.LogNotificationBodies))
+
+	ctx := context.Background()
+	if srv.Config.MigrateOnStart {
+		if err := MigrateDatabase(ctx, dbr); err != nil {
+			log.Fatalf("Database migration failed: '%v'", err)
+		}
+	}
+
+	//* Cargamos las claves de firma de los 'token' y programamos su rotación.
+	if srv.KeyRing.EncryptionKey == nil {
+		log.Printf("Signing keys are stored unencrypted: set 'APP_KEY_ENCRYPTION_KEY' to encrypt them\n")
+	}
+	if err := srv.KeyRing.Load(ctx); err != nil {
+		log.Fatalf("Signing keys load failed: '%v'", err)
+	}
+	srv.KeyRing.StartRotation(ctx)
+
+	//* Programamos el borrado definitivo de las cuentas eliminadas cuyo plazo de gracia ha vencido.
+	srv.StartAccountPurge(ctx)
 
 	log.Printf("Server started and listening for requests on port: %s\n", srv.Config.Port)
 	if err := http.ListenAndServe(":"+srv.Config.Port, srv.Router); err != nil {
 		log.Fatalf("Error from 'Listen&Serve': '%v'", err)
 	}
 }
+
+func NewDatabaseRepository(dbCfg *DBConfig) (databases.DatabaseRepository, error) {
+	switch dbCfg.Driver {
+	case "", DATABASE_DRIVER_POSTGRES:
+		return databases.NewPostgresImplementation(
+			dbCfg.User,
+			dbCfg.Password,
+			dbCfg.Host,
+			dbCfg.Port,
+			dbCfg.Schema,
+		)
+	case DATABASE_DRIVER_MEMORY:
+		log.Printf("Using the in-memory database: nothing will be persisted\n")
+		return databases.NewMemoryImplementation(), nil
+	case DATABASE_DRIVER_SQLITE:
+		return databases.NewSqliteImplementation(dbCfg.Path)
+	default:
+		return nil, fmt.Errorf("unknown database driver '%s'", dbCfg.Driver)
+	}
+}
+
+func MigrateDatabase(ctx context.Context, dbr databases.DatabaseRepository) error {
+	//* Las DB sin esquema, como la de memoria, no tienen nada que migrar.
+	migrator, err := databases.RepositoryMigrator(dbr)
+	if err == databases.ErrMigrationsNotSupported {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	//* Varias réplicas pueden arrancar a la vez: el 'migrator' se encarga de que sólo una migre.
+	applied, err := migrator.Up(ctx)
+	for _, migration := range applied {
+		log.Printf("Database migration applied: %04d_%s\n", migration.Version, migration.Name)
+	}
+	return err
+}
+
+func (srv *HttpServer) StartAccountPurge(ctx context.Context) {
+	purge := func() {
+		purged, err := databases.PurgeDeletedUsers(ctx, time.Now().Add(-srv.Config.AccountDeletionGracePeriod))
+		if err != nil {
+			log.Printf("Deleted accounts purge failed: '%v'\n", err)
+			return
+		}
+		if purged > 0 {
+			log.Printf("Deleted accounts purged: %d\n", purged)
+		}
+	}
+
+	//* Varias réplicas pueden purgar a la vez: el borrado es idempotente.
+	go func() {
+		purge()
+		ticker := time.NewTicker(ACCOUNT_PURGE_INTERVAL)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				purge()
+			}
+		}
+	}()
+}
@@ -0,0 +1,92 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	SECRET_SIZE = 20
+	DIGITS      = 6
+	PERIOD      = 30
+	SKEW        = 1
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func GenerateSecret() (string, error) {
+	randomBytes := make([]byte, SECRET_SIZE)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", err
+	}
+
+	return encoding.EncodeToString(randomBytes), nil
+}
+
+func BuildURI(issuer, accountName, secret string) string {
+	//* Formato 'Key Uri' que entienden las aplicaciones de autenticación:
+	//* otpauth://totp/Issuer:account?secret=...&issuer=...
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(accountName)
+	values := url.Values{}
+	values.Set("secret", secret)
+	values.Set("issuer", issuer)
+	values.Set("algorithm", "SHA1")
+	values.Set("digits", fmt.Sprint(DIGITS))
+	values.Set("period", fmt.Sprint(PERIOD))
+
+	return "otpauth://totp/" + label + "?" + values.Encode()
+}
+
+func GenerateCode(secret string, step int64) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+
+	//* RFC 4226: HMAC-SHA1 sobre el contador y truncado dinámico.
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulus := uint32(1)
+	for i := 0; i < DIGITS; i++ {
+		modulus *= 10
+	}
+
+	return fmt.Sprintf("%0*d", DIGITS, value%modulus), nil
+}
+
+func Step(t time.Time) int64 {
+	return t.Unix() / PERIOD
+}
+
+func Validate(secret, code string, t time.Time) (int64, bool) {
+	//* Aceptamos el paso actual y los 'SKEW' adyacentes para tolerar desfases de reloj.
+	//* Devolvemos el paso que coincidió para que el llamante pueda impedir su reutilización.
+	code = strings.TrimSpace(code)
+	currentStep := Step(t)
+	for delta := int64(-SKEW); delta <= SKEW; delta++ {
+		expectedCode, err := GenerateCode(secret, currentStep+delta)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expectedCode), []byte(code)) == 1 {
+			return currentStep + delta, true
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,125 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// SoftwareAuthenticator emula un autenticador ES256 sin atestación. Permite ejercitar
+// las ceremonias de alta e inicio de sesión sin navegador ni hardware.
+type SoftwareAuthenticator struct {
+	CredentialId []byte
+	PrivateKey   *ecdsa.PrivateKey
+	SignCount    uint32
+}
+
+func NewSoftwareAuthenticator() (*SoftwareAuthenticator, error) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	credentialId, err := NewChallenge()
+	if err != nil {
+		return nil, err
+	}
+
+	return &SoftwareAuthenticator{
+		CredentialId: credentialId,
+		PrivateKey:   privateKey,
+	}, nil
+}
+
+func (sa *SoftwareAuthenticator) Create(relyingPartyId, origin string, challenge []byte) (*AttestationResponse, error) {
+	//* Serializamos la clave pública en formato COSE.
+	publicKey, err := cbor.Marshal(coseKey{
+		KeyType:   COSE_KEY_TYPE_EC2,
+		Algorithm: COSE_ALGORITHM_ES256,
+		Curve:     1,
+		X:         sa.PrivateKey.X.FillBytes(make([]byte, 32)),
+		Y:         sa.PrivateKey.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	//* Añadimos a los datos del autenticador la credencial creada: aaguid nulo, longitud, id y clave.
+	authenticatorData := sa.authenticatorData(relyingPartyId, FLAG_USER_PRESENT|FLAG_USER_VERIFIED|FLAG_ATTESTED_CREDENTIAL_DATA)
+	authenticatorData = append(authenticatorData, make([]byte, 16)...)
+	credentialIdLength := make([]byte, 2)
+	binary.BigEndian.PutUint16(credentialIdLength, uint16(len(sa.CredentialId)))
+	authenticatorData = append(authenticatorData, credentialIdLength...)
+	authenticatorData = append(authenticatorData, sa.CredentialId...)
+	authenticatorData = append(authenticatorData, publicKey...)
+
+	attestationStatement, err := cbor.Marshal(map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+	encodedAttestationObject, err := cbor.Marshal(attestationObject{
+		Format:               "none",
+		AttestationStatement: attestationStatement,
+		AuthenticatorData:    authenticatorData,
+	})
+	if err != nil {
+		return nil, err
+	}
+	clientDataJSON, err := newClientDataJSON(CEREMONY_CREATE, origin, challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AttestationResponse{
+		ClientDataJSON:    clientDataJSON,
+		AttestationObject: encodedAttestationObject,
+	}, nil
+}
+func (sa *SoftwareAuthenticator) Get(relyingPartyId, origin string, challenge, userHandle []byte) (*AssertionResponse, error) {
+	return sa.get(relyingPartyId, origin, challenge, userHandle, FLAG_USER_PRESENT|FLAG_USER_VERIFIED)
+}
+func (sa *SoftwareAuthenticator) get(relyingPartyId, origin string, challenge, userHandle []byte, flags byte) (*AssertionResponse, error) {
+	//* Cada firma incrementa el contador, como haría un autenticador real.
+	sa.SignCount++
+	authenticatorData := sa.authenticatorData(relyingPartyId, flags)
+
+	clientDataJSON, err := newClientDataJSON(CEREMONY_GET, origin, challenge)
+	if err != nil {
+		return nil, err
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	hash := sha256.Sum256(append(append([]byte{}, authenticatorData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, sa.PrivateKey, hash[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return &AssertionResponse{
+		ClientDataJSON:    clientDataJSON,
+		AuthenticatorData: authenticatorData,
+		Signature:         signature,
+		UserHandle:        userHandle,
+	}, nil
+}
+func (sa *SoftwareAuthenticator) authenticatorData(relyingPartyId string, flags byte) []byte {
+	relyingPartyIdHash := sha256.Sum256([]byte(relyingPartyId))
+	authenticatorData := append([]byte{}, relyingPartyIdHash[:]...)
+	authenticatorData = append(authenticatorData, flags)
+
+	signCount := make([]byte, 4)
+	binary.BigEndian.PutUint32(signCount, sa.SignCount)
+
+	return append(authenticatorData, signCount...)
+}
+func newClientDataJSON(ceremony, origin string, challenge []byte) ([]byte, error) {
+	return json.Marshal(clientData{
+		Type:      ceremony,
+		Challenge: base64.RawURLEncoding.EncodeToString(challenge),
+		Origin:    origin,
+	})
+}
@@ -0,0 +1,411 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+const (
+	CHALLENGE_SIZE = 32
+	TIMEOUT        = 300000
+
+	CEREMONY_CREATE = "webauthn.create"
+	CEREMONY_GET    = "webauthn.get"
+
+	FLAG_USER_PRESENT             = 0x01
+	FLAG_USER_VERIFIED            = 0x04
+	FLAG_ATTESTED_CREDENTIAL_DATA = 0x40
+
+	COSE_ALGORITHM_ES256 = -7
+	COSE_ALGORITHM_EDDSA = -8
+	COSE_ALGORITHM_RS256 = -257
+
+	COSE_KEY_TYPE_OKP = 1
+	COSE_KEY_TYPE_EC2 = 2
+	COSE_KEY_TYPE_RSA = 3
+)
+
+var (
+	ErrInvalidClientData        = errors.New("webauthn: invalid client data")
+	ErrInvalidAuthenticatorData = errors.New("webauthn: invalid authenticator data")
+	ErrUnsupportedAttestation   = errors.New("webauthn: unsupported attestation format")
+	ErrUnsupportedKey           = errors.New("webauthn: unsupported public key")
+	ErrInvalidSignature         = errors.New("webauthn: invalid signature")
+	ErrSignCountRegression      = errors.New("webauthn: sign count did not increase")
+	ErrUserNotVerified          = errors.New("webauthn: user not verified")
+)
+
+// * Bytes que en JSON viajan codificados en 'base64url', tal y como los manejan los navegadores.
+type URLEncodedBytes []byte
+
+func (ueb URLEncodedBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(ueb))
+}
+func (ueb *URLEncodedBytes) UnmarshalJSON(data []byte) error {
+	var encoded string
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+	if err != nil {
+		return err
+	}
+	*ueb = decoded
+
+	return nil
+}
+
+type RelyingParty struct {
+	ID     string
+	Name   string
+	Origin string
+}
+
+type RelyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+type UserEntity struct {
+	ID          URLEncodedBytes `json:"id"`
+	Name        string          `json:"name"`
+	DisplayName string          `json:"displayName"`
+}
+type CredentialParameter struct {
+	Type      string `json:"type"`
+	Algorithm int    `json:"alg"`
+}
+type CredentialDescriptor struct {
+	Type string          `json:"type"`
+	ID   URLEncodedBytes `json:"id"`
+}
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+type CreationOptions struct {
+	Challenge              URLEncodedBytes        `json:"challenge"`
+	RelyingParty           RelyingPartyEntity     `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	CredentialParameters   []CredentialParameter  `json:"pubKeyCredParams"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+	Timeout                int                    `json:"timeout"`
+}
+type RequestOptions struct {
+	Challenge        URLEncodedBytes        `json:"challenge"`
+	RelyingPartyId   string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+	Timeout          int                    `json:"timeout"`
+}
+
+type AttestationResponse struct {
+	ClientDataJSON    URLEncodedBytes `json:"clientDataJSON"`
+	AttestationObject URLEncodedBytes `json:"attestationObject"`
+}
+type AssertionResponse struct {
+	ClientDataJSON    URLEncodedBytes `json:"clientDataJSON"`
+	AuthenticatorData URLEncodedBytes `json:"authenticatorData"`
+	Signature         URLEncodedBytes `json:"signature"`
+	UserHandle        URLEncodedBytes `json:"userHandle"`
+}
+
+type RegisteredCredential struct {
+	Id        []byte
+	PublicKey []byte
+	SignCount uint32
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+type attestationObject struct {
+	Format               string          `cbor:"fmt"`
+	AttestationStatement cbor.RawMessage `cbor:"attStmt"`
+	AuthenticatorData    []byte          `cbor:"authData"`
+}
+type authenticatorData struct {
+	RelyingPartyIdHash []byte
+	Flags              byte
+	SignCount          uint32
+	CredentialId       []byte
+	PublicKey          []byte
+}
+type coseKey struct {
+	KeyType   int    `cbor:"1,keyasint"`
+	Algorithm int    `cbor:"3,keyasint"`
+	Curve     int    `cbor:"-1,keyasint,omitempty"`
+	X         []byte `cbor:"-2,keyasint,omitempty"`
+	Y         []byte `cbor:"-3,keyasint,omitempty"`
+}
+type coseRSAKey struct {
+	KeyType   int    `cbor:"1,keyasint"`
+	Algorithm int    `cbor:"3,keyasint"`
+	N         []byte `cbor:"-1,keyasint"`
+	E         []byte `cbor:"-2,keyasint"`
+}
+
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, CHALLENGE_SIZE)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+
+	return challenge, nil
+}
+
+func (rp *RelyingParty) CreationOptions(challenge, userId []byte, userName string, excludeCredentialIds [][]byte) *CreationOptions {
+	return &CreationOptions{
+		Challenge: challenge,
+		RelyingParty: RelyingPartyEntity{
+			ID:   rp.ID,
+			Name: rp.Name,
+		},
+		User: UserEntity{
+			ID:          userId,
+			Name:        userName,
+			DisplayName: userName,
+		},
+		CredentialParameters: []CredentialParameter{
+			{Type: "public-key", Algorithm: COSE_ALGORITHM_ES256},
+			{Type: "public-key", Algorithm: COSE_ALGORITHM_EDDSA},
+			{Type: "public-key", Algorithm: COSE_ALGORITHM_RS256},
+		},
+		ExcludeCredentials: credentialDescriptors(excludeCredentialIds),
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: "preferred",
+		},
+		Attestation: "none",
+		Timeout:     TIMEOUT,
+	}
+}
+func (rp *RelyingParty) RequestOptions(challenge []byte, allowCredentialIds [][]byte) *RequestOptions {
+	return &RequestOptions{
+		Challenge:        challenge,
+		RelyingPartyId:   rp.ID,
+		AllowCredentials: credentialDescriptors(allowCredentialIds),
+		UserVerification: "required",
+		Timeout:          TIMEOUT,
+	}
+}
+func credentialDescriptors(credentialIds [][]byte) []CredentialDescriptor {
+	credentialDescriptors := make([]CredentialDescriptor, 0, len(credentialIds))
+	for _, credentialId := range credentialIds {
+		credentialDescriptors = append(credentialDescriptors, CredentialDescriptor{
+			Type: "public-key",
+			ID:   credentialId,
+		})
+	}
+
+	return credentialDescriptors
+}
+
+func (rp *RelyingParty) VerifyRegistration(challenge []byte, response *AttestationResponse) (*RegisteredCredential, error) {
+	//* Comprobamos que el navegador firmó nuestro desafío, desde nuestro origen y para un alta.
+	if err := rp.verifyClientData(response.ClientDataJSON, CEREMONY_CREATE, challenge); err != nil {
+		return nil, err
+	}
+
+	//* Decodificamos el objeto de atestación. Pedimos atestación 'none', así que no hay certificados que validar.
+	var decodedAttestationObject attestationObject
+	if err := cbor.Unmarshal(response.AttestationObject, &decodedAttestationObject); err != nil {
+		return nil, err
+	}
+	if decodedAttestationObject.Format != "none" {
+		return nil, ErrUnsupportedAttestation
+	}
+
+	//* Comprobamos los datos del autenticador, que deben traer la credencial recién creada.
+	decodedAuthenticatorData, err := rp.parseAuthenticatorData(decodedAttestationObject.AuthenticatorData)
+	if err != nil {
+		return nil, err
+	}
+	if decodedAuthenticatorData.Flags&FLAG_ATTESTED_CREDENTIAL_DATA == 0 {
+		return nil, ErrInvalidAuthenticatorData
+	}
+
+	//* Nos aseguramos de que sabremos verificar firmas con la clave pública recibida.
+	if _, err := parsePublicKey(decodedAuthenticatorData.PublicKey); err != nil {
+		return nil, err
+	}
+
+	return &RegisteredCredential{
+		Id:        decodedAuthenticatorData.CredentialId,
+		PublicKey: decodedAuthenticatorData.PublicKey,
+		SignCount: decodedAuthenticatorData.SignCount,
+	}, nil
+}
+func (rp *RelyingParty) VerifyAssertion(challenge, publicKey []byte, storedSignCount uint32, response *AssertionResponse) (uint32, error) {
+	//* Comprobamos que el navegador firmó nuestro desafío, desde nuestro origen y para un inicio de sesión.
+	if err := rp.verifyClientData(response.ClientDataJSON, CEREMONY_GET, challenge); err != nil {
+		return 0, err
+	}
+
+	//* Comprobamos los datos del autenticador.
+	decodedAuthenticatorData, err := rp.parseAuthenticatorData(response.AuthenticatorData)
+	if err != nil {
+		return 0, err
+	}
+	//* La 'passkey' sustituye a la 'password', así que no basta con tocar el autenticador:
+	//* este debe haber verificado al usuario (PIN, biometría...).
+	if decodedAuthenticatorData.Flags&FLAG_USER_VERIFIED == 0 {
+		return 0, ErrUserNotVerified
+	}
+
+	//* Verificamos la firma sobre 'authenticatorData || SHA-256(clientDataJSON)'.
+	clientDataHash := sha256.Sum256(response.ClientDataJSON)
+	signedData := append(append([]byte{}, response.AuthenticatorData...), clientDataHash[:]...)
+	if err := verifySignature(publicKey, signedData, response.Signature); err != nil {
+		return 0, err
+	}
+
+	//* Si el autenticador lleva contador, debe crecer siempre; si no, puede tratarse de un clon.
+	if (decodedAuthenticatorData.SignCount != 0 || storedSignCount != 0) && decodedAuthenticatorData.SignCount <= storedSignCount {
+		return 0, ErrSignCountRegression
+	}
+
+	return decodedAuthenticatorData.SignCount, nil
+}
+
+func (rp *RelyingParty) verifyClientData(clientDataJSON []byte, ceremony string, challenge []byte) error {
+	var decodedClientData clientData
+	if err := json.Unmarshal(clientDataJSON, &decodedClientData); err != nil {
+		return ErrInvalidClientData
+	}
+	if decodedClientData.Type != ceremony || decodedClientData.Origin != rp.Origin {
+		return ErrInvalidClientData
+	}
+	receivedChallenge, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(decodedClientData.Challenge, "="))
+	if err != nil || subtle.ConstantTimeCompare(receivedChallenge, challenge) != 1 {
+		return ErrInvalidClientData
+	}
+
+	return nil
+}
+func (rp *RelyingParty) parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	//* Estructura: rpIdHash (32) | flags (1) | signCount (4) | [aaguid (16) | idLength (2) | id | clave COSE].
+	if len(data) < 37 {
+		return nil, ErrInvalidAuthenticatorData
+	}
+	decodedAuthenticatorData := &authenticatorData{
+		RelyingPartyIdHash: data[:32],
+		Flags:              data[32],
+		SignCount:          binary.BigEndian.Uint32(data[33:37]),
+	}
+
+	relyingPartyIdHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(decodedAuthenticatorData.RelyingPartyIdHash, relyingPartyIdHash[:]) {
+		return nil, ErrInvalidAuthenticatorData
+	}
+	if decodedAuthenticatorData.Flags&FLAG_USER_PRESENT == 0 {
+		return nil, ErrInvalidAuthenticatorData
+	}
+
+	if decodedAuthenticatorData.Flags&FLAG_ATTESTED_CREDENTIAL_DATA != 0 {
+		rest := data[37:]
+		if len(rest) < 18 {
+			return nil, ErrInvalidAuthenticatorData
+		}
+		credentialIdLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if len(rest) < credentialIdLength {
+			return nil, ErrInvalidAuthenticatorData
+		}
+		decodedAuthenticatorData.CredentialId = rest[:credentialIdLength]
+		rest = rest[credentialIdLength:]
+
+		//* La clave es el primer elemento CBOR; detrás pueden venir extensiones.
+		var publicKey cbor.RawMessage
+		if _, err := cbor.UnmarshalFirst(rest, &publicKey); err != nil {
+			return nil, ErrInvalidAuthenticatorData
+		}
+		decodedAuthenticatorData.PublicKey = publicKey
+	}
+
+	return decodedAuthenticatorData, nil
+}
+
+func parsePublicKey(publicKey []byte) (interface{}, error) {
+	var decodedKey coseKey
+	if err := cbor.Unmarshal(publicKey, &decodedKey); err != nil {
+		return nil, ErrUnsupportedKey
+	}
+
+	switch {
+	case decodedKey.KeyType == COSE_KEY_TYPE_EC2 && decodedKey.Algorithm == COSE_ALGORITHM_ES256:
+		//* Curva P-256 (identificador COSE 1).
+		if decodedKey.Curve != 1 || len(decodedKey.X) != 32 || len(decodedKey.Y) != 32 {
+			return nil, ErrUnsupportedKey
+		}
+		ecdsaKey := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(decodedKey.X),
+			Y:     new(big.Int).SetBytes(decodedKey.Y),
+		}
+		if !ecdsaKey.Curve.IsOnCurve(ecdsaKey.X, ecdsaKey.Y) {
+			return nil, ErrUnsupportedKey
+		}
+		return ecdsaKey, nil
+	case decodedKey.KeyType == COSE_KEY_TYPE_OKP && decodedKey.Algorithm == COSE_ALGORITHM_EDDSA:
+		//* Curva Ed25519 (identificador COSE 6).
+		if decodedKey.Curve != 6 || len(decodedKey.X) != ed25519.PublicKeySize {
+			return nil, ErrUnsupportedKey
+		}
+		return ed25519.PublicKey(decodedKey.X), nil
+	case decodedKey.KeyType == COSE_KEY_TYPE_RSA && decodedKey.Algorithm == COSE_ALGORITHM_RS256:
+		var decodedRSAKey coseRSAKey
+		if err := cbor.Unmarshal(publicKey, &decodedRSAKey); err != nil {
+			return nil, ErrUnsupportedKey
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(decodedRSAKey.N),
+			E: int(new(big.Int).SetBytes(decodedRSAKey.E).Int64()),
+		}, nil
+	}
+
+	return nil, ErrUnsupportedKey
+}
+func verifySignature(publicKey, signedData, signature []byte) error {
+	parsedKey, err := parsePublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.Sum256(signedData)
+	switch key := parsedKey.(type) {
+	case *ecdsa.PublicKey:
+		if ecdsa.VerifyASN1(key, hash[:], signature) {
+			return nil
+		}
+	case ed25519.PublicKey:
+		if ed25519.Verify(key, signedData, signature) {
+			return nil
+		}
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature) == nil {
+			return nil
+		}
+	}
+
+	return ErrInvalidSignature
+}
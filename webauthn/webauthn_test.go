@@ -0,0 +1,160 @@
+package webauthn
+
+import (
+	"bytes"
+	"testing"
+)
+
+const (
+	TEST_RELYING_PARTY_ID = "localhost"
+	TEST_ORIGIN           = "http://localhost:5050"
+)
+
+func newTestRelyingParty() *RelyingParty {
+	return &RelyingParty{
+		ID:     TEST_RELYING_PARTY_ID,
+		Name:   "thisisme",
+		Origin: TEST_ORIGIN,
+	}
+}
+func newTestChallenge(t *testing.T) []byte {
+	t.Helper()
+	challenge, err := NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return challenge
+}
+func registerTestCredential(t *testing.T, rp *RelyingParty, sa *SoftwareAuthenticator) *RegisteredCredential {
+	t.Helper()
+	challenge := newTestChallenge(t)
+	response, err := sa.Create(rp.ID, rp.Origin, challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credential, err := rp.VerifyRegistration(challenge, response)
+	if err != nil {
+		t.Fatalf("VerifyRegistration: %v", err)
+	}
+	return credential
+}
+
+func TestRegistration(t *testing.T) {
+	rp := newTestRelyingParty()
+	sa, err := NewSoftwareAuthenticator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	credential := registerTestCredential(t, rp, sa)
+	if !bytes.Equal(credential.Id, sa.CredentialId) {
+		t.Errorf("credential id = %x, want %x", credential.Id, sa.CredentialId)
+	}
+	if credential.SignCount != 0 {
+		t.Errorf("sign count = %d, want 0", credential.SignCount)
+	}
+}
+func TestRegistrationRejected(t *testing.T) {
+	rp := newTestRelyingParty()
+	sa, err := NewSoftwareAuthenticator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge := newTestChallenge(t)
+
+	tests := []struct {
+		name           string
+		relyingPartyId string
+		origin         string
+		challenge      []byte
+	}{
+		{"other challenge", rp.ID, rp.Origin, newTestChallenge(t)},
+		{"other origin", rp.ID, "https://evil.example", challenge},
+		{"other relying party", "evil.example", rp.Origin, challenge},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, err := sa.Create(test.relyingPartyId, test.origin, test.challenge)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := rp.VerifyRegistration(challenge, response); err == nil {
+				t.Error("VerifyRegistration accepted the response")
+			}
+		})
+	}
+}
+
+func TestLogIn(t *testing.T) {
+	rp := newTestRelyingParty()
+	sa, err := NewSoftwareAuthenticator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	credential := registerTestCredential(t, rp, sa)
+
+	//* Dos inicios de sesión seguidos: el contador guardado debe avanzar con cada uno.
+	storedSignCount := credential.SignCount
+	for i := 0; i < 2; i++ {
+		challenge := newTestChallenge(t)
+		response, err := sa.Get(rp.ID, rp.Origin, challenge, []byte("userId"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		signCount, err := rp.VerifyAssertion(challenge, credential.PublicKey, storedSignCount, response)
+		if err != nil {
+			t.Fatalf("VerifyAssertion: %v", err)
+		}
+		if signCount != sa.SignCount {
+			t.Errorf("sign count = %d, want %d", signCount, sa.SignCount)
+		}
+		storedSignCount = signCount
+	}
+}
+func TestLogInRejected(t *testing.T) {
+	rp := newTestRelyingParty()
+	sa, err := NewSoftwareAuthenticator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	credential := registerTestCredential(t, rp, sa)
+	other, err := NewSoftwareAuthenticator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name            string
+		authenticator   *SoftwareAuthenticator
+		relyingPartyId  string
+		origin          string
+		otherChallenge  bool
+		flags           byte
+		storedSignCount uint32
+		want            error
+	}{
+		{"other challenge", sa, rp.ID, rp.Origin, true, FLAG_USER_PRESENT | FLAG_USER_VERIFIED, 0, ErrInvalidClientData},
+		{"other origin", sa, rp.ID, "https://evil.example", false, FLAG_USER_PRESENT | FLAG_USER_VERIFIED, 0, ErrInvalidClientData},
+		{"other relying party", sa, "evil.example", rp.Origin, false, FLAG_USER_PRESENT | FLAG_USER_VERIFIED, 0, ErrInvalidAuthenticatorData},
+		{"user not present", sa, rp.ID, rp.Origin, false, FLAG_USER_VERIFIED, 0, ErrInvalidAuthenticatorData},
+		{"user not verified", sa, rp.ID, rp.Origin, false, FLAG_USER_PRESENT, 0, ErrUserNotVerified},
+		{"other key", other, rp.ID, rp.Origin, false, FLAG_USER_PRESENT | FLAG_USER_VERIFIED, 0, ErrInvalidSignature},
+		{"sign count regression", sa, rp.ID, rp.Origin, false, FLAG_USER_PRESENT | FLAG_USER_VERIFIED, 1000, ErrSignCountRegression},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			challenge := newTestChallenge(t)
+			signedChallenge := challenge
+			if test.otherChallenge {
+				signedChallenge = newTestChallenge(t)
+			}
+			response, err := test.authenticator.get(test.relyingPartyId, test.origin, signedChallenge, nil, test.flags)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := rp.VerifyAssertion(challenge, credential.PublicKey, test.storedSignCount, response); err != test.want {
+				t.Errorf("VerifyAssertion error = %v, want %v", err, test.want)
+			}
+		})
+	}
+}